@@ -17,10 +17,18 @@ func main() {
 			return &fxevent.ZapLogger{Logger: logger}
 		}),
 		dependencies.ConfigModule,
+		dependencies.IdentityModule,
 		dependencies.DbModule,
 		dependencies.SmtpModule,
 		dependencies.RepositoryModule,
+		dependencies.UserCacheModule,
+		dependencies.SecurityModule,
+		dependencies.AuditServicesModule,
+		dependencies.ChallengeServicesModule,
 		dependencies.AuthServicesModule,
+		dependencies.OrganizationServicesModule,
+		dependencies.ProfileServicesModule,
+		dependencies.AccountServicesModule,
 		dependencies.ApiModule,
 	)
 
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"apart-deal-api/pkg/security"
+)
+
+// Builds a bloom filter for BREACHED_PASSWORDS_FORMAT=bloom out of a SHA-1 corpus
+// ("Have I Been Pwned" format)
+func main() {
+	in := flag.String("in", "", "SHA-1 corpus, one hex digest per line")
+	out := flag.String("out", "", "Destination of the bloom filter")
+	fpRate := flag.Float64("fp", 0.001, "Desired false positive rate")
+	flag.Parse()
+
+	if *in == "" || *out == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*in, *out, *fpRate); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(in string, out string, fpRate float64) error {
+	n := 0
+	if err := eachDigest(in, func(_ [sha1.Size]byte) { n++ }); err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("corpus %s is empty", in)
+	}
+
+	m := uint64(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	k := uint32(math.Max(1, math.Round(float64(m)/float64(n)*math.Ln2)))
+
+	filter := security.NewBloomFilter(m, k)
+	if err := eachDigest(in, filter.AddDigest); err != nil {
+		return err
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	if _, err := filter.WriteTo(f); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d digests into %d bits with %d hash functions\n", n, m, k)
+
+	return nil
+}
+
+func eachDigest(path string, fn func(digest [sha1.Size]byte)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if idx := strings.IndexByte(line, ':'); idx >= 0 {
+			line = line[:idx]
+		}
+
+		raw, err := hex.DecodeString(line)
+		if err != nil || len(raw) != sha1.Size {
+			return fmt.Errorf("invalid SHA-1 digest: %s", line)
+		}
+
+		var digest [sha1.Size]byte
+		copy(digest[:], raw)
+		fn(digest)
+	}
+
+	return scanner.Err()
+}
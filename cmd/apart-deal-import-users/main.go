@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"apart-deal-api/dependencies"
+	"apart-deal-api/pkg/domain/userimport"
+
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxevent"
+	"go.uber.org/zap"
+)
+
+// Imports users exported from a legacy system, see userimport.Row for the expected fields
+func main() {
+	file := flag.String("file", "", "CSV or JSONL file with users")
+	format := flag.String("format", "", "csv or jsonl, guessed from the file extension when omitted")
+	flag.Parse()
+
+	logger := dependencies.LoggerFromEnv()
+
+	if *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(*file), ".")
+	}
+
+	var importSvc *userimport.ImportService
+
+	app := fx.New(
+		fx.Supply(logger),
+		fx.WithLogger(func(logger *zap.Logger) fxevent.Logger {
+			return &fxevent.ZapLogger{Logger: logger}
+		}),
+		dependencies.ConfigModule,
+		dependencies.IdentityModule,
+		dependencies.DbModule,
+		dependencies.RepositoryModule,
+		fx.Provide(userimport.NewImportService),
+		fx.Populate(&importSvc),
+	)
+
+	startCtx, startCancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer startCancel()
+
+	if err := app.Start(startCtx); err != nil {
+		logger.Fatal(err.Error())
+	}
+
+	report, err := run(importSvc, *file, *format)
+
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer stopCancel()
+
+	_ = app.Stop(stopCtx)
+
+	if report != nil {
+		printReport(report)
+	}
+
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+}
+
+func run(importSvc *userimport.ImportService, file string, format string) (*userimport.Report, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	reader, err := userimport.NewRowReader(f, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return importSvc.Import(context.Background(), reader)
+}
+
+func printReport(report *userimport.Report) {
+	fmt.Printf("Imported: %d\n", report.Imported)
+
+	fmt.Printf("Duplicates: %d\n", len(report.Duplicates))
+	for _, issue := range report.Duplicates {
+		fmt.Printf("  line %d (%s): %s\n", issue.Line, issue.Email, issue.Reason)
+	}
+
+	fmt.Printf("Invalid: %d\n", len(report.Invalid))
+	for _, issue := range report.Invalid {
+		fmt.Printf("  line %d (%s): %s\n", issue.Line, issue.Email, issue.Reason)
+	}
+}
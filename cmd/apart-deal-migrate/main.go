@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"apart-deal-api/dependencies"
+	"apart-deal-api/pkg/mongo/schema"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxevent"
+	"go.uber.org/zap"
+)
+
+// Applies or reverts the schema migrations and reconciles indexes and validators with their
+// declarations, the API and the worker refuse to start until every migration is applied
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s up | down | status | to <version> | indexes [-dry-run] [-drop-unknown] | validators\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	logger := dependencies.LoggerFromEnv()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var (
+		client     *mongo.Client
+		db         *mongo.Database
+		migrator   *schema.Migrator
+		validation schema.ValidationSettings
+	)
+
+	app := fx.New(
+		fx.Supply(logger),
+		fx.WithLogger(func(logger *zap.Logger) fxevent.Logger {
+			return &fxevent.ZapLogger{Logger: logger}
+		}),
+		dependencies.IdentityModule,
+		fx.Provide(
+			dependencies.NewDbConfig,
+			dependencies.NewMongoClient,
+			dependencies.NewMongoDb,
+			dependencies.NewValidationSettings,
+			dependencies.NewMigrator,
+		),
+		fx.Populate(&client, &db, &migrator, &validation),
+	)
+
+	if err := app.Err(); err != nil {
+		logger.Fatal(err.Error())
+	}
+
+	err := run(context.Background(), db, migrator, validation, args)
+
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer stopCancel()
+
+	_ = client.Disconnect(stopCtx)
+
+	var collisionsErr *schema.EmailCollisionsError
+	if errors.As(err, &collisionsErr) {
+		printCollisions(collisionsErr.Collisions)
+	}
+
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+}
+
+func run(
+	ctx context.Context,
+	db *mongo.Database,
+	migrator *schema.Migrator,
+	validation schema.ValidationSettings,
+	args []string,
+) error {
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		printMigrations("Applied", applied)
+
+		return err
+	case "down":
+		reverted, err := migrator.Down(ctx)
+		if reverted != nil {
+			printMigrations("Reverted", []schema.Migration{*reverted})
+		}
+
+		return err
+	case "to":
+		if len(args) != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+
+		migrations, err := migrator.To(ctx, version)
+		printMigrations("Run", migrations)
+
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		printStatuses(statuses)
+
+		return nil
+	case "indexes":
+		return reconcileIndexes(ctx, db, args[1:])
+	case "validators":
+		// validators follow the structs of pkg/store, they're applied again after a change
+		return schema.ApplyValidators(ctx, db, schema.Validators(), validation)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	return nil
+}
+
+// reconcileIndexes prints the changes needed for indexes to match schema.Indexes and
+// applies them unless dry-run is set
+func reconcileIndexes(ctx context.Context, db *mongo.Database, args []string) error {
+	flags := flag.NewFlagSet("indexes", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only print the planned changes")
+	dropUnknown := flags.Bool("drop-unknown", false, "drop indexes which aren't declared instead of reporting them")
+	_ = flags.Parse(args)
+
+	reconciler := schema.NewIndexReconciler(db, schema.Indexes(), schema.IndexReconcilerSettings{
+		DropUnknown: *dropUnknown,
+	})
+
+	changes, err := reconciler.Plan(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Planned changes: %d\n", len(changes))
+	for _, change := range changes {
+		fmt.Printf("  %s\n", change)
+	}
+
+	if *dryRun {
+		return nil
+	}
+
+	return reconciler.Apply(ctx, changes)
+}
+
+func printMigrations(title string, migrations []schema.Migration) {
+	fmt.Printf("%s: %d\n", title, len(migrations))
+	for _, migration := range migrations {
+		fmt.Printf("  %d %s\n", migration.Version, migration.Name)
+	}
+}
+
+func printStatuses(statuses []schema.MigrationStatus) {
+	for _, status := range statuses {
+		state := "pending"
+		if status.AppliedAt != nil {
+			state = "applied at " + status.AppliedAt.Format(time.RFC3339)
+		}
+
+		fmt.Printf("%4d %-40s %s\n", status.Version, status.Name, state)
+	}
+}
+
+func printCollisions(collisions []schema.EmailCollision) {
+	fmt.Printf("Users sharing an email: %d\n", len(collisions))
+	for _, collision := range collisions {
+		fmt.Printf("  %s: %v %v\n", collision.EmailKey, collision.UIDs, collision.Emails)
+	}
+}
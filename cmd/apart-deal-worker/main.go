@@ -17,9 +17,11 @@ func main() {
 			return &fxevent.ZapLogger{Logger: logger}
 		}),
 		dependencies.ConfigModule,
+		dependencies.IdentityModule,
 		dependencies.DbModule,
 		dependencies.SmtpModule,
 		dependencies.RepositoryModule,
+		dependencies.AccountServicesModule,
 		dependencies.WorkerModule,
 	)
 
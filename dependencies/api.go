@@ -3,11 +3,15 @@ package dependencies
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/http"
 	"strings"
 	"time"
 
 	"apart-deal-api/pkg/api/auth"
 	"apart-deal-api/pkg/api/server"
+	"apart-deal-api/pkg/config"
+	"apart-deal-api/pkg/security"
 	"apart-deal-api/pkg/store/user"
 
 	"github.com/Netflix/go-env"
@@ -17,7 +21,16 @@ import (
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 
+	accountHandlers "apart-deal-api/pkg/api/handlers/account"
+	auditHandlers "apart-deal-api/pkg/api/handlers/audit"
 	authHandlers "apart-deal-api/pkg/api/handlers/auth"
+	challengeHandlers "apart-deal-api/pkg/api/handlers/challenge"
+	orgHandlers "apart-deal-api/pkg/api/handlers/organization"
+	userHandlers "apart-deal-api/pkg/api/handlers/user"
+	auditDomain "apart-deal-api/pkg/domain/audit"
+	challengeDomain "apart-deal-api/pkg/domain/challenge"
+	deviceDomain "apart-deal-api/pkg/domain/device"
+	identityDomain "apart-deal-api/pkg/domain/identity"
 )
 
 type ApiRunFn func(ctx context.Context) error
@@ -26,6 +39,14 @@ type ApiConfig struct {
 	Port         int    `env:"API_PORT,required=true"`
 	AllowOrigins string `env:"ALLOW_ORIGINS"`
 	TokenSecret  string `env:"JWT_SECRET,required=true"`
+	// AllowCredentials lets browsers of the allowed origins send the session cookie
+	AllowCredentials bool `env:"ALLOW_CREDENTIALS,default=false"`
+	// TrustedProxies are comma separated CIDRs whose X-Forwarded-For is trusted, the client
+	// IP is the address of the peer when it's empty
+	TrustedProxies string `env:"TRUSTED_PROXIES"`
+	// StepUpMaxAge is how recent the authentication has to be for sensitive operations such
+	// as inviting members or deleting accounts
+	StepUpMaxAge time.Duration `env:"STEP_UP_MAX_AGE,default=5m"`
 }
 
 func NewApiConfig() (*ApiConfig, error) {
@@ -39,6 +60,39 @@ func NewApiConfig() (*ApiConfig, error) {
 	return &cfg, nil
 }
 
+// NewIPExtractor tells echo where the client IP comes from, it's recorded in the audit log
+// and identifies devices so that it must not be forged by clients
+func NewIPExtractor(cfg *ApiConfig) (echo.IPExtractor, error) {
+	if cfg.TrustedProxies == "" {
+		return echo.ExtractIPDirect(), nil
+	}
+
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+
+	for _, cidr := range strings.Split(cfg.TrustedProxies, ",") {
+		_, ipRange, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid TRUSTED_PROXIES range %s", cidr)
+		}
+
+		options = append(options, echo.TrustIPRange(ipRange))
+	}
+
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
+
+func NewStepUpRequirement(cfg *ApiConfig) (auth.StepUpRequirement, error) {
+	if cfg.StepUpMaxAge <= 0 {
+		return auth.StepUpRequirement{}, errors.Errorf("STEP_UP_MAX_AGE must be positive")
+	}
+
+	return auth.StepUpRequirement{MaxAge: cfg.StepUpMaxAge}, nil
+}
+
 func NewApiRunFn(e *echo.Echo, logger *zap.Logger, shutdowner fx.Shutdowner, apiCfg *ApiConfig) ApiRunFn {
 	return func(ctx context.Context) error {
 		logger.Info(fmt.Sprintf("Starting API on port %d", apiCfg.Port))
@@ -82,8 +136,79 @@ func NewApiRunFn(e *echo.Echo, logger *zap.Logger, shutdowner fx.Shutdowner, api
 	}
 }
 
-func NewAuthenticationService(cfg *ApiConfig, userRepo user.UserRepository) *auth.AuthenticationService {
-	return auth.NewAuthenticationService(cfg.TokenSecret, userRepo)
+func NewAuthenticationService(
+	cfg *ApiConfig,
+	appCfg *config.Config,
+	userRepo user.UserRepository,
+	hasher *security.PasswordHasher,
+	auditSvc *auditDomain.AuditService,
+	deviceSvc *deviceDomain.DeviceService,
+	emails *identityDomain.EmailNormalizer,
+	logger *zap.Logger,
+) *auth.AuthenticationService {
+	return auth.NewAuthenticationService(
+		cfg.TokenSecret,
+		userRepo,
+		hasher,
+		auditSvc,
+		deviceSvc,
+		emails,
+		logger,
+		appCfg.EnumerationSafe,
+	)
+}
+
+type SessionConfig struct {
+	CookieName     string        `env:"SESSION_COOKIE_NAME,default=session"`
+	CSRFCookieName string        `env:"SESSION_CSRF_COOKIE_NAME,default=csrf_token"`
+	CookieDomain   string        `env:"SESSION_COOKIE_DOMAIN"`
+	CookieSecure   bool          `env:"SESSION_COOKIE_SECURE,default=true"`
+	SameSite       string        `env:"SESSION_COOKIE_SAME_SITE,default=lax"`
+	IdleTimeout    time.Duration `env:"SESSION_IDLE_TIMEOUT,default=24h"`
+	MaxLifetime    time.Duration `env:"SESSION_MAX_LIFETIME,default=720h"`
+}
+
+func NewSessionConfig() (*SessionConfig, error) {
+	var cfg SessionConfig
+
+	_, err := env.UnmarshalFromEnviron(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+func NewSessionSettings(cfg *SessionConfig) (auth.SessionSettings, error) {
+	sameSite := map[string]http.SameSite{
+		"lax":    http.SameSiteLaxMode,
+		"strict": http.SameSiteStrictMode,
+		"none":   http.SameSiteNoneMode,
+	}
+
+	mode, ok := sameSite[strings.ToLower(cfg.SameSite)]
+	if !ok {
+		return auth.SessionSettings{}, errors.Errorf("Unknown SameSite mode: %s", cfg.SameSite)
+	}
+
+	// browsers drop SameSite=None cookies which are not Secure
+	if mode == http.SameSiteNoneMode && !cfg.CookieSecure {
+		return auth.SessionSettings{}, errors.Errorf("SameSite=None session cookies must be secure")
+	}
+
+	return auth.SessionSettings{
+		CookieName:     cfg.CookieName,
+		CSRFCookieName: cfg.CSRFCookieName,
+		CookieDomain:   cfg.CookieDomain,
+		Secure:         cfg.CookieSecure,
+		SameSite:       mode,
+		IdleTimeout:    cfg.IdleTimeout,
+		MaxLifetime:    cfg.MaxLifetime,
+	}, nil
+}
+
+func NewChallengeGuard(cfg *ChallengeConfig, verifier challengeDomain.Verifier) *challengeHandlers.Guard {
+	return challengeHandlers.NewGuard(verifier, cfg.RouteList())
 }
 
 var ApiModule = fx.Module(
@@ -93,22 +218,76 @@ var ApiModule = fx.Module(
 		NewApiRunFn,
 		server.NewServer,
 		server.NewAuthRouteGroup,
+		server.NewOrganizationRouteGroup,
+		server.NewAuditRouteGroup,
+		server.NewChallengeRouteGroup,
+		server.NewUserRouteGroup,
+		server.NewAccountRouteGroup,
+		NewChallengeGuard,
+		NewStepUpRequirement,
 		NewAuthenticationService,
+		NewSessionConfig,
+		NewSessionSettings,
+		auth.NewSessionService,
 		authHandlers.NewSignUpHandler,
 		authHandlers.NewSignUpConfirmHandler,
+		authHandlers.NewSignUpResendHandler,
 		authHandlers.NewSignInHandler,
+		authHandlers.NewReportDeviceHandler,
+		authHandlers.NewPasswordResetHandler,
+		authHandlers.NewReauthenticateHandler,
+		authHandlers.NewSignOutHandler,
+		orgHandlers.NewCreateOrganizationHandler,
+		orgHandlers.NewListOrganizationsHandler,
+		orgHandlers.NewSelectOrganizationHandler,
+		orgHandlers.NewInviteMemberHandler,
+		orgHandlers.NewAcceptInvitationHandler,
+		auditHandlers.NewListAuditEventsHandler,
+		challengeHandlers.NewIssueChallengeHandler,
+		challengeHandlers.NewVerifyChallengeHandler,
+		userHandlers.NewGetProfileHandler,
+		userHandlers.NewUpdateProfileHandler,
+		userHandlers.NewUserInfoHandler,
+		accountHandlers.NewDeleteAccountHandler,
+		accountHandlers.NewRestoreAccountHandler,
 	),
-	fx.Invoke(func(cfg *ApiConfig, e *echo.Echo) {
+	fx.Invoke(func(cfg *ApiConfig, e *echo.Echo) error {
+		extractor, err := NewIPExtractor(cfg)
+		if err != nil {
+			return err
+		}
+
+		e.IPExtractor = extractor
+
+		return nil
+	}),
+	fx.Invoke(func(cfg *ApiConfig, e *echo.Echo) error {
 		if cfg.AllowOrigins == "" {
-			return
+			return nil
 		}
 
 		origins := strings.Split(cfg.AllowOrigins, ",")
+
+		if cfg.AllowCredentials {
+			// a wildcard would let any site make authenticated requests with the cookie
+			for _, origin := range origins {
+				if strings.Contains(origin, "*") {
+					return errors.Errorf("ALLOW_CREDENTIALS can't be used with a wildcard origin")
+				}
+			}
+		}
+
 		e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-			AllowOrigins: origins,
+			AllowOrigins:     origins,
+			AllowCredentials: cfg.AllowCredentials,
 		}))
+
+		return nil
 	}),
 	fx.Invoke(server.RegisterRoutes),
+	fx.Invoke(func(guard *challengeHandlers.Guard, e *echo.Echo) error {
+		return guard.CheckRoutes(e.Routes())
+	}),
 	fx.Invoke(func(lc fx.Lifecycle, fn ApiRunFn, e *echo.Echo) {
 		lc.Append(fx.Hook{
 			OnStart: func(ctx context.Context) error {
@@ -1,17 +1,34 @@
 package dependencies
 
 import (
+	"strings"
+
 	"apart-deal-api/pkg/config"
 
+	"github.com/Netflix/go-env"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
-func NewAppConfig(logger *zap.Logger) *config.Config {
-	return &config.Config{
-		IsDebug: logger.Core().Enabled(zapcore.DebugLevel),
+type AppEnvConfig struct {
+	EnumerationSafe bool   `env:"ENUMERATION_SAFE,default=false"`
+	AppURL          string `env:"APP_URL,default=http://localhost:3000"`
+}
+
+func NewAppConfig(logger *zap.Logger) (*config.Config, error) {
+	var envCfg AppEnvConfig
+
+	_, err := env.UnmarshalFromEnviron(&envCfg)
+	if err != nil {
+		return nil, err
 	}
+
+	return &config.Config{
+		IsDebug:         logger.Core().Enabled(zapcore.DebugLevel),
+		EnumerationSafe: envCfg.EnumerationSafe,
+		AppURL:          strings.TrimSuffix(envCfg.AppURL, "/"),
+	}, nil
 }
 
 var ConfigModule = fx.Provide(
@@ -0,0 +1,137 @@
+package dependencies
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"apart-deal-api/pkg/store/user"
+
+	"github.com/Netflix/go-env"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+type UserCacheConfig struct {
+	Enabled bool          `env:"USER_CACHE_ENABLED,default=false"`
+	Size    int           `env:"USER_CACHE_SIZE,default=10000"`
+	TTL     time.Duration `env:"USER_CACHE_TTL,default=1m"`
+	// ChangeStreams invalidates users changed by other replicas right away instead of
+	// after the TTL, Mongo has to run as a replica set
+	ChangeStreams bool `env:"USER_CACHE_CHANGE_STREAMS,default=false"`
+	// StatsInterval is how often hits and misses are logged, 0 disables it
+	StatsInterval time.Duration `env:"USER_CACHE_STATS_INTERVAL,default=5m"`
+}
+
+func NewUserCacheConfig() (*UserCacheConfig, error) {
+	var cfg UserCacheConfig
+
+	_, err := env.UnmarshalFromEnviron(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// NewCachedUserRepository decorates the user repository with a cache when it's enabled, the
+// change stream and the stats logging run for the lifetime of the app
+func NewCachedUserRepository(
+	lc fx.Lifecycle,
+	cfg *UserCacheConfig,
+	db *mongo.Database,
+	logger *zap.Logger,
+	repo user.UserRepository,
+) user.UserRepository {
+	if !cfg.Enabled {
+		return repo
+	}
+
+	cache := user.NewCachedUserRepository(repo, user.CacheSettings{
+		Size: cfg.Size,
+		TTL:  cfg.TTL,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{}, 2)
+	running := 0
+
+	lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			if cfg.ChangeStreams {
+				invalidator := user.NewCacheInvalidator(db, cache, func(err error) {
+					logger.Warn(fmt.Sprintf("User cache invalidation stream failed: %s", err))
+				})
+
+				running++
+				go func() {
+					defer func() { done <- struct{}{} }()
+
+					invalidator.Run(ctx)
+				}()
+			}
+
+			if cfg.StatsInterval > 0 {
+				running++
+				go func() {
+					defer func() { done <- struct{}{} }()
+
+					logUserCacheStats(ctx, cache, cfg.StatsInterval, logger)
+				}()
+			}
+
+			return nil
+		},
+		OnStop: func(stopCtx context.Context) error {
+			cancel()
+
+			for ; running > 0; running-- {
+				select {
+				case <-done:
+				case <-stopCtx.Done():
+					return stopCtx.Err()
+				}
+			}
+
+			logUserCacheStatsOnce(cache, logger)
+
+			return nil
+		},
+	})
+
+	return cache
+}
+
+func logUserCacheStats(ctx context.Context, cache *user.CachedUserRepository, interval time.Duration, logger *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			logUserCacheStatsOnce(cache, logger)
+		}
+	}
+}
+
+func logUserCacheStatsOnce(cache *user.CachedUserRepository, logger *zap.Logger) {
+	stats := cache.Stats()
+
+	logger.
+		With(zap.Uint64("hits", stats.Hits)).
+		With(zap.Uint64("misses", stats.Misses)).
+		With(zap.Uint64("evictions", stats.Evictions)).
+		With(zap.Uint64("invalidations", stats.Invalidations)).
+		With(zap.Int("size", stats.Size)).
+		Info("User cache stats")
+}
+
+// UserCacheModule puts the cache in front of the user repository of RepositoryModule, it's
+// switched on with USER_CACHE_ENABLED
+var UserCacheModule = fx.Options(
+	fx.Provide(NewUserCacheConfig),
+	fx.Decorate(NewCachedUserRepository),
+)
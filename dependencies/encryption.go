@@ -0,0 +1,164 @@
+package dependencies
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"apart-deal-api/pkg/security"
+	"apart-deal-api/pkg/store/datakey"
+	"apart-deal-api/pkg/store/user"
+
+	"github.com/Netflix/go-env"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+type EncryptionConfig struct {
+	// Enabled encrypts the name and the email of users, users stored before are encrypted by
+	// the worker
+	Enabled bool `env:"PII_ENCRYPTION_ENABLED,default=false"`
+	// MasterKeys are given as id:base64 separated by commas, the first one wraps the data
+	// keys and the others only unwrap them. A new key is added last, it's moved first once
+	// every replica knows it and the previous one is removed once every replica moved it.
+	MasterKeys string `env:"PII_MASTER_KEYS"`
+	// MasterKeysFile is read instead of MasterKeys when it's set, with a key per line
+	MasterKeysFile string `env:"PII_MASTER_KEYS_FILE"`
+	// IndexKey is the base64 HMAC key of the blind index of emails, it can't be changed
+	IndexKey string `env:"PII_INDEX_KEY"`
+	// DataKeyRotation is the age after which the worker creates a new data key and encrypts
+	// every user again, 0 disables it
+	DataKeyRotation time.Duration `env:"PII_DATA_KEY_ROTATION,default=2160h"`
+	// KeyringRefresh is how often data keys created by the worker are loaded, the worker
+	// waits twice as long before it encrypts users with a new key. 0 disables it.
+	KeyringRefresh     time.Duration `env:"PII_KEYRING_REFRESH,default=1m"`
+	ReEncryptBatchSize int           `env:"PII_REENCRYPT_BATCH_SIZE,default=500"`
+}
+
+func NewEncryptionConfig() (*EncryptionConfig, error) {
+	var cfg EncryptionConfig
+
+	_, err := env.UnmarshalFromEnviron(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+func (cfg *EncryptionConfig) keyringSettings() (user.KeyringSettings, error) {
+	masterKeys := cfg.MasterKeys
+
+	if cfg.MasterKeysFile != "" {
+		content, err := os.ReadFile(cfg.MasterKeysFile)
+		if err != nil {
+			return user.KeyringSettings{}, err
+		}
+
+		masterKeys = string(content)
+	}
+
+	parsed, err := security.ParseMasterKeys(masterKeys)
+	if err != nil {
+		return user.KeyringSettings{}, err
+	}
+
+	indexKey, err := security.ParseKey(cfg.IndexKey)
+	if err != nil {
+		return user.KeyringSettings{}, errors.Wrap(err, "invalid PII_INDEX_KEY")
+	}
+
+	return user.KeyringSettings{
+		MasterKeys: parsed,
+		IndexKey:   indexKey,
+		Rotation:   cfg.DataKeyRotation,
+	}, nil
+}
+
+// NewKeyring loads the data keys and reloads them for the lifetime of the app, it's nil when
+// the encryption is disabled
+func NewKeyring(
+	lc fx.Lifecycle,
+	cfg *EncryptionConfig,
+	repo datakey.DataKeyRepository,
+	logger *zap.Logger,
+) (*user.Keyring, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	settings, err := cfg.keyringSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	keyring := user.NewKeyring(repo, settings)
+
+	loadCtx, loadCancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer loadCancel()
+
+	if err := keyring.Load(loadCtx); err != nil {
+		return nil, err
+	}
+
+	if cfg.KeyringRefresh <= 0 {
+		return keyring, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			go func() {
+				defer close(done)
+
+				refreshKeyring(ctx, keyring, cfg.KeyringRefresh, logger)
+			}()
+
+			return nil
+		},
+		OnStop: func(stopCtx context.Context) error {
+			cancel()
+
+			select {
+			case <-done:
+				return nil
+			case <-stopCtx.Done():
+				return stopCtx.Err()
+			}
+		},
+	})
+
+	return keyring, nil
+}
+
+func refreshKeyring(ctx context.Context, keyring *user.Keyring, interval time.Duration, logger *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := keyring.Load(ctx); err != nil {
+				logger.Warn(fmt.Sprintf("Could not load data keys: %s", err))
+			}
+		}
+	}
+}
+
+// NewUserRepository encrypts the PII of users when PII_ENCRYPTION_ENABLED is set
+func NewUserRepository(db *mongo.Database, keyring *user.Keyring) user.UserRepository {
+	repo := user.NewUserRepository(db)
+
+	if keyring == nil {
+		return repo
+	}
+
+	return user.NewEncryptedUserRepository(repo, keyring)
+}
@@ -0,0 +1,36 @@
+package dependencies
+
+import (
+	"apart-deal-api/pkg/domain/identity"
+
+	"github.com/Netflix/go-env"
+	"go.uber.org/fx"
+)
+
+type IdentityConfig struct {
+	// EmailProviderRules also ignores Gmail dots and plus tags of known providers, keys
+	// of existing users have to be unset to be computed again after a change
+	EmailProviderRules bool `env:"EMAIL_PROVIDER_RULES,default=false"`
+}
+
+func NewIdentityConfig() (*IdentityConfig, error) {
+	var cfg IdentityConfig
+
+	_, err := env.UnmarshalFromEnviron(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+func NewEmailNormalizer(cfg *IdentityConfig) *identity.EmailNormalizer {
+	return identity.NewEmailNormalizer(identity.EmailSettings{
+		ProviderRules: cfg.EmailProviderRules,
+	})
+}
+
+var IdentityModule = fx.Provide(
+	NewIdentityConfig,
+	NewEmailNormalizer,
+)
@@ -8,6 +8,7 @@ import (
 	"os"
 	"time"
 
+	"apart-deal-api/pkg/domain/identity"
 	"apart-deal-api/pkg/mongo/schema"
 
 	"github.com/Netflix/go-env"
@@ -15,6 +16,10 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 	"go.uber.org/fx"
+
+	authDomain "apart-deal-api/pkg/domain/auth"
+	deviceDomain "apart-deal-api/pkg/domain/device"
+	notificationStore "apart-deal-api/pkg/store/notification"
 )
 
 type DbConfig struct {
@@ -23,6 +28,11 @@ type DbConfig struct {
 	DbCaCrt     string `env:"MONGO_CA_CRT"`
 	DbClientCrt string `env:"MONGO_CLIENT_CRT"`
 	DbClientKey string `env:"MONGO_CLIENT_KEY"`
+
+	// ValidationLevel and ValidationAction apply to the $jsonSchema validators of every
+	// collection, see schema.Validators
+	ValidationLevel  string `env:"MONGO_VALIDATION_LEVEL,default=moderate"`
+	ValidationAction string `env:"MONGO_VALIDATION_ACTION,default=error"`
 }
 
 type TLSConfig struct {
@@ -102,20 +112,45 @@ func NewMongoDb(client *mongo.Client, cfg *DbConfig) *mongo.Database {
 	return client.Database(cfg.DbName)
 }
 
+func NewValidationSettings(cfg *DbConfig) schema.ValidationSettings {
+	return schema.ValidationSettings{
+		Level:  cfg.ValidationLevel,
+		Action: cfg.ValidationAction,
+	}
+}
+
+func NewMigrator(
+	db *mongo.Database,
+	emails *identity.EmailNormalizer,
+	validation schema.ValidationSettings,
+) *schema.Migrator {
+	return schema.NewMigrator(db, schema.Migrations(schema.MigrationSettings{
+		EmailKey:              emails.Key,
+		SignUpExpiration:      authDomain.SignUpExpiration,
+		NotificationRetention: notificationStore.Retention,
+		RevokeTokenExpiration: deviceDomain.RevokeTokenExpiration,
+		Validation:            validation,
+	}))
+}
+
+// DbModule connects to Mongo and refuses to start on an outdated schema, migrations are
+// only run by the migrate CLI
 var DbModule = fx.Module("Mongo",
 	fx.Provide(
 		NewDbConfig,
 		NewMongoClient,
 		NewMongoDb,
+		NewValidationSettings,
+		NewMigrator,
 	),
-	fx.Invoke(func(lc fx.Lifecycle, client *mongo.Client, db *mongo.Database) {
+	fx.Invoke(func(
+		lc fx.Lifecycle,
+		client *mongo.Client,
+		migrator *schema.Migrator,
+	) {
 		lc.Append(fx.Hook{
 			OnStart: func(ctx context.Context) error {
-				if err := schema.Migrate(ctx, db); err != nil {
-					return err
-				}
-
-				return nil
+				return migrator.Verify(ctx)
 			},
 			OnStop: func(ctx context.Context) error {
 				_ = client.Disconnect(ctx)
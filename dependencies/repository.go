@@ -1,11 +1,37 @@
 package dependencies
 
 import (
+	"apart-deal-api/pkg/store/audit"
+	"apart-deal-api/pkg/store/challenge"
+	"apart-deal-api/pkg/store/datakey"
+	"apart-deal-api/pkg/store/device"
+	"apart-deal-api/pkg/store/notification"
+	"apart-deal-api/pkg/store/organization"
+	"apart-deal-api/pkg/store/session"
 	"apart-deal-api/pkg/store/user"
+	"apart-deal-api/pkg/store/verification"
 
 	"go.uber.org/fx"
 )
 
 var RepositoryModule = fx.Provide(
-	user.NewUserRepository,
+	NewEncryptionConfig,
+	NewKeyring,
+	NewUserRepository,
+	datakey.NewDataKeyRepository,
+	organization.NewOrganizationRepository,
+	organization.NewMembershipRepository,
+	organization.NewInvitationRepository,
+	notification.NewNotificationRepository,
+	audit.NewEventRepository,
+	device.NewKnownDeviceRepository,
+	challenge.NewChallengeRepository,
+	session.NewSessionRepository,
+	verification.NewRequestRepository,
 )
+
+// MemoryUserRepositoryModule replaces the user repository of RepositoryModule with one kept
+// in memory, users are lost when the app stops
+var MemoryUserRepositoryModule = fx.Decorate(func(_ user.UserRepository) user.UserRepository {
+	return user.NewMemoryUserRepository()
+})
@@ -0,0 +1,209 @@
+package dependencies
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"apart-deal-api/pkg/security"
+
+	"github.com/Netflix/go-env"
+	"github.com/pkg/errors"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+type PasswordPolicyConfig struct {
+	MinLength      int     `env:"PASSWORD_MIN_LENGTH,default=8"`
+	MaxLength      int     `env:"PASSWORD_MAX_LENGTH,default=128"`
+	RequireLower   bool    `env:"PASSWORD_REQUIRE_LOWER,default=false"`
+	RequireUpper   bool    `env:"PASSWORD_REQUIRE_UPPER,default=false"`
+	RequireDigit   bool    `env:"PASSWORD_REQUIRE_DIGIT,default=false"`
+	RequireSymbol  bool    `env:"PASSWORD_REQUIRE_SYMBOL,default=false"`
+	MinCharClasses int     `env:"PASSWORD_MIN_CHAR_CLASSES,default=0"`
+	MinEntropyBits float64 `env:"PASSWORD_MIN_ENTROPY_BITS,default=28"`
+
+	BreachedPasswordsFile   string `env:"BREACHED_PASSWORDS_FILE"`
+	BreachedPasswordsFormat string `env:"BREACHED_PASSWORDS_FORMAT,default=sha1"`
+}
+
+func NewPasswordPolicyConfig() (*PasswordPolicyConfig, error) {
+	var cfg PasswordPolicyConfig
+
+	_, err := env.UnmarshalFromEnviron(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// NewPasswordPolicy limits passwords to what bcrypt reads when it hashes new passwords
+func NewPasswordPolicy(cfg *PasswordPolicyConfig, hasherCfg *PasswordHasherConfig) (*security.PasswordPolicy, error) {
+	var breached security.BreachedPasswordChecker
+
+	if cfg.BreachedPasswordsFile != "" {
+		checker, err := security.LoadBreachedPasswords(cfg.BreachedPasswordsFile, cfg.BreachedPasswordsFormat)
+		if err != nil {
+			return nil, err
+		}
+
+		breached = checker
+	}
+
+	maxBytes := 0
+	if hasherCfg.Algorithm == security.BcryptID {
+		maxBytes = security.BcryptMaxPasswordBytes
+	}
+
+	return security.NewPasswordPolicy(security.PasswordPolicyConfig{
+		MinLength:      cfg.MinLength,
+		MaxLength:      cfg.MaxLength,
+		MaxBytes:       maxBytes,
+		RequireLower:   cfg.RequireLower,
+		RequireUpper:   cfg.RequireUpper,
+		RequireDigit:   cfg.RequireDigit,
+		RequireSymbol:  cfg.RequireSymbol,
+		MinCharClasses: cfg.MinCharClasses,
+		MinEntropyBits: cfg.MinEntropyBits,
+	}, breached), nil
+}
+
+type PasswordHasherConfig struct {
+	Algorithm string `env:"PASSWORD_HASH_ALGORITHM,default=argon2id"`
+
+	Argon2Memory      uint32 `env:"ARGON2_MEMORY_KIB,default=65536"`
+	Argon2Iterations  uint32 `env:"ARGON2_ITERATIONS,default=3"`
+	Argon2Parallelism uint8  `env:"ARGON2_PARALLELISM,default=2"`
+
+	BcryptCost int `env:"BCRYPT_COST,default=12"`
+}
+
+func NewPasswordHasherConfig() (*PasswordHasherConfig, error) {
+	var cfg PasswordHasherConfig
+
+	_, err := env.UnmarshalFromEnviron(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// legacyHashAlgorithms verify hashes of users imported from other systems, their
+// parameters only matter for hashing, verification reads them from the hash itself
+var legacyHashAlgorithms = []security.HashAlgorithm{
+	security.NewPbkdf2Sha256Algorithm(security.Pbkdf2Params{Iterations: 100000, SaltLength: 16, KeyLength: 32}),
+	security.NewScryptAlgorithm(security.ScryptParams{N: 32768, R: 8, P: 1, SaltLength: 16, KeyLength: 32}),
+}
+
+// NewPasswordHasher hashes with the configured algorithm and keeps the other ones
+// for verification, so that switching algorithms doesn't lock anyone out
+func NewPasswordHasher(cfg *PasswordHasherConfig) (*security.PasswordHasher, error) {
+	argon2idParams := security.Argon2idParams{
+		Memory:      cfg.Argon2Memory,
+		Iterations:  cfg.Argon2Iterations,
+		Parallelism: cfg.Argon2Parallelism,
+		SaltLength:  security.DefaultArgon2idParams.SaltLength,
+		KeyLength:   security.DefaultArgon2idParams.KeyLength,
+	}
+
+	// hashes beyond the limits could not be verified afterwards
+	if err := security.ValidateArgon2idParams(argon2idParams); err != nil {
+		return nil, errors.Wrap(err, "invalid ARGON2 parameters")
+	}
+
+	argon2id := security.NewArgon2idAlgorithm(argon2idParams)
+
+	bcrypt := security.NewBcryptAlgorithm(security.BcryptParams{
+		Cost: cfg.BcryptCost,
+	})
+
+	switch cfg.Algorithm {
+	case security.Argon2idID:
+		return security.NewPasswordHasher(argon2id, append([]security.HashAlgorithm{bcrypt}, legacyHashAlgorithms...)...), nil
+	case security.BcryptID:
+		return security.NewPasswordHasher(bcrypt, append([]security.HashAlgorithm{argon2id}, legacyHashAlgorithms...)...), nil
+	default:
+		return nil, errors.Errorf("Unknown password hash algorithm: %s", cfg.Algorithm)
+	}
+}
+
+type EmailDomainsConfig struct {
+	// Allow and Deny are comma separated, a non-empty allow list rejects every other domain
+	Allow     string `env:"EMAIL_DOMAINS_ALLOW"`
+	Deny      string `env:"EMAIL_DOMAINS_DENY"`
+	AllowFile string `env:"EMAIL_DOMAINS_ALLOW_FILE"`
+	DenyFile  string `env:"EMAIL_DOMAINS_DENY_FILE"`
+
+	BlockDisposable bool   `env:"BLOCK_DISPOSABLE_EMAILS,default=true"`
+	DisposableFile  string `env:"DISPOSABLE_EMAIL_DOMAINS_FILE"`
+
+	ReloadInterval time.Duration `env:"EMAIL_DOMAINS_RELOAD_INTERVAL,default=1m"`
+}
+
+func NewEmailDomainsConfig() (*EmailDomainsConfig, error) {
+	var cfg EmailDomainsConfig
+
+	_, err := env.UnmarshalFromEnviron(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// NewEmailDomainPolicy also watches the list files for the lifetime of the app,
+// so that they can be updated without a restart
+func NewEmailDomainPolicy(
+	lc fx.Lifecycle,
+	cfg *EmailDomainsConfig,
+	logger *zap.Logger,
+) (*security.EmailDomainPolicy, error) {
+	policy, err := security.NewEmailDomainPolicy(security.EmailDomainPolicyConfig{
+		Allow:           splitList(cfg.Allow),
+		Deny:            splitList(cfg.Deny),
+		AllowFile:       cfg.AllowFile,
+		DenyFile:        cfg.DenyFile,
+		DisposableFile:  cfg.DisposableFile,
+		BlockDisposable: cfg.BlockDisposable,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	watchCtx, cancel := context.WithCancel(context.Background())
+
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			go policy.Watch(watchCtx, cfg.ReloadInterval, logger)
+
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			cancel()
+
+			return nil
+		},
+	})
+
+	return policy, nil
+}
+
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+
+	return strings.Split(value, ",")
+}
+
+var SecurityModule = fx.Provide(
+	NewPasswordPolicyConfig,
+	NewPasswordPolicy,
+	NewPasswordHasherConfig,
+	NewPasswordHasher,
+	security.NewSecretGenerator,
+	NewEmailDomainsConfig,
+	NewEmailDomainPolicy,
+)
@@ -1,12 +1,200 @@
 package dependencies
 
 import (
-	authDomain "apart-deal-api/pkg/domain/auth"
+	"strings"
+	"time"
 
+	"github.com/Netflix/go-env"
+	"github.com/pkg/errors"
 	"go.uber.org/fx"
+
+	accountDomain "apart-deal-api/pkg/domain/account"
+	auditDomain "apart-deal-api/pkg/domain/audit"
+	authDomain "apart-deal-api/pkg/domain/auth"
+	challengeDomain "apart-deal-api/pkg/domain/challenge"
+	deviceDomain "apart-deal-api/pkg/domain/device"
+	orgDomain "apart-deal-api/pkg/domain/organization"
+	profileDomain "apart-deal-api/pkg/domain/profile"
+)
+
+type SignUpConfig struct {
+	ResendCooldown  time.Duration `env:"SIGN_UP_RESEND_COOLDOWN,default=1m"`
+	ResendDailyCap  int           `env:"SIGN_UP_RESEND_DAILY_CAP,default=5"`
+	MaxCodeAttempts int           `env:"SIGN_UP_MAX_CODE_ATTEMPTS,default=5"`
+}
+
+func NewSignUpConfig() (*SignUpConfig, error) {
+	var cfg SignUpConfig
+
+	_, err := env.UnmarshalFromEnviron(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+func NewSignUpLimits(cfg *SignUpConfig) authDomain.SignUpLimits {
+	return authDomain.SignUpLimits{
+		ResendCooldown:  cfg.ResendCooldown,
+		ResendDailyCap:  cfg.ResendDailyCap,
+		MaxCodeAttempts: cfg.MaxCodeAttempts,
+	}
+}
+
+type AuditConfig struct {
+	Retention time.Duration `env:"AUDIT_RETENTION,default=2160h"`
+}
+
+func NewAuditConfig() (*AuditConfig, error) {
+	var cfg AuditConfig
+
+	_, err := env.UnmarshalFromEnviron(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+func NewAuditSettings(cfg *AuditConfig) auditDomain.Settings {
+	return auditDomain.Settings{
+		Retention: cfg.Retention,
+	}
+}
+
+const (
+	ChallengeProviderPow         = "pow"
+	ChallengeProviderCaptcha     = "captcha"
+	ChallengeProviderCaptchaStub = "captcha_stub"
+)
+
+type ChallengeConfig struct {
+	Provider string `env:"CHALLENGE_PROVIDER,default=pow"`
+	// Routes are comma separated full paths, e.g. /api/v1/auth/sign-up, the API doesn't start
+	// when one of them isn't registered
+	Routes string `env:"CHALLENGE_ROUTES"`
+
+	PowDifficulty int           `env:"POW_DIFFICULTY,default=20"`
+	PowTTL        time.Duration `env:"POW_TTL,default=5m"`
+
+	CaptchaVerifyURL string `env:"CAPTCHA_VERIFY_URL"`
+	CaptchaSecret    string `env:"CAPTCHA_SECRET"`
+	CaptchaStubToken string `env:"CAPTCHA_STUB_TOKEN"`
+}
+
+func NewChallengeConfig() (*ChallengeConfig, error) {
+	var cfg ChallengeConfig
+
+	_, err := env.UnmarshalFromEnviron(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+func (c *ChallengeConfig) RouteList() []string {
+	var routes []string
+
+	for _, route := range strings.Split(c.Routes, ",") {
+		if route = strings.TrimSpace(route); route != "" {
+			routes = append(routes, route)
+		}
+	}
+
+	return routes
+}
+
+func NewProofOfWorkSettings(cfg *ChallengeConfig) challengeDomain.ProofOfWorkSettings {
+	return challengeDomain.ProofOfWorkSettings{
+		Difficulty: cfg.PowDifficulty,
+		TTL:        cfg.PowTTL,
+	}
+}
+
+// NewChallengeVerifier picks what protected routes expect in the challenge header,
+// the proof-of-work endpoints are served regardless
+func NewChallengeVerifier(
+	cfg *ChallengeConfig,
+	powSvc *challengeDomain.ProofOfWorkService,
+) (challengeDomain.Verifier, error) {
+	switch cfg.Provider {
+	case ChallengeProviderPow:
+		return powSvc, nil
+	case ChallengeProviderCaptcha:
+		if cfg.CaptchaVerifyURL == "" || cfg.CaptchaSecret == "" {
+			return nil, errors.Errorf("CAPTCHA_VERIFY_URL and CAPTCHA_SECRET are required by the captcha provider")
+		}
+
+		return challengeDomain.NewSiteVerifyCaptcha(cfg.CaptchaVerifyURL, cfg.CaptchaSecret), nil
+	case ChallengeProviderCaptchaStub:
+		if cfg.CaptchaStubToken == "" {
+			return nil, errors.Errorf("CAPTCHA_STUB_TOKEN is required by the captcha_stub provider")
+		}
+
+		return challengeDomain.NewStaticCaptcha(cfg.CaptchaStubToken), nil
+	default:
+		return nil, errors.Errorf("Unknown challenge provider: %s", cfg.Provider)
+	}
+}
+
+var ChallengeServicesModule = fx.Provide(
+	challengeDomain.NewProofOfWorkService,
+	NewChallengeConfig,
+	NewProofOfWorkSettings,
+	NewChallengeVerifier,
+)
+
+var AuditServicesModule = fx.Provide(
+	auditDomain.NewAuditService,
+	NewAuditConfig,
+	NewAuditSettings,
 )
 
 var AuthServicesModule = fx.Provide(
 	authDomain.NewSignUpService,
 	authDomain.NewConfirmSignUpService,
+	authDomain.NewResendSignUpCodeService,
+	authDomain.NewPasswordResetService,
+	deviceDomain.NewDeviceService,
+	NewSignUpConfig,
+	NewSignUpLimits,
+)
+
+var OrganizationServicesModule = fx.Provide(
+	orgDomain.NewOrganizationService,
+	orgDomain.NewInvitationService,
+)
+
+var ProfileServicesModule = fx.Provide(
+	profileDomain.NewProfileService,
+)
+
+type AccountConfig struct {
+	DeletedRetention time.Duration `env:"USER_DELETED_RETENTION,default=720h"`
+}
+
+func NewAccountConfig() (*AccountConfig, error) {
+	var cfg AccountConfig
+
+	_, err := env.UnmarshalFromEnviron(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+func NewAccountSettings(cfg *AccountConfig) accountDomain.Settings {
+	return accountDomain.Settings{
+		DeletedRetention: cfg.DeletedRetention,
+	}
+}
+
+var AccountServicesModule = fx.Provide(
+	accountDomain.NewAccountService,
+	accountDomain.NewPurgeService,
+	NewAccountConfig,
+	NewAccountSettings,
 )
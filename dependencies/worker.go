@@ -4,28 +4,73 @@ import (
 	"context"
 	"time"
 
+	"apart-deal-api/pkg/store/user"
+	"apart-deal-api/pkg/worker/invitation"
+	"apart-deal-api/pkg/worker/notification"
 	"apart-deal-api/pkg/worker/signup"
 
 	"go.uber.org/fx"
+	"go.uber.org/zap"
 
+	accountDomain "apart-deal-api/pkg/domain/account"
+	accountWorker "apart-deal-api/pkg/worker/account"
 	pkgScheduler "apart-deal-api/pkg/worker/scheduler"
 )
 
+func NewPurgeWorker(
+	settings accountDomain.Settings,
+	purgeSvc *accountDomain.PurgeService,
+	logger *zap.Logger,
+) *accountWorker.PurgeWorker {
+	return accountWorker.NewPurgeWorker(purgeSvc, settings.DeletedRetention, logger)
+}
+
+// NewReEncryptWorker is nil when the encryption is disabled
+func NewReEncryptWorker(
+	cfg *EncryptionConfig,
+	keyring *user.Keyring,
+	userRepo user.UserRepository,
+	logger *zap.Logger,
+) *accountWorker.ReEncryptWorker {
+	if keyring == nil {
+		return nil
+	}
+
+	return accountWorker.NewReEncryptWorker(userRepo, keyring, cfg.ReEncryptBatchSize, cfg.KeyringRefresh*2, logger)
+}
+
 var WorkerModule = fx.Module(
 	"Worker",
 	fx.Provide(
 		signup.NewNotificationHandler,
 		signup.NewNotificationWorker,
 		signup.NewObsoleteReqWorker,
+		invitation.NewNotificationHandler,
+		invitation.NewNotificationWorker,
+		notification.NewNotificationHandler,
+		notification.NewNotificationWorker,
+		NewPurgeWorker,
+		NewReEncryptWorker,
 		pkgScheduler.NewScheduler,
 	),
 	fx.Invoke(func(
 		scheduler *pkgScheduler.Scheduler,
 		notificationWorker *signup.NotificationWorker,
 		obsoleteReqWorker *signup.ObsoleteReqWorker,
+		invitationWorker *invitation.NotificationWorker,
+		genericNotificationWorker *notification.NotificationWorker,
+		purgeWorker *accountWorker.PurgeWorker,
+		reEncryptWorker *accountWorker.ReEncryptWorker,
 	) {
 		scheduler.Register(notificationWorker, time.Second*10, time.Second*10)
 		scheduler.Register(obsoleteReqWorker, time.Minute, 0)
+		scheduler.Register(invitationWorker, time.Second*10, time.Second*10)
+		scheduler.Register(genericNotificationWorker, time.Second*10, time.Second*10)
+		scheduler.Register(purgeWorker, time.Hour, time.Minute)
+
+		if reEncryptWorker != nil {
+			scheduler.Register(reEncryptWorker, time.Minute*10, time.Minute)
+		}
 	}),
 	fx.Invoke(func(lc fx.Lifecycle, scheduler *pkgScheduler.Scheduler) {
 		lc.Append(fx.Hook{
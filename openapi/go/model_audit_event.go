@@ -0,0 +1,36 @@
+/*
+ * Apart-Deal API Contracts
+ *
+ * Apart-Deal API Contracts
+ *
+ * API version: 0.0.1
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+import (
+	"time"
+)
+
+type AuditEvent struct {
+	Uid string `json:"uid"`
+
+	Type string `json:"type"`
+
+	UserUid string `json:"userUid,omitempty"`
+
+	Email string `json:"email,omitempty"`
+
+	Ip string `json:"ip,omitempty"`
+
+	UserAgent string `json:"userAgent,omitempty"`
+
+	TraceId string `json:"traceId,omitempty"`
+
+	Outcome string `json:"outcome"`
+
+	Reason string `json:"reason,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
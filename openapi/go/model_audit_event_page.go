@@ -0,0 +1,20 @@
+/*
+ * Apart-Deal API Contracts
+ *
+ * Apart-Deal API Contracts
+ *
+ * API version: 0.0.1
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+type AuditEventPage struct {
+	Items []AuditEvent `json:"items"`
+
+	Total int64 `json:"total"`
+
+	Page int32 `json:"page"`
+
+	PerPage int32 `json:"perPage"`
+}
@@ -0,0 +1,24 @@
+/*
+ * Apart-Deal API Contracts
+ *
+ * Apart-Deal API Contracts
+ *
+ * API version: 0.0.1
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+import (
+	"time"
+)
+
+type Challenge struct {
+	Uid string `json:"uid"`
+
+	Algorithm string `json:"algorithm"`
+
+	Difficulty int32 `json:"difficulty"`
+
+	ExpiresAt time.Time `json:"expiresAt"`
+}
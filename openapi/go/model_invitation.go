@@ -0,0 +1,24 @@
+/*
+ * Apart-Deal API Contracts
+ *
+ * Apart-Deal API Contracts
+ *
+ * API version: 0.0.1
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+import (
+	"time"
+)
+
+type Invitation struct {
+	Uid string `json:"uid"`
+
+	Email string `json:"email"`
+
+	Role string `json:"role"`
+
+	ExpiresAt time.Time `json:"expiresAt"`
+}
@@ -0,0 +1,18 @@
+/*
+ * Apart-Deal API Contracts
+ *
+ * Apart-Deal API Contracts
+ *
+ * API version: 0.0.1
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+type Organization struct {
+	Uid string `json:"uid"`
+
+	Name string `json:"name"`
+
+	Role string `json:"role"`
+}
@@ -0,0 +1,30 @@
+/*
+ * Apart-Deal API Contracts
+ *
+ * Apart-Deal API Contracts
+ *
+ * API version: 0.0.1
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+import (
+	"time"
+)
+
+type Profile struct {
+	Name string `json:"name"`
+
+	Email string `json:"email"`
+
+	Locale string `json:"locale,omitempty"`
+
+	Timezone string `json:"timezone,omitempty"`
+
+	AvatarUrl string `json:"avatarUrl,omitempty"`
+
+	Version int32 `json:"version"`
+
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+}
@@ -0,0 +1,16 @@
+/*
+ * Apart-Deal API Contracts
+ *
+ * Apart-Deal API Contracts
+ *
+ * API version: 0.0.1
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+type ResetPassword struct {
+	Token string `json:"token"`
+
+	Password string `json:"password"`
+}
@@ -0,0 +1,20 @@
+/*
+ * Apart-Deal API Contracts
+ *
+ * Apart-Deal API Contracts
+ *
+ * API version: 0.0.1
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+import (
+	"time"
+)
+
+type SessionStarted struct {
+	CsrfToken string `json:"csrfToken"`
+
+	ExpiresAt time.Time `json:"expiresAt"`
+}
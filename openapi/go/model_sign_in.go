@@ -13,4 +13,6 @@ type SignIn struct {
 	Email string `json:"email"`
 
 	Password string `json:"password"`
+
+	UseCookie bool `json:"useCookie,omitempty"`
 }
@@ -15,4 +15,6 @@ type SignUp struct {
 	Email string `json:"email"`
 
 	Password string `json:"password"`
+
+	InvitationToken string `json:"invitationToken,omitempty"`
 }
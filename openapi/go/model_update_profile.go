@@ -0,0 +1,22 @@
+/*
+ * Apart-Deal API Contracts
+ *
+ * Apart-Deal API Contracts
+ *
+ * API version: 0.0.1
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+type UpdateProfile struct {
+	Version int32 `json:"version"`
+
+	Name *string `json:"name,omitempty"`
+
+	Locale *string `json:"locale,omitempty"`
+
+	Timezone *string `json:"timezone,omitempty"`
+
+	AvatarUrl *string `json:"avatarUrl,omitempty"`
+}
@@ -0,0 +1,28 @@
+/*
+ * Apart-Deal API Contracts
+ *
+ * Apart-Deal API Contracts
+ *
+ * API version: 0.0.1
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+type UserInfo struct {
+	Sub string `json:"sub"`
+
+	Email string `json:"email"`
+
+	EmailVerified bool `json:"email_verified"`
+
+	Name string `json:"name"`
+
+	Locale string `json:"locale,omitempty"`
+
+	Zoneinfo string `json:"zoneinfo,omitempty"`
+
+	Picture string `json:"picture,omitempty"`
+
+	UpdatedAt int64 `json:"updated_at,omitempty"`
+}
@@ -2,7 +2,9 @@ package aspects
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 
 	apiErr "apart-deal-api/pkg/api/aspects/errors"
 
@@ -37,16 +39,33 @@ func NewErrorHandler(logger *zap.Logger) echo.HTTPErrorHandler {
 			return
 		}
 
+		if _, ok := err.(*apiErr.PreconditionFailedError); ok {
+			_ = context.JSON(http.StatusPreconditionFailed, err)
+			return
+		}
+
 		if _, ok := err.(*apiErr.UnauthorizedError); ok {
 			_ = context.JSON(http.StatusUnauthorized, err)
 			return
 		}
 
+		if _, ok := err.(*apiErr.StepUpRequiredError); ok {
+			_ = context.JSON(http.StatusUnauthorized, err)
+			return
+		}
+
 		if _, ok := err.(*apiErr.NotFoundError); ok {
 			_ = context.JSON(http.StatusNotFound, err)
 			return
 		}
 
+		if tooManyErr, ok := err.(*apiErr.TooManyRequestsError); ok {
+			retryAfter := int(math.Ceil(tooManyErr.RetryAfter().Seconds()))
+			context.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			_ = context.JSON(http.StatusTooManyRequests, err)
+			return
+		}
+
 		logger.Error(
 			fmt.Sprintf("Unhandled error at [%s %s]: %s",
 				context.Request().Method,
@@ -0,0 +1,21 @@
+package errors
+
+import "encoding/json"
+
+type PreconditionFailedError struct {
+	msg string
+}
+
+func NewPreconditionFailedError(msg string) *PreconditionFailedError {
+	return &PreconditionFailedError{msg}
+}
+
+func (e *PreconditionFailedError) Error() string {
+	return e.msg
+}
+
+func (e *PreconditionFailedError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{
+		"message": e.msg,
+	})
+}
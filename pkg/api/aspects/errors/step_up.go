@@ -0,0 +1,42 @@
+package errors
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+)
+
+// StepUpRequiredError tells the client to re-authenticate before retrying, it lists what
+// the new token must satisfy
+type StepUpRequiredError struct {
+	maxAge time.Duration
+	amr    []string
+}
+
+func NewStepUpRequiredError(maxAge time.Duration, amr []string) *StepUpRequiredError {
+	return &StepUpRequiredError{
+		maxAge: maxAge,
+		amr:    amr,
+	}
+}
+
+func (e *StepUpRequiredError) Error() string {
+	return "Step-up authentication is required"
+}
+
+func (e *StepUpRequiredError) MarshalJSON() ([]byte, error) {
+	body := map[string]interface{}{
+		"message": "Recent authentication required",
+		"reason":  "step_up_required",
+	}
+
+	if e.maxAge > 0 {
+		body["maxAge"] = int(math.Ceil(e.maxAge.Seconds()))
+	}
+
+	if len(e.amr) > 0 {
+		body["amr"] = e.amr
+	}
+
+	return json.Marshal(body)
+}
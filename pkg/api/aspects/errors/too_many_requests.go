@@ -0,0 +1,35 @@
+package errors
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type TooManyRequestsError struct {
+	msg        string
+	tag        string
+	retryAfter time.Duration
+}
+
+func NewTooManyRequestsError(msg string, tag string, retryAfter time.Duration) *TooManyRequestsError {
+	return &TooManyRequestsError{
+		msg:        msg,
+		tag:        tag,
+		retryAfter: retryAfter,
+	}
+}
+
+func (e *TooManyRequestsError) Error() string {
+	return e.msg
+}
+
+func (e *TooManyRequestsError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+func (e *TooManyRequestsError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{
+		"message": e.msg,
+		"tag":     e.tag,
+	})
+}
@@ -19,11 +19,17 @@ func NewTracingMiddleware() echo.MiddlewareFunc {
 				return next(c)
 			}
 
+			newCtx := tracing.WithClient(c.Request().Context(), tracing.Client{
+				IP:        c.RealIP(),
+				UserAgent: c.Request().UserAgent(),
+			})
+
 			if traceID := c.Request().Header.Get("X-Trace-Id"); traceID != "" {
-				newCtx := tracing.WithTraceID(c.Request().Context(), traceID)
-				c.SetRequest(c.Request().WithContext(newCtx))
+				newCtx = tracing.WithTraceID(newCtx, traceID)
 			}
 
+			c.SetRequest(c.Request().WithContext(newCtx))
+
 			return next(c)
 		}
 	}
@@ -44,3 +44,29 @@ type NoSuchUserError struct {
 func (e *NoSuchUserError) Error() string {
 	return "No such user"
 }
+
+// InvalidCredentialsError replaces the errors above in enumeration-safe mode
+type InvalidCredentialsError struct {
+	error
+}
+
+func (e *InvalidCredentialsError) Error() string {
+	return "Invalid credentials"
+}
+
+type SessionRevokedError struct {
+}
+
+func (e *SessionRevokedError) Error() string {
+	return "Session has been revoked"
+}
+
+// PasswordResetRequiredError is returned for the right credentials of an account whose
+// sessions were revoked, a new password has to be set with the emailed token
+type PasswordResetRequiredError struct {
+	error
+}
+
+func (e *PasswordResetRequiredError) Error() string {
+	return "Password has to be reset"
+}
@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	apiErr "apart-deal-api/pkg/api/aspects/errors"
+	sessionStore "apart-deal-api/pkg/store/session"
+)
+
+const (
+	tokenPayloadCtxKey = "tokenPayload"
+	sessionCtxKey      = "session"
+	bearerPrefix       = "Bearer "
+)
+
+// NewAuthMiddleware accepts a bearer token or a session cookie, the bearer token wins
+// when a request carries both. Cookie authenticated requests which change state must
+// pass the CSRF check, see SessionService.VerifyCSRF.
+func NewAuthMiddleware(authSvc *AuthenticationService, sessionSvc *SessionService) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var (
+				payload *TokenPayload
+				err     error
+			)
+
+			header := c.Request().Header.Get(echo.HeaderAuthorization)
+			if strings.HasPrefix(header, bearerPrefix) {
+				payload, err = authSvc.Verify(strings.TrimPrefix(header, bearerPrefix))
+				if err != nil {
+					return apiErr.NewUnauthorizedError("invalid_token")
+				}
+
+				err = authSvc.CheckSession(c.Request().Context(), payload)
+			} else {
+				session, resolveErr := resolveSession(c, sessionSvc)
+				if resolveErr != nil {
+					return resolveErr
+				}
+
+				payload, err = authSvc.CheckCookieSession(c.Request().Context(), session)
+				c.Set(sessionCtxKey, session)
+			}
+
+			if err != nil {
+				switch err.(type) {
+				case *TokenInvalidError:
+					return apiErr.NewUnauthorizedError("invalid_token")
+				case *SessionRevokedError:
+					return apiErr.NewUnauthorizedError("session_revoked")
+				default:
+					return err
+				}
+			}
+
+			c.Set(tokenPayloadCtxKey, payload)
+
+			return next(c)
+		}
+	}
+}
+
+func resolveSession(c echo.Context, sessionSvc *SessionService) (*sessionStore.Session, error) {
+	cookie, err := c.Cookie(sessionSvc.CookieName())
+	if err != nil || cookie.Value == "" {
+		return nil, apiErr.NewUnauthorizedError("no_token")
+	}
+
+	session, err := sessionSvc.Resolve(c.Request().Context(), cookie.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	if session == nil {
+		return nil, apiErr.NewUnauthorizedError("invalid_session")
+	}
+
+	if isSafeMethod(c.Request().Method) {
+		return session, nil
+	}
+
+	csrfCookie := ""
+	if cookie, err := c.Cookie(sessionSvc.CSRFCookieName()); err == nil {
+		csrfCookie = cookie.Value
+	}
+
+	if !sessionSvc.VerifyCSRF(session, c.Request().Header.Get(CSRFHeader), csrfCookie) {
+		return nil, apiErr.NewUnauthorizedError("invalid_csrf_token")
+	}
+
+	return session, nil
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// SessionFromContext returns the cookie session the request was authenticated with,
+// it's nil for bearer tokens
+func SessionFromContext(c echo.Context) *sessionStore.Session {
+	session, _ := c.Get(sessionCtxKey).(*sessionStore.Session)
+
+	return session
+}
+
+// PayloadFromContext returns the payload of the token the request was authenticated with,
+// it's nil for routes which are not behind NewAuthMiddleware
+func PayloadFromContext(c echo.Context) *TokenPayload {
+	payload, _ := c.Get(tokenPayloadCtxKey).(*TokenPayload)
+
+	return payload
+}
+
+// NewAdminMiddleware must run after NewAuthMiddleware
+func NewAdminMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			payload := PayloadFromContext(c)
+			if payload == nil || !payload.Admin {
+				return apiErr.NewUnauthorizedError("not_admin")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// StepUpRequirement is what NewStepUpMiddleware expects from the token, a zero MaxAge
+// doesn't limit the age of the authentication
+type StepUpRequirement struct {
+	MaxAge time.Duration
+	AMR    []string
+}
+
+// DefaultStepUpRequirement asks for an authentication of the last 5 minutes, whatever the
+// factor
+var DefaultStepUpRequirement = StepUpRequirement{
+	MaxAge: time.Minute * 5,
+}
+
+// NewStepUpMiddleware guards sensitive operations, it must run after NewAuthMiddleware.
+// The client is expected to call the reauthenticate route and retry with the new token.
+func NewStepUpMiddleware(requirement StepUpRequirement) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			payload := PayloadFromContext(c)
+			if payload == nil {
+				return apiErr.NewUnauthorizedError("no_token")
+			}
+
+			if !requirement.satisfiedBy(payload, time.Now()) {
+				return apiErr.NewStepUpRequiredError(requirement.MaxAge, requirement.AMR)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+func (r StepUpRequirement) satisfiedBy(payload *TokenPayload, now time.Time) bool {
+	if r.MaxAge > 0 && now.Sub(payload.AuthTime) > r.MaxAge {
+		return false
+	}
+
+	for _, required := range r.AMR {
+		found := false
+		for _, method := range payload.AMR {
+			if method == required {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
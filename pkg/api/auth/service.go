@@ -2,12 +2,23 @@ package auth
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"time"
 
 	"apart-deal-api/pkg/security"
+	"apart-deal-api/pkg/utils"
+
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
 
+	auditDomain "apart-deal-api/pkg/domain/audit"
+	deviceDomain "apart-deal-api/pkg/domain/device"
+	identityDomain "apart-deal-api/pkg/domain/identity"
+	auditStore "apart-deal-api/pkg/store/audit"
+	sessionStore "apart-deal-api/pkg/store/session"
 	userStore "apart-deal-api/pkg/store/user"
 
 	oas "gitlab.com/apart-deals/openapi/go/api"
@@ -16,34 +27,113 @@ import (
 type TokenPayload struct {
 	UserID string
 	Email  string
+
+	// Name, Locale and Zoneinfo are the profile claims of OpenID Connect, they reflect the
+	// profile at the time the token was issued
+	Name     string
+	Locale   string
+	Zoneinfo string
+
+	// OrganizationID and Role are set once the user has selected an organization
+	OrganizationID string
+	Role           string
+
+	// Admin grants access to the administration routes, see NewAdminMiddleware
+	Admin bool
+
+	// AuthTime is when the user last proved their identity and AMR lists how, both are
+	// carried over to tokens derived from this one, see NewStepUpMiddleware
+	AuthTime time.Time
+	AMR      []string
+
+	// IssuedAt is filled by Verify, it's compared to User.SessionsRevokedAt
+	IssuedAt time.Time
 }
 
 const (
 	TokenExpDuration = time.Minute * 15
 )
 
+// Authentication methods references, see RFC 8176
+const (
+	AMRPassword = "pwd"
+)
+
 type AuthenticationService struct {
-	tokenSecret string
-	userRepo    userStore.UserRepository
+	tokenSecret     string
+	userRepo        userStore.UserRepository
+	hasher          *security.PasswordHasher
+	auditSvc        *auditDomain.AuditService
+	deviceSvc       *deviceDomain.DeviceService
+	emails          *identityDomain.EmailNormalizer
+	logger          *zap.Logger
+	enumerationSafe bool
+
+	dummyHashOnce sync.Once
+	dummyHash     string
 }
 
 func NewAuthenticationService(
 	tokenSecret string,
 	userRepo userStore.UserRepository,
+	hasher *security.PasswordHasher,
+	auditSvc *auditDomain.AuditService,
+	deviceSvc *deviceDomain.DeviceService,
+	emails *identityDomain.EmailNormalizer,
+	logger *zap.Logger,
+	enumerationSafe bool,
 ) *AuthenticationService {
 	return &AuthenticationService{
-		tokenSecret: tokenSecret,
-		userRepo:    userRepo,
+		tokenSecret:     tokenSecret,
+		userRepo:        userRepo,
+		hasher:          hasher,
+		auditSvc:        auditSvc,
+		deviceSvc:       deviceSvc,
+		emails:          emails,
+		logger:          logger,
+		enumerationSafe: enumerationSafe,
 	}
 }
 
 func (s *AuthenticationService) Sign(payload TokenPayload) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	authTime := payload.AuthTime
+	if authTime.IsZero() {
+		authTime = time.Now()
+	}
+
+	claims := jwt.MapClaims{
 		"userID":    payload.UserID,
 		"userEmail": payload.Email,
-		"nbf":       time.Now(),
-		"exp":       time.Now().Add(TokenExpDuration),
-	})
+		"iat":       time.Now().Unix(),
+		"nbf":       time.Now().Unix(),
+		"exp":       time.Now().Add(TokenExpDuration).Unix(),
+		"auth_time": authTime.Unix(),
+	}
+
+	if len(payload.AMR) > 0 {
+		claims["amr"] = payload.AMR
+	}
+
+	for claim, value := range map[string]string{
+		"name":     payload.Name,
+		"locale":   payload.Locale,
+		"zoneinfo": payload.Zoneinfo,
+	} {
+		if value != "" {
+			claims[claim] = value
+		}
+	}
+
+	if payload.OrganizationID != "" {
+		claims["orgID"] = payload.OrganizationID
+		claims["orgRole"] = payload.Role
+	}
+
+	if payload.Admin {
+		claims["admin"] = true
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	tokenString, err := token.SignedString([]byte(s.tokenSecret))
 	if err != nil {
@@ -59,7 +149,7 @@ func (s *AuthenticationService) Verify(tokenString string) (*TokenPayload, error
 			return nil, &TokenInvalidError{}
 		}
 
-		return s.tokenSecret, nil
+		return []byte(s.tokenSecret), nil
 	})
 	if err != nil {
 		return nil, &TokenInvalidError{}
@@ -74,45 +164,321 @@ func (s *AuthenticationService) Verify(tokenString string) (*TokenPayload, error
 		return nil, &TokenInvalidError{}
 	}
 
+	userID, _ := claims["userID"].(string)
+	if userID == "" {
+		return nil, &TokenInvalidError{}
+	}
+
+	email, _ := claims["userEmail"].(string)
+	name, _ := claims["name"].(string)
+	locale, _ := claims["locale"].(string)
+	zoneinfo, _ := claims["zoneinfo"].(string)
+	orgID, _ := claims["orgID"].(string)
+	orgRole, _ := claims["orgRole"].(string)
+	admin, _ := claims["admin"].(bool)
+	iat, _ := claims["iat"].(float64)
+	authTime, _ := claims["auth_time"].(float64)
+
+	var amr []string
+	rawAMR, _ := claims["amr"].([]interface{})
+	for _, method := range rawAMR {
+		if m, ok := method.(string); ok {
+			amr = append(amr, m)
+		}
+	}
+
 	return &TokenPayload{
-		UserID: claims["userID"].(string),
-		Email:  claims["userEmail"].(string),
+		UserID:         userID,
+		Email:          email,
+		Name:           name,
+		Locale:         locale,
+		Zoneinfo:       zoneinfo,
+		OrganizationID: orgID,
+		Role:           orgRole,
+		Admin:          admin,
+		AuthTime:       time.Unix(int64(authTime), 0),
+		AMR:            amr,
+		IssuedAt:       time.Unix(int64(iat), 0),
 	}, nil
 }
 
+// CheckSession rejects tokens of users who don't exist anymore or whose sessions were revoked
+// after the token had been issued
+func (s *AuthenticationService) CheckSession(ctx context.Context, payload *TokenPayload) error {
+	_, err := s.checkSession(ctx, payload)
+
+	return err
+}
+
+// CheckCookieSession checks a cookie session like CheckSession and returns its payload with
+// the current profile of the user, sessions don't keep a copy of it
+func (s *AuthenticationService) CheckCookieSession(ctx context.Context, model *sessionStore.Session) (*TokenPayload, error) {
+	payload := PayloadOfSession(model)
+
+	user, err := s.checkSession(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	payload.Email = user.Email
+	payload.Name = user.Name
+	payload.Locale = user.Locale
+	payload.Zoneinfo = user.Timezone
+
+	return payload, nil
+}
+
+func (s *AuthenticationService) checkSession(ctx context.Context, payload *TokenPayload) (*userStore.User, error) {
+	user, err := s.userRepo.FindByUID(ctx, payload.UserID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, &TokenInvalidError{}
+		}
+
+		return nil, err
+	}
+
+	// iat has a second precision, a token issued within the same second is revoked as well
+	if user.SessionsRevokedAt != nil && !payload.IssuedAt.After(*user.SessionsRevokedAt) {
+		return nil, &SessionRevokedError{}
+	}
+
+	return user, nil
+}
+
 func (s *AuthenticationService) FindUser(ctx context.Context, payload *oas.SignIn) (*userStore.User, error) {
-	user, err := s.userRepo.FindByEmail(ctx, payload.Email)
+	user, err := s.userRepo.FindByEmailKey(ctx, s.emails.Key(payload.Email))
 	if err != nil {
 		return nil, err
 	}
 
 	if user == nil {
+		if s.enumerationSafe {
+			s.equalizeTiming(payload.Password)
+
+			return nil, &InvalidCredentialsError{}
+		}
+
 		return nil, &NoSuchUserError{}
 	}
 
-	if user.Status != userStore.StatusConfirmed {
+	// in enumeration-safe mode the password is verified first, so that a pending
+	// account takes as long to reject as a confirmed one
+	if user.Status != userStore.StatusConfirmed && !s.enumerationSafe {
 		return nil, &UserNotConfirmedError{error: errors.New("Not authorized")}
 	}
 
-	if ok := security.CheckPasswordHash(payload.Password, user.PasswordHash); !ok {
+	ok, needsRehash, err := s.hasher.Verify(payload.Password, user.PasswordHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		if s.enumerationSafe {
+			return nil, &InvalidCredentialsError{}
+		}
+
 		return nil, &InvalidPasswordError{error: errors.New("Invalid password")}
 	}
 
+	if user.Status != userStore.StatusConfirmed {
+		return nil, &InvalidCredentialsError{}
+	}
+
+	if user.PasswordResetRequired {
+		return nil, &PasswordResetRequiredError{}
+	}
+
+	if needsRehash {
+		s.rehash(ctx, user, payload.Password)
+	}
+
 	return user, nil
 }
 
+// equalizeTiming runs a verification against a throwaway hash of the current algorithm,
+// so that an unknown email costs as much as a wrong password
+func (s *AuthenticationService) equalizeTiming(password string) {
+	s.dummyHashOnce.Do(func() {
+		hash, err := s.hasher.Hash(utils.RandomString(16))
+		if err != nil {
+			s.logger.Warn(fmt.Sprintf("Could not produce dummy hash: %s", err))
+			return
+		}
+
+		s.dummyHash = hash
+	})
+
+	if s.dummyHash != "" {
+		_, _, _ = s.hasher.Verify(password, s.dummyHash)
+	}
+}
+
+// rehash upgrades the stored hash to the current algorithm and parameters, a failure
+// here must not prevent the user from signing in, the upgrade is retried next time
+func (s *AuthenticationService) rehash(ctx context.Context, user *userStore.User, password string) {
+	passwordHash, err := s.hasher.Hash(password)
+	if err != nil {
+		s.logger.With(zap.String("uid", user.UID)).Warn(fmt.Sprintf("Could not rehash password: %s", err))
+		s.recordRehash(ctx, user, err)
+		return
+	}
+
+	// the password may have changed since it was verified, the stale hash must not replace
+	// the new one, so a conflict isn't retried
+	if err := s.userRepo.UpdatePasswordHash(ctx, user.UID, user.Version, passwordHash); err != nil {
+		s.logger.With(zap.String("uid", user.UID)).Warn(fmt.Sprintf("Could not save rehashed password: %s", err))
+		s.recordRehash(ctx, user, err)
+		return
+	}
+
+	user.PasswordHash = passwordHash
+	user.Version++
+	s.recordRehash(ctx, user, nil)
+}
+
+func (s *AuthenticationService) recordRehash(ctx context.Context, user *userStore.User, err error) {
+	event := auditDomain.RecordInput{
+		Type:    auditStore.TypePasswordRehash,
+		UserUID: user.UID,
+		Email:   user.Email,
+		Outcome: auditDomain.OutcomeOf(err),
+	}
+
+	if err != nil {
+		event.Reason = "internal_error"
+	}
+
+	s.auditSvc.Record(ctx, event)
+}
+
 func (s *AuthenticationService) Auth(ctx context.Context, payload *oas.SignIn) (string, error) {
-	user, err := s.FindUser(ctx, payload)
+	tokenPayload, err := s.Authenticate(ctx, payload)
 	if err != nil {
 		return "", err
 	}
 
-	tokenString, err := s.Sign(TokenPayload{
-		UserID: user.UID,
-	})
+	tokenString, err := s.Sign(*tokenPayload)
 	if err != nil {
 		return "", err
 	}
 
 	return tokenString, nil
 }
+
+// Authenticate checks the credentials and returns what the token or the session of the
+// user will carry
+func (s *AuthenticationService) Authenticate(ctx context.Context, payload *oas.SignIn) (*TokenPayload, error) {
+	user, err := s.FindUser(ctx, payload)
+
+	event := auditDomain.RecordInput{
+		Type:    auditStore.TypeSignIn,
+		Email:   s.emails.Normalize(payload.Email),
+		Outcome: auditDomain.OutcomeOf(err),
+		Reason:  signInAuditReason(err),
+	}
+
+	if user != nil {
+		event.UserUID = user.UID
+	}
+
+	s.auditSvc.Record(ctx, event)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.deviceSvc.Remember(ctx, user)
+
+	return &TokenPayload{
+		UserID:   user.UID,
+		Email:    user.Email,
+		Name:     user.Name,
+		Locale:   user.Locale,
+		Zoneinfo: user.Timezone,
+		Admin:    user.Admin,
+		AuthTime: time.Now(),
+		AMR:      []string{AMRPassword},
+	}, nil
+}
+
+// Reauthenticate checks the password of an already signed in user and returns the payload
+// with a fresh auth_time, everything else is kept from the current one
+func (s *AuthenticationService) Reauthenticate(ctx context.Context, payload *TokenPayload, password string) (*TokenPayload, error) {
+	user, err := s.checkPassword(ctx, payload.UserID, password)
+
+	s.auditSvc.Record(ctx, auditDomain.RecordInput{
+		Type:    auditStore.TypeReauthenticate,
+		UserUID: payload.UserID,
+		Email:   payload.Email,
+		Outcome: auditDomain.OutcomeOf(err),
+		Reason:  signInAuditReason(err),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	amr := []string{AMRPassword}
+	for _, method := range payload.AMR {
+		if method != AMRPassword {
+			amr = append(amr, method)
+		}
+	}
+
+	return &TokenPayload{
+		UserID:         user.UID,
+		Email:          user.Email,
+		Name:           user.Name,
+		Locale:         user.Locale,
+		Zoneinfo:       user.Timezone,
+		OrganizationID: payload.OrganizationID,
+		Role:           payload.Role,
+		Admin:          user.Admin,
+		AuthTime:       time.Now(),
+		AMR:            amr,
+	}, nil
+}
+
+func (s *AuthenticationService) checkPassword(ctx context.Context, uid string, password string) (*userStore.User, error) {
+	user, err := s.userRepo.FindByUID(ctx, uid)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, &TokenInvalidError{}
+		}
+
+		return nil, err
+	}
+
+	ok, _, err := s.hasher.Verify(password, user.PasswordHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, &InvalidPasswordError{error: errors.New("Invalid password")}
+	}
+
+	return user, nil
+}
+
+func signInAuditReason(err error) string {
+	switch err.(type) {
+	case nil:
+		return ""
+	case *NoSuchUserError:
+		return "no_user"
+	case *InvalidPasswordError:
+		return "invalid_password"
+	case *UserNotConfirmedError:
+		return "not_confirmed"
+	case *InvalidCredentialsError:
+		return "invalid_credentials"
+	case *PasswordResetRequiredError:
+		return "password_reset_required"
+	case *TokenInvalidError:
+		return "invalid_token"
+	default:
+		return "internal_error"
+	}
+}
@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"apart-deal-api/pkg/security"
+	"apart-deal-api/pkg/tracing"
+
+	"github.com/labstack/echo/v4"
+
+	sessionStore "apart-deal-api/pkg/store/session"
+)
+
+const (
+	CSRFHeader = "X-CSRF-Token"
+
+	// sessions are touched at most once per touchInterval, not on every request
+	touchInterval = time.Minute
+)
+
+type SessionSettings struct {
+	CookieName     string
+	CSRFCookieName string
+	CookieDomain   string
+	Secure         bool
+	SameSite       http.SameSite
+
+	// IdleTimeout is extended on use, a session never outlives MaxLifetime
+	IdleTimeout time.Duration
+	MaxLifetime time.Duration
+}
+
+var DefaultSessionSettings = SessionSettings{
+	CookieName:     "session",
+	CSRFCookieName: "csrf_token",
+	Secure:         true,
+	SameSite:       http.SameSiteLaxMode,
+	IdleTimeout:    time.Hour * 24,
+	MaxLifetime:    time.Hour * 24 * 30,
+}
+
+type StartedSession struct {
+	ID        string
+	CSRFToken string
+	ExpiresAt time.Time
+}
+
+// SessionService keeps browser sessions, the cookie holds a random id and never the token,
+// so that scripts on the page can't read what authenticates the user
+type SessionService struct {
+	sessionRepo sessionStore.SessionRepository
+	secrets     security.SecretGenerator
+	settings    SessionSettings
+}
+
+func NewSessionService(
+	sessionRepo sessionStore.SessionRepository,
+	secrets security.SecretGenerator,
+	settings SessionSettings,
+) *SessionService {
+	return &SessionService{
+		sessionRepo: sessionRepo,
+		secrets:     secrets,
+		settings:    settings,
+	}
+}
+
+func (s *SessionService) Start(ctx context.Context, payload TokenPayload) (*StartedSession, error) {
+	id, err := s.secrets.Token(security.DefaultTokenBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	csrfToken, err := s.secrets.Token(security.DefaultTokenBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	client := tracing.ClientFromContext(ctx)
+
+	model := sessionStore.Session{
+		UID:             security.HashToken(id),
+		UserUID:         payload.UserID,
+		OrganizationUID: payload.OrganizationID,
+		Role:            payload.Role,
+		Admin:           payload.Admin,
+		AuthTime:        payload.AuthTime,
+		AMR:             payload.AMR,
+		CSRFToken:       security.HashToken(csrfToken),
+		IP:              client.IP,
+		UserAgent:       client.UserAgent,
+		CreatedAt:       now,
+		LastSeenAt:      now,
+		ExpiresAt:       s.expiresAt(now, now),
+	}
+
+	if err := s.sessionRepo.Create(ctx, &model); err != nil {
+		return nil, err
+	}
+
+	return &StartedSession{
+		ID:        id,
+		CSRFToken: csrfToken,
+		ExpiresAt: model.ExpiresAt,
+	}, nil
+}
+
+// Resolve returns nil for unknown and expired sessions, a used session is extended
+func (s *SessionService) Resolve(ctx context.Context, id string) (*sessionStore.Session, error) {
+	model, err := s.sessionRepo.FindByUID(ctx, security.HashToken(id))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	// the TTL monitor only runs once a minute
+	if model == nil || !model.ExpiresAt.After(now) {
+		return nil, nil
+	}
+
+	if now.Sub(model.LastSeenAt) >= touchInterval {
+		model.LastSeenAt = now
+		model.ExpiresAt = s.expiresAt(model.CreatedAt, now)
+
+		if err := s.sessionRepo.Touch(ctx, model.UID, model.LastSeenAt, model.ExpiresAt); err != nil {
+			return nil, err
+		}
+	}
+
+	return model, nil
+}
+
+// VerifyCSRF implements the double-submit check, the header must repeat the cookie and
+// both must match the token the session was started with
+func (s *SessionService) VerifyCSRF(model *sessionStore.Session, header string, cookie string) bool {
+	if header == "" || subtle.ConstantTimeCompare([]byte(header), []byte(cookie)) != 1 {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(security.HashToken(header)), []byte(model.CSRFToken)) == 1
+}
+
+func (s *SessionService) SelectOrganization(ctx context.Context, model *sessionStore.Session, organizationUID string, role string) error {
+	return s.sessionRepo.SaveOrganization(ctx, model.UID, organizationUID, role)
+}
+
+func (s *SessionService) SaveAuthentication(ctx context.Context, model *sessionStore.Session, authTime time.Time, amr []string) error {
+	return s.sessionRepo.SaveAuthentication(ctx, model.UID, authTime, amr)
+}
+
+func (s *SessionService) End(ctx context.Context, model *sessionStore.Session) error {
+	return s.sessionRepo.Delete(ctx, model.UID)
+}
+
+func (s *SessionService) SetCookies(c echo.Context, started *StartedSession) {
+	c.SetCookie(s.cookie(s.settings.CookieName, started.ID, started.ExpiresAt, true))
+	// the CSRF cookie is read by the frontend and sent back in CSRFHeader
+	c.SetCookie(s.cookie(s.settings.CSRFCookieName, started.CSRFToken, started.ExpiresAt, false))
+}
+
+func (s *SessionService) ClearCookies(c echo.Context) {
+	for _, cookie := range []*http.Cookie{
+		s.cookie(s.settings.CookieName, "", time.Unix(0, 0), true),
+		s.cookie(s.settings.CSRFCookieName, "", time.Unix(0, 0), false),
+	} {
+		cookie.MaxAge = -1
+		c.SetCookie(cookie)
+	}
+}
+
+func (s *SessionService) CookieName() string {
+	return s.settings.CookieName
+}
+
+func (s *SessionService) CSRFCookieName() string {
+	return s.settings.CSRFCookieName
+}
+
+func (s *SessionService) cookie(name string, value string, expires time.Time, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   s.settings.CookieDomain,
+		Expires:  expires,
+		Secure:   s.settings.Secure,
+		HttpOnly: httpOnly,
+		SameSite: s.settings.SameSite,
+	}
+}
+
+func (s *SessionService) expiresAt(createdAt time.Time, now time.Time) time.Time {
+	expiresAt := now.Add(s.settings.IdleTimeout)
+
+	if limit := createdAt.Add(s.settings.MaxLifetime); expiresAt.After(limit) {
+		return limit
+	}
+
+	return expiresAt
+}
+
+// PayloadOfSession gives cookie sessions the same shape as verified tokens, IssuedAt is
+// the start of the session so that revoking sessions works alike. The profile is left
+// empty, see AuthenticationService.CheckCookieSession.
+func PayloadOfSession(model *sessionStore.Session) *TokenPayload {
+	return &TokenPayload{
+		UserID:         model.UserUID,
+		OrganizationID: model.OrganizationUID,
+		Role:           model.Role,
+		Admin:          model.Admin,
+		AuthTime:       model.AuthTime,
+		AMR:            model.AMR,
+		IssuedAt:       model.CreatedAt,
+	}
+}
@@ -0,0 +1,35 @@
+package account
+
+import (
+	"net/http"
+
+	"apart-deal-api/pkg/api/auth"
+
+	"github.com/labstack/echo/v4"
+
+	accountDomain "apart-deal-api/pkg/domain/account"
+)
+
+// DeleteAccountHandler soft deletes an account, it can be restored until it's purged
+type DeleteAccountHandler struct {
+	accountSvc *accountDomain.AccountService
+}
+
+func NewDeleteAccountHandler(accountSvc *accountDomain.AccountService) *DeleteAccountHandler {
+	return &DeleteAccountHandler{
+		accountSvc: accountSvc,
+	}
+}
+
+func (h *DeleteAccountHandler) Handle(eCtx echo.Context) error {
+	tokenPayload := auth.PayloadFromContext(eCtx)
+
+	if err := h.accountSvc.Delete(eCtx.Request().Context(), accountDomain.DeleteInput{
+		UserUID:  eCtx.Param("uid"),
+		AdminUID: tokenPayload.UserID,
+	}); err != nil {
+		return mapError(err)
+	}
+
+	return eCtx.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,22 @@
+package account
+
+import (
+	apiErr "apart-deal-api/pkg/api/aspects/errors"
+	accountDomain "apart-deal-api/pkg/domain/account"
+)
+
+func mapError(err error) error {
+	if _, ok := err.(*accountDomain.AccountNotFound); ok {
+		return apiErr.NewNotFoundError("Account not found")
+	}
+
+	if _, ok := err.(*accountDomain.EmailTakenError); ok {
+		return apiErr.NewConflictError("Email of the account is used by another user")
+	}
+
+	if _, ok := err.(*accountDomain.SelfDeletionError); ok {
+		return apiErr.NewSimpleValidationInputError("Admins can't delete their own account", "self_deletion")
+	}
+
+	return err
+}
@@ -0,0 +1,27 @@
+package account
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	accountDomain "apart-deal-api/pkg/domain/account"
+)
+
+type RestoreAccountHandler struct {
+	accountSvc *accountDomain.AccountService
+}
+
+func NewRestoreAccountHandler(accountSvc *accountDomain.AccountService) *RestoreAccountHandler {
+	return &RestoreAccountHandler{
+		accountSvc: accountSvc,
+	}
+}
+
+func (h *RestoreAccountHandler) Handle(eCtx echo.Context) error {
+	if err := h.accountSvc.Restore(eCtx.Request().Context(), eCtx.Param("uid")); err != nil {
+		return mapError(err)
+	}
+
+	return eCtx.NoContent(http.StatusNoContent)
+}
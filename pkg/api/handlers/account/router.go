@@ -0,0 +1,21 @@
+package account
+
+import (
+	"apart-deal-api/pkg/api/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+type RouteGroup *echo.Group
+
+// RegisterDeleteAccountRoute and RegisterRestoreAccountRoute ask the admin for a recent
+// authentication
+func RegisterDeleteAccountRoute(g RouteGroup, deleteHandler *DeleteAccountHandler, stepUp auth.StepUpRequirement) {
+	v := *g
+	v.DELETE("/:uid", deleteHandler.Handle, auth.NewStepUpMiddleware(stepUp))
+}
+
+func RegisterRestoreAccountRoute(g RouteGroup, restoreHandler *RestoreAccountHandler, stepUp auth.StepUpRequirement) {
+	v := *g
+	v.POST("/:uid/restore", restoreHandler.Handle, auth.NewStepUpMiddleware(stepUp))
+}
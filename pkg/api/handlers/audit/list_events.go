@@ -0,0 +1,114 @@
+package audit
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	apiErr "apart-deal-api/pkg/api/aspects/errors"
+	auditDomain "apart-deal-api/pkg/domain/audit"
+	auditStore "apart-deal-api/pkg/store/audit"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	oas "gitlab.com/apart-deals/openapi/go/api"
+)
+
+type listAuditEventsQuery struct {
+	Type    string `query:"type"`
+	UserUID string `query:"userUid"`
+	Email   string `query:"email"`
+	Outcome string `query:"outcome"`
+	From    string `query:"from"`
+	To      string `query:"to"`
+	Page    int    `query:"page"`
+	PerPage int    `query:"perPage"`
+}
+
+func validateListAuditEvents(query *listAuditEventsQuery) error {
+	return validation.ValidateStruct(
+		query,
+		validation.Field(&query.Outcome, validation.In(string(auditStore.OutcomeSuccess), string(auditStore.OutcomeFailure))),
+		validation.Field(&query.From, validation.Date(time.RFC3339)),
+		validation.Field(&query.To, validation.Date(time.RFC3339)),
+		validation.Field(&query.Page, validation.Min(0)),
+		validation.Field(&query.PerPage, validation.Min(0), validation.Max(auditDomain.MaxPerPage)),
+	)
+}
+
+type ListAuditEventsHandler struct {
+	auditSvc *auditDomain.AuditService
+}
+
+func NewListAuditEventsHandler(auditSvc *auditDomain.AuditService) *ListAuditEventsHandler {
+	return &ListAuditEventsHandler{
+		auditSvc: auditSvc,
+	}
+}
+
+func (h *ListAuditEventsHandler) Handle(eCtx echo.Context) error {
+	query := listAuditEventsQuery{}
+
+	if err := eCtx.Bind(&query); err != nil {
+		return err
+	}
+
+	if err := validateListAuditEvents(&query); err != nil {
+		return apiErr.NewMultipleValidationInputError(err)
+	}
+
+	filter := auditStore.EventFilter{
+		Type:    auditStore.EventType(query.Type),
+		UserUID: query.UserUID,
+		Email:   query.Email,
+		Outcome: auditStore.Outcome(query.Outcome),
+		From:    parseTime(query.From),
+		To:      parseTime(query.To),
+	}
+
+	result, err := h.auditSvc.Query(eCtx.Request().Context(), auditDomain.QueryInput{
+		Filter:  filter,
+		Page:    query.Page,
+		PerPage: query.PerPage,
+	})
+	if err != nil {
+		return err
+	}
+
+	items := make([]oas.AuditEvent, 0, len(result.Events))
+	for _, e := range result.Events {
+		items = append(items, oas.AuditEvent{
+			Uid:       e.UID,
+			Type:      string(e.Type),
+			UserUid:   e.UserUID,
+			Email:     e.Email,
+			Ip:        e.IP,
+			UserAgent: e.UserAgent,
+			TraceId:   e.TraceID,
+			Outcome:   string(e.Outcome),
+			Reason:    e.Reason,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+
+	return eCtx.JSON(http.StatusOK, oas.AuditEventPage{
+		Items:   items,
+		Total:   result.Total,
+		Page:    int32(result.Page),
+		PerPage: int32(result.PerPage),
+	})
+}
+
+// parseTime expects a value which already passed validation
+func parseTime(value string) *time.Time {
+	if value == "" {
+		return nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil
+	}
+
+	return &t
+}
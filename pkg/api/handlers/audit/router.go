@@ -0,0 +1,12 @@
+package audit
+
+import (
+	"github.com/labstack/echo/v4"
+)
+
+type RouteGroup *echo.Group
+
+func RegisterListAuditEventsRoute(g RouteGroup, listHandler *ListAuditEventsHandler) {
+	v := *g
+	v.GET("/events", listHandler.Handle)
+}
@@ -2,10 +2,13 @@ package auth
 
 import (
 	"apart-deal-api/pkg/api/auth"
+	"apart-deal-api/pkg/security"
 	"apart-deal-api/pkg/store/user"
 
 	apiErr "apart-deal-api/pkg/api/aspects/errors"
 	authDomain "apart-deal-api/pkg/domain/auth"
+	deviceDomain "apart-deal-api/pkg/domain/device"
+	orgDomain "apart-deal-api/pkg/domain/organization"
 )
 
 func mapError(err error) error {
@@ -13,6 +16,10 @@ func mapError(err error) error {
 		return apiErr.NewConflictError("Such user already exists")
 	}
 
+	if domainErr, ok := err.(*authDomain.EmailDomainRejectedError); ok {
+		return mapEmailDomainError(domainErr)
+	}
+
 	if _, ok := err.(*auth.InvalidPasswordError); ok {
 		return apiErr.NewUnauthorizedError("invalid_password")
 	}
@@ -37,9 +44,71 @@ func mapError(err error) error {
 		)
 	}
 
+	if _, ok := err.(*authDomain.ConfirmationAttemptsExceededError); ok {
+		return apiErr.NewSimpleValidationInputError(
+			"Too many wrong codes, request a new one",
+			"attempts_exceeded",
+		)
+	}
+
+	if cooldownErr, ok := err.(*authDomain.ResendCooldownError); ok {
+		return apiErr.NewTooManyRequestsError("Code was sent recently", "resend_cooldown", cooldownErr.RetryAfter)
+	}
+
+	if limitErr, ok := err.(*authDomain.ResendLimitExceededError); ok {
+		return apiErr.NewTooManyRequestsError("Too many codes requested today", "resend_limit", limitErr.RetryAfter)
+	}
+
+	if _, ok := err.(*auth.InvalidCredentialsError); ok {
+		return apiErr.NewUnauthorizedError("invalid_credentials")
+	}
+
+	if _, ok := err.(*auth.TokenInvalidError); ok {
+		return apiErr.NewUnauthorizedError("invalid_token")
+	}
+
+	if _, ok := err.(*auth.PasswordResetRequiredError); ok {
+		return apiErr.NewUnauthorizedError("password_reset_required")
+	}
+
+	if _, ok := err.(*authDomain.PasswordResetNotFound); ok {
+		return apiErr.NewSimpleValidationInputError("Password reset request not found", "reset_not_found")
+	}
+
+	if _, ok := err.(*authDomain.PasswordResetExpiredError); ok {
+		return apiErr.NewSimpleValidationInputError("Password reset request has expired", "reset_expired")
+	}
+
+	if _, ok := err.(*deviceDomain.DeviceNotFound); ok {
+		return apiErr.NewNotFoundError("Device not found")
+	}
+
 	if _, ok := err.(*auth.UserNotConfirmedError); ok {
 		return apiErr.NewUnauthorizedError("not_confirmed")
 	}
 
+	if _, ok := err.(*orgDomain.InvitationNotFound); ok {
+		return apiErr.NewSimpleValidationInputError("Invitation not found", "invitation_not_found")
+	}
+
+	if _, ok := err.(*orgDomain.InvitationExpiredError); ok {
+		return apiErr.NewSimpleValidationInputError("Invitation has expired", "invitation_expired")
+	}
+
+	if _, ok := err.(*orgDomain.InvitationEmailMismatchError); ok {
+		return apiErr.NewSimpleValidationInputError("Invitation was issued for another email", "invitation_email_mismatch")
+	}
+
 	return err
 }
+
+func mapEmailDomainError(err *authDomain.EmailDomainRejectedError) error {
+	switch err.Reason {
+	case security.EmailDomainDisposable:
+		return apiErr.NewSimpleValidationInputError("Disposable email addresses are not accepted", "email_domain_disposable")
+	case security.EmailDomainDenied:
+		return apiErr.NewSimpleValidationInputError("Email domain is not accepted", "email_domain_denied")
+	default:
+		return apiErr.NewSimpleValidationInputError("Email domain is not allowed", "email_domain_not_allowed")
+	}
+}
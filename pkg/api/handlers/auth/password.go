@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"errors"
+
+	"apart-deal-api/pkg/security"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// passwordPolicyRule reports every policy violation as a nested validation error,
+// so the response carries one entry per violation, e.g. "password.too_short"
+func passwordPolicyRule(policy *security.PasswordPolicy) validation.Rule {
+	return validation.By(func(value interface{}) error {
+		password, _ := value.(string)
+
+		violations := policy.Check(password)
+		if len(violations) == 0 {
+			return nil
+		}
+
+		errs := validation.Errors{}
+		for _, v := range violations {
+			errs[v.Code] = errors.New(v.Message)
+		}
+
+		return errs
+	})
+}
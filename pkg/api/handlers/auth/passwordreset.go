@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"net/http"
+
+	"apart-deal-api/pkg/api/aspects/errors"
+	"apart-deal-api/pkg/security"
+
+	"github.com/labstack/echo/v4"
+
+	authDomain "apart-deal-api/pkg/domain/auth"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	oas "gitlab.com/apart-deals/openapi/go/api"
+)
+
+func validatePasswordReset(input *oas.ResetPassword, policy *security.PasswordPolicy) error {
+	return validation.ValidateStruct(
+		input,
+		validation.Field(&input.Token, validation.Required),
+		validation.Field(&input.Password, validation.Required, passwordPolicyRule(policy)),
+	)
+}
+
+type PasswordResetHandler struct {
+	passwordResetSvc *authDomain.PasswordResetService
+	passwordPolicy   *security.PasswordPolicy
+}
+
+func NewPasswordResetHandler(
+	passwordResetSvc *authDomain.PasswordResetService,
+	passwordPolicy *security.PasswordPolicy,
+) *PasswordResetHandler {
+	return &PasswordResetHandler{
+		passwordResetSvc: passwordResetSvc,
+		passwordPolicy:   passwordPolicy,
+	}
+}
+
+func (h *PasswordResetHandler) Handle(eCtx echo.Context) error {
+	payload := oas.ResetPassword{}
+
+	if err := eCtx.Bind(&payload); err != nil {
+		return err
+	}
+
+	if err := validatePasswordReset(&payload, h.passwordPolicy); err != nil {
+		return errors.NewMultipleValidationInputError(err)
+	}
+
+	if err := h.passwordResetSvc.Reset(eCtx.Request().Context(), authDomain.PasswordResetInput{
+		Token:    payload.Token,
+		Password: payload.Password,
+	}); err != nil {
+		return mapError(err)
+	}
+
+	return eCtx.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"net/http"
+
+	"apart-deal-api/pkg/api/auth"
+	"apart-deal-api/pkg/security"
+
+	"github.com/labstack/echo/v4"
+
+	apiErr "apart-deal-api/pkg/api/aspects/errors"
+	validation "github.com/go-ozzo/ozzo-validation"
+	oas "gitlab.com/apart-deals/openapi/go/api"
+)
+
+func validateReauthenticate(payload *oas.Reauthenticate) error {
+	return validation.ValidateStruct(
+		payload,
+		validation.Field(&payload.Password, validation.Required, validation.Length(1, security.MaxAcceptedPasswordLength)),
+	)
+}
+
+// ReauthenticateHandler exchanges the current token for one with a fresh auth_time,
+// see auth.NewStepUpMiddleware. A cookie session is refreshed in place.
+type ReauthenticateHandler struct {
+	authSvc    *auth.AuthenticationService
+	sessionSvc *auth.SessionService
+}
+
+func NewReauthenticateHandler(authSvc *auth.AuthenticationService, sessionSvc *auth.SessionService) *ReauthenticateHandler {
+	return &ReauthenticateHandler{
+		authSvc:    authSvc,
+		sessionSvc: sessionSvc,
+	}
+}
+
+func (h *ReauthenticateHandler) Handle(eCtx echo.Context) error {
+	payload := &oas.Reauthenticate{}
+
+	if err := eCtx.Bind(payload); err != nil {
+		return err
+	}
+
+	if err := validateReauthenticate(payload); err != nil {
+		return apiErr.NewMultipleValidationInputError(err)
+	}
+
+	ctx := eCtx.Request().Context()
+
+	tokenPayload, err := h.authSvc.Reauthenticate(ctx, auth.PayloadFromContext(eCtx), payload.Password)
+	if err != nil {
+		return mapError(err)
+	}
+
+	if session := auth.SessionFromContext(eCtx); session != nil {
+		if err := h.sessionSvc.SaveAuthentication(ctx, session, tokenPayload.AuthTime, tokenPayload.AMR); err != nil {
+			return err
+		}
+
+		return eCtx.NoContent(http.StatusNoContent)
+	}
+
+	tokenString, err := h.authSvc.Sign(*tokenPayload)
+	if err != nil {
+		return err
+	}
+
+	return eCtx.JSON(http.StatusOK, oas.SignedIn{
+		Token: tokenString,
+	})
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"net/http"
+
+	"apart-deal-api/pkg/api/aspects/errors"
+
+	"github.com/labstack/echo/v4"
+
+	deviceDomain "apart-deal-api/pkg/domain/device"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	oas "gitlab.com/apart-deals/openapi/go/api"
+)
+
+func validateReportDevice(input *oas.ReportDevice) error {
+	return validation.ValidateStruct(
+		input,
+		validation.Field(&input.Token, validation.Required),
+	)
+}
+
+// ReportDeviceHandler serves the "this wasn't me" link of new device emails
+type ReportDeviceHandler struct {
+	deviceSvc *deviceDomain.DeviceService
+}
+
+func NewReportDeviceHandler(deviceSvc *deviceDomain.DeviceService) *ReportDeviceHandler {
+	return &ReportDeviceHandler{
+		deviceSvc: deviceSvc,
+	}
+}
+
+func (h *ReportDeviceHandler) Handle(eCtx echo.Context) error {
+	payload := oas.ReportDevice{}
+
+	if err := eCtx.Bind(&payload); err != nil {
+		return err
+	}
+
+	if err := validateReportDevice(&payload); err != nil {
+		return errors.NewMultipleValidationInputError(err)
+	}
+
+	if err := h.deviceSvc.Report(eCtx.Request().Context(), deviceDomain.ReportDeviceInput{
+		Token: payload.Token,
+	}); err != nil {
+		return mapError(err)
+	}
+
+	return eCtx.NoContent(http.StatusNoContent)
+}
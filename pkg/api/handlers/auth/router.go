@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"apart-deal-api/pkg/api/auth"
+
 	"github.com/labstack/echo/v4"
 )
 
@@ -16,7 +18,44 @@ func RegisterSignUpConfirmRoute(g RouteGroup, signUpConfirmHandler *SignUpConfir
 	v.POST("/sign-up-confirm", signUpConfirmHandler.Handle)
 }
 
+func RegisterSignUpResendRoute(g RouteGroup, signUpResendHandler *SignUpResendHandler) {
+	v := *g
+	v.POST("/sign-up-resend", signUpResendHandler.Handle)
+}
+
 func RegisterSignInRoute(g RouteGroup, signInHandler *SignInHandler) {
 	v := *g
 	v.POST("/sign-in", signInHandler.Handle)
 }
+
+func RegisterReportDeviceRoute(g RouteGroup, reportDeviceHandler *ReportDeviceHandler) {
+	v := *g
+	v.POST("/not-me", reportDeviceHandler.Handle)
+}
+
+func RegisterPasswordResetRoute(g RouteGroup, passwordResetHandler *PasswordResetHandler) {
+	v := *g
+	v.POST("/password-reset", passwordResetHandler.Handle)
+}
+
+// RegisterReauthenticateRoute and RegisterSignOutRoute are the only routes of the group
+// which need a token or a session
+func RegisterReauthenticateRoute(
+	g RouteGroup,
+	reauthenticateHandler *ReauthenticateHandler,
+	authSvc *auth.AuthenticationService,
+	sessionSvc *auth.SessionService,
+) {
+	v := *g
+	v.POST("/reauthenticate", reauthenticateHandler.Handle, auth.NewAuthMiddleware(authSvc, sessionSvc))
+}
+
+func RegisterSignOutRoute(
+	g RouteGroup,
+	signOutHandler *SignOutHandler,
+	authSvc *auth.AuthenticationService,
+	sessionSvc *auth.SessionService,
+) {
+	v := *g
+	v.POST("/sign-out", signOutHandler.Handle, auth.NewAuthMiddleware(authSvc, sessionSvc))
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"apart-deal-api/pkg/api/auth"
+	"apart-deal-api/pkg/security"
 
 	"github.com/go-ozzo/ozzo-validation/is"
 	"github.com/labstack/echo/v4"
@@ -17,17 +18,20 @@ func validateSignIn(payload *oas.SignIn) error {
 	return validation.ValidateStruct(
 		payload,
 		validation.Field(&payload.Email, validation.Required, is.Email, validation.Length(3, 50)),
-		validation.Field(&payload.Password, validation.Required, validation.Length(4, 10)),
+		// the policy is not checked here, passwords set under an older policy must keep working
+		validation.Field(&payload.Password, validation.Required, validation.Length(1, security.MaxAcceptedPasswordLength)),
 	)
 }
 
 type SignInHandler struct {
-	authSvc *auth.AuthenticationService
+	authSvc    *auth.AuthenticationService
+	sessionSvc *auth.SessionService
 }
 
-func NewSignInHandler(authSvc *auth.AuthenticationService) *SignInHandler {
+func NewSignInHandler(authSvc *auth.AuthenticationService, sessionSvc *auth.SessionService) *SignInHandler {
 	return &SignInHandler{
-		authSvc: authSvc,
+		authSvc:    authSvc,
+		sessionSvc: sessionSvc,
 	}
 }
 
@@ -42,11 +46,32 @@ func (h *SignInHandler) Handle(eCtx echo.Context) error {
 		return apiErr.NewMultipleValidationInputError(err)
 	}
 
-	tokenString, err := h.authSvc.Auth(eCtx.Request().Context(), payload)
+	ctx := eCtx.Request().Context()
+
+	tokenPayload, err := h.authSvc.Authenticate(ctx, payload)
 	if err != nil {
 		return mapError(err)
 	}
 
+	if payload.UseCookie {
+		started, err := h.sessionSvc.Start(ctx, *tokenPayload)
+		if err != nil {
+			return err
+		}
+
+		h.sessionSvc.SetCookies(eCtx, started)
+
+		return eCtx.JSON(http.StatusOK, oas.SessionStarted{
+			CsrfToken: started.CSRFToken,
+			ExpiresAt: started.ExpiresAt,
+		})
+	}
+
+	tokenString, err := h.authSvc.Sign(*tokenPayload)
+	if err != nil {
+		return err
+	}
+
 	return eCtx.JSON(http.StatusOK, oas.SignedIn{
 		Token: tokenString,
 	})
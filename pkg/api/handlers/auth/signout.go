@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"net/http"
+
+	"apart-deal-api/pkg/api/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SignOutHandler ends the cookie session, bearer tokens simply expire
+type SignOutHandler struct {
+	sessionSvc *auth.SessionService
+}
+
+func NewSignOutHandler(sessionSvc *auth.SessionService) *SignOutHandler {
+	return &SignOutHandler{
+		sessionSvc: sessionSvc,
+	}
+}
+
+func (h *SignOutHandler) Handle(eCtx echo.Context) error {
+	session := auth.SessionFromContext(eCtx)
+	if session == nil {
+		return eCtx.NoContent(http.StatusNoContent)
+	}
+
+	if err := h.sessionSvc.End(eCtx.Request().Context(), session); err != nil {
+		return err
+	}
+
+	h.sessionSvc.ClearCookies(eCtx)
+
+	return eCtx.NoContent(http.StatusNoContent)
+}
@@ -3,6 +3,8 @@ package auth
 import (
 	"net/http"
 
+	"apart-deal-api/pkg/security"
+
 	"github.com/go-ozzo/ozzo-validation/is"
 	"github.com/labstack/echo/v4"
 
@@ -13,22 +15,24 @@ import (
 	oas "gitlab.com/apart-deals/openapi/go/api"
 )
 
-func validateSignUp(payload *oas.SignUp) error {
+func validateSignUp(payload *oas.SignUp, policy *security.PasswordPolicy) error {
 	return validation.ValidateStruct(
 		payload,
 		validation.Field(&payload.Name, validation.Required, validation.Length(2, 50)),
 		validation.Field(&payload.Email, validation.Required, is.Email, validation.Length(3, 50)),
-		validation.Field(&payload.Password, validation.Required, validation.Length(4, 10)),
+		validation.Field(&payload.Password, validation.Required, passwordPolicyRule(policy)),
 	)
 }
 
 type SignUpHandler struct {
-	signUpSvc *authDomain.SignUpService
+	signUpSvc      *authDomain.SignUpService
+	passwordPolicy *security.PasswordPolicy
 }
 
-func NewSignUpHandler(signUpSvc *authDomain.SignUpService) *SignUpHandler {
+func NewSignUpHandler(signUpSvc *authDomain.SignUpService, passwordPolicy *security.PasswordPolicy) *SignUpHandler {
 	return &SignUpHandler{
-		signUpSvc: signUpSvc,
+		signUpSvc:      signUpSvc,
+		passwordPolicy: passwordPolicy,
 	}
 }
 
@@ -39,7 +43,7 @@ func (h *SignUpHandler) Handle(eCtx echo.Context) error {
 		return err
 	}
 
-	if err := validateSignUp(&payload); err != nil {
+	if err := validateSignUp(&payload, h.passwordPolicy); err != nil {
 		return apiErr.NewMultipleValidationInputError(err)
 	}
 
@@ -49,6 +53,8 @@ func (h *SignUpHandler) Handle(eCtx echo.Context) error {
 		Email:    payload.Email,
 		Name:     payload.Name,
 		Password: payload.Password,
+
+		InvitationToken: payload.InvitationToken,
 	})
 	if err != nil {
 		return mapError(err)
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"net/http"
+
+	"apart-deal-api/pkg/api/aspects/errors"
+
+	"github.com/labstack/echo/v4"
+
+	authDomain "apart-deal-api/pkg/domain/auth"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	oas "gitlab.com/apart-deals/openapi/go/api"
+)
+
+func validateSignUpResend(input *oas.ResendSignUp) error {
+	return validation.ValidateStruct(
+		input,
+		validation.Field(&input.Token, validation.Required),
+	)
+}
+
+type SignUpResendHandler struct {
+	resendSvc *authDomain.ResendSignUpCodeService
+}
+
+func NewSignUpResendHandler(resendSvc *authDomain.ResendSignUpCodeService) *SignUpResendHandler {
+	return &SignUpResendHandler{
+		resendSvc: resendSvc,
+	}
+}
+
+func (h *SignUpResendHandler) Handle(eCtx echo.Context) error {
+	payload := oas.ResendSignUp{}
+
+	if err := eCtx.Bind(&payload); err != nil {
+		return err
+	}
+
+	if err := validateSignUpResend(&payload); err != nil {
+		return errors.NewMultipleValidationInputError(err)
+	}
+
+	if err := h.resendSvc.Resend(eCtx.Request().Context(), authDomain.ResendSignUpCodeInput{
+		Token: payload.Token,
+	}); err != nil {
+		return mapError(err)
+	}
+
+	return eCtx.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,30 @@
+package challenge
+
+import (
+	apiErr "apart-deal-api/pkg/api/aspects/errors"
+	challengeDomain "apart-deal-api/pkg/domain/challenge"
+)
+
+func mapError(err error) error {
+	if _, ok := err.(*challengeDomain.ChallengeNotFound); ok {
+		return apiErr.NewNotFoundError("Challenge not found")
+	}
+
+	if _, ok := err.(*challengeDomain.ChallengeExpiredError); ok {
+		return apiErr.NewSimpleValidationInputError("Challenge has expired", "challenge_expired")
+	}
+
+	if _, ok := err.(*challengeDomain.SolutionInvalidError); ok {
+		return apiErr.NewSimpleValidationInputError("Solution is invalid", "solution_invalid")
+	}
+
+	if _, ok := err.(*challengeDomain.ChallengeRequiredError); ok {
+		return apiErr.NewUnauthorizedError("challenge_required")
+	}
+
+	if _, ok := err.(*challengeDomain.ChallengeFailedError); ok {
+		return apiErr.NewUnauthorizedError("challenge_failed")
+	}
+
+	return err
+}
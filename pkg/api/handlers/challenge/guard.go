@@ -0,0 +1,78 @@
+package challenge
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+
+	challengeDomain "apart-deal-api/pkg/domain/challenge"
+)
+
+const (
+	ResponseHeader = "X-Challenge-Response"
+)
+
+// Guard requires a challenge response on the configured routes, they're matched by
+// their full path, e.g. "/api/v1/auth/sign-up"
+type Guard struct {
+	verifier challengeDomain.Verifier
+	routes   map[string]struct{}
+}
+
+func NewGuard(verifier challengeDomain.Verifier, routes []string) *Guard {
+	set := make(map[string]struct{}, len(routes))
+	for _, route := range routes {
+		set[route] = struct{}{}
+	}
+
+	return &Guard{
+		verifier: verifier,
+		routes:   set,
+	}
+}
+
+// CheckRoutes fails when a configured route isn't one of the registered ones, a typo would
+// leave the route unprotected
+func (g *Guard) CheckRoutes(registered []*echo.Route) error {
+	known := make(map[string]struct{}, len(registered))
+	for _, route := range registered {
+		known[route.Path] = struct{}{}
+	}
+
+	var unknown []string
+
+	for route := range g.routes {
+		if _, ok := known[route]; !ok {
+			unknown = append(unknown, route)
+		}
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+
+		return errors.Errorf("Unknown challenge routes: %s", strings.Join(unknown, ", "))
+	}
+
+	return nil
+}
+
+// Middleware has to be attached to the route group on creation, so that the routes are
+// already matched when it runs
+func (g *Guard) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if _, ok := g.routes[c.Path()]; !ok {
+				return next(c)
+			}
+
+			response := c.Request().Header.Get(ResponseHeader)
+			if err := g.verifier.Verify(c.Request().Context(), response, c.RealIP()); err != nil {
+				return mapError(err)
+			}
+
+			return next(c)
+		}
+	}
+}
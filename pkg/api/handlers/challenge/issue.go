@@ -0,0 +1,39 @@
+package challenge
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	challengeDomain "apart-deal-api/pkg/domain/challenge"
+
+	oas "gitlab.com/apart-deals/openapi/go/api"
+)
+
+const (
+	algorithmSha256 = "sha256"
+)
+
+type IssueChallengeHandler struct {
+	powSvc *challengeDomain.ProofOfWorkService
+}
+
+func NewIssueChallengeHandler(powSvc *challengeDomain.ProofOfWorkService) *IssueChallengeHandler {
+	return &IssueChallengeHandler{
+		powSvc: powSvc,
+	}
+}
+
+func (h *IssueChallengeHandler) Handle(eCtx echo.Context) error {
+	model, err := h.powSvc.Issue(eCtx.Request().Context())
+	if err != nil {
+		return mapError(err)
+	}
+
+	return eCtx.JSON(http.StatusOK, oas.Challenge{
+		Uid:        model.UID,
+		Algorithm:  algorithmSha256,
+		Difficulty: int32(model.Difficulty),
+		ExpiresAt:  model.ExpiresAt,
+	})
+}
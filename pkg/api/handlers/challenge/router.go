@@ -0,0 +1,17 @@
+package challenge
+
+import (
+	"github.com/labstack/echo/v4"
+)
+
+type RouteGroup *echo.Group
+
+func RegisterIssueChallengeRoute(g RouteGroup, issueHandler *IssueChallengeHandler) {
+	v := *g
+	v.POST("", issueHandler.Handle)
+}
+
+func RegisterVerifyChallengeRoute(g RouteGroup, verifyHandler *VerifyChallengeHandler) {
+	v := *g
+	v.POST("/verify", verifyHandler.Handle)
+}
@@ -0,0 +1,55 @@
+package challenge
+
+import (
+	"net/http"
+
+	"apart-deal-api/pkg/api/aspects/errors"
+
+	"github.com/labstack/echo/v4"
+
+	challengeDomain "apart-deal-api/pkg/domain/challenge"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	oas "gitlab.com/apart-deals/openapi/go/api"
+)
+
+func validateChallengeSolution(input *oas.ChallengeSolution) error {
+	return validation.ValidateStruct(
+		input,
+		validation.Field(&input.Uid, validation.Required),
+		validation.Field(&input.Nonce, validation.Required, validation.Length(1, 64)),
+	)
+}
+
+// VerifyChallengeHandler accepts a proof-of-work solution, the challenge uid can then be
+// sent in the ResponseHeader of a protected request
+type VerifyChallengeHandler struct {
+	powSvc *challengeDomain.ProofOfWorkService
+}
+
+func NewVerifyChallengeHandler(powSvc *challengeDomain.ProofOfWorkService) *VerifyChallengeHandler {
+	return &VerifyChallengeHandler{
+		powSvc: powSvc,
+	}
+}
+
+func (h *VerifyChallengeHandler) Handle(eCtx echo.Context) error {
+	payload := oas.ChallengeSolution{}
+
+	if err := eCtx.Bind(&payload); err != nil {
+		return err
+	}
+
+	if err := validateChallengeSolution(&payload); err != nil {
+		return errors.NewMultipleValidationInputError(err)
+	}
+
+	if err := h.powSvc.Solve(eCtx.Request().Context(), challengeDomain.SolveInput{
+		UID:   payload.Uid,
+		Nonce: payload.Nonce,
+	}); err != nil {
+		return mapError(err)
+	}
+
+	return eCtx.NoContent(http.StatusNoContent)
+}
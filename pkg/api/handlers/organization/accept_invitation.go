@@ -0,0 +1,71 @@
+package organization
+
+import (
+	"net/http"
+
+	"apart-deal-api/pkg/api/auth"
+
+	"github.com/labstack/echo/v4"
+
+	apiErr "apart-deal-api/pkg/api/aspects/errors"
+	orgDomain "apart-deal-api/pkg/domain/organization"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	oas "gitlab.com/apart-deals/openapi/go/api"
+)
+
+func validateAcceptInvitation(payload *oas.AcceptInvitation) error {
+	return validation.ValidateStruct(
+		payload,
+		validation.Field(&payload.Token, validation.Required),
+	)
+}
+
+type AcceptInvitationHandler struct {
+	invitationSvc *orgDomain.InvitationService
+	orgSvc        *orgDomain.OrganizationService
+}
+
+func NewAcceptInvitationHandler(
+	invitationSvc *orgDomain.InvitationService,
+	orgSvc *orgDomain.OrganizationService,
+) *AcceptInvitationHandler {
+	return &AcceptInvitationHandler{
+		invitationSvc: invitationSvc,
+		orgSvc:        orgSvc,
+	}
+}
+
+func (h *AcceptInvitationHandler) Handle(eCtx echo.Context) error {
+	payload := oas.AcceptInvitation{}
+
+	if err := eCtx.Bind(&payload); err != nil {
+		return err
+	}
+
+	if err := validateAcceptInvitation(&payload); err != nil {
+		return apiErr.NewMultipleValidationInputError(err)
+	}
+
+	tokenPayload := auth.PayloadFromContext(eCtx)
+	ctx := eCtx.Request().Context()
+
+	membership, err := h.invitationSvc.Accept(ctx, orgDomain.AcceptInvitationInput{
+		Token:   payload.Token,
+		UserUID: tokenPayload.UserID,
+	})
+	if err != nil {
+		return mapError(err)
+	}
+
+	org, err := h.orgSvc.FindForMember(ctx, membership.OrganizationUID, tokenPayload.UserID)
+	if err != nil {
+		return mapError(err)
+	}
+
+	return eCtx.JSON(http.StatusOK, oas.Organization{
+		Uid:  org.Organization.UID,
+		Name: org.Organization.Name,
+		Role: string(org.Role),
+	})
+}
@@ -0,0 +1,61 @@
+package organization
+
+import (
+	"net/http"
+
+	"apart-deal-api/pkg/api/auth"
+
+	"github.com/labstack/echo/v4"
+
+	apiErr "apart-deal-api/pkg/api/aspects/errors"
+	orgDomain "apart-deal-api/pkg/domain/organization"
+	orgStore "apart-deal-api/pkg/store/organization"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	oas "gitlab.com/apart-deals/openapi/go/api"
+)
+
+func validateCreateOrganization(payload *oas.CreateOrganization) error {
+	return validation.ValidateStruct(
+		payload,
+		validation.Field(&payload.Name, validation.Required, validation.Length(2, 100)),
+	)
+}
+
+type CreateOrganizationHandler struct {
+	orgSvc *orgDomain.OrganizationService
+}
+
+func NewCreateOrganizationHandler(orgSvc *orgDomain.OrganizationService) *CreateOrganizationHandler {
+	return &CreateOrganizationHandler{
+		orgSvc: orgSvc,
+	}
+}
+
+func (h *CreateOrganizationHandler) Handle(eCtx echo.Context) error {
+	payload := oas.CreateOrganization{}
+
+	if err := eCtx.Bind(&payload); err != nil {
+		return err
+	}
+
+	if err := validateCreateOrganization(&payload); err != nil {
+		return apiErr.NewMultipleValidationInputError(err)
+	}
+
+	tokenPayload := auth.PayloadFromContext(eCtx)
+
+	org, err := h.orgSvc.Create(eCtx.Request().Context(), orgDomain.CreateOrganizationInput{
+		Name:     payload.Name,
+		OwnerUID: tokenPayload.UserID,
+	})
+	if err != nil {
+		return mapError(err)
+	}
+
+	return eCtx.JSON(http.StatusCreated, oas.Organization{
+		Uid:  org.UID,
+		Name: org.Name,
+		Role: string(orgStore.RoleOwner),
+	})
+}
@@ -0,0 +1,38 @@
+package organization
+
+import (
+	apiErr "apart-deal-api/pkg/api/aspects/errors"
+	orgDomain "apart-deal-api/pkg/domain/organization"
+)
+
+func mapError(err error) error {
+	if _, ok := err.(*orgDomain.OrganizationNotFound); ok {
+		return apiErr.NewNotFoundError("Organization not found")
+	}
+
+	if _, ok := err.(*orgDomain.NotAMemberError); ok {
+		return apiErr.NewNotFoundError("Organization not found")
+	}
+
+	if _, ok := err.(*orgDomain.InsufficientRoleError); ok {
+		return apiErr.NewUnauthorizedError("insufficient_role")
+	}
+
+	if _, ok := err.(*orgDomain.AlreadyMemberError); ok {
+		return apiErr.NewConflictError("User is already a member of the organization")
+	}
+
+	if _, ok := err.(*orgDomain.InvitationNotFound); ok {
+		return apiErr.NewNotFoundError("Invitation not found")
+	}
+
+	if _, ok := err.(*orgDomain.InvitationExpiredError); ok {
+		return apiErr.NewSimpleValidationInputError("Invitation has expired", "invitation_expired")
+	}
+
+	if _, ok := err.(*orgDomain.InvitationEmailMismatchError); ok {
+		return apiErr.NewSimpleValidationInputError("Invitation was issued for another email", "invitation_email_mismatch")
+	}
+
+	return err
+}
@@ -0,0 +1,71 @@
+package organization
+
+import (
+	"net/http"
+
+	"apart-deal-api/pkg/api/auth"
+
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/labstack/echo/v4"
+
+	apiErr "apart-deal-api/pkg/api/aspects/errors"
+	orgDomain "apart-deal-api/pkg/domain/organization"
+	orgStore "apart-deal-api/pkg/store/organization"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	oas "gitlab.com/apart-deals/openapi/go/api"
+)
+
+func validateInviteMember(payload *oas.InviteMember) error {
+	roles := make([]interface{}, 0, len(orgStore.Roles))
+	for _, r := range orgStore.Roles {
+		roles = append(roles, string(r))
+	}
+
+	return validation.ValidateStruct(
+		payload,
+		validation.Field(&payload.Email, validation.Required, is.Email, validation.Length(3, 50)),
+		validation.Field(&payload.Role, validation.Required, validation.In(roles...)),
+	)
+}
+
+type InviteMemberHandler struct {
+	invitationSvc *orgDomain.InvitationService
+}
+
+func NewInviteMemberHandler(invitationSvc *orgDomain.InvitationService) *InviteMemberHandler {
+	return &InviteMemberHandler{
+		invitationSvc: invitationSvc,
+	}
+}
+
+func (h *InviteMemberHandler) Handle(eCtx echo.Context) error {
+	payload := oas.InviteMember{}
+
+	if err := eCtx.Bind(&payload); err != nil {
+		return err
+	}
+
+	if err := validateInviteMember(&payload); err != nil {
+		return apiErr.NewMultipleValidationInputError(err)
+	}
+
+	tokenPayload := auth.PayloadFromContext(eCtx)
+
+	invitation, err := h.invitationSvc.Invite(eCtx.Request().Context(), orgDomain.InviteMemberInput{
+		OrganizationUID: eCtx.Param("uid"),
+		InviterUID:      tokenPayload.UserID,
+		Email:           payload.Email,
+		Role:            orgStore.Role(payload.Role),
+	})
+	if err != nil {
+		return mapError(err)
+	}
+
+	return eCtx.JSON(http.StatusCreated, oas.Invitation{
+		Uid:       invitation.UID,
+		Email:     invitation.Email,
+		Role:      string(invitation.Role),
+		ExpiresAt: invitation.ExpiresAt,
+	})
+}
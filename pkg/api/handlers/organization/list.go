@@ -0,0 +1,43 @@
+package organization
+
+import (
+	"net/http"
+
+	"apart-deal-api/pkg/api/auth"
+
+	"github.com/labstack/echo/v4"
+
+	orgDomain "apart-deal-api/pkg/domain/organization"
+
+	oas "gitlab.com/apart-deals/openapi/go/api"
+)
+
+type ListOrganizationsHandler struct {
+	orgSvc *orgDomain.OrganizationService
+}
+
+func NewListOrganizationsHandler(orgSvc *orgDomain.OrganizationService) *ListOrganizationsHandler {
+	return &ListOrganizationsHandler{
+		orgSvc: orgSvc,
+	}
+}
+
+func (h *ListOrganizationsHandler) Handle(eCtx echo.Context) error {
+	tokenPayload := auth.PayloadFromContext(eCtx)
+
+	orgs, err := h.orgSvc.ListForUser(eCtx.Request().Context(), tokenPayload.UserID)
+	if err != nil {
+		return mapError(err)
+	}
+
+	res := make([]oas.Organization, 0, len(orgs))
+	for _, o := range orgs {
+		res = append(res, oas.Organization{
+			Uid:  o.Organization.UID,
+			Name: o.Organization.Name,
+			Role: string(o.Role),
+		})
+	}
+
+	return eCtx.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,35 @@
+package organization
+
+import (
+	"apart-deal-api/pkg/api/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+type RouteGroup *echo.Group
+
+func RegisterCreateOrganizationRoute(g RouteGroup, createHandler *CreateOrganizationHandler) {
+	v := *g
+	v.POST("", createHandler.Handle)
+}
+
+func RegisterListOrganizationsRoute(g RouteGroup, listHandler *ListOrganizationsHandler) {
+	v := *g
+	v.GET("", listHandler.Handle)
+}
+
+func RegisterSelectOrganizationRoute(g RouteGroup, selectHandler *SelectOrganizationHandler) {
+	v := *g
+	v.POST("/:uid/token", selectHandler.Handle)
+}
+
+// RegisterInviteMemberRoute asks for a recent authentication, invitations can grant any role
+func RegisterInviteMemberRoute(g RouteGroup, inviteHandler *InviteMemberHandler, stepUp auth.StepUpRequirement) {
+	v := *g
+	v.POST("/:uid/invitations", inviteHandler.Handle, auth.NewStepUpMiddleware(stepUp))
+}
+
+func RegisterAcceptInvitationRoute(g RouteGroup, acceptHandler *AcceptInvitationHandler) {
+	v := *g
+	v.POST("/invitations/accept", acceptHandler.Handle)
+}
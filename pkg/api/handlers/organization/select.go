@@ -0,0 +1,75 @@
+package organization
+
+import (
+	"net/http"
+
+	"apart-deal-api/pkg/api/auth"
+
+	"github.com/labstack/echo/v4"
+
+	orgDomain "apart-deal-api/pkg/domain/organization"
+
+	oas "gitlab.com/apart-deals/openapi/go/api"
+)
+
+// SelectOrganizationHandler issues a token which carries the chosen organization
+// and the user's role in it, a cookie session is updated in place instead
+type SelectOrganizationHandler struct {
+	orgSvc     *orgDomain.OrganizationService
+	authSvc    *auth.AuthenticationService
+	sessionSvc *auth.SessionService
+}
+
+func NewSelectOrganizationHandler(
+	orgSvc *orgDomain.OrganizationService,
+	authSvc *auth.AuthenticationService,
+	sessionSvc *auth.SessionService,
+) *SelectOrganizationHandler {
+	return &SelectOrganizationHandler{
+		orgSvc:     orgSvc,
+		authSvc:    authSvc,
+		sessionSvc: sessionSvc,
+	}
+}
+
+func (h *SelectOrganizationHandler) Handle(eCtx echo.Context) error {
+	tokenPayload := auth.PayloadFromContext(eCtx)
+
+	membership, err := h.orgSvc.FindMembership(eCtx.Request().Context(), eCtx.Param("uid"), tokenPayload.UserID)
+	if err != nil {
+		return mapError(err)
+	}
+
+	if session := auth.SessionFromContext(eCtx); session != nil {
+		if err := h.sessionSvc.SelectOrganization(
+			eCtx.Request().Context(),
+			session,
+			membership.OrganizationUID,
+			string(membership.Role),
+		); err != nil {
+			return err
+		}
+
+		return eCtx.NoContent(http.StatusNoContent)
+	}
+
+	tokenString, err := h.authSvc.Sign(auth.TokenPayload{
+		UserID:         tokenPayload.UserID,
+		Email:          tokenPayload.Email,
+		Name:           tokenPayload.Name,
+		Locale:         tokenPayload.Locale,
+		Zoneinfo:       tokenPayload.Zoneinfo,
+		OrganizationID: membership.OrganizationUID,
+		Role:           string(membership.Role),
+		Admin:          tokenPayload.Admin,
+		AuthTime:       tokenPayload.AuthTime,
+		AMR:            tokenPayload.AMR,
+	})
+	if err != nil {
+		return err
+	}
+
+	return eCtx.JSON(http.StatusOK, oas.SignedIn{
+		Token: tokenString,
+	})
+}
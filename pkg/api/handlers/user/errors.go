@@ -0,0 +1,18 @@
+package user
+
+import (
+	apiErr "apart-deal-api/pkg/api/aspects/errors"
+	profileDomain "apart-deal-api/pkg/domain/profile"
+)
+
+func mapError(err error) error {
+	if _, ok := err.(*profileDomain.ProfileNotFound); ok {
+		return apiErr.NewNotFoundError("User not found")
+	}
+
+	if _, ok := err.(*profileDomain.VersionConflictError); ok {
+		return apiErr.NewConflictError("Profile was updated in the meantime")
+	}
+
+	return err
+}
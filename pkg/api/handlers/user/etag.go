@@ -0,0 +1,62 @@
+package user
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	apiErr "apart-deal-api/pkg/api/aspects/errors"
+	userStore "apart-deal-api/pkg/store/user"
+)
+
+// echo has no constants for these headers
+const (
+	headerETag        = "ETag"
+	headerIfMatch     = "If-Match"
+	headerIfNoneMatch = "If-None-Match"
+)
+
+// etag of a user resource is the version of the user, it changes with every update of the
+// user and not only with the fields of the resource
+func etag(user *userStore.User) string {
+	return `"` + strconv.Itoa(user.Version) + `"`
+}
+
+// ifMatchVersion reads the version from the If-Match header, ok is false when the header
+// isn't set or is "*". Only a single strong ETag is accepted since the update is
+// conditional on exactly one version.
+func ifMatchVersion(eCtx echo.Context) (version int, ok bool, err error) {
+	header := strings.TrimSpace(eCtx.Request().Header.Get(headerIfMatch))
+	if header == "" || header == "*" {
+		return 0, false, nil
+	}
+
+	invalidErr := apiErr.NewSimpleValidationInputError("If-Match must be a single ETag of the resource", "if_match_invalid")
+
+	if len(header) < 2 || !strings.HasPrefix(header, `"`) || !strings.HasSuffix(header, `"`) {
+		return 0, false, invalidErr
+	}
+
+	version, err = strconv.Atoi(header[1 : len(header)-1])
+	if err != nil || version < 0 {
+		return 0, false, invalidErr
+	}
+
+	return version, true, nil
+}
+
+// notModified tells whether the client's copy, as named by If-None-Match, is current
+func notModified(eCtx echo.Context, user *userStore.User) bool {
+	current := etag(user)
+
+	for _, tag := range strings.Split(eCtx.Request().Header.Get(headerIfNoneMatch), ",") {
+		// weak comparison applies to If-None-Match
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == current || tag == "*" {
+			return true
+		}
+	}
+
+	return false
+}
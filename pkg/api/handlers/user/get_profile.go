@@ -0,0 +1,53 @@
+package user
+
+import (
+	"net/http"
+
+	"apart-deal-api/pkg/api/auth"
+
+	"github.com/labstack/echo/v4"
+
+	profileDomain "apart-deal-api/pkg/domain/profile"
+	userStore "apart-deal-api/pkg/store/user"
+
+	oas "gitlab.com/apart-deals/openapi/go/api"
+)
+
+type GetProfileHandler struct {
+	profileSvc *profileDomain.ProfileService
+}
+
+func NewGetProfileHandler(profileSvc *profileDomain.ProfileService) *GetProfileHandler {
+	return &GetProfileHandler{
+		profileSvc: profileSvc,
+	}
+}
+
+func (h *GetProfileHandler) Handle(eCtx echo.Context) error {
+	tokenPayload := auth.PayloadFromContext(eCtx)
+
+	user, err := h.profileSvc.Get(eCtx.Request().Context(), tokenPayload.UserID)
+	if err != nil {
+		return mapError(err)
+	}
+
+	eCtx.Response().Header().Set(headerETag, etag(user))
+
+	if notModified(eCtx, user) {
+		return eCtx.NoContent(http.StatusNotModified)
+	}
+
+	return eCtx.JSON(http.StatusOK, toProfile(user))
+}
+
+func toProfile(user *userStore.User) oas.Profile {
+	return oas.Profile{
+		Name:      user.Name,
+		Email:     user.Email,
+		Locale:    user.Locale,
+		Timezone:  user.Timezone,
+		AvatarUrl: user.AvatarURL,
+		Version:   int32(user.Version),
+		UpdatedAt: user.ProfileUpdatedAt,
+	}
+}
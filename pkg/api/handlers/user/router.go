@@ -0,0 +1,22 @@
+package user
+
+import (
+	"github.com/labstack/echo/v4"
+)
+
+type RouteGroup *echo.Group
+
+func RegisterGetProfileRoute(g RouteGroup, getHandler *GetProfileHandler) {
+	v := *g
+	v.GET("/me/profile", getHandler.Handle)
+}
+
+func RegisterUpdateProfileRoute(g RouteGroup, updateHandler *UpdateProfileHandler) {
+	v := *g
+	v.PATCH("/me/profile", updateHandler.Handle)
+}
+
+func RegisterUserInfoRoute(g RouteGroup, userInfoHandler *UserInfoHandler) {
+	v := *g
+	v.GET("/me/userinfo", userInfoHandler.Handle)
+}
@@ -0,0 +1,114 @@
+package user
+
+import (
+	"net/http"
+	"regexp"
+	"time"
+
+	"apart-deal-api/pkg/api/auth"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+
+	apiErr "apart-deal-api/pkg/api/aspects/errors"
+	profileDomain "apart-deal-api/pkg/domain/profile"
+	userStore "apart-deal-api/pkg/store/user"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+	oas "gitlab.com/apart-deals/openapi/go/api"
+
+	// time zones are validated against the embedded database, the image may not have one
+	_ "time/tzdata"
+)
+
+var (
+	// localeRegexp accepts BCP 47 language tags such as "en", "de-CH" or "zh-Hant-TW"
+	localeRegexp = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+	httpsRegexp  = regexp.MustCompile(`^https://`)
+)
+
+var timezoneRule = validation.By(func(value interface{}) error {
+	tz, _ := value.(*string)
+	if tz == nil || *tz == "" {
+		return nil
+	}
+
+	// "Local" is the time zone of the server, not a name the user could mean
+	if _, err := time.LoadLocation(*tz); err != nil || *tz == "Local" {
+		return errors.New("must be an IANA time zone")
+	}
+
+	return nil
+})
+
+func validateUpdateProfile(payload *oas.UpdateProfile) error {
+	return validation.ValidateStruct(
+		payload,
+		validation.Field(&payload.Version, validation.Min(0)),
+		validation.Field(&payload.Name, validation.NilOrNotEmpty, validation.Length(2, 50)),
+		validation.Field(&payload.Locale, validation.Length(2, 35), validation.Match(localeRegexp)),
+		validation.Field(&payload.Timezone, timezoneRule),
+		validation.Field(&payload.AvatarUrl, validation.Length(0, 2048), is.URL, validation.Match(httpsRegexp)),
+	)
+}
+
+// UpdateProfileHandler applies a partial update, the version read with the profile has
+// to be sent back and a stale one is rejected with a conflict. The ETag of the profile can
+// be sent in If-Match instead, a stale one is then rejected with 412.
+type UpdateProfileHandler struct {
+	profileSvc *profileDomain.ProfileService
+}
+
+func NewUpdateProfileHandler(profileSvc *profileDomain.ProfileService) *UpdateProfileHandler {
+	return &UpdateProfileHandler{
+		profileSvc: profileSvc,
+	}
+}
+
+func (h *UpdateProfileHandler) Handle(eCtx echo.Context) error {
+	payload := oas.UpdateProfile{}
+
+	if err := eCtx.Bind(&payload); err != nil {
+		return err
+	}
+
+	if err := validateUpdateProfile(&payload); err != nil {
+		return apiErr.NewMultipleValidationInputError(err)
+	}
+
+	version := int(payload.Version)
+
+	ifMatch, hasIfMatch, err := ifMatchVersion(eCtx)
+	if err != nil {
+		return err
+	}
+
+	if hasIfMatch {
+		version = ifMatch
+	}
+
+	tokenPayload := auth.PayloadFromContext(eCtx)
+
+	user, err := h.profileSvc.Update(eCtx.Request().Context(), profileDomain.UpdateProfileInput{
+		UserUID: tokenPayload.UserID,
+		Version: version,
+		Update: userStore.ProfileUpdate{
+			Name:      payload.Name,
+			Locale:    payload.Locale,
+			Timezone:  payload.Timezone,
+			AvatarURL: payload.AvatarUrl,
+		},
+	})
+	if err != nil {
+		if _, ok := err.(*profileDomain.VersionConflictError); ok && hasIfMatch {
+			return apiErr.NewPreconditionFailedError("Profile was updated in the meantime")
+		}
+
+		return mapError(err)
+	}
+
+	eCtx.Response().Header().Set(headerETag, etag(user))
+
+	return eCtx.JSON(http.StatusOK, toProfile(user))
+}
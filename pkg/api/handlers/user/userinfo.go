@@ -0,0 +1,53 @@
+package user
+
+import (
+	"net/http"
+
+	"apart-deal-api/pkg/api/auth"
+
+	"github.com/labstack/echo/v4"
+
+	profileDomain "apart-deal-api/pkg/domain/profile"
+	userStore "apart-deal-api/pkg/store/user"
+
+	oas "gitlab.com/apart-deals/openapi/go/api"
+)
+
+// UserInfoHandler returns the standard claims of OpenID Connect, read from the user
+// rather than from the token so that they are never stale
+type UserInfoHandler struct {
+	profileSvc *profileDomain.ProfileService
+}
+
+func NewUserInfoHandler(profileSvc *profileDomain.ProfileService) *UserInfoHandler {
+	return &UserInfoHandler{
+		profileSvc: profileSvc,
+	}
+}
+
+func (h *UserInfoHandler) Handle(eCtx echo.Context) error {
+	tokenPayload := auth.PayloadFromContext(eCtx)
+
+	user, err := h.profileSvc.Get(eCtx.Request().Context(), tokenPayload.UserID)
+	if err != nil {
+		return mapError(err)
+	}
+
+	eCtx.Response().Header().Set(headerETag, etag(user))
+
+	updatedAt := user.CreatedAt
+	if user.ProfileUpdatedAt != nil {
+		updatedAt = *user.ProfileUpdatedAt
+	}
+
+	return eCtx.JSON(http.StatusOK, oas.UserInfo{
+		Sub:           user.UID,
+		Email:         user.Email,
+		EmailVerified: user.Status == userStore.StatusConfirmed,
+		Name:          user.Name,
+		Locale:        user.Locale,
+		Zoneinfo:      user.Timezone,
+		Picture:       user.AvatarURL,
+		UpdatedAt:     updatedAt.Unix(),
+	})
+}
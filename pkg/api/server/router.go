@@ -2,11 +2,18 @@ package server
 
 import (
 	"apart-deal-api/pkg/api/aspects"
+	"apart-deal-api/pkg/api/handlers/account"
+	"apart-deal-api/pkg/api/handlers/audit"
 	"apart-deal-api/pkg/api/handlers/auth"
+	"apart-deal-api/pkg/api/handlers/challenge"
+	"apart-deal-api/pkg/api/handlers/organization"
+	"apart-deal-api/pkg/api/handlers/user"
 	"apart-deal-api/pkg/config"
 
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
+
+	apiAuth "apart-deal-api/pkg/api/auth"
 )
 
 func NewServer(logger *zap.Logger, cfg *config.Config) *echo.Echo {
@@ -14,6 +21,9 @@ func NewServer(logger *zap.Logger, cfg *config.Config) *echo.Echo {
 	e.HideBanner = true
 	e.HidePort = true
 	e.HTTPErrorHandler = aspects.NewErrorHandler(logger)
+	// client headers such as X-Forwarded-For are only trusted from the proxies configured
+	// with TRUSTED_PROXIES, see dependencies.NewIPExtractor
+	e.IPExtractor = echo.ExtractIPDirect()
 	e.Use(aspects.NewLoggingMiddleware(logger, &aspects.LoggingMiddlewareConfig{
 		IncludeRequestBodies:  cfg.IsDebug,
 		IncludeResponseBodies: cfg.IsDebug,
@@ -23,16 +33,80 @@ func NewServer(logger *zap.Logger, cfg *config.Config) *echo.Echo {
 	return e
 }
 
-func NewAuthRouteGroup(e *echo.Echo) auth.RouteGroup {
-	return e.Group("/api/v1/auth")
+func NewAuthRouteGroup(e *echo.Echo, guard *challenge.Guard) auth.RouteGroup {
+	return e.Group("/api/v1/auth", guard.Middleware())
+}
+
+func NewChallengeRouteGroup(e *echo.Echo) challenge.RouteGroup {
+	return e.Group("/api/v1/challenges")
+}
+
+func NewOrganizationRouteGroup(
+	e *echo.Echo,
+	authSvc *apiAuth.AuthenticationService,
+	sessionSvc *apiAuth.SessionService,
+) organization.RouteGroup {
+	return e.Group("/api/v1/organizations", apiAuth.NewAuthMiddleware(authSvc, sessionSvc))
+}
+
+// NewAuditRouteGroup is reserved to admins
+func NewAuditRouteGroup(
+	e *echo.Echo,
+	authSvc *apiAuth.AuthenticationService,
+	sessionSvc *apiAuth.SessionService,
+) audit.RouteGroup {
+	return e.Group("/api/v1/audit", apiAuth.NewAuthMiddleware(authSvc, sessionSvc), apiAuth.NewAdminMiddleware())
+}
+
+// NewAccountRouteGroup is reserved to admins
+func NewAccountRouteGroup(
+	e *echo.Echo,
+	authSvc *apiAuth.AuthenticationService,
+	sessionSvc *apiAuth.SessionService,
+) account.RouteGroup {
+	return e.Group("/api/v1/admin/users", apiAuth.NewAuthMiddleware(authSvc, sessionSvc), apiAuth.NewAdminMiddleware())
+}
+
+func NewUserRouteGroup(
+	e *echo.Echo,
+	authSvc *apiAuth.AuthenticationService,
+	sessionSvc *apiAuth.SessionService,
+) user.RouteGroup {
+	return e.Group("/api/v1/users", apiAuth.NewAuthMiddleware(authSvc, sessionSvc))
 }
 
 func RegisterRoutes(
 	e *echo.Echo,
 	authGroup auth.RouteGroup,
+	orgGroup organization.RouteGroup,
+	auditGroup audit.RouteGroup,
+	challengeGroup challenge.RouteGroup,
+	userGroup user.RouteGroup,
+	accountGroup account.RouteGroup,
 	signUpHandler *auth.SignUpHandler,
 	signUpConfirmHandler *auth.SignUpConfirmHandler,
+	signUpResendHandler *auth.SignUpResendHandler,
 	signInHandler *auth.SignInHandler,
+	reportDeviceHandler *auth.ReportDeviceHandler,
+	passwordResetHandler *auth.PasswordResetHandler,
+	reauthenticateHandler *auth.ReauthenticateHandler,
+	signOutHandler *auth.SignOutHandler,
+	authSvc *apiAuth.AuthenticationService,
+	sessionSvc *apiAuth.SessionService,
+	createOrgHandler *organization.CreateOrganizationHandler,
+	listOrgsHandler *organization.ListOrganizationsHandler,
+	selectOrgHandler *organization.SelectOrganizationHandler,
+	inviteMemberHandler *organization.InviteMemberHandler,
+	acceptInvitationHandler *organization.AcceptInvitationHandler,
+	listAuditEventsHandler *audit.ListAuditEventsHandler,
+	issueChallengeHandler *challenge.IssueChallengeHandler,
+	verifyChallengeHandler *challenge.VerifyChallengeHandler,
+	getProfileHandler *user.GetProfileHandler,
+	updateProfileHandler *user.UpdateProfileHandler,
+	userInfoHandler *user.UserInfoHandler,
+	deleteAccountHandler *account.DeleteAccountHandler,
+	restoreAccountHandler *account.RestoreAccountHandler,
+	stepUp apiAuth.StepUpRequirement,
 ) {
 	e.GET("ready", func(c echo.Context) error {
 		return c.String(200, "OK")
@@ -40,5 +114,28 @@ func RegisterRoutes(
 
 	auth.RegisterSignUpRoute(authGroup, signUpHandler)
 	auth.RegisterSignUpConfirmRoute(authGroup, signUpConfirmHandler)
+	auth.RegisterSignUpResendRoute(authGroup, signUpResendHandler)
 	auth.RegisterSignInRoute(authGroup, signInHandler)
+	auth.RegisterReportDeviceRoute(authGroup, reportDeviceHandler)
+	auth.RegisterPasswordResetRoute(authGroup, passwordResetHandler)
+	auth.RegisterReauthenticateRoute(authGroup, reauthenticateHandler, authSvc, sessionSvc)
+	auth.RegisterSignOutRoute(authGroup, signOutHandler, authSvc, sessionSvc)
+
+	organization.RegisterCreateOrganizationRoute(orgGroup, createOrgHandler)
+	organization.RegisterListOrganizationsRoute(orgGroup, listOrgsHandler)
+	organization.RegisterSelectOrganizationRoute(orgGroup, selectOrgHandler)
+	organization.RegisterInviteMemberRoute(orgGroup, inviteMemberHandler, stepUp)
+	organization.RegisterAcceptInvitationRoute(orgGroup, acceptInvitationHandler)
+
+	audit.RegisterListAuditEventsRoute(auditGroup, listAuditEventsHandler)
+
+	challenge.RegisterIssueChallengeRoute(challengeGroup, issueChallengeHandler)
+	challenge.RegisterVerifyChallengeRoute(challengeGroup, verifyChallengeHandler)
+
+	user.RegisterGetProfileRoute(userGroup, getProfileHandler)
+	user.RegisterUpdateProfileRoute(userGroup, updateProfileHandler)
+	user.RegisterUserInfoRoute(userGroup, userInfoHandler)
+
+	account.RegisterDeleteAccountRoute(accountGroup, deleteAccountHandler, stepUp)
+	account.RegisterRestoreAccountRoute(accountGroup, restoreAccountHandler, stepUp)
 }
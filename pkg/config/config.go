@@ -2,4 +2,11 @@ package config
 
 type Config struct {
 	IsDebug bool
+
+	// EnumerationSafe hides whether an email is registered: sign-in fails with a generic
+	// error and sign-up for a taken email looks successful
+	EnumerationSafe bool
+
+	// AppURL is the base of links put in emails, e.g. https://apart-deal.com
+	AppURL string
 }
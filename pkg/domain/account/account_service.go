@@ -0,0 +1,127 @@
+package account
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	auditDomain "apart-deal-api/pkg/domain/audit"
+	auditStore "apart-deal-api/pkg/store/audit"
+	userStore "apart-deal-api/pkg/store/user"
+)
+
+type Settings struct {
+	// DeletedRetention is how long deleted accounts can be restored before they're purged
+	DeletedRetention time.Duration
+}
+
+var DefaultSettings = Settings{
+	DeletedRetention: time.Hour * 24 * 30,
+}
+
+type DeleteInput struct {
+	UserUID  string
+	AdminUID string
+}
+
+// AccountService lets admins delete and restore accounts. Deleted accounts can't sign in and
+// their tokens are revoked, they're purged by the worker once the retention has passed.
+type AccountService struct {
+	userRepo userStore.UserRepository
+	auditSvc *auditDomain.AuditService
+	settings Settings
+}
+
+func NewAccountService(
+	userRepo userStore.UserRepository,
+	auditSvc *auditDomain.AuditService,
+	settings Settings,
+) *AccountService {
+	return &AccountService{
+		userRepo: userRepo,
+		auditSvc: auditSvc,
+		settings: settings,
+	}
+}
+
+func (s *AccountService) Delete(ctx context.Context, input DeleteInput) error {
+	userModel, err := s.delete(ctx, input)
+
+	s.record(ctx, auditStore.TypeAccountDelete, input.UserUID, userModel, err)
+
+	return err
+}
+
+func (s *AccountService) delete(ctx context.Context, input DeleteInput) (*userStore.User, error) {
+	if input.UserUID == input.AdminUID {
+		return nil, &SelfDeletionError{}
+	}
+
+	var userModel *userStore.User
+
+	err := userStore.RetryOnConflict(ctx, s.userRepo, input.UserUID, userStore.DefaultRetryAttempts, func(u *userStore.User) error {
+		userModel = u
+
+		return s.userRepo.Delete(ctx, u.UID, u.Version, input.AdminUID, time.Now())
+	})
+	if err == mongo.ErrNoDocuments {
+		return userModel, &AccountNotFound{}
+	}
+
+	return userModel, err
+}
+
+// Restore brings back an account deleted within the retention, its sessions stay revoked.
+// Accounts past the retention are left to the purge even before it has run.
+func (s *AccountService) Restore(ctx context.Context, userUID string) error {
+	userModel, err := s.restore(ctx, userUID)
+
+	s.record(ctx, auditStore.TypeAccountRestore, userUID, userModel, err)
+
+	return err
+}
+
+func (s *AccountService) restore(ctx context.Context, userUID string) (*userStore.User, error) {
+	userModel, err := s.userRepo.FindDeletedByUID(ctx, userUID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, &AccountNotFound{}
+		}
+
+		return nil, err
+	}
+
+	err = s.userRepo.Restore(ctx, userUID, time.Now().Add(-s.settings.DeletedRetention))
+	if _, ok := err.(*userStore.UserDuplicateError); ok {
+		return userModel, &EmailTakenError{}
+	}
+
+	// past the retention or purged in the meantime
+	if err == mongo.ErrNoDocuments {
+		return userModel, &AccountNotFound{}
+	}
+
+	return userModel, err
+}
+
+func (s *AccountService) record(
+	ctx context.Context,
+	eventType auditStore.EventType,
+	userUID string,
+	userModel *userStore.User,
+	err error,
+) {
+	event := auditDomain.RecordInput{
+		Type:    eventType,
+		UserUID: userUID,
+		Outcome: auditDomain.OutcomeOf(err),
+		Reason:  auditReason(err),
+	}
+
+	if userModel != nil {
+		event.Email = userModel.Email
+	}
+
+	s.auditSvc.Record(ctx, event)
+}
@@ -0,0 +1,17 @@
+package account
+
+// auditReason turns the errors of account administration into the reason codes of audit events
+func auditReason(err error) string {
+	switch err.(type) {
+	case nil:
+		return ""
+	case *AccountNotFound:
+		return "account_not_found"
+	case *EmailTakenError:
+		return "email_taken"
+	case *SelfDeletionError:
+		return "self_deletion"
+	default:
+		return "internal_error"
+	}
+}
@@ -0,0 +1,16 @@
+package account
+
+type AccountNotFound struct {
+	error
+}
+
+// EmailTakenError means a user signed up with the email of the deleted account, which has
+// to change before the account can be restored
+type EmailTakenError struct {
+	error
+}
+
+// SelfDeletionError prevents admins from locking themselves out
+type SelfDeletionError struct {
+	error
+}
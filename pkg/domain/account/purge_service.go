@@ -0,0 +1,158 @@
+package account
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	deviceStore "apart-deal-api/pkg/store/device"
+	orgStore "apart-deal-api/pkg/store/organization"
+	sessionStore "apart-deal-api/pkg/store/session"
+	userStore "apart-deal-api/pkg/store/user"
+	verificationStore "apart-deal-api/pkg/store/verification"
+)
+
+const purgeBatchSize = 100
+
+// PurgeService removes for good the accounts deleted before a given time, with their
+// memberships, sessions, known devices and verification requests. Organizations the user
+// owned alone are handed over to their oldest admin, or oldest member, and deleted with their
+// invitations when nobody else belongs to them.
+//
+// The user goes last, so that a purge which failed halfway is completed by the next one.
+// Kept on purpose: audit events, which expire with the audit retention, notifications, which
+// expire on their own, invitations sent by or to the user, which belong to the organization
+// and expire, and the createdBy of organizations.
+type PurgeService struct {
+	userRepo         userStore.UserRepository
+	membershipRepo   orgStore.MembershipRepository
+	organizationRepo orgStore.OrganizationRepository
+	invitationRepo   orgStore.InvitationRepository
+	sessionRepo      sessionStore.SessionRepository
+	deviceRepo       deviceStore.KnownDeviceRepository
+	requestRepo      verificationStore.RequestRepository
+}
+
+func NewPurgeService(
+	userRepo userStore.UserRepository,
+	membershipRepo orgStore.MembershipRepository,
+	organizationRepo orgStore.OrganizationRepository,
+	invitationRepo orgStore.InvitationRepository,
+	sessionRepo sessionStore.SessionRepository,
+	deviceRepo deviceStore.KnownDeviceRepository,
+	requestRepo verificationStore.RequestRepository,
+) *PurgeService {
+	return &PurgeService{
+		userRepo:         userRepo,
+		membershipRepo:   membershipRepo,
+		organizationRepo: organizationRepo,
+		invitationRepo:   invitationRepo,
+		sessionRepo:      sessionRepo,
+		deviceRepo:       deviceRepo,
+		requestRepo:      requestRepo,
+	}
+}
+
+// Purge returns how many accounts deleted before t were purged. AccountService doesn't
+// restore accounts past the retention, so t has to be at least the retention ago.
+func (s *PurgeService) Purge(ctx context.Context, t time.Time) (int, error) {
+	purged := 0
+
+	for {
+		uids, err := s.userRepo.FindUIDsDeletedBefore(ctx, t, purgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+
+		for _, uid := range uids {
+			ok, err := s.purge(ctx, uid, t)
+			if err != nil {
+				return purged, errors.Wrapf(err, "purge user %s", uid)
+			}
+
+			if ok {
+				purged++
+			}
+		}
+
+		if len(uids) < purgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+func (s *PurgeService) purge(ctx context.Context, userUID string, t time.Time) (bool, error) {
+	memberships, err := s.membershipRepo.FindAllByUser(ctx, userUID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, m := range memberships {
+		if m.Role != orgStore.RoleOwner {
+			continue
+		}
+
+		if err := s.handOver(ctx, m); err != nil {
+			return false, err
+		}
+	}
+
+	if err := s.membershipRepo.DeleteAllByUser(ctx, userUID); err != nil {
+		return false, err
+	}
+
+	if err := s.sessionRepo.DeleteAllOfUser(ctx, userUID); err != nil {
+		return false, err
+	}
+
+	if err := s.deviceRepo.DeleteAllOfUser(ctx, userUID); err != nil {
+		return false, err
+	}
+
+	for _, requestType := range []verificationStore.RequestType{
+		verificationStore.TypeSignUp,
+		verificationStore.TypePasswordReset,
+		verificationStore.TypeEmailChange,
+	} {
+		if err := s.requestRepo.DeleteAllOfUser(ctx, requestType, userUID); err != nil {
+			return false, err
+		}
+	}
+
+	return s.userRepo.PurgeDeleted(ctx, userUID, t)
+}
+
+// handOver keeps the organization of an owner with an owner, its oldest admin is preferred
+func (s *PurgeService) handOver(ctx context.Context, owner orgStore.Membership) error {
+	memberships, err := s.membershipRepo.FindAllByOrganization(ctx, owner.OrganizationUID)
+	if err != nil {
+		return err
+	}
+
+	var successor *orgStore.Membership
+
+	for i, m := range memberships {
+		if m.UserUID == owner.UserUID {
+			continue
+		}
+
+		if m.Role == orgStore.RoleOwner {
+			return nil
+		}
+
+		if successor == nil || (m.Role == orgStore.RoleAdmin && successor.Role != orgStore.RoleAdmin) {
+			successor = &memberships[i]
+		}
+	}
+
+	if successor != nil {
+		return s.membershipRepo.UpdateRole(ctx, successor.UID, orgStore.RoleOwner)
+	}
+
+	if err := s.invitationRepo.DeleteAllByOrganization(ctx, owner.OrganizationUID); err != nil {
+		return err
+	}
+
+	return s.organizationRepo.Delete(ctx, owner.OrganizationUID)
+}
@@ -0,0 +1,140 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"apart-deal-api/pkg/tools"
+	"apart-deal-api/pkg/tracing"
+
+	"go.uber.org/zap"
+
+	auditStore "apart-deal-api/pkg/store/audit"
+)
+
+const (
+	DefaultPerPage = 20
+	MaxPerPage     = 100
+)
+
+type Settings struct {
+	Retention time.Duration
+}
+
+var DefaultSettings = Settings{
+	Retention: time.Hour * 24 * 90,
+}
+
+type RecordInput struct {
+	Type    auditStore.EventType
+	UserUID string
+	Email   string
+	Outcome auditStore.Outcome
+	// Reason is a short machine readable code explaining a failure
+	Reason string
+}
+
+type QueryInput struct {
+	Filter  auditStore.EventFilter
+	Page    int
+	PerPage int
+}
+
+type QueryOutput struct {
+	Events  []auditStore.Event
+	Total   int64
+	Page    int
+	PerPage int
+}
+
+type AuditService struct {
+	eventRepo auditStore.EventRepository
+	settings  Settings
+	logger    *zap.Logger
+}
+
+func NewAuditService(eventRepo auditStore.EventRepository, settings Settings, logger *zap.Logger) *AuditService {
+	return &AuditService{
+		eventRepo: eventRepo,
+		settings:  settings,
+		logger:    logger,
+	}
+}
+
+// Record stores an event along with the client and trace id found in ctx. Auditing must not
+// break the flow being audited, so a failure is only logged. Emails are stored in lower case
+// so that filtering by email finds every case variant.
+func (s *AuditService) Record(ctx context.Context, input RecordInput) {
+	client := tracing.ClientFromContext(ctx)
+	now := time.Now()
+
+	if err := s.eventRepo.Create(ctx, &auditStore.Event{
+		UID:       tools.NewUUID().String(),
+		Type:      input.Type,
+		UserUID:   input.UserUID,
+		Email:     auditEmail(input.Email),
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		TraceID:   tracing.TraceIDFromContext(ctx),
+		Outcome:   input.Outcome,
+		Reason:    input.Reason,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.settings.Retention),
+	}); err != nil {
+		s.logger.With(
+			zap.String("type", string(input.Type)),
+			zap.String("uid", input.UserUID),
+		).Warn(fmt.Sprintf("Could not record audit event: %s", err))
+	}
+}
+
+// Query pages through events newest first, pages start at 1
+func (s *AuditService) Query(ctx context.Context, input QueryInput) (*QueryOutput, error) {
+	page := input.Page
+	if page < 1 {
+		page = 1
+	}
+
+	perPage := input.PerPage
+	if perPage < 1 {
+		perPage = DefaultPerPage
+	}
+
+	if perPage > MaxPerPage {
+		perPage = MaxPerPage
+	}
+
+	input.Filter.Email = auditEmail(input.Filter.Email)
+
+	total, err := s.eventRepo.Count(ctx, input.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := s.eventRepo.Find(ctx, input.Filter, int64((page-1)*perPage), int64(perPage))
+	if err != nil {
+		return nil, err
+	}
+
+	return &QueryOutput{
+		Events:  events,
+		Total:   total,
+		Page:    page,
+		PerPage: perPage,
+	}, nil
+}
+
+// OutcomeOf treats any error as a failure of the audited action
+func OutcomeOf(err error) auditStore.Outcome {
+	if err != nil {
+		return auditStore.OutcomeFailure
+	}
+
+	return auditStore.OutcomeSuccess
+}
+
+func auditEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
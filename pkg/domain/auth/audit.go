@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"apart-deal-api/pkg/store/user"
+
+	orgDomain "apart-deal-api/pkg/domain/organization"
+)
+
+// auditReason turns the errors of the sign-up and password flows into the reason codes of audit events
+func auditReason(err error) string {
+	switch e := err.(type) {
+	case nil:
+		return ""
+	case *user.UserDuplicateError:
+		return "email_occupied"
+	case *EmailDomainRejectedError:
+		return "email_domain_" + e.Reason
+	case *UserNotFound:
+		return "unknown_token"
+	case *ConfirmationCodeMismatchError:
+		return "code_mismatch"
+	case *ConfirmationAttemptsExceededError:
+		return "attempts_exceeded"
+	case *CouldNotConfirmError:
+		return "confirmation_failed"
+	case *ResendCooldownError:
+		return "resend_cooldown"
+	case *ResendLimitExceededError:
+		return "resend_limit"
+	case *PasswordResetNotFound:
+		return "unknown_token"
+	case *PasswordResetExpiredError:
+		return "reset_expired"
+	case *orgDomain.InvitationNotFound:
+		return "invitation_not_found"
+	case *orgDomain.InvitationExpiredError:
+		return "invitation_expired"
+	case *orgDomain.InvitationEmailMismatchError:
+		return "invitation_email_mismatch"
+	default:
+		return "internal_error"
+	}
+}
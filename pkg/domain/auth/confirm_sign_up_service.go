@@ -2,8 +2,18 @@ package auth
 
 import (
 	"context"
+	"crypto/subtle"
+	"time"
 
+	"apart-deal-api/pkg/security"
 	"apart-deal-api/pkg/store/user"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	auditDomain "apart-deal-api/pkg/domain/audit"
+	orgDomain "apart-deal-api/pkg/domain/organization"
+	auditStore "apart-deal-api/pkg/store/audit"
+	verificationStore "apart-deal-api/pkg/store/verification"
 )
 
 type ConfirmationCodeMismatchError struct {
@@ -16,37 +26,150 @@ type ConfirmSignUpInput struct {
 }
 
 type ConfirmSignUpService struct {
-	userRepo user.UserRepository
+	userRepo      user.UserRepository
+	requestRepo   verificationStore.RequestRepository
+	invitationSvc *orgDomain.InvitationService
+	auditSvc      *auditDomain.AuditService
+	limits        SignUpLimits
 }
 
-func NewConfirmSignUpService(userRepo user.UserRepository) *ConfirmSignUpService {
+func NewConfirmSignUpService(
+	userRepo user.UserRepository,
+	requestRepo verificationStore.RequestRepository,
+	invitationSvc *orgDomain.InvitationService,
+	auditSvc *auditDomain.AuditService,
+	limits SignUpLimits,
+) *ConfirmSignUpService {
 	return &ConfirmSignUpService{
-		userRepo: userRepo,
+		userRepo:      userRepo,
+		requestRepo:   requestRepo,
+		invitationSvc: invitationSvc,
+		auditSvc:      auditSvc,
+		limits:        limits,
 	}
 }
 
 func (s *ConfirmSignUpService) Confirm(ctx context.Context, input ConfirmSignUpInput) error {
-	userModel, err := s.userRepo.FindBySignUpReqToken(ctx, input.Token)
+	userModel, err := s.confirm(ctx, input)
+
+	event := auditDomain.RecordInput{
+		Type:    auditStore.TypeSignUpConfirm,
+		Outcome: auditDomain.OutcomeOf(err),
+		Reason:  auditReason(err),
+	}
+
+	if userModel != nil {
+		event.UserUID = userModel.UID
+		event.Email = userModel.Email
+	}
+
+	s.auditSvc.Record(ctx, event)
+
+	return err
+}
+
+func (s *ConfirmSignUpService) confirm(ctx context.Context, input ConfirmSignUpInput) (*user.User, error) {
+	req, userModel, err := findSignUpRequest(ctx, s.requestRepo, s.userRepo, input.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	// the attempt is counted before the code is compared so that concurrent guesses can't
+	// exceed the limit, the request stays unusable until a new code is resent
+	req, err = s.requestRepo.IncrementAttempts(ctx, req.UID, s.limits.MaxCodeAttempts)
+	if err != nil {
+		return userModel, err
+	}
+
+	if req == nil {
+		return userModel, &ConfirmationAttemptsExceededError{}
+	}
+
+	if subtle.ConstantTimeCompare([]byte(req.Code), []byte(input.Code)) != 1 {
+		if req.Attempts >= s.limits.MaxCodeAttempts {
+			return userModel, &ConfirmationAttemptsExceededError{}
+		}
+
+		return userModel, &ConfirmationCodeMismatchError{}
+	}
+
+	err = user.RetryOnConflict(ctx, s.userRepo, userModel.UID, user.DefaultRetryAttempts, func(u *user.User) error {
+		confirmed, err := s.userRepo.Confirm(ctx, u.UID, u.Version)
+		if err != nil {
+			return err
+		}
+
+		if !confirmed {
+			return &CouldNotConfirmError{}
+		}
+
+		return nil
+	})
 	if err != nil {
-		return err
+		if err == mongo.ErrNoDocuments {
+			return userModel, &CouldNotConfirmError{}
+		}
+
+		return userModel, err
 	}
 
-	if userModel == nil {
-		return &UserNotFound{}
+	if _, err := s.requestRepo.Delete(ctx, req.UID); err != nil {
+		return userModel, err
 	}
 
-	if userModel.SignUpReq.Code != input.Code {
-		return &ConfirmationCodeMismatchError{}
+	if req.Data[DataInvitationUID] != "" || req.Data[DataInvitationToken] != "" {
+		if _, err := s.invitationSvc.Accept(ctx, orgDomain.AcceptInvitationInput{
+			Token:         req.Data[DataInvitationToken],
+			InvitationUID: req.Data[DataInvitationUID],
+			UserUID:       userModel.UID,
+		}); err != nil {
+			// the account is confirmed at this point, a stale invitation must not fail the confirmation
+			switch err.(type) {
+			case *orgDomain.InvitationNotFound, *orgDomain.InvitationExpiredError, *orgDomain.AlreadyMemberError:
+				return userModel, nil
+			default:
+				return userModel, err
+			}
+		}
 	}
 
-	confirmed, err := s.userRepo.ConfirmAndDeleteSignUpReq(ctx, userModel.UID)
+	return userModel, nil
+}
+
+// findSignUpRequest resolves the token given at sign-up, an expired request or one whose
+// user is gone is reported as UserNotFound
+func findSignUpRequest(
+	ctx context.Context,
+	requestRepo verificationStore.RequestRepository,
+	userRepo user.UserRepository,
+	token string,
+) (*verificationStore.Request, *user.User, error) {
+	req, err := requestRepo.FindByToken(ctx, verificationStore.TypeSignUp, security.HashToken(token))
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+
+	// requests created before tokens were hashed, they're gone once SignUpMaxLifetime has
+	// passed since the upgrade
+	if req == nil {
+		req, err = requestRepo.FindByToken(ctx, verificationStore.TypeSignUp, token)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
-	if !confirmed {
-		return &CouldNotConfirmError{}
+	if req == nil || !req.ExpiresAt.After(time.Now()) {
+		return nil, nil, &UserNotFound{}
+	}
+
+	userModel, err := userRepo.FindByUID(ctx, req.UserUID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil, &UserNotFound{}
+		}
+
+		return nil, nil, err
 	}
 
-	return nil
+	return req, userModel, nil
 }
@@ -1,5 +1,7 @@
 package auth
 
+import "time"
+
 type UserNotFound struct {
 	error
 }
@@ -7,3 +9,31 @@ type UserNotFound struct {
 type CouldNotConfirmError struct {
 	error
 }
+
+type ConfirmationAttemptsExceededError struct {
+	error
+}
+
+type ResendCooldownError struct {
+	error
+	RetryAfter time.Duration
+}
+
+type ResendLimitExceededError struct {
+	error
+	RetryAfter time.Duration
+}
+
+type PasswordResetNotFound struct {
+	error
+}
+
+type PasswordResetExpiredError struct {
+	error
+}
+
+// EmailDomainRejectedError carries one of the security.EmailDomain* reasons
+type EmailDomainRejectedError struct {
+	error
+	Reason string
+}
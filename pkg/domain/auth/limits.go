@@ -0,0 +1,15 @@
+package auth
+
+import "time"
+
+type SignUpLimits struct {
+	ResendCooldown  time.Duration
+	ResendDailyCap  int
+	MaxCodeAttempts int
+}
+
+var DefaultSignUpLimits = SignUpLimits{
+	ResendCooldown:  time.Minute,
+	ResendDailyCap:  5,
+	MaxCodeAttempts: 5,
+}
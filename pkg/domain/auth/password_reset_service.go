@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"apart-deal-api/pkg/security"
+	"apart-deal-api/pkg/store/user"
+	"apart-deal-api/pkg/tools"
+
+	auditDomain "apart-deal-api/pkg/domain/audit"
+	auditStore "apart-deal-api/pkg/store/audit"
+	notificationStore "apart-deal-api/pkg/store/notification"
+	verificationStore "apart-deal-api/pkg/store/verification"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	PasswordResetExpiration = time.Hour
+
+	passwordResetRestoreTimeout = time.Second * 5
+)
+
+type PasswordResetInput struct {
+	Token    string
+	Password string
+}
+
+type PasswordResetService struct {
+	userRepo         user.UserRepository
+	requestRepo      verificationStore.RequestRepository
+	notificationRepo notificationStore.NotificationRepository
+	hasher           *security.PasswordHasher
+	secrets          security.SecretGenerator
+	auditSvc         *auditDomain.AuditService
+}
+
+func NewPasswordResetService(
+	userRepo user.UserRepository,
+	requestRepo verificationStore.RequestRepository,
+	notificationRepo notificationStore.NotificationRepository,
+	hasher *security.PasswordHasher,
+	secrets security.SecretGenerator,
+	auditSvc *auditDomain.AuditService,
+) *PasswordResetService {
+	return &PasswordResetService{
+		userRepo:         userRepo,
+		requestRepo:      requestRepo,
+		notificationRepo: notificationRepo,
+		hasher:           hasher,
+		secrets:          secrets,
+		auditSvc:         auditSvc,
+	}
+}
+
+// Require blocks sign-in for the user until the password is reset with the token emailed
+// by the worker, revokeSessions also signs the user out everywhere
+func (s *PasswordResetService) Require(ctx context.Context, userModel *user.User, revokeSessions bool) error {
+	token, err := s.secrets.Token(security.DefaultTokenBytes)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	// only the latest emailed token can be used
+	if err := s.requestRepo.DeleteAllOfUser(ctx, verificationStore.TypePasswordReset, userModel.UID); err != nil {
+		return err
+	}
+
+	// a reset may be required while the user is being updated, e.g. by a new device sign-in
+	if err := user.RetryOnConflict(ctx, s.userRepo, userModel.UID, user.DefaultRetryAttempts, func(u *user.User) error {
+		return s.userRepo.RequirePasswordReset(ctx, u.UID, u.Version, revokeSessions, now)
+	}); err != nil {
+		return err
+	}
+
+	if err := s.requestRepo.Create(ctx, &verificationStore.Request{
+		UID:       tools.NewUUID().String(),
+		Type:      verificationStore.TypePasswordReset,
+		UserUID:   userModel.UID,
+		Token:     security.HashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(PasswordResetExpiration),
+	}); err != nil {
+		return err
+	}
+
+	return s.notificationRepo.Create(ctx, &notificationStore.Notification{
+		UID:   tools.NewUUID().String(),
+		Type:  notificationStore.TypePasswordReset,
+		Email: userModel.Email,
+		Data: map[string]string{
+			"token": token,
+		},
+		CreatedAt: now,
+		ExpiresAt: now.Add(notificationStore.Retention),
+	})
+}
+
+func (s *PasswordResetService) Reset(ctx context.Context, input PasswordResetInput) error {
+	userModel, err := s.reset(ctx, input)
+
+	event := auditDomain.RecordInput{
+		Type:    auditStore.TypePasswordReset,
+		Outcome: auditDomain.OutcomeOf(err),
+		Reason:  auditReason(err),
+	}
+
+	if userModel != nil {
+		event.UserUID = userModel.UID
+		event.Email = userModel.Email
+	}
+
+	s.auditSvc.Record(ctx, event)
+
+	return err
+}
+
+func (s *PasswordResetService) reset(ctx context.Context, input PasswordResetInput) (*user.User, error) {
+	req, err := s.requestRepo.FindByToken(ctx, verificationStore.TypePasswordReset, security.HashToken(input.Token))
+	if err != nil {
+		return nil, err
+	}
+
+	if req == nil {
+		return nil, &PasswordResetNotFound{}
+	}
+
+	userModel, err := s.userRepo.FindByUID(ctx, req.UserUID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, &PasswordResetNotFound{}
+		}
+
+		return nil, err
+	}
+
+	if time.Now().After(req.ExpiresAt) {
+		return userModel, &PasswordResetExpiredError{}
+	}
+
+	passwordHash, err := s.hasher.Hash(input.Password)
+	if err != nil {
+		return userModel, err
+	}
+
+	// deleting the request first makes it single use, even when two resets race
+	deleted, err := s.requestRepo.Delete(ctx, req.UID)
+	if err != nil {
+		return userModel, err
+	}
+
+	if !deleted {
+		return userModel, &PasswordResetNotFound{}
+	}
+
+	err = user.RetryOnConflict(ctx, s.userRepo, userModel.UID, user.DefaultRetryAttempts, func(u *user.User) error {
+		if !u.PasswordResetRequired {
+			return &PasswordResetNotFound{}
+		}
+
+		return s.userRepo.CompletePasswordReset(ctx, u.UID, u.Version, passwordHash)
+	})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return userModel, &PasswordResetNotFound{}
+		}
+
+		if _, ok := err.(*PasswordResetNotFound); ok {
+			return userModel, err
+		}
+
+		// the user still has to reset the password, the token is given back so that it can be
+		// tried again, no other token can be asked for
+		if restoreErr := s.restore(req); restoreErr != nil {
+			return userModel, errors.Wrapf(err, "password reset request %s was lost: %s", req.UID, restoreErr)
+		}
+
+		return userModel, err
+	}
+
+	return userModel, nil
+}
+
+// restore creates again a request deleted by a failed reset, the reset may have failed
+// because its context was cancelled
+func (s *PasswordResetService) restore(req *verificationStore.Request) error {
+	ctx, cancel := context.WithTimeout(context.Background(), passwordResetRestoreTimeout)
+	defer cancel()
+
+	return s.requestRepo.Create(ctx, req)
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"apart-deal-api/pkg/security"
+	"apart-deal-api/pkg/store/user"
+
+	auditDomain "apart-deal-api/pkg/domain/audit"
+	auditStore "apart-deal-api/pkg/store/audit"
+	verificationStore "apart-deal-api/pkg/store/verification"
+)
+
+const (
+	resendWindow = time.Hour * 24
+)
+
+type ResendSignUpCodeInput struct {
+	Token string
+}
+
+type ResendSignUpCodeService struct {
+	userRepo    user.UserRepository
+	requestRepo verificationStore.RequestRepository
+	secrets     security.SecretGenerator
+	auditSvc    *auditDomain.AuditService
+	limits      SignUpLimits
+}
+
+func NewResendSignUpCodeService(
+	userRepo user.UserRepository,
+	requestRepo verificationStore.RequestRepository,
+	secrets security.SecretGenerator,
+	auditSvc *auditDomain.AuditService,
+	limits SignUpLimits,
+) *ResendSignUpCodeService {
+	return &ResendSignUpCodeService{
+		userRepo:    userRepo,
+		requestRepo: requestRepo,
+		secrets:     secrets,
+		auditSvc:    auditSvc,
+		limits:      limits,
+	}
+}
+
+func (s *ResendSignUpCodeService) Resend(ctx context.Context, input ResendSignUpCodeInput) error {
+	userModel, err := s.resend(ctx, input)
+
+	event := auditDomain.RecordInput{
+		Type:    auditStore.TypeSignUpResend,
+		Outcome: auditDomain.OutcomeOf(err),
+		Reason:  auditReason(err),
+	}
+
+	if userModel != nil {
+		event.UserUID = userModel.UID
+		event.Email = userModel.Email
+	}
+
+	s.auditSvc.Record(ctx, event)
+
+	return err
+}
+
+func (s *ResendSignUpCodeService) resend(ctx context.Context, input ResendSignUpCodeInput) (*user.User, error) {
+	req, userModel, err := findSignUpRequest(ctx, s.requestRepo, s.userRepo, input.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	if userModel.Status != user.StatusPending {
+		return nil, &UserNotFound{}
+	}
+
+	now := time.Now()
+
+	issuedAt := req.CreatedAt
+	if req.ResentAt != nil {
+		issuedAt = *req.ResentAt
+	}
+
+	if elapsed := now.Sub(issuedAt); elapsed < s.limits.ResendCooldown {
+		return userModel, &ResendCooldownError{RetryAfter: s.limits.ResendCooldown - elapsed}
+	}
+
+	windowStart := now
+	resendCount := 0
+
+	if req.ResendWindowStart != nil && now.Sub(*req.ResendWindowStart) < resendWindow {
+		windowStart = *req.ResendWindowStart
+		resendCount = req.ResendCount
+	}
+
+	if resendCount >= s.limits.ResendDailyCap {
+		return userModel, &ResendLimitExceededError{RetryAfter: windowStart.Add(resendWindow).Sub(now)}
+	}
+
+	code, err := s.secrets.NumericCode(SignUpCodeLength)
+	if err != nil {
+		return userModel, err
+	}
+
+	// a resend gives as much time as the sign-up did, up to SignUpMaxLifetime
+	expiresAt := now.Add(SignUpExpiration)
+	if maxExpiresAt := req.CreatedAt.Add(SignUpMaxLifetime); expiresAt.After(maxExpiresAt) {
+		expiresAt = maxExpiresAt
+	}
+
+	renewed, err := s.requestRepo.RenewCode(ctx, req, verificationStore.CodeRenewal{
+		Code:              code,
+		ResentAt:          now,
+		ResendWindowStart: windowStart,
+		ResendCount:       resendCount + 1,
+		ExpiresAt:         expiresAt,
+	})
+	if err != nil {
+		return userModel, err
+	}
+
+	// another resend renewed the code since the request was read
+	if !renewed {
+		return userModel, &ResendCooldownError{RetryAfter: s.limits.ResendCooldown}
+	}
+
+	return userModel, nil
+}
@@ -2,13 +2,38 @@ package auth
 
 import (
 	"context"
-	"strconv"
 	"time"
 
+	"apart-deal-api/pkg/config"
 	"apart-deal-api/pkg/security"
 	"apart-deal-api/pkg/store/user"
 	"apart-deal-api/pkg/tools"
-	"apart-deal-api/pkg/utils"
+
+	auditDomain "apart-deal-api/pkg/domain/audit"
+	identityDomain "apart-deal-api/pkg/domain/identity"
+	orgDomain "apart-deal-api/pkg/domain/organization"
+	auditStore "apart-deal-api/pkg/store/audit"
+	notificationStore "apart-deal-api/pkg/store/notification"
+	orgStore "apart-deal-api/pkg/store/organization"
+	verificationStore "apart-deal-api/pkg/store/verification"
+)
+
+const (
+	SignUpCodeLength = 5
+
+	// SignUpExpiration is how long a pending user has to confirm, the request expires and
+	// the pending user is deleted after it. Every resend of the code gives as much time again.
+	SignUpExpiration = time.Minute * 15
+
+	// SignUpMaxLifetime bounds how long resends keep a sign-up alive
+	SignUpMaxLifetime = time.Hour * 24
+
+	// DataInvitationUID is the invitation accepted once the sign-up is confirmed
+	DataInvitationUID = "invitationUid"
+
+	// DataInvitationToken is the invitation of sign-ups started before DataInvitationUID
+	// replaced it, it's a token in plaintext
+	DataInvitationToken = "invitationToken"
 )
 
 type EmailOccupiedError struct {
@@ -19,6 +44,8 @@ type SignUpInput struct {
 	Name     string
 	Email    string
 	Password string
+
+	InvitationToken string
 }
 
 type SignUpOutput struct {
@@ -26,38 +53,153 @@ type SignUpOutput struct {
 }
 
 type SignUpService struct {
-	userRepo user.UserRepository
+	userRepo         user.UserRepository
+	requestRepo      verificationStore.RequestRepository
+	notificationRepo notificationStore.NotificationRepository
+	invitationSvc    *orgDomain.InvitationService
+	hasher           *security.PasswordHasher
+	secrets          security.SecretGenerator
+	auditSvc         *auditDomain.AuditService
+	domainPolicy     *security.EmailDomainPolicy
+	emails           *identityDomain.EmailNormalizer
+	cfg              *config.Config
 }
 
-func NewSignUpService(userRepo user.UserRepository) *SignUpService {
+func NewSignUpService(
+	userRepo user.UserRepository,
+	requestRepo verificationStore.RequestRepository,
+	notificationRepo notificationStore.NotificationRepository,
+	invitationSvc *orgDomain.InvitationService,
+	hasher *security.PasswordHasher,
+	secrets security.SecretGenerator,
+	auditSvc *auditDomain.AuditService,
+	domainPolicy *security.EmailDomainPolicy,
+	emails *identityDomain.EmailNormalizer,
+	cfg *config.Config,
+) *SignUpService {
 	return &SignUpService{
-		userRepo: userRepo,
+		userRepo:         userRepo,
+		requestRepo:      requestRepo,
+		notificationRepo: notificationRepo,
+		invitationSvc:    invitationSvc,
+		hasher:           hasher,
+		secrets:          secrets,
+		auditSvc:         auditSvc,
+		domainPolicy:     domainPolicy,
+		emails:           emails,
+		cfg:              cfg,
 	}
 }
 
 func (s *SignUpService) SignUp(ctx context.Context, input SignUpInput) (SignUpOutput, error) {
-	passwordHash, err := security.HashPassword(input.Password)
+	input.Email = s.emails.Normalize(input.Email)
+
+	output, userUID, err := s.createPendingUser(ctx, input)
+
+	s.auditSvc.Record(ctx, auditDomain.RecordInput{
+		Type:    auditStore.TypeSignUp,
+		UserUID: userUID,
+		Email:   input.Email,
+		Outcome: auditDomain.OutcomeOf(err),
+		Reason:  auditReason(err),
+	})
+
+	if _, ok := err.(*user.UserDuplicateError); ok && s.cfg.EnumerationSafe {
+		return s.signUpTakenEmail(ctx, input)
+	}
+
+	return output, err
+}
+
+func (s *SignUpService) createPendingUser(ctx context.Context, input SignUpInput) (SignUpOutput, string, error) {
+	if reason := s.domainPolicy.Check(input.Email); reason != "" {
+		return SignUpOutput{}, "", &EmailDomainRejectedError{Reason: reason}
+	}
+
+	var invitation *orgStore.Invitation
+
+	if input.InvitationToken != "" {
+		var err error
+
+		invitation, err = s.invitationSvc.Validate(ctx, input.InvitationToken, input.Email)
+		if err != nil {
+			return SignUpOutput{}, "", err
+		}
+	}
+
+	passwordHash, err := s.hasher.Hash(input.Password)
 	if err != nil {
-		return SignUpOutput{}, err
+		return SignUpOutput{}, "", err
 	}
 
-	token := utils.RandomString(12)
-	code := utils.RandomIntBetween(10000, 99999)
+	token, err := s.secrets.Token(security.DefaultTokenBytes)
+	if err != nil {
+		return SignUpOutput{}, "", err
+	}
+
+	code, err := s.secrets.NumericCode(SignUpCodeLength)
+	if err != nil {
+		return SignUpOutput{}, "", err
+	}
+
+	now := time.Now()
 
 	model := user.User{
 		UID:          tools.NewUUID().String(),
 		Email:        input.Email,
+		EmailKey:     s.emails.Key(input.Email),
 		Name:         input.Name,
 		PasswordHash: passwordHash,
 		Status:       user.StatusPending,
-		CreatedAt:    time.Now(),
-		SignUpReq: &user.SignUpRequest{
-			Token: token,
-			Code:  strconv.Itoa(code),
-		},
+		CreatedAt:    now,
 	}
 
 	if err := s.userRepo.Create(ctx, &model); err != nil {
+		return SignUpOutput{}, "", err
+	}
+
+	req := verificationStore.Request{
+		UID:       tools.NewUUID().String(),
+		Type:      verificationStore.TypeSignUp,
+		UserUID:   model.UID,
+		Token:     security.HashToken(token),
+		Code:      code,
+		CreatedAt: now,
+		ExpiresAt: now.Add(SignUpExpiration),
+	}
+
+	if invitation != nil {
+		req.Data = map[string]string{
+			DataInvitationUID: invitation.UID,
+		}
+	}
+
+	if err := s.requestRepo.Create(ctx, &req); err != nil {
+		return SignUpOutput{}, model.UID, err
+	}
+
+	return SignUpOutput{
+		Token: token,
+	}, model.UID, nil
+}
+
+// signUpTakenEmail answers like a successful sign-up with a token that matches nothing,
+// the owner of the email is told about the attempt instead
+func (s *SignUpService) signUpTakenEmail(ctx context.Context, input SignUpInput) (SignUpOutput, error) {
+	token, err := s.secrets.Token(security.DefaultTokenBytes)
+	if err != nil {
+		return SignUpOutput{}, err
+	}
+
+	now := time.Now()
+
+	if err := s.notificationRepo.Create(ctx, &notificationStore.Notification{
+		UID:       tools.NewUUID().String(),
+		Type:      notificationStore.TypeSignUpAttempt,
+		Email:     input.Email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(notificationStore.Retention),
+	}); err != nil {
 		return SignUpOutput{}, err
 	}
 
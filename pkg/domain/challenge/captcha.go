@@ -0,0 +1,103 @@
+package challenge
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SiteVerifyCaptcha verifies tokens with the "siteverify" API shared by reCAPTCHA,
+// hCaptcha and Cloudflare Turnstile
+type SiteVerifyCaptcha struct {
+	verifyURL string
+	secret    string
+	client    *http.Client
+}
+
+func NewSiteVerifyCaptcha(verifyURL string, secret string) *SiteVerifyCaptcha {
+	return &SiteVerifyCaptcha{
+		verifyURL: verifyURL,
+		secret:    secret,
+		client: &http.Client{
+			Timeout: time.Second * 5,
+		},
+	}
+}
+
+type siteVerifyResponse struct {
+	Success    bool     `json:"success"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+func (c *SiteVerifyCaptcha) Verify(ctx context.Context, response string, remoteIP string) error {
+	if response == "" {
+		return &ChallengeRequiredError{}
+	}
+
+	form := url.Values{}
+	form.Set("secret", c.secret)
+	form.Set("response", response)
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("CAPTCHA verification responded with status %d", resp.StatusCode)
+	}
+
+	var result siteVerifyResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+
+	if !result.Success {
+		return &ChallengeFailedError{}
+	}
+
+	return nil
+}
+
+// StaticCaptcha stands in for a CAPTCHA provider locally and in tests, it accepts
+// a single configured token
+type StaticCaptcha struct {
+	token string
+}
+
+func NewStaticCaptcha(token string) *StaticCaptcha {
+	return &StaticCaptcha{
+		token: token,
+	}
+}
+
+func (c *StaticCaptcha) Verify(_ context.Context, response string, _ string) error {
+	if response == "" {
+		return &ChallengeRequiredError{}
+	}
+
+	if subtle.ConstantTimeCompare([]byte(response), []byte(c.token)) != 1 {
+		return &ChallengeFailedError{}
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package challenge
+
+import (
+	"context"
+	"crypto/sha256"
+	"math/bits"
+	"time"
+
+	"apart-deal-api/pkg/tools"
+
+	challengeStore "apart-deal-api/pkg/store/challenge"
+)
+
+type ChallengeNotFound struct {
+	error
+}
+
+type ChallengeExpiredError struct {
+	error
+}
+
+type SolutionInvalidError struct {
+	error
+}
+
+type ProofOfWorkSettings struct {
+	// Difficulty is the number of leading zero bits the solution hash must have,
+	// every extra bit doubles the work of the client
+	Difficulty int
+	TTL        time.Duration
+}
+
+var DefaultProofOfWorkSettings = ProofOfWorkSettings{
+	Difficulty: 20,
+	TTL:        time.Minute * 5,
+}
+
+type SolveInput struct {
+	UID   string
+	Nonce string
+}
+
+// ProofOfWorkService issues hashcash-style challenges: the client looks for a nonce that
+// makes SHA-256("<uid>:<nonce>") start with Difficulty zero bits, submits it to Solve and
+// then sends the challenge uid along the protected request, where Verify spends it
+type ProofOfWorkService struct {
+	challengeRepo challengeStore.ChallengeRepository
+	settings      ProofOfWorkSettings
+}
+
+func NewProofOfWorkService(
+	challengeRepo challengeStore.ChallengeRepository,
+	settings ProofOfWorkSettings,
+) *ProofOfWorkService {
+	return &ProofOfWorkService{
+		challengeRepo: challengeRepo,
+		settings:      settings,
+	}
+}
+
+func (s *ProofOfWorkService) Issue(ctx context.Context) (*challengeStore.Challenge, error) {
+	now := time.Now()
+
+	model := challengeStore.Challenge{
+		UID:        tools.NewUUID().String(),
+		Difficulty: s.settings.Difficulty,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(s.settings.TTL),
+	}
+
+	if err := s.challengeRepo.Create(ctx, &model); err != nil {
+		return nil, err
+	}
+
+	return &model, nil
+}
+
+func (s *ProofOfWorkService) Solve(ctx context.Context, input SolveInput) error {
+	model, err := s.challengeRepo.FindByUID(ctx, input.UID)
+	if err != nil {
+		return err
+	}
+
+	if model == nil {
+		return &ChallengeNotFound{}
+	}
+
+	now := time.Now()
+
+	if !model.ExpiresAt.After(now) {
+		return &ChallengeExpiredError{}
+	}
+
+	if WorkBits(model.UID, input.Nonce) < model.Difficulty {
+		return &SolutionInvalidError{}
+	}
+
+	solved, err := s.challengeRepo.MarkSolved(ctx, model.UID, now)
+	if err != nil {
+		return err
+	}
+
+	if !solved {
+		// solved twice, the first solution is the one which counts
+		return &SolutionInvalidError{}
+	}
+
+	return nil
+}
+
+// Verify spends a solved challenge, the response is its uid
+func (s *ProofOfWorkService) Verify(ctx context.Context, response string, _ string) error {
+	if response == "" {
+		return &ChallengeRequiredError{}
+	}
+
+	spent, err := s.challengeRepo.Spend(ctx, response, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if !spent {
+		return &ChallengeFailedError{}
+	}
+
+	return nil
+}
+
+// WorkBits returns the number of leading zero bits of SHA-256("<uid>:<nonce>")
+func WorkBits(uid string, nonce string) int {
+	sum := sha256.Sum256([]byte(uid + ":" + nonce))
+
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+
+		n += 8
+	}
+
+	return n
+}
@@ -0,0 +1,19 @@
+package challenge
+
+import (
+	"context"
+)
+
+type ChallengeRequiredError struct {
+	error
+}
+
+type ChallengeFailedError struct {
+	error
+}
+
+// Verifier checks the challenge response sent along a protected request. It's implemented
+// by the self-hosted ProofOfWorkService and by CAPTCHA providers.
+type Verifier interface {
+	Verify(ctx context.Context, response string, remoteIP string) error
+}
@@ -0,0 +1,188 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"apart-deal-api/pkg/security"
+	"apart-deal-api/pkg/tools"
+	"apart-deal-api/pkg/tracing"
+
+	"go.uber.org/zap"
+
+	auditDomain "apart-deal-api/pkg/domain/audit"
+	authDomain "apart-deal-api/pkg/domain/auth"
+	auditStore "apart-deal-api/pkg/store/audit"
+	deviceStore "apart-deal-api/pkg/store/device"
+	notificationStore "apart-deal-api/pkg/store/notification"
+	userStore "apart-deal-api/pkg/store/user"
+)
+
+const (
+	// RevokeTokenExpiration is how long the "this wasn't me" link of a new device email works
+	RevokeTokenExpiration = time.Hour * 24 * 7
+)
+
+type DeviceNotFound struct {
+	error
+}
+
+type ReportDeviceInput struct {
+	Token string
+}
+
+type DeviceService struct {
+	deviceRepo       deviceStore.KnownDeviceRepository
+	userRepo         userStore.UserRepository
+	notificationRepo notificationStore.NotificationRepository
+	passwordResetSvc *authDomain.PasswordResetService
+	auditSvc         *auditDomain.AuditService
+	secrets          security.SecretGenerator
+	logger           *zap.Logger
+}
+
+func NewDeviceService(
+	deviceRepo deviceStore.KnownDeviceRepository,
+	userRepo userStore.UserRepository,
+	notificationRepo notificationStore.NotificationRepository,
+	passwordResetSvc *authDomain.PasswordResetService,
+	auditSvc *auditDomain.AuditService,
+	secrets security.SecretGenerator,
+	logger *zap.Logger,
+) *DeviceService {
+	return &DeviceService{
+		deviceRepo:       deviceRepo,
+		userRepo:         userRepo,
+		notificationRepo: notificationRepo,
+		passwordResetSvc: passwordResetSvc,
+		auditSvc:         auditSvc,
+		secrets:          secrets,
+		logger:           logger,
+	}
+}
+
+// Remember is called after a successful sign-in, the user is emailed when the device is not
+// known yet. The very first device is remembered silently. A failure is only logged, it must
+// not prevent the user from signing in.
+func (s *DeviceService) Remember(ctx context.Context, user *userStore.User) {
+	if err := s.remember(ctx, user); err != nil {
+		s.logger.With(zap.String("uid", user.UID)).Warn(fmt.Sprintf("Could not check sign-in device: %s", err))
+	}
+}
+
+func (s *DeviceService) remember(ctx context.Context, user *userStore.User) error {
+	client := tracing.ClientFromContext(ctx)
+	if client.IP == "" && client.UserAgent == "" {
+		return nil
+	}
+
+	identity := security.IdentifyDevice(client.UserAgent, client.IP)
+	now := time.Now()
+
+	known, err := s.deviceRepo.FindByUserAndFingerprint(ctx, user.UID, identity.Fingerprint())
+	if err != nil {
+		return err
+	}
+
+	if known != nil {
+		return s.deviceRepo.SaveLastSeen(ctx, known.UID, now)
+	}
+
+	count, err := s.deviceRepo.CountByUser(ctx, user.UID)
+	if err != nil {
+		return err
+	}
+
+	token, err := s.secrets.Token(security.DefaultTokenBytes)
+	if err != nil {
+		return err
+	}
+
+	if err := s.deviceRepo.Create(ctx, &deviceStore.KnownDevice{
+		UID:                  tools.NewUUID().String(),
+		UserUID:              user.UID,
+		Fingerprint:          identity.Fingerprint(),
+		Family:               identity.Family,
+		IPPrefix:             identity.IPPrefix,
+		RevokeToken:          security.HashToken(token),
+		RevokeTokenExpiresAt: now.Add(RevokeTokenExpiration),
+		FirstSeenAt:          now,
+		LastSeenAt:           now,
+	}); err != nil {
+		// a concurrent sign-in from the same device has already taken care of it
+		if _, ok := err.(*deviceStore.KnownDeviceDuplicateError); ok {
+			return nil
+		}
+
+		return err
+	}
+
+	if count == 0 {
+		return nil
+	}
+
+	return s.notificationRepo.Create(ctx, &notificationStore.Notification{
+		UID:   tools.NewUUID().String(),
+		Type:  notificationStore.TypeNewDevice,
+		Email: user.Email,
+		Data: map[string]string{
+			"device":     identity.Family,
+			"ip":         client.IP,
+			"signedInAt": now.UTC().Format(time.RFC1123),
+			"token":      token,
+		},
+		CreatedAt: now,
+		ExpiresAt: now.Add(notificationStore.Retention),
+	})
+}
+
+// Report handles the "this wasn't me" link of a new device email: every session is revoked
+// and the password has to be reset before the next sign-in
+func (s *DeviceService) Report(ctx context.Context, input ReportDeviceInput) error {
+	user, err := s.report(ctx, input)
+
+	event := auditDomain.RecordInput{
+		Type:    auditStore.TypeDeviceReported,
+		Outcome: auditDomain.OutcomeOf(err),
+	}
+
+	if err != nil {
+		event.Reason = "internal_error"
+		if _, ok := err.(*DeviceNotFound); ok {
+			event.Reason = "unknown_token"
+		}
+	}
+
+	if user != nil {
+		event.UserUID = user.UID
+		event.Email = user.Email
+	}
+
+	s.auditSvc.Record(ctx, event)
+
+	return err
+}
+
+func (s *DeviceService) report(ctx context.Context, input ReportDeviceInput) (*userStore.User, error) {
+	known, err := s.deviceRepo.FindByRevokeToken(ctx, security.HashToken(input.Token))
+	if err != nil {
+		return nil, err
+	}
+
+	// devices remembered before revoke tokens expired have a zero expiry
+	if known == nil || time.Now().After(known.RevokeTokenExpiresAt) {
+		return nil, &DeviceNotFound{}
+	}
+
+	user, err := s.userRepo.FindByUID(ctx, known.UserUID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.passwordResetSvc.Require(ctx, user, true); err != nil {
+		return user, err
+	}
+
+	return user, nil
+}
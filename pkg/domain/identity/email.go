@@ -0,0 +1,108 @@
+package identity
+
+import (
+	"strings"
+)
+
+type EmailSettings struct {
+	// ProviderRules applies the addressing rules of known providers to keys, e.g. Gmail
+	// ignores dots and everything after a plus in the local part
+	ProviderRules bool
+}
+
+var DefaultEmailSettings = EmailSettings{
+	ProviderRules: false,
+}
+
+type providerRule struct {
+	// domain replaces aliases of the provider's domain, empty keeps it
+	domain       string
+	stripDots    bool
+	tagSeparator string
+}
+
+var providerRules = map[string]providerRule{
+	"gmail.com":      {stripDots: true, tagSeparator: "+"},
+	"googlemail.com": {domain: "gmail.com", stripDots: true, tagSeparator: "+"},
+	"outlook.com":    {tagSeparator: "+"},
+	"hotmail.com":    {tagSeparator: "+"},
+	"live.com":       {tagSeparator: "+"},
+	"icloud.com":     {tagSeparator: "+"},
+	"me.com":         {domain: "icloud.com", tagSeparator: "+"},
+	"fastmail.com":   {tagSeparator: "+"},
+	"proton.me":      {tagSeparator: "+"},
+	"protonmail.com": {domain: "proton.me", tagSeparator: "+"},
+}
+
+// EmailNormalizer decides when two addresses are the same identity, users are looked up
+// and kept unique by the key of their email, never by the address as typed
+type EmailNormalizer struct {
+	settings EmailSettings
+}
+
+func NewEmailNormalizer(settings EmailSettings) *EmailNormalizer {
+	return &EmailNormalizer{
+		settings: settings,
+	}
+}
+
+// Normalize returns the address as it's stored and shown, trimmed and with a lowercase
+// domain, the local part keeps its case
+func (n *EmailNormalizer) Normalize(email string) string {
+	local, domain, ok := split(email)
+	if !ok {
+		return strings.TrimSpace(email)
+	}
+
+	return local + "@" + strings.ToLower(domain)
+}
+
+// Key returns the identity of the address, two addresses with the same key can't be
+// registered twice and sign in to the same user
+func (n *EmailNormalizer) Key(email string) string {
+	local, domain, ok := split(email)
+	if !ok {
+		return strings.ToLower(strings.TrimSpace(email))
+	}
+
+	local = strings.ToLower(local)
+	domain = strings.ToLower(domain)
+
+	if n.settings.ProviderRules {
+		if rule, ok := providerRules[domain]; ok {
+			local, domain = rule.apply(local, domain)
+		}
+	}
+
+	return local + "@" + domain
+}
+
+func (r providerRule) apply(local string, domain string) (string, string) {
+	if r.tagSeparator != "" {
+		// a tag alone is not an address, "+foo@gmail.com" is left as it is
+		if i := strings.Index(local, r.tagSeparator); i > 0 {
+			local = local[:i]
+		}
+	}
+
+	if r.stripDots {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+
+	if r.domain != "" {
+		domain = r.domain
+	}
+
+	return local, domain
+}
+
+func split(email string) (string, string, bool) {
+	email = strings.TrimSpace(email)
+
+	i := strings.LastIndex(email, "@")
+	if i <= 0 || i == len(email)-1 {
+		return "", "", false
+	}
+
+	return email[:i], email[i+1:], true
+}
@@ -0,0 +1,29 @@
+package organization
+
+type OrganizationNotFound struct {
+	error
+}
+
+type NotAMemberError struct {
+	error
+}
+
+type InsufficientRoleError struct {
+	error
+}
+
+type AlreadyMemberError struct {
+	error
+}
+
+type InvitationNotFound struct {
+	error
+}
+
+type InvitationExpiredError struct {
+	error
+}
+
+type InvitationEmailMismatchError struct {
+	error
+}
@@ -0,0 +1,221 @@
+package organization
+
+import (
+	"context"
+	"time"
+
+	"apart-deal-api/pkg/security"
+	"apart-deal-api/pkg/tools"
+
+	identityDomain "apart-deal-api/pkg/domain/identity"
+	orgStore "apart-deal-api/pkg/store/organization"
+	userStore "apart-deal-api/pkg/store/user"
+)
+
+const (
+	InvitationExpiration = time.Hour * 24 * 7
+)
+
+type InviteMemberInput struct {
+	OrganizationUID string
+	InviterUID      string
+	Email           string
+	Role            orgStore.Role
+}
+
+type AcceptInvitationInput struct {
+	Token string
+	// InvitationUID is given instead of Token once the token has been validated, by a sign-up
+	InvitationUID string
+	UserUID       string
+}
+
+type InvitationService struct {
+	orgRepo        orgStore.OrganizationRepository
+	membershipRepo orgStore.MembershipRepository
+	invitationRepo orgStore.InvitationRepository
+	userRepo       userStore.UserRepository
+	secrets        security.SecretGenerator
+	emails         *identityDomain.EmailNormalizer
+}
+
+func NewInvitationService(
+	orgRepo orgStore.OrganizationRepository,
+	membershipRepo orgStore.MembershipRepository,
+	invitationRepo orgStore.InvitationRepository,
+	userRepo userStore.UserRepository,
+	secrets security.SecretGenerator,
+	emails *identityDomain.EmailNormalizer,
+) *InvitationService {
+	return &InvitationService{
+		orgRepo:        orgRepo,
+		membershipRepo: membershipRepo,
+		invitationRepo: invitationRepo,
+		userRepo:       userRepo,
+		secrets:        secrets,
+		emails:         emails,
+	}
+}
+
+func (s *InvitationService) Invite(ctx context.Context, input InviteMemberInput) (*orgStore.Invitation, error) {
+	org, err := s.orgRepo.FindByUID(ctx, input.OrganizationUID)
+	if err != nil {
+		return nil, err
+	}
+
+	if org == nil {
+		return nil, &OrganizationNotFound{}
+	}
+
+	inviter, err := s.membershipRepo.FindByOrganizationAndUser(ctx, org.UID, input.InviterUID)
+	if err != nil {
+		return nil, err
+	}
+
+	if inviter == nil {
+		return nil, &NotAMemberError{}
+	}
+
+	// owners are the only ones who can hand out ownership
+	if !inviter.Role.CanInvite() || (input.Role == orgStore.RoleOwner && inviter.Role != orgStore.RoleOwner) {
+		return nil, &InsufficientRoleError{}
+	}
+
+	existing, err := s.userRepo.FindByEmailKey(ctx, s.emails.Key(input.Email))
+	if err != nil {
+		return nil, err
+	}
+
+	if existing != nil {
+		membership, err := s.membershipRepo.FindByOrganizationAndUser(ctx, org.UID, existing.UID)
+		if err != nil {
+			return nil, err
+		}
+
+		if membership != nil {
+			return nil, &AlreadyMemberError{}
+		}
+	}
+
+	token, err := s.secrets.Token(security.DefaultTokenBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	model := orgStore.Invitation{
+		UID:             tools.NewUUID().String(),
+		OrganizationUID: org.UID,
+		Email:           s.emails.Normalize(input.Email),
+		Role:            input.Role,
+		Token:           security.HashToken(token),
+		MailToken:       token,
+		InvitedBy:       input.InviterUID,
+		Status:          orgStore.InvitationStatusPending,
+		CreatedAt:       now,
+		ExpiresAt:       now.Add(InvitationExpiration),
+	}
+
+	if err := s.invitationRepo.Create(ctx, &model); err != nil {
+		return nil, err
+	}
+
+	return &model, nil
+}
+
+// Validate checks that the invitation can be accepted by the owner of the given email,
+// it's used during sign-up when the user does not exist yet
+func (s *InvitationService) Validate(ctx context.Context, token string, email string) (*orgStore.Invitation, error) {
+	invitation, err := s.invitationRepo.FindByToken(ctx, security.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	// invitations created before tokens were hashed, they're gone once InvitationExpiration
+	// has passed since the upgrade
+	if invitation == nil {
+		invitation, err = s.invitationRepo.FindByToken(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s.check(invitation, email)
+}
+
+func (s *InvitationService) check(invitation *orgStore.Invitation, email string) (*orgStore.Invitation, error) {
+	if invitation == nil || invitation.Status != orgStore.InvitationStatusPending {
+		return nil, &InvitationNotFound{}
+	}
+
+	if time.Now().After(invitation.ExpiresAt) {
+		return nil, &InvitationExpiredError{}
+	}
+
+	if s.emails.Key(invitation.Email) != s.emails.Key(email) {
+		return nil, &InvitationEmailMismatchError{}
+	}
+
+	return invitation, nil
+}
+
+func (s *InvitationService) Accept(ctx context.Context, input AcceptInvitationInput) (*orgStore.Membership, error) {
+	userModel, err := s.userRepo.FindByUID(ctx, input.UserUID)
+	if err != nil {
+		return nil, err
+	}
+
+	var invitation *orgStore.Invitation
+
+	if input.InvitationUID != "" {
+		invitation, err = s.invitationRepo.FindByUID(ctx, input.InvitationUID)
+		if err == nil {
+			invitation, err = s.check(invitation, userModel.Email)
+		}
+	} else {
+		invitation, err = s.Validate(ctx, input.Token, userModel.Email)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the membership is created first so that a failure leaves the invitation pending and
+	// accepting it again completes it
+	membership := &orgStore.Membership{
+		UID:             tools.NewUUID().String(),
+		OrganizationUID: invitation.OrganizationUID,
+		UserUID:         userModel.UID,
+		Role:            invitation.Role,
+		InvitationUID:   invitation.UID,
+		CreatedAt:       time.Now(),
+	}
+
+	if err := s.membershipRepo.Create(ctx, membership); err != nil {
+		if _, ok := err.(*orgStore.MembershipDuplicateError); !ok {
+			return nil, err
+		}
+
+		membership, err = s.membershipRepo.FindByOrganizationAndUser(ctx, invitation.OrganizationUID, userModel.UID)
+		if err != nil {
+			return nil, err
+		}
+
+		// only a membership of this invitation completes it, another one keeps its own role
+		if membership == nil || membership.InvitationUID != invitation.UID {
+			return nil, &AlreadyMemberError{}
+		}
+	}
+
+	accepted, err := s.invitationRepo.MarkAccepted(ctx, invitation.UID, userModel.UID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !accepted {
+		return nil, &InvitationNotFound{}
+	}
+
+	return membership, nil
+}
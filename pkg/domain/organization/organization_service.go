@@ -0,0 +1,142 @@
+package organization
+
+import (
+	"context"
+	"time"
+
+	"apart-deal-api/pkg/tools"
+
+	"github.com/pkg/errors"
+
+	orgStore "apart-deal-api/pkg/store/organization"
+)
+
+type CreateOrganizationInput struct {
+	Name     string
+	OwnerUID string
+}
+
+type OrganizationWithRole struct {
+	Organization orgStore.Organization
+	Role         orgStore.Role
+}
+
+type OrganizationService struct {
+	orgRepo        orgStore.OrganizationRepository
+	membershipRepo orgStore.MembershipRepository
+}
+
+func NewOrganizationService(
+	orgRepo orgStore.OrganizationRepository,
+	membershipRepo orgStore.MembershipRepository,
+) *OrganizationService {
+	return &OrganizationService{
+		orgRepo:        orgRepo,
+		membershipRepo: membershipRepo,
+	}
+}
+
+func (s *OrganizationService) Create(ctx context.Context, input CreateOrganizationInput) (*orgStore.Organization, error) {
+	model := orgStore.Organization{
+		UID:       tools.NewUUID().String(),
+		Name:      input.Name,
+		CreatedBy: input.OwnerUID,
+		CreatedAt: time.Now(),
+	}
+
+	if err := s.orgRepo.Create(ctx, &model); err != nil {
+		return nil, err
+	}
+
+	if err := s.membershipRepo.Create(ctx, &orgStore.Membership{
+		UID:             tools.NewUUID().String(),
+		OrganizationUID: model.UID,
+		UserUID:         input.OwnerUID,
+		Role:            orgStore.RoleOwner,
+		CreatedAt:       time.Now(),
+	}); err != nil {
+		// an organization without its owner can't be reached by anyone
+		if deleteErr := s.orgRepo.Delete(ctx, model.UID); deleteErr != nil {
+			return nil, errors.Wrapf(err, "organization %s was left without owner: %s", model.UID, deleteErr)
+		}
+
+		return nil, err
+	}
+
+	return &model, nil
+}
+
+func (s *OrganizationService) ListForUser(ctx context.Context, userUID string) ([]OrganizationWithRole, error) {
+	memberships, err := s.membershipRepo.FindAllByUser(ctx, userUID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make(map[string]orgStore.Role, len(memberships))
+	uids := make([]string, 0, len(memberships))
+
+	for _, m := range memberships {
+		roles[m.OrganizationUID] = m.Role
+		uids = append(uids, m.OrganizationUID)
+	}
+
+	orgs, err := s.orgRepo.FindByUIDs(ctx, uids)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]OrganizationWithRole, 0, len(orgs))
+
+	for _, o := range orgs {
+		result = append(result, OrganizationWithRole{
+			Organization: o,
+			Role:         roles[o.UID],
+		})
+	}
+
+	return result, nil
+}
+
+// FindMembership returns the user's membership in the organization, it's used to
+// verify access and to pick the role a token should carry
+func (s *OrganizationService) FindMembership(
+	ctx context.Context,
+	organizationUID string,
+	userUID string,
+) (*orgStore.Membership, error) {
+	membership, err := s.membershipRepo.FindByOrganizationAndUser(ctx, organizationUID, userUID)
+	if err != nil {
+		return nil, err
+	}
+
+	if membership == nil {
+		return nil, &NotAMemberError{}
+	}
+
+	return membership, nil
+}
+
+func (s *OrganizationService) FindForMember(
+	ctx context.Context,
+	organizationUID string,
+	userUID string,
+) (*OrganizationWithRole, error) {
+	membership, err := s.FindMembership(ctx, organizationUID, userUID)
+	if err != nil {
+		return nil, err
+	}
+
+	org, err := s.orgRepo.FindByUID(ctx, organizationUID)
+	if err != nil {
+		return nil, err
+	}
+
+	if org == nil {
+		return nil, &OrganizationNotFound{}
+	}
+
+	return &OrganizationWithRole{
+		Organization: *org,
+		Role:         membership.Role,
+	}, nil
+}
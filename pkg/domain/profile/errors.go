@@ -0,0 +1,10 @@
+package profile
+
+type ProfileNotFound struct {
+	error
+}
+
+// VersionConflictError means the profile was updated since the client read it
+type VersionConflictError struct {
+	error
+}
@@ -0,0 +1,59 @@
+package profile
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	userStore "apart-deal-api/pkg/store/user"
+)
+
+type UpdateProfileInput struct {
+	UserUID string
+	// Version is the user version the client has read, the update is rejected if it has
+	// changed since, so that two devices don't overwrite each other
+	Version int
+	Update  userStore.ProfileUpdate
+}
+
+type ProfileService struct {
+	userRepo userStore.UserRepository
+}
+
+func NewProfileService(userRepo userStore.UserRepository) *ProfileService {
+	return &ProfileService{
+		userRepo: userRepo,
+	}
+}
+
+func (s *ProfileService) Get(ctx context.Context, userUID string) (*userStore.User, error) {
+	user, err := s.userRepo.FindByUID(ctx, userUID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, &ProfileNotFound{}
+		}
+
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *ProfileService) Update(ctx context.Context, input UpdateProfileInput) (*userStore.User, error) {
+	// not retried, the client has to see the latest profile before changing it
+	err := s.userRepo.UpdateProfile(ctx, input.UserUID, input.Version, input.Update, time.Now())
+	if _, ok := err.(*userStore.ConcurrentModificationError); ok {
+		return nil, &VersionConflictError{}
+	}
+
+	if err == mongo.ErrNoDocuments {
+		return nil, &ProfileNotFound{}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Get(ctx, input.UserUID)
+}
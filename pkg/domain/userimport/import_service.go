@@ -0,0 +1,164 @@
+package userimport
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"strings"
+	"time"
+
+	"apart-deal-api/pkg/security"
+	"apart-deal-api/pkg/tools"
+
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/pkg/errors"
+
+	identityDomain "apart-deal-api/pkg/domain/identity"
+	userStore "apart-deal-api/pkg/store/user"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+type Issue struct {
+	Line   int
+	Email  string
+	Reason string
+}
+
+type Report struct {
+	Imported   int
+	Duplicates []Issue
+	Invalid    []Issue
+}
+
+type ImportService struct {
+	userRepo userStore.UserRepository
+	emails   *identityDomain.EmailNormalizer
+}
+
+func NewImportService(userRepo userStore.UserRepository, emails *identityDomain.EmailNormalizer) *ImportService {
+	return &ImportService{
+		userRepo: userRepo,
+		emails:   emails,
+	}
+}
+
+// Import creates a confirmed user per row keeping the legacy hash, which is upgraded
+// to the current algorithm on the user's first sign-in. Bad rows and duplicates are
+// collected into the report, only infrastructure errors stop the import.
+func (s *ImportService) Import(ctx context.Context, reader RowReader) (*Report, error) {
+	report := &Report{
+		Duplicates: make([]Issue, 0),
+		Invalid:    make([]Issue, 0),
+	}
+
+	for {
+		row, err := reader.Next()
+		if err == io.EOF {
+			return report, nil
+		}
+
+		if err != nil {
+			if rowErr, ok := err.(*InvalidRowError); ok {
+				report.Invalid = append(report.Invalid, Issue{Line: rowErr.Line, Reason: rowErr.Reason})
+				continue
+			}
+
+			return report, err
+		}
+
+		row.Email = s.emails.Normalize(row.Email)
+
+		model, err := buildUser(row)
+		if err != nil {
+			report.Invalid = append(report.Invalid, Issue{Line: row.Line, Email: row.Email, Reason: err.Error()})
+			continue
+		}
+
+		model.EmailKey = s.emails.Key(model.Email)
+
+		if err := s.userRepo.Create(ctx, model); err != nil {
+			if _, ok := err.(*userStore.UserDuplicateError); ok {
+				report.Duplicates = append(report.Duplicates, Issue{Line: row.Line, Email: row.Email, Reason: "email is taken"})
+				continue
+			}
+
+			return report, err
+		}
+
+		report.Imported++
+	}
+}
+
+func buildUser(row *Row) (*userStore.User, error) {
+	if err := validation.ValidateStruct(
+		row,
+		validation.Field(&row.Email, validation.Required, is.Email, validation.Length(3, 50)),
+		validation.Field(&row.Name, validation.Length(0, 50)),
+		validation.Field(&row.Algorithm, validation.Required, validation.In(security.Pbkdf2Sha256ID, security.ScryptID)),
+		validation.Field(&row.Salt, validation.Required),
+		validation.Field(&row.Hash, validation.Required),
+	); err != nil {
+		return nil, err
+	}
+
+	salt, err := decodeBase64(row.Salt)
+	if err != nil {
+		return nil, errors.New("salt is not base64")
+	}
+
+	key, err := decodeBase64(row.Hash)
+	if err != nil {
+		return nil, errors.New("hash is not base64")
+	}
+
+	var passwordHash string
+
+	switch row.Algorithm {
+	case security.Pbkdf2Sha256ID:
+		if err := security.ValidatePbkdf2Params(row.Iterations, len(key)); err != nil {
+			return nil, err
+		}
+
+		passwordHash = security.EncodePbkdf2Sha256(row.Iterations, salt, key)
+	case security.ScryptID:
+		if err := security.ValidateScryptParams(row.N, row.R, row.P, len(key)); err != nil {
+			return nil, err
+		}
+
+		passwordHash = security.EncodeScrypt(row.N, row.R, row.P, salt, key)
+	}
+
+	createdAt := time.Now()
+	if row.CreatedAt != "" {
+		createdAt, err = time.Parse(time.RFC3339, row.CreatedAt)
+		if err != nil {
+			return nil, errors.New("createdAt is not RFC3339")
+		}
+	}
+
+	name := row.Name
+	if name == "" {
+		name = strings.SplitN(row.Email, "@", 2)[0]
+	}
+
+	confirmedAt := time.Now()
+
+	return &userStore.User{
+		UID:          tools.NewUUID().String(),
+		Name:         name,
+		Email:        row.Email,
+		Status:       userStore.StatusConfirmed,
+		PasswordHash: passwordHash,
+		CreatedAt:    createdAt,
+		ConfirmedAt:  &confirmedAt,
+	}, nil
+}
+
+func decodeBase64(value string) ([]byte, error) {
+	if decoded, err := base64.StdEncoding.DecodeString(value); err == nil {
+		return decoded, nil
+	}
+
+	return base64.RawStdEncoding.DecodeString(value)
+}
@@ -0,0 +1,193 @@
+package userimport
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// Row is a user exported from a legacy system, Salt and Hash are base64 encoded
+type Row struct {
+	Line int `json:"-"`
+
+	Email      string `json:"email"`
+	Name       string `json:"name"`
+	Algorithm  string `json:"algorithm"`
+	Salt       string `json:"salt"`
+	Hash       string `json:"hash"`
+	Iterations int    `json:"iterations"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	CreatedAt  string `json:"createdAt"`
+}
+
+// InvalidRowError is reported for a row which could not be parsed, the import goes on
+type InvalidRowError struct {
+	Line   int
+	Reason string
+}
+
+func (e *InvalidRowError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+}
+
+// RowReader returns io.EOF once there are no rows left
+type RowReader interface {
+	Next() (*Row, error)
+}
+
+func NewRowReader(r io.Reader, format string) (RowReader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVReader(r)
+	case FormatJSONL:
+		return newJSONLReader(r), nil
+	default:
+		return nil, errors.Errorf("Unknown import format: %s", format)
+	}
+}
+
+type jsonlReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newJSONLReader(r io.Reader) *jsonlReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	return &jsonlReader{
+		scanner: scanner,
+	}
+}
+
+func (r *jsonlReader) Next() (*Row, error) {
+	for r.scanner.Scan() {
+		r.line++
+
+		line := strings.TrimSpace(r.scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var row Row
+		if err := json.Unmarshal([]byte(line), &row); err != nil {
+			return nil, &InvalidRowError{Line: r.line, Reason: fmt.Sprintf("malformed json: %s", err)}
+		}
+
+		row.Line = r.line
+
+		return &row, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, io.EOF
+}
+
+// csvReader expects a header row, columns are matched by name:
+// email,name,algorithm,salt,hash,iterations,n,r,p,created_at
+type csvReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+	line    int
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read csv header")
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, required := range []string{"email", "algorithm", "salt", "hash"} {
+		if _, ok := columns[required]; !ok {
+			return nil, errors.Errorf("CSV header misses the %s column", required)
+		}
+	}
+
+	return &csvReader{
+		reader:  reader,
+		columns: columns,
+		line:    1,
+	}, nil
+}
+
+func (r *csvReader) Next() (*Row, error) {
+	record, err := r.reader.Read()
+	r.line++
+
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+
+	if err != nil {
+		if parseErr, ok := err.(*csv.ParseError); ok {
+			return nil, &InvalidRowError{Line: parseErr.Line, Reason: parseErr.Err.Error()}
+		}
+
+		return nil, err
+	}
+
+	row := &Row{
+		Line:      r.line,
+		Email:     r.field(record, "email"),
+		Name:      r.field(record, "name"),
+		Algorithm: r.field(record, "algorithm"),
+		Salt:      r.field(record, "salt"),
+		Hash:      r.field(record, "hash"),
+		CreatedAt: r.field(record, "created_at"),
+	}
+
+	for column, dest := range map[string]*int{
+		"iterations": &row.Iterations,
+		"n":          &row.N,
+		"r":          &row.R,
+		"p":          &row.P,
+	} {
+		raw := r.field(record, column)
+		if raw == "" {
+			continue
+		}
+
+		v, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, &InvalidRowError{Line: r.line, Reason: fmt.Sprintf("%s is not a number", column)}
+		}
+
+		*dest = v
+	}
+
+	return row, nil
+}
+
+func (r *csvReader) field(record []string, column string) string {
+	idx, ok := r.columns[column]
+	if !ok || idx >= len(record) {
+		return ""
+	}
+
+	return strings.TrimSpace(record[idx])
+}
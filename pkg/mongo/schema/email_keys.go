@@ -0,0 +1,135 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	emailKeysBatchSize = 500
+)
+
+// EmailCollision lists users whose emails have the same key, they have to be merged or
+// changed by hand before the unique index on emailKey can be built
+type EmailCollision struct {
+	EmailKey string   `bson:"_id"`
+	UIDs     []string `bson:"uids"`
+	Emails   []string `bson:"emails"`
+}
+
+// EmailCollisionsError fails the migration until the listed users are resolved by hand,
+// the keys filled so far are kept and the migration can be run again
+type EmailCollisionsError struct {
+	Collisions []EmailCollision
+}
+
+func (e *EmailCollisionsError) Error() string {
+	return fmt.Sprintf("%d email keys are shared by several users", len(e.Collisions))
+}
+
+// EmailKeysMigrations fills the key of users created before emails were normalized and
+// builds its unique index, it fails with EmailCollisionsError when keys aren't unique.
+//
+// Keys are only computed where missing, after a change of the normalization rules they
+// have to be unset to be computed again.
+func EmailKeysMigrations(ctx context.Context, db *mongo.Database, emailKey func(string) string) error {
+	if err := BackfillEmailKeys(ctx, db, emailKey); err != nil {
+		return err
+	}
+
+	collisions, err := FindEmailCollisions(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	if len(collisions) > 0 {
+		return &EmailCollisionsError{Collisions: collisions}
+	}
+
+	return AddEmailKeyIndexes(ctx, db)
+}
+
+func BackfillEmailKeys(ctx context.Context, db *mongo.Database, emailKey func(string) string) error {
+	cursor, err := db.Collection("users").Find(ctx, bson.M{
+		"emailKey": bson.M{"$in": bson.A{nil, ""}},
+	}, options.Find().SetProjection(bson.M{"email": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	batch := make([]mongo.WriteModel, 0, emailKeysBatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if _, err := db.Collection("users").BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(false)); err != nil {
+			return err
+		}
+
+		batch = batch[:0]
+
+		return nil
+	}
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			UID   string `bson:"_id"`
+			Email string `bson:"email"`
+		}
+
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+
+		batch = append(batch, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": doc.UID}).
+			SetUpdate(bson.M{"$set": bson.M{"emailKey": emailKey(doc.Email)}}))
+
+		if len(batch) == emailKeysBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	return flush()
+}
+
+func FindEmailCollisions(ctx context.Context, db *mongo.Database) ([]EmailCollision, error) {
+	cursor, err := db.Collection("users").Aggregate(ctx, mongo.Pipeline{
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id":    "$emailKey",
+			"uids":   bson.M{"$push": "$_id"},
+			"emails": bson.M{"$push": "$email"},
+			"count":  bson.M{"$sum": 1},
+		}}},
+		bson.D{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+		bson.D{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	collisions := make([]EmailCollision, 0)
+
+	if err := cursor.All(ctx, &collisions); err != nil {
+		return nil, err
+	}
+
+	return collisions, nil
+}
+
+func AddEmailKeyIndexes(ctx context.Context, db *mongo.Database) error {
+	return createIndexes("users", "uniq_email_key")(ctx, db)
+}
@@ -0,0 +1,303 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type IndexChangeType string
+
+const (
+	IndexCreate IndexChangeType = "create"
+	// IndexRecreate drops and creates again an index whose options drifted from its declaration
+	IndexRecreate IndexChangeType = "recreate"
+	IndexDrop     IndexChangeType = "drop"
+	// IndexUnknown is only reported, unknown indexes are dropped with DropUnknown
+	IndexUnknown IndexChangeType = "unknown"
+)
+
+type IndexChange struct {
+	Type       IndexChangeType
+	Collection string
+	Name       string
+	// Reason lists the differences of a drifted index
+	Reason string
+	Spec   *IndexSpec
+}
+
+func (c IndexChange) String() string {
+	if c.Reason != "" {
+		return fmt.Sprintf("%-8s %s.%s (%s)", c.Type, c.Collection, c.Name, c.Reason)
+	}
+
+	return fmt.Sprintf("%-8s %s.%s", c.Type, c.Collection, c.Name)
+}
+
+type IndexReconcilerSettings struct {
+	// DropUnknown drops the indexes of declared collections which aren't declared, they are
+	// only reported otherwise
+	DropUnknown bool
+}
+
+// IndexReconciler makes the indexes of the declared collections match their declarations.
+// Plan has no effect on the database, so that changes can be reviewed before Apply.
+type IndexReconciler struct {
+	db       *mongo.Database
+	declared []CollectionIndexes
+	settings IndexReconcilerSettings
+	owner    string
+}
+
+func NewIndexReconciler(
+	db *mongo.Database,
+	declared []CollectionIndexes,
+	settings IndexReconcilerSettings,
+) *IndexReconciler {
+	return &IndexReconciler{
+		db:       db,
+		declared: declared,
+		settings: settings,
+		owner:    lockOwner(),
+	}
+}
+
+type existingIndex struct {
+	Name                    string     `bson:"name"`
+	Key                     bson.D     `bson:"key"`
+	Unique                  bool       `bson:"unique"`
+	Sparse                  bool       `bson:"sparse"`
+	ExpireAfterSeconds      *int64     `bson:"expireAfterSeconds"`
+	PartialFilterExpression bson.D     `bson:"partialFilterExpression"`
+	Collation               *collation `bson:"collation"`
+}
+
+type collation struct {
+	Locale   string `bson:"locale"`
+	Strength int    `bson:"strength"`
+}
+
+// Plan lists the changes Apply would make, drops come first so that a recreated index or an
+// unknown index with the same keys doesn't conflict with the created ones
+func (r *IndexReconciler) Plan(ctx context.Context) ([]IndexChange, error) {
+	var drops, creates []IndexChange
+
+	for _, c := range r.declared {
+		existing, err := r.list(ctx, c.Collection)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range c.Indexes {
+			spec := &c.Indexes[i]
+
+			index, ok := existing[spec.Name]
+			if !ok {
+				creates = append(creates, IndexChange{Type: IndexCreate, Collection: c.Collection, Name: spec.Name, Spec: spec})
+
+				continue
+			}
+
+			if diff := indexDiff(spec, index); len(diff) > 0 {
+				drops = append(drops, IndexChange{
+					Type:       IndexRecreate,
+					Collection: c.Collection,
+					Name:       spec.Name,
+					Reason:     strings.Join(diff, ", "),
+					Spec:       spec,
+				})
+			}
+		}
+
+		unknown := make([]string, 0)
+
+		for name := range existing {
+			if _, ok := findIndexSpec(r.declared, c.Collection, name); !ok && name != "_id_" {
+				unknown = append(unknown, name)
+			}
+		}
+
+		sort.Strings(unknown)
+
+		for _, name := range unknown {
+			changeType := IndexUnknown
+			if r.settings.DropUnknown {
+				changeType = IndexDrop
+			}
+
+			drops = append(drops, IndexChange{Type: changeType, Collection: c.Collection, Name: name})
+		}
+	}
+
+	return append(drops, creates...), nil
+}
+
+// Apply makes the planned changes while holding the migrations lock, it stops at the first
+// failure
+func (r *IndexReconciler) Apply(ctx context.Context, changes []IndexChange) error {
+	return withMigrationsLock(ctx, r.db, r.owner, func(ctx context.Context) error {
+		for _, change := range changes {
+			indexes := r.db.Collection(change.Collection).Indexes()
+
+			switch change.Type {
+			case IndexDrop:
+				if _, err := indexes.DropOne(ctx, change.Name); err != nil && !isNotFound(err) {
+					return fmt.Errorf("%s: %w", change, err)
+				}
+			case IndexRecreate:
+				if _, err := indexes.DropOne(ctx, change.Name); err != nil && !isNotFound(err) {
+					return fmt.Errorf("%s: %w", change, err)
+				}
+
+				if _, err := indexes.CreateOne(ctx, change.Spec.Model()); err != nil {
+					return fmt.Errorf("%s: %w", change, err)
+				}
+			case IndexCreate:
+				if _, err := indexes.CreateOne(ctx, change.Spec.Model()); err != nil {
+					return fmt.Errorf("%s: %w", change, err)
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *IndexReconciler) list(ctx context.Context, collection string) (map[string]existingIndex, error) {
+	cursor, err := r.db.Collection(collection).Indexes().List(ctx)
+	if err != nil {
+		if isNotFound(err) {
+			return map[string]existingIndex{}, nil
+		}
+
+		return nil, err
+	}
+
+	var indexes []existingIndex
+
+	if err := cursor.All(ctx, &indexes); err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]existingIndex, len(indexes))
+
+	for _, index := range indexes {
+		existing[index.Name] = index
+	}
+
+	return existing, nil
+}
+
+// indexDiff lists how an existing index differs from its declaration, collation is only
+// compared on the declared fields since the server fills in the others
+func indexDiff(spec *IndexSpec, index existingIndex) []string {
+	var diff []string
+
+	if !sameDocument(spec.Keys, index.Key) {
+		diff = append(diff, fmt.Sprintf("keys %s instead of %s", extJSON(index.Key), extJSON(spec.Keys)))
+	}
+
+	if spec.Unique != index.Unique {
+		diff = append(diff, fmt.Sprintf("unique %t instead of %t", index.Unique, spec.Unique))
+	}
+
+	if spec.Sparse != index.Sparse {
+		diff = append(diff, fmt.Sprintf("sparse %t instead of %t", index.Sparse, spec.Sparse))
+	}
+
+	switch {
+	case spec.ExpireAfter == nil && index.ExpireAfterSeconds != nil:
+		diff = append(diff, fmt.Sprintf("expires after %ds instead of never", *index.ExpireAfterSeconds))
+	case spec.ExpireAfter != nil && index.ExpireAfterSeconds == nil:
+		diff = append(diff, fmt.Sprintf("never expires instead of after %s", spec.ExpireAfter))
+	case spec.ExpireAfter != nil && int64(spec.ExpireAfter.Seconds()) != *index.ExpireAfterSeconds:
+		diff = append(diff, fmt.Sprintf("expires after %ds instead of %s", *index.ExpireAfterSeconds, spec.ExpireAfter))
+	}
+
+	if !sameDocument(spec.PartialFilter, index.PartialFilterExpression) {
+		diff = append(diff, fmt.Sprintf(
+			"partial filter %s instead of %s",
+			extJSON(index.PartialFilterExpression),
+			extJSON(spec.PartialFilter),
+		))
+	}
+
+	switch {
+	case spec.Collation == nil && index.Collation != nil:
+		diff = append(diff, fmt.Sprintf("collation %s instead of none", index.Collation.Locale))
+	case spec.Collation != nil && index.Collation == nil:
+		diff = append(diff, fmt.Sprintf("no collation instead of %s", spec.Collation.Locale))
+	case spec.Collation != nil && (spec.Collation.Locale != index.Collation.Locale ||
+		(spec.Collation.Strength != 0 && spec.Collation.Strength != index.Collation.Strength)):
+		diff = append(diff, fmt.Sprintf(
+			"collation %s/%d instead of %s/%d",
+			index.Collation.Locale, index.Collation.Strength,
+			spec.Collation.Locale, spec.Collation.Strength,
+		))
+	}
+
+	return diff
+}
+
+// sameDocument compares documents in order, numbers are compared by value since the server
+// may return 1 as a double for an index created with an int
+func sameDocument(a bson.D, b bson.D) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].Key != b[i].Key {
+			return false
+		}
+
+		aNumber, aIsNumber := number(a[i].Value)
+		bNumber, bIsNumber := number(b[i].Value)
+
+		switch {
+		case aIsNumber || bIsNumber:
+			if !aIsNumber || !bIsNumber || aNumber != bNumber {
+				return false
+			}
+		default:
+			if extJSON(a[i].Value) != extJSON(b[i].Value) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+func extJSON(v interface{}) string {
+	if d, ok := v.(bson.D); ok && len(d) == 0 {
+		return "none"
+	}
+
+	b, err := bson.MarshalExtJSON(bson.M{"v": v}, false, false)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	// strips the wrapping document, MarshalExtJSON only accepts documents
+	return strings.TrimSuffix(strings.TrimPrefix(string(b), `{"v":`), "}")
+}
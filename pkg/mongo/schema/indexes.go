@@ -0,0 +1,307 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexSpec declares an index, fields left to their zero value aren't set on it
+type IndexSpec struct {
+	Name   string
+	Keys   bson.D
+	Unique bool
+	Sparse bool
+	// ExpireAfter makes a TTL index, 0 expires documents at the time of the indexed field
+	ExpireAfter   *time.Duration
+	PartialFilter bson.D
+	Collation     *options.Collation
+}
+
+type CollectionIndexes struct {
+	Collection string
+	Indexes    []IndexSpec
+}
+
+// Indexes declares the indexes of every collection, it's the reference used by the
+// reconciler and by index migrations
+func Indexes() []CollectionIndexes {
+	return []CollectionIndexes{
+		{
+			// deleted users have a deletedAt, so emails are only unique among the others
+			Collection: "users",
+			Indexes: []IndexSpec{
+				{
+					Name:   "uniq_email_live",
+					Keys:   bson.D{{Key: "email", Value: 1}, {Key: "deletedAt", Value: 1}},
+					Unique: true,
+				},
+				{
+					Name:   "uniq_email_key_live",
+					Keys:   bson.D{{Key: "emailKey", Value: 1}, {Key: "deletedAt", Value: 1}},
+					Unique: true,
+				},
+				{
+					Name: "deleted_at",
+					Keys: bson.D{{Key: "deletedAt", Value: 1}},
+					// only deleted users are looked up by deletedAt, by the purge
+					PartialFilter: bson.D{{Key: "deletedAt", Value: bson.D{{Key: "$exists", Value: true}}}},
+				},
+				{
+					// users to encrypt again are paged over by _id
+					Name: "key_generation_id",
+					Keys: bson.D{{Key: "keyGeneration", Value: 1}, {Key: "_id", Value: 1}},
+				},
+			},
+		},
+		{
+			Collection: "memberships",
+			Indexes: []IndexSpec{
+				{
+					Name:   "uniq_organization_user",
+					Keys:   bson.D{{Key: "organizationUid", Value: 1}, {Key: "userUid", Value: 1}},
+					Unique: true,
+				},
+				{
+					Name: "user",
+					Keys: bson.D{{Key: "userUid", Value: 1}},
+				},
+			},
+		},
+		{
+			Collection: "invitations",
+			Indexes: []IndexSpec{
+				{
+					Name:   "uniq_token",
+					Keys:   bson.D{{Key: "token", Value: 1}},
+					Unique: true,
+				},
+				{
+					// invitations of an organization are deleted with it
+					Name: "organization",
+					Keys: bson.D{{Key: "organizationUid", Value: 1}},
+				},
+			},
+		},
+		{
+			// events expire at their own expiresAt, so that the retention can be changed
+			// without rebuilding the index
+			Collection: "audit_events",
+			Indexes: []IndexSpec{
+				{
+					Name:        "ttl_expires_at",
+					Keys:        bson.D{{Key: "expiresAt", Value: 1}},
+					ExpireAfter: expireAt(),
+				},
+				{
+					Name: "created_at",
+					Keys: bson.D{{Key: "createdAt", Value: -1}},
+				},
+				{
+					Name: "user_created_at",
+					Keys: bson.D{{Key: "userUid", Value: 1}, {Key: "createdAt", Value: -1}},
+				},
+				{
+					Name: "type_created_at",
+					Keys: bson.D{{Key: "type", Value: 1}, {Key: "createdAt", Value: -1}},
+				},
+			},
+		},
+		{
+			Collection: "notifications",
+			Indexes: []IndexSpec{
+				{
+					Name:        "ttl_expires_at",
+					Keys:        bson.D{{Key: "expiresAt", Value: 1}},
+					ExpireAfter: expireAt(),
+				},
+			},
+		},
+		{
+			Collection: "known_devices",
+			Indexes: []IndexSpec{
+				{
+					Name:   "uniq_user_fingerprint",
+					Keys:   bson.D{{Key: "userUid", Value: 1}, {Key: "fingerprint", Value: 1}},
+					Unique: true,
+				},
+				{
+					Name: "revoke_token",
+					Keys: bson.D{{Key: "revokeToken", Value: 1}},
+				},
+			},
+		},
+		{
+			Collection: "challenges",
+			Indexes: []IndexSpec{
+				{
+					Name:        "ttl_expires_at",
+					Keys:        bson.D{{Key: "expiresAt", Value: 1}},
+					ExpireAfter: expireAt(),
+				},
+			},
+		},
+		{
+			Collection: "sessions",
+			Indexes: []IndexSpec{
+				{
+					Name:        "ttl_expires_at",
+					Keys:        bson.D{{Key: "expiresAt", Value: 1}},
+					ExpireAfter: expireAt(),
+				},
+				{
+					Name: "user",
+					Keys: bson.D{{Key: "userUid", Value: 1}},
+				},
+			},
+		},
+		{
+			// the queue of codes to send only indexes sign-up requests
+			Collection: "verification_requests",
+			Indexes: []IndexSpec{
+				{
+					Name:        "ttl_expires_at",
+					Keys:        bson.D{{Key: "expiresAt", Value: 1}},
+					ExpireAfter: expireAt(),
+				},
+				{
+					Name:   "uniq_type_token",
+					Keys:   bson.D{{Key: "type", Value: 1}, {Key: "token", Value: 1}},
+					Unique: true,
+				},
+				{
+					Name: "user_type",
+					Keys: bson.D{{Key: "userUid", Value: 1}, {Key: "type", Value: 1}},
+				},
+				{
+					Name:          "sign_up_not_notified",
+					Keys:          bson.D{{Key: "notifiedAt", Value: 1}, {Key: "createdAt", Value: 1}},
+					PartialFilter: bson.D{{Key: "type", Value: "sign_up"}},
+				},
+			},
+		},
+	}
+}
+
+// retiredIndexes were replaced by later migrations, they're only declared for the migrations
+// which created them
+func retiredIndexes() []CollectionIndexes {
+	return []CollectionIndexes{
+		{
+			Collection: "users",
+			Indexes: []IndexSpec{
+				{
+					Name:   "uniq_email",
+					Keys:   bson.D{{Key: "email", Value: 1}},
+					Unique: true,
+				},
+				{
+					Name:   "uniq_email_key",
+					Keys:   bson.D{{Key: "emailKey", Value: 1}},
+					Unique: true,
+				},
+			},
+		},
+	}
+}
+
+func expireAt() *time.Duration {
+	var expireAfter time.Duration
+
+	return &expireAfter
+}
+
+func (s IndexSpec) Model() mongo.IndexModel {
+	opts := options.Index().SetName(s.Name)
+
+	if s.Unique {
+		opts.SetUnique(true)
+	}
+
+	if s.Sparse {
+		opts.SetSparse(true)
+	}
+
+	if s.ExpireAfter != nil {
+		opts.SetExpireAfterSeconds(int32(s.ExpireAfter.Seconds()))
+	}
+
+	if len(s.PartialFilter) > 0 {
+		opts.SetPartialFilterExpression(s.PartialFilter)
+	}
+
+	if s.Collation != nil {
+		opts.SetCollation(s.Collation)
+	}
+
+	return mongo.IndexModel{
+		Keys:    s.Keys,
+		Options: opts,
+	}
+}
+
+func findIndexSpec(declared []CollectionIndexes, collection string, name string) (IndexSpec, bool) {
+	for _, c := range declared {
+		if c.Collection != collection {
+			continue
+		}
+
+		for _, spec := range c.Indexes {
+			if spec.Name == name {
+				return spec, true
+			}
+		}
+	}
+
+	return IndexSpec{}, false
+}
+
+// createIndexes builds the up step of an index migration, the named indexes are created as
+// they're declared by Indexes or retiredIndexes
+func createIndexes(collection string, names ...string) func(ctx context.Context, db *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		models := make([]mongo.IndexModel, 0, len(names))
+		declared := append(Indexes(), retiredIndexes()...)
+
+		for _, name := range names {
+			spec, ok := findIndexSpec(declared, collection, name)
+			if !ok {
+				return fmt.Errorf("index %s.%s isn't declared", collection, name)
+			}
+
+			models = append(models, spec.Model())
+		}
+
+		_, err := db.Collection(collection).Indexes().CreateMany(ctx, models)
+
+		return err
+	}
+}
+
+// dropIndexes builds the down step of an index migration, indexes which are already gone
+// are skipped so that a failed down can be run again
+func dropIndexes(collection string, names ...string) func(ctx context.Context, db *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		for _, name := range names {
+			if _, err := db.Collection(collection).Indexes().DropOne(ctx, name); err != nil {
+				if isNotFound(err) {
+					continue
+				}
+
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+func isNotFound(err error) bool {
+	cmdErr, ok := err.(mongo.CommandError)
+
+	return ok && (cmdErr.Name == "IndexNotFound" || cmdErr.Name == "NamespaceNotFound")
+}
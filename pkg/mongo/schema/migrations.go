@@ -2,39 +2,186 @@ package schema
 
 import (
 	"context"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func UsersMigrations(ctx context.Context, db *mongo.Database) error {
-	if err := AddUsersIndexes(ctx, db); err != nil {
-		return err
-	}
+// MigrationSettings holds what migrations need from the configuration of the app
+type MigrationSettings struct {
+	// EmailKey identifies a user by their email, see identity.EmailNormalizer
+	EmailKey func(email string) string
+	// SignUpExpiration is the lifetime of a sign-up request
+	SignUpExpiration time.Duration
+	// NotificationRetention is the lifetime of a notification, sent or not
+	NotificationRetention time.Duration
+	// RevokeTokenExpiration is the lifetime of the revoke token of a known device
+	RevokeTokenExpiration time.Duration
+	Validation            ValidationSettings
+}
+
+// Migrations is the registry of every migration, a released version must never change,
+// a new one has to be added instead. Index migrations create indexes as declared by Indexes,
+// later changes of a declaration are applied by the IndexReconciler. Likewise validators
+// follow the stored structs and are applied again with ApplyValidators.
+func Migrations(settings MigrationSettings) []Migration {
+	return []Migration{
+		{
+			Version: 1,
+			Name:    "users_indexes",
+			Up:      createIndexes("users", "uniq_email"),
+			Down:    dropIndexes("users", "uniq_email"),
+		},
+		{
+			Version: 2,
+			Name:    "organizations_indexes",
+			Up:      AddOrganizationsIndexes,
+			Down:    DropOrganizationsIndexes,
+		},
+		{
+			Version: 3,
+			Name:    "audit_events_indexes",
+			Up:      createIndexes("audit_events", auditEventsIndexes...),
+			Down:    dropIndexes("audit_events", auditEventsIndexes...),
+		},
+		{
+			Version: 4,
+			Name:    "known_devices_indexes",
+			Up:      createIndexes("known_devices", "uniq_user_fingerprint", "revoke_token"),
+			Down:    dropIndexes("known_devices", "uniq_user_fingerprint", "revoke_token"),
+		},
+		{
+			Version: 5,
+			Name:    "challenges_indexes",
+			Up:      createIndexes("challenges", "ttl_expires_at"),
+			Down:    dropIndexes("challenges", "ttl_expires_at"),
+		},
+		{
+			Version: 6,
+			Name:    "sessions_indexes",
+			Up:      createIndexes("sessions", "ttl_expires_at", "user"),
+			Down:    dropIndexes("sessions", "ttl_expires_at", "user"),
+		},
+		{
+			Version: 7,
+			Name:    "verification_requests_indexes",
+			Up:      createIndexes("verification_requests", verificationRequestsIndexes...),
+			Down:    dropIndexes("verification_requests", verificationRequestsIndexes...),
+		},
+		{
+			Version: 8,
+			Name:    "move_embedded_verification_requests",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				return MoveEmbeddedRequests(ctx, db, settings.SignUpExpiration)
+			},
+		},
+		{
+			Version: 9,
+			Name:    "email_keys",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				return EmailKeysMigrations(ctx, db, settings.EmailKey)
+			},
+			Down: dropIndexes("users", "uniq_email_key"),
+		},
+		{
+			Version: 10,
+			Name:    "notifications_expiry",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				return ExpireNotifications(ctx, db, settings.NotificationRetention, settings.RevokeTokenExpiration)
+			},
+			// expiries are kept, they're ignored by the previous versions
+			Down: dropIndexes("notifications", "ttl_expires_at"),
+		},
+		{
+			Version: 11,
+			Name:    "collection_validators",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				return ApplyValidators(ctx, db, Validators(), settings.Validation)
+			},
+			Down: func(ctx context.Context, db *mongo.Database) error {
+				return RemoveValidators(ctx, db, Validators())
+			},
+		},
+		{
+			Version: 12,
+			Name:    "user_versions",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				// users are only checked against the new validator once they have a version,
+				// see the moderate validation level
+				if err := ApplyValidators(ctx, db, Validators(), settings.Validation); err != nil {
+					return err
+				}
+
+				return UserVersions(ctx, db)
+			},
+			Down: RevertUserVersions,
+		},
+		{
+			Version: 13,
+			Name:    "users_soft_delete",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				// the new unique indexes are built first, so that emails stay unique meanwhile
+				if err := createIndexes("users", usersSoftDeleteIndexes...)(ctx, db); err != nil {
+					return err
+				}
 
-	return nil
+				return dropIndexes("users", "uniq_email", "uniq_email_key")(ctx, db)
+			},
+			Down: func(ctx context.Context, db *mongo.Database) error {
+				// fails while a deleted user shares its email with another user
+				if err := createIndexes("users", "uniq_email", "uniq_email_key")(ctx, db); err != nil {
+					return err
+				}
+
+				return dropIndexes("users", usersSoftDeleteIndexes...)(ctx, db)
+			},
+		},
+		{
+			Version: 14,
+			Name:    "invitations_organization_index",
+			Up:      createIndexes("invitations", "organization"),
+			Down:    dropIndexes("invitations", "organization"),
+		},
+		{
+			Version: 15,
+			Name:    "users_key_generation_index",
+			Up:      createIndexes("users", "key_generation_id"),
+			Down:    dropIndexes("users", "key_generation_id"),
+		},
+		{
+			Version: 16,
+			Name:    "sessions_without_profile",
+			// sessions read the profile from the user, the copies are removed
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				_, err := db.Collection("sessions").UpdateMany(ctx, bson.M{}, bson.M{
+					"$unset": bson.M{"email": "", "name": "", "locale": "", "timezone": ""},
+				})
+
+				return err
+			},
+		},
+	}
 }
 
-func AddUsersIndexes(ctx context.Context, db *mongo.Database) error {
-	if _, err := db.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
-		Keys:    bson.M{"email": 1},
-		Options: options.Index().SetUnique(true).SetName("uniq_email"),
-	}); err != nil {
-		if cmdErr, ok := err.(mongo.CommandError); ok && cmdErr.Name == "DuplicateKey" {
-			return nil
-		}
+var (
+	auditEventsIndexes          = []string{"ttl_expires_at", "created_at", "user_created_at", "type_created_at"}
+	verificationRequestsIndexes = []string{"ttl_expires_at", "uniq_type_token", "user_type", "sign_up_not_notified"}
+	usersSoftDeleteIndexes      = []string{"uniq_email_live", "uniq_email_key_live", "deleted_at"}
+)
 
+func AddOrganizationsIndexes(ctx context.Context, db *mongo.Database) error {
+	if err := createIndexes("memberships", "uniq_organization_user", "user")(ctx, db); err != nil {
 		return err
 	}
 
-	return nil
+	return createIndexes("invitations", "uniq_token")(ctx, db)
 }
 
-func Migrate(ctx context.Context, db *mongo.Database) error {
-	if err := UsersMigrations(ctx, db); err != nil {
+func DropOrganizationsIndexes(ctx context.Context, db *mongo.Database) error {
+	if err := dropIndexes("memberships", "uniq_organization_user", "user")(ctx, db); err != nil {
 		return err
 	}
 
-	return nil
+	return dropIndexes("invitations", "uniq_token")(ctx, db)
 }
@@ -0,0 +1,421 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	MigrationsCollectionName     = "schema_migrations"
+	MigrationsLockCollectionName = "schema_migrations_lock"
+
+	// MigrationsLockTTL is how long a lock left by a crashed run blocks the next ones
+	MigrationsLockTTL = time.Minute * 15
+	// MigrationsLockRenewal is how often a running process extends its lock, a few renewals
+	// can fail in a row before the lock expires
+	MigrationsLockRenewal = MigrationsLockTTL / 5
+
+	migrationsLockID = "lock"
+)
+
+// Migration is a versioned change of the schema, versions are applied in ascending order
+// and reverted in descending order
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+	// Down is nil for migrations which can't be reverted, e.g. moving data
+	Down func(ctx context.Context, db *mongo.Database) error
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+type appliedMigration struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"appliedAt"`
+}
+
+type MigrationsLockedError struct {
+	error
+}
+
+func (e *MigrationsLockedError) Error() string {
+	return "Migrations are being run by another process"
+}
+
+// MigrationsLockLostError stops a run whose lock couldn't be renewed, another process may
+// have taken it over once it expired
+type MigrationsLockLostError struct {
+	error
+}
+
+func (e *MigrationsLockLostError) Error() string {
+	return fmt.Sprintf("Migrations lock was lost: %s", e.error)
+}
+
+type IrreversibleMigrationError struct {
+	Version int
+	Name    string
+}
+
+func (e *IrreversibleMigrationError) Error() string {
+	return fmt.Sprintf("Migration %d %s can't be reverted", e.Version, e.Name)
+}
+
+type UnknownMigrationError struct {
+	Version int
+}
+
+func (e *UnknownMigrationError) Error() string {
+	return fmt.Sprintf("Migration %d doesn't exist", e.Version)
+}
+
+// SchemaOutdatedError is returned by Verify, the pending migrations have to be applied
+// with the migrate CLI
+type SchemaOutdatedError struct {
+	Pending []int
+}
+
+func (e *SchemaOutdatedError) Error() string {
+	return fmt.Sprintf("Schema is outdated, pending migrations: %v", e.Pending)
+}
+
+type Migrator struct {
+	db         *mongo.Database
+	migrations []Migration
+	owner      string
+}
+
+func NewMigrator(db *mongo.Database, migrations []Migration) *Migrator {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	return &Migrator{
+		db:         db,
+		migrations: sorted,
+		owner:      lockOwner(),
+	}
+}
+
+// Status lists every known migration, AppliedAt is nil for pending ones
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Migration: migration}
+
+		if record, ok := applied[migration.Version]; ok {
+			appliedAt := record.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Verify fails with SchemaOutdatedError when a known migration hasn't been applied, versions
+// applied by a newer release are tolerated so that it can be rolled back
+func (m *Migrator) Verify(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	var pending []int
+
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending = append(pending, status.Version)
+		}
+	}
+
+	if len(pending) > 0 {
+		return &SchemaOutdatedError{Pending: pending}
+	}
+
+	return nil
+}
+
+// Up applies every pending migration and returns them, it stops at the first failure
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	if len(m.migrations) == 0 {
+		return nil, nil
+	}
+
+	return m.To(ctx, m.migrations[len(m.migrations)-1].Version)
+}
+
+// Down reverts the latest applied migration, nil is returned when none is applied
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	var reverted *Migration
+
+	err := m.withLock(ctx, func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			if _, ok := applied[m.migrations[i].Version]; !ok {
+				continue
+			}
+
+			if err := m.revert(ctx, m.migrations[i]); err != nil {
+				return err
+			}
+
+			reverted = &m.migrations[i]
+
+			return nil
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// To applies the pending migrations up to version and reverts the applied ones above it,
+// version 0 reverts everything. Nothing is run when one of the migrations to revert is
+// irreversible.
+func (m *Migrator) To(ctx context.Context, version int) ([]Migration, error) {
+	if version != 0 && !m.exists(version) {
+		return nil, &UnknownMigrationError{Version: version}
+	}
+
+	var run []Migration
+
+	err := m.withLock(ctx, func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		var toApply, toRevert []Migration
+
+		for _, migration := range m.migrations {
+			_, isApplied := applied[migration.Version]
+
+			if migration.Version <= version && !isApplied {
+				toApply = append(toApply, migration)
+			}
+
+			if migration.Version > version && isApplied {
+				if migration.Down == nil {
+					return &IrreversibleMigrationError{Version: migration.Version, Name: migration.Name}
+				}
+
+				toRevert = append([]Migration{migration}, toRevert...)
+			}
+		}
+
+		for _, migration := range toApply {
+			if err := m.apply(ctx, migration); err != nil {
+				return err
+			}
+
+			run = append(run, migration)
+		}
+
+		for _, migration := range toRevert {
+			if err := m.revert(ctx, migration); err != nil {
+				return err
+			}
+
+			run = append(run, migration)
+		}
+
+		return nil
+	})
+
+	return run, err
+}
+
+func (m *Migrator) apply(ctx context.Context, migration Migration) error {
+	if err := migration.Up(ctx, m.db); err != nil {
+		return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+	}
+
+	_, err := m.db.Collection(MigrationsCollectionName).InsertOne(ctx, appliedMigration{
+		Version:   migration.Version,
+		Name:      migration.Name,
+		AppliedAt: time.Now(),
+	})
+
+	return err
+}
+
+func (m *Migrator) revert(ctx context.Context, migration Migration) error {
+	if migration.Down == nil {
+		return &IrreversibleMigrationError{Version: migration.Version, Name: migration.Name}
+	}
+
+	if err := migration.Down(ctx, m.db); err != nil {
+		return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+	}
+
+	_, err := m.db.Collection(MigrationsCollectionName).DeleteOne(ctx, bson.M{
+		"_id": migration.Version,
+	})
+
+	return err
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]appliedMigration, error) {
+	cursor, err := m.db.Collection(MigrationsCollectionName).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	var records []appliedMigration
+
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]appliedMigration, len(records))
+
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+
+	return applied, nil
+}
+
+func (m *Migrator) exists(version int) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *Migrator) withLock(ctx context.Context, fn func(ctx context.Context) error) error {
+	return withMigrationsLock(ctx, m.db, m.owner, fn)
+}
+
+// withMigrationsLock runs fn while holding the lock document, it can only be taken over once
+// it has expired so that two replicas never change the schema concurrently. The lock is
+// renewed while fn runs, the context of fn is cancelled as soon as a renewal fails.
+func withMigrationsLock(ctx context.Context, db *mongo.Database, owner string, fn func(ctx context.Context) error) error {
+	now := time.Now()
+
+	_, err := db.Collection(MigrationsLockCollectionName).UpdateOne(ctx, bson.M{
+		"_id":       migrationsLockID,
+		"expiresAt": bson.M{"$lt": now},
+	}, bson.M{
+		"$set": bson.M{
+			"owner":     owner,
+			"lockedAt":  now,
+			"expiresAt": now.Add(MigrationsLockTTL),
+		},
+	}, options.Update().SetUpsert(true))
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return &MigrationsLockedError{}
+		}
+
+		return err
+	}
+
+	defer func() {
+		_, _ = db.Collection(MigrationsLockCollectionName).DeleteOne(context.Background(), bson.M{
+			"_id":   migrationsLockID,
+			"owner": owner,
+		})
+	}()
+
+	fnCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	lost := make(chan error, 1)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		if err := renewMigrationsLock(fnCtx, db, owner); err != nil {
+			lost <- err
+			cancel()
+		}
+	}()
+
+	err = fn(fnCtx)
+
+	cancel()
+	<-done
+
+	select {
+	case lostErr := <-lost:
+		return &MigrationsLockLostError{lostErr}
+	default:
+		return err
+	}
+}
+
+// renewMigrationsLock extends the lock of owner until ctx is done, it fails once the lock
+// has expired without being renewed or belongs to another process
+func renewMigrationsLock(ctx context.Context, db *mongo.Database, owner string) error {
+	ticker := time.NewTicker(MigrationsLockRenewal)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+
+		result, err := db.Collection(MigrationsLockCollectionName).UpdateOne(ctx, bson.M{
+			"_id":       migrationsLockID,
+			"owner":     owner,
+			"expiresAt": bson.M{"$gt": now},
+		}, bson.M{
+			"$set": bson.M{"expiresAt": now.Add(MigrationsLockTTL)},
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			// the lock is still held, the next tick tries again
+			continue
+		}
+
+		if result.MatchedCount == 0 {
+			return fmt.Errorf("the lock of %s has expired or was taken over", owner)
+		}
+	}
+}
+
+func lockOwner() string {
+	hostname, _ := os.Hostname()
+
+	return fmt.Sprintf("%s:%d", hostname, os.Getpid())
+}
@@ -0,0 +1,59 @@
+package schema
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ExpireNotifications gives an expiry to the notifications and the device revoke tokens
+// created before they had one, tokens of sent notifications are removed as they are by
+// the worker. The TTL index of notifications is built last, so that it only sees
+// notifications with an expiry.
+func ExpireNotifications(
+	ctx context.Context,
+	db *mongo.Database,
+	retention time.Duration,
+	revokeTokenExpiration time.Duration,
+) error {
+	if _, err := db.Collection("notifications").UpdateMany(ctx, bson.M{
+		"sentAt":     bson.M{"$ne": nil},
+		"data.token": bson.M{"$exists": true},
+	}, bson.M{
+		"$unset": bson.M{"data.token": ""},
+	}); err != nil {
+		return err
+	}
+
+	if err := backfillExpiry(ctx, db, "notifications", "expiresAt", "createdAt", retention); err != nil {
+		return err
+	}
+
+	if err := backfillExpiry(ctx, db, "known_devices", "revokeTokenExpiresAt", "firstSeenAt", revokeTokenExpiration); err != nil {
+		return err
+	}
+
+	return createIndexes("notifications", "ttl_expires_at")(ctx, db)
+}
+
+// backfillExpiry sets field where it's missing to the time of from plus lifetime
+func backfillExpiry(
+	ctx context.Context,
+	db *mongo.Database,
+	collection string,
+	field string,
+	from string,
+	lifetime time.Duration,
+) error {
+	_, err := db.Collection(collection).UpdateMany(ctx, bson.M{
+		field: bson.M{"$exists": false},
+	}, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			field: bson.M{"$add": bson.A{"$" + from, lifetime.Milliseconds()}},
+		}}},
+	})
+
+	return err
+}
@@ -0,0 +1,43 @@
+package schema
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// UserVersions turns the profile version into the version of the whole user, which every
+// update increments, and starts users without any at 0. Profile versions are kept so
+// that the version clients have read stays valid.
+func UserVersions(ctx context.Context, db *mongo.Database) error {
+	users := db.Collection("users")
+
+	if _, err := users.UpdateMany(ctx, bson.M{
+		"profileVersion": bson.M{"$exists": true},
+	}, bson.M{
+		"$rename": bson.M{"profileVersion": "version"},
+	}); err != nil {
+		return err
+	}
+
+	_, err := users.UpdateMany(ctx, bson.M{
+		"version": bson.M{"$exists": false},
+	}, bson.M{
+		"$set": bson.M{"version": 0},
+	})
+
+	return err
+}
+
+// RevertUserVersions gives the version back to profiles, it only grows so clients never
+// see a version they have already read for a different profile
+func RevertUserVersions(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("users").UpdateMany(ctx, bson.M{
+		"version": bson.M{"$exists": true},
+	}, bson.M{
+		"$rename": bson.M{"version": "profileVersion"},
+	})
+
+	return err
+}
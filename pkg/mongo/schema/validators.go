@@ -0,0 +1,340 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"apart-deal-api/pkg/store/audit"
+	"apart-deal-api/pkg/store/challenge"
+	"apart-deal-api/pkg/store/datakey"
+	"apart-deal-api/pkg/store/device"
+	"apart-deal-api/pkg/store/notification"
+	"apart-deal-api/pkg/store/organization"
+	"apart-deal-api/pkg/store/session"
+	"apart-deal-api/pkg/store/user"
+	"apart-deal-api/pkg/store/verification"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ValidationSettings are the validationLevel and validationAction of every validated
+// collection, see the $jsonSchema documentation of Mongo for their values
+type ValidationSettings struct {
+	Level  string
+	Action string
+}
+
+var DefaultValidationSettings = ValidationSettings{
+	// documents which were already invalid can still be updated
+	Level:  "moderate",
+	Action: "error",
+}
+
+// CollectionValidator derives the $jsonSchema of a collection from the struct stored in it,
+// fields without omitempty are required. Unknown fields are allowed so that documents
+// written before a field was removed stay valid.
+type CollectionValidator struct {
+	Collection string
+	Model      interface{}
+	// Enums restricts the values of string fields, keys are dotted bson paths
+	Enums map[string][]string
+}
+
+// Validators lists the validated collections, they are applied by the migration
+// collection_validators and again by the migrate CLI after a struct changes
+func Validators() []CollectionValidator {
+	return []CollectionValidator{
+		{
+			Collection: user.CollectionName,
+			Model:      user.User{},
+			Enums: map[string][]string{
+				"status": enum(user.StatusPending, user.StatusConfirmed),
+			},
+		},
+		{
+			Collection: verification.CollectionName,
+			Model:      verification.Request{},
+			Enums: map[string][]string{
+				"type": enum(verification.TypeSignUp, verification.TypePasswordReset, verification.TypeEmailChange),
+			},
+		},
+		{
+			Collection: organization.CollectionName,
+			Model:      organization.Organization{},
+		},
+		{
+			Collection: organization.MembershipsCollectionName,
+			Model:      organization.Membership{},
+			Enums: map[string][]string{
+				"role": enum(organization.Roles...),
+			},
+		},
+		{
+			Collection: organization.InvitationsCollectionName,
+			Model:      organization.Invitation{},
+			Enums: map[string][]string{
+				"role":   enum(organization.Roles...),
+				"status": enum(organization.InvitationStatusPending, organization.InvitationStatusAccepted),
+			},
+		},
+		{
+			Collection: audit.CollectionName,
+			Model:      audit.Event{},
+			Enums: map[string][]string{
+				"outcome": enum(audit.OutcomeSuccess, audit.OutcomeFailure),
+			},
+		},
+		{
+			Collection: notification.CollectionName,
+			Model:      notification.Notification{},
+			Enums: map[string][]string{
+				"type": enum(notification.TypeSignUpAttempt, notification.TypeNewDevice, notification.TypePasswordReset),
+			},
+		},
+		{
+			Collection: device.CollectionName,
+			Model:      device.KnownDevice{},
+		},
+		{
+			Collection: challenge.CollectionName,
+			Model:      challenge.Challenge{},
+		},
+		{
+			Collection: session.CollectionName,
+			Model:      session.Session{},
+		},
+		{
+			Collection: datakey.CollectionName,
+			Model:      datakey.DataKey{},
+		},
+	}
+}
+
+func enum[T ~string](values ...T) []string {
+	strs := make([]string, 0, len(values))
+
+	for _, v := range values {
+		strs = append(strs, string(v))
+	}
+
+	return strs
+}
+
+// JSONSchema fails when a field has a type with no bson counterpart or when an enum
+// targets a field which isn't a string of the struct
+func (v CollectionValidator) JSONSchema() (bson.M, error) {
+	used := make(map[string]bool, len(v.Enums))
+
+	schema, err := v.structSchema(reflect.TypeOf(v.Model), "", used)
+	if err != nil {
+		return nil, err
+	}
+
+	for path := range v.Enums {
+		if !used[path] {
+			return nil, fmt.Errorf("%s: enum of %s doesn't match a string field", v.Collection, path)
+		}
+	}
+
+	return schema, nil
+}
+
+func (v CollectionValidator) structSchema(t reflect.Type, prefix string, used map[string]bool) (bson.M, error) {
+	properties := bson.M{}
+	required := bson.A{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, omitEmpty := bsonName(field)
+		if name == "-" {
+			continue
+		}
+
+		path := prefix + name
+
+		schema, err := v.typeSchema(field.Type, path, used)
+		if err != nil {
+			return nil, err
+		}
+
+		properties[name] = schema
+
+		if !omitEmpty {
+			required = append(required, name)
+		}
+	}
+
+	schema := bson.M{
+		"bsonType":   "object",
+		"properties": properties,
+	}
+
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+
+	return schema, nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (v CollectionValidator) typeSchema(t reflect.Type, path string, used map[string]bool) (bson.M, error) {
+	if t == timeType {
+		return bson.M{"bsonType": "date"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		schema := bson.M{"bsonType": "string"}
+
+		if values, ok := v.Enums[path]; ok {
+			schema["enum"] = values
+			used[path] = true
+		}
+
+		return schema, nil
+	case reflect.Bool:
+		return bson.M{"bsonType": "bool"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// the driver stores an int as int32 when it fits
+		return bson.M{"bsonType": bson.A{"int", "long"}}, nil
+	case reflect.Float32, reflect.Float64:
+		return bson.M{"bsonType": "double"}, nil
+	case reflect.Ptr:
+		schema, err := v.typeSchema(t.Elem(), path, used)
+		if err != nil {
+			return nil, err
+		}
+
+		return nullable(schema), nil
+	case reflect.Slice:
+		items, err := v.typeSchema(t.Elem(), path+".$", used)
+		if err != nil {
+			return nil, err
+		}
+
+		// nil slices are stored as null
+		return bson.M{"bsonType": bson.A{"array", "null"}, "items": items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("%s: %s has no bson counterpart", path, t)
+		}
+
+		values, err := v.typeSchema(t.Elem(), path+".$", used)
+		if err != nil {
+			return nil, err
+		}
+
+		// nil maps are stored as null
+		return bson.M{"bsonType": bson.A{"object", "null"}, "additionalProperties": values}, nil
+	case reflect.Struct:
+		return v.structSchema(t, path+".", used)
+	default:
+		return nil, fmt.Errorf("%s: %s has no bson counterpart", path, t)
+	}
+}
+
+func nullable(schema bson.M) bson.M {
+	switch bsonType := schema["bsonType"].(type) {
+	case string:
+		schema["bsonType"] = bson.A{bsonType, "null"}
+	case bson.A:
+		for _, t := range bsonType {
+			if t == "null" {
+				return schema
+			}
+		}
+
+		schema["bsonType"] = append(bsonType, "null")
+	}
+
+	return schema
+}
+
+// bsonName follows the rules of the driver, a field without tag is stored lowercased
+func bsonName(field reflect.StructField) (string, bool) {
+	tag, ok := field.Tag.Lookup("bson")
+	if !ok {
+		return strings.ToLower(field.Name), false
+	}
+
+	parts := strings.Split(tag, ",")
+
+	name := parts[0]
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+
+	omitEmpty := false
+
+	for _, option := range parts[1:] {
+		if option == "omitempty" {
+			omitEmpty = true
+		}
+	}
+
+	return name, omitEmpty
+}
+
+// ApplyValidators sets the validators on existing collections and creates the missing ones
+func ApplyValidators(
+	ctx context.Context,
+	db *mongo.Database,
+	validators []CollectionValidator,
+	settings ValidationSettings,
+) error {
+	for _, v := range validators {
+		schema, err := v.JSONSchema()
+		if err != nil {
+			return err
+		}
+
+		validator := bson.M{"$jsonSchema": schema}
+
+		err = db.RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: v.Collection},
+			{Key: "validator", Value: validator},
+			{Key: "validationLevel", Value: settings.Level},
+			{Key: "validationAction", Value: settings.Action},
+		}).Err()
+		if err == nil {
+			continue
+		}
+
+		if !isNotFound(err) {
+			return fmt.Errorf("%s: %w", v.Collection, err)
+		}
+
+		if err := db.CreateCollection(ctx, v.Collection, options.CreateCollection().
+			SetValidator(validator).
+			SetValidationLevel(settings.Level).
+			SetValidationAction(settings.Action)); err != nil {
+			return fmt.Errorf("%s: %w", v.Collection, err)
+		}
+	}
+
+	return nil
+}
+
+func RemoveValidators(ctx context.Context, db *mongo.Database, validators []CollectionValidator) error {
+	for _, v := range validators {
+		err := db.RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: v.Collection},
+			{Key: "validator", Value: bson.M{}},
+		}).Err()
+		if err != nil && !isNotFound(err) {
+			return fmt.Errorf("%s: %w", v.Collection, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package schema
+
+import (
+	"context"
+	"time"
+
+	"apart-deal-api/pkg/tools"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	verificationRequestsBatchSize = 500
+)
+
+// MoveEmbeddedRequests moves the requests still embedded in users into
+// verification_requests and drops the indexes which served them. Embedded sign-up requests
+// had no expiry of their own, it's computed from the creation of the user with
+// signUpExpiration.
+func MoveEmbeddedRequests(ctx context.Context, db *mongo.Database, signUpExpiration time.Duration) error {
+	if err := MoveEmbeddedSignUpRequests(ctx, db, signUpExpiration); err != nil {
+		return err
+	}
+
+	if err := MoveEmbeddedPasswordResetRequests(ctx, db); err != nil {
+		return err
+	}
+
+	return dropIndexes("users", "password_reset_token", "pending_not_notified")(ctx, db)
+}
+
+// embeddedRequests is the shape of users before requests moved to verification_requests
+type embeddedRequests struct {
+	UID       string    `bson:"_id"`
+	CreatedAt time.Time `bson:"createdAt"`
+	SignUpReq *struct {
+		Token             string     `bson:"token"`
+		Code              string     `bson:"code"`
+		NotifiedAt        *time.Time `bson:"notifiedAt"`
+		InvitationToken   string     `bson:"invitationToken"`
+		ResentAt          *time.Time `bson:"resentAt"`
+		ResendWindowStart *time.Time `bson:"resendWindowStart"`
+		ResendCount       int        `bson:"resendCount"`
+		FailedAttempts    int        `bson:"failedAttempts"`
+	} `bson:"signUpReq"`
+	PasswordResetReq *struct {
+		Token     string    `bson:"token"`
+		CreatedAt time.Time `bson:"createdAt"`
+		ExpiresAt time.Time `bson:"expiresAt"`
+	} `bson:"passwordResetReq"`
+}
+
+func MoveEmbeddedSignUpRequests(ctx context.Context, db *mongo.Database, signUpExpiration time.Duration) error {
+	return moveEmbeddedRequests(ctx, db, "signUpReq", func(doc *embeddedRequests) bson.M {
+		req := doc.SignUpReq
+
+		request := bson.M{
+			"type":        "sign_up",
+			"token":       req.Token,
+			"code":        req.Code,
+			"attempts":    req.FailedAttempts,
+			"notifiedAt":  req.NotifiedAt,
+			"resendCount": req.ResendCount,
+			"createdAt":   doc.CreatedAt,
+			"expiresAt":   doc.CreatedAt.Add(signUpExpiration),
+		}
+
+		if req.ResentAt != nil {
+			request["resentAt"] = req.ResentAt
+			request["resendWindowStart"] = req.ResendWindowStart
+		}
+
+		if req.InvitationToken != "" {
+			request["data"] = bson.M{"invitationToken": req.InvitationToken}
+		}
+
+		return request
+	})
+}
+
+func MoveEmbeddedPasswordResetRequests(ctx context.Context, db *mongo.Database) error {
+	return moveEmbeddedRequests(ctx, db, "passwordResetReq", func(doc *embeddedRequests) bson.M {
+		return bson.M{
+			"type":        "password_reset",
+			"token":       doc.PasswordResetReq.Token,
+			"attempts":    0,
+			"notifiedAt":  nil,
+			"resendCount": 0,
+			"createdAt":   doc.PasswordResetReq.CreatedAt,
+			"expiresAt":   doc.PasswordResetReq.ExpiresAt,
+		}
+	})
+}
+
+// moveEmbeddedRequests upserts the request built by toRequest for every user having field
+// and unsets it afterwards. Requests are matched on their token, so that a run interrupted
+// between both steps can be started again.
+func moveEmbeddedRequests(
+	ctx context.Context,
+	db *mongo.Database,
+	field string,
+	toRequest func(doc *embeddedRequests) bson.M,
+) error {
+	cursor, err := db.Collection("users").Find(ctx, bson.M{
+		field: bson.M{"$ne": nil},
+	}, options.Find().SetProjection(bson.M{field: 1, "createdAt": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	requests := make([]mongo.WriteModel, 0, verificationRequestsBatchSize)
+	uids := make([]string, 0, verificationRequestsBatchSize)
+
+	flush := func() error {
+		if len(requests) == 0 {
+			return nil
+		}
+
+		if _, err := db.Collection("verification_requests").BulkWrite(ctx, requests, options.BulkWrite().SetOrdered(false)); err != nil {
+			return err
+		}
+
+		if _, err := db.Collection("users").UpdateMany(ctx, bson.M{
+			"_id": bson.M{"$in": uids},
+		}, bson.M{
+			"$unset": bson.M{field: ""},
+		}); err != nil {
+			return err
+		}
+
+		requests = requests[:0]
+		uids = uids[:0]
+
+		return nil
+	}
+
+	for cursor.Next(ctx) {
+		var doc embeddedRequests
+
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+
+		request := toRequest(&doc)
+		request["_id"] = tools.NewUUID().String()
+		request["userUid"] = doc.UID
+
+		requests = append(requests, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"type": request["type"], "token": request["token"]}).
+			SetUpdate(bson.M{"$setOnInsert": request}).
+			SetUpsert(true))
+		uids = append(uids, doc.UID)
+
+		if len(requests) == verificationRequestsBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	return flush()
+}
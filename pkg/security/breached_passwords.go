@@ -0,0 +1,211 @@
+package security
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	BreachedFormatSha1  = "sha1"
+	BreachedFormatBloom = "bloom"
+
+	bloomMagic = "PWBF"
+
+	// MaxSha1CorpusDigests caps the digests a Sha1Corpus keeps in memory (20 bytes each, so
+	// about 200MB), bigger corpora such as the full "Have I Been Pwned" dump have to be turned
+	// into a bloom filter with apart-deal-breached-bloom
+	MaxSha1CorpusDigests = 10_000_000
+)
+
+type BreachedPasswordChecker interface {
+	IsBreached(password string) bool
+}
+
+// LoadBreachedPasswords reads a local breached-password corpus, format is either
+// BreachedFormatSha1 or BreachedFormatBloom
+func LoadBreachedPasswords(path string, format string) (BreachedPasswordChecker, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	switch format {
+	case BreachedFormatSha1:
+		return ReadSha1Corpus(f)
+	case BreachedFormatBloom:
+		return ReadBloomFilter(f)
+	default:
+		return nil, errors.Errorf("Unknown breached passwords format: %s", format)
+	}
+}
+
+// Sha1Corpus keeps sorted SHA-1 digests of breached passwords in memory, it reads the format
+// used by "Have I Been Pwned" dumps: one uppercase hex digest per line optionally followed by
+// ":count". It's meant for curated lists of at most MaxSha1CorpusDigests digests.
+type Sha1Corpus struct {
+	digests [][sha1.Size]byte
+}
+
+func ReadSha1Corpus(r io.Reader) (*Sha1Corpus, error) {
+	corpus := &Sha1Corpus{
+		digests: make([][sha1.Size]byte, 0),
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if idx := strings.IndexByte(line, ':'); idx >= 0 {
+			line = line[:idx]
+		}
+
+		raw, err := hex.DecodeString(line)
+		if err != nil || len(raw) != sha1.Size {
+			return nil, errors.Errorf("Invalid SHA-1 digest in breached passwords corpus: %s", line)
+		}
+
+		if len(corpus.digests) >= MaxSha1CorpusDigests {
+			return nil, errors.Errorf(
+				"Breached passwords corpus has more than %d digests, use the %s format instead",
+				MaxSha1CorpusDigests,
+				BreachedFormatBloom,
+			)
+		}
+
+		var digest [sha1.Size]byte
+		copy(digest[:], raw)
+		corpus.digests = append(corpus.digests, digest)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(corpus.digests, func(i, j int) bool {
+		return bytes.Compare(corpus.digests[i][:], corpus.digests[j][:]) < 0
+	})
+
+	return corpus, nil
+}
+
+func (c *Sha1Corpus) IsBreached(password string) bool {
+	digest := sha1.Sum([]byte(password))
+
+	idx := sort.Search(len(c.digests), func(i int) bool {
+		return bytes.Compare(c.digests[i][:], digest[:]) >= 0
+	})
+
+	return idx < len(c.digests) && c.digests[idx] == digest
+}
+
+// BloomFilter is a compact alternative to Sha1Corpus for big corpora, it may report false
+// positives with the probability chosen when the filter was built
+type BloomFilter struct {
+	bits []uint64
+	m    uint64
+	k    uint32
+}
+
+func NewBloomFilter(m uint64, k uint32) *BloomFilter {
+	return &BloomFilter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+func (b *BloomFilter) Add(password string) {
+	b.AddDigest(sha1.Sum([]byte(password)))
+}
+
+func (b *BloomFilter) AddDigest(digest [sha1.Size]byte) {
+	for _, pos := range b.positions(digest) {
+		b.bits[pos/64] |= 1 << (pos % 64)
+	}
+}
+
+func (b *BloomFilter) IsBreached(password string) bool {
+	for _, pos := range b.positions(sha1.Sum([]byte(password))) {
+		if b.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// positions uses double hashing over the SHA-1 digest, which is uniform enough on its own
+func (b *BloomFilter) positions(digest [sha1.Size]byte) []uint64 {
+	h1 := binary.BigEndian.Uint64(digest[0:8])
+	h2 := binary.BigEndian.Uint64(digest[8:16])
+
+	positions := make([]uint64, b.k)
+	for i := uint32(0); i < b.k; i++ {
+		positions[i] = (h1 + uint64(i)*h2) % b.m
+	}
+
+	return positions
+}
+
+// WriteTo stores the filter as "PWBF", m (uint64), k (uint32) and the bit set, all big-endian
+func (b *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, 16+len(b.bits)*8))
+	buf.WriteString(bloomMagic)
+	_ = binary.Write(buf, binary.BigEndian, b.m)
+	_ = binary.Write(buf, binary.BigEndian, b.k)
+	_ = binary.Write(buf, binary.BigEndian, b.bits)
+
+	n, err := w.Write(buf.Bytes())
+
+	return int64(n), err
+}
+
+func ReadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	br := bufio.NewReader(r)
+
+	magic := make([]byte, len(bloomMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return nil, err
+	}
+
+	if string(magic) != bloomMagic {
+		return nil, errors.New("Breached passwords file is not a bloom filter")
+	}
+
+	var (
+		m uint64
+		k uint32
+	)
+
+	if err := binary.Read(br, binary.BigEndian, &m); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(br, binary.BigEndian, &k); err != nil {
+		return nil, err
+	}
+
+	if m == 0 || k == 0 {
+		return nil, errors.New("Bloom filter has no bits or hash functions")
+	}
+
+	b := NewBloomFilter(m, k)
+	if err := binary.Read(br, binary.BigEndian, b.bits); err != nil {
+		return nil, errors.Wrap(err, "failed while reading bloom filter bits")
+	}
+
+	return b, nil
+}
@@ -0,0 +1,98 @@
+package security
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strings"
+)
+
+// DeviceIdentity is a coarse description of where a request comes from, it's stable
+// across browser updates and address changes within the same network
+type DeviceIdentity struct {
+	Family   string
+	IPPrefix string
+}
+
+// userAgentFamilies is checked in order, several browsers mention the others in
+// their user agent so the most specific ones go first
+var userAgentFamilies = []struct {
+	token  string
+	family string
+}{
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"Opera", "Opera"},
+	{"YaBrowser", "Yandex"},
+	{"SamsungBrowser", "Samsung Internet"},
+	{"Firefox/", "Firefox"},
+	{"Chrome/", "Chrome"},
+	{"CriOS/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"curl/", "curl"},
+	{"okhttp/", "OkHttp"},
+}
+
+var operatingSystems = []struct {
+	token string
+	os    string
+}{
+	{"Android", "Android"},
+	{"iPhone", "iOS"},
+	{"iPad", "iOS"},
+	{"Windows", "Windows"},
+	{"Mac OS X", "macOS"},
+	{"Macintosh", "macOS"},
+	{"CrOS", "ChromeOS"},
+	{"Linux", "Linux"},
+}
+
+func IdentifyDevice(userAgent string, ip string) DeviceIdentity {
+	return DeviceIdentity{
+		Family:   userAgentFamily(userAgent),
+		IPPrefix: ipPrefix(ip),
+	}
+}
+
+func (d DeviceIdentity) Fingerprint() string {
+	sum := sha256.Sum256([]byte(d.Family + "|" + d.IPPrefix))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// userAgentFamily returns e.g. "Firefox on Linux", versions are left out on purpose
+func userAgentFamily(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown"
+	}
+
+	family := "Other"
+	for _, f := range userAgentFamilies {
+		if strings.Contains(userAgent, f.token) {
+			family = f.family
+			break
+		}
+	}
+
+	for _, o := range operatingSystems {
+		if strings.Contains(userAgent, o.token) {
+			return family + " on " + o.os
+		}
+	}
+
+	return family
+}
+
+// ipPrefix masks IPv4 addresses to /24 and IPv6 ones to /48
+func ipPrefix(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
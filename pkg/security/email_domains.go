@@ -0,0 +1,241 @@
+package security
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	EmailDomainNotAllowed = "not_allowed"
+	EmailDomainDenied     = "denied"
+	EmailDomainDisposable = "disposable"
+)
+
+//go:embed data/disposable_email_domains.txt
+var bundledDisposableDomains []byte
+
+// EmailDomainPolicyConfig lists domains inline and in files, the files are the ones which can
+// be updated at runtime, see EmailDomainPolicy.Watch
+type EmailDomainPolicyConfig struct {
+	Allow     []string
+	Deny      []string
+	AllowFile string
+	DenyFile  string
+	// DisposableFile replaces the bundled list of disposable domains
+	DisposableFile  string
+	BlockDisposable bool
+}
+
+type domainSet map[string]struct{}
+
+// contains matches the domain itself and any of its parents, so that "mailinator.com"
+// covers "foo.mailinator.com" as well
+func (s domainSet) contains(domain string) bool {
+	for domain != "" {
+		if _, ok := s[domain]; ok {
+			return true
+		}
+
+		idx := strings.IndexByte(domain, '.')
+		if idx < 0 {
+			return false
+		}
+
+		domain = domain[idx+1:]
+	}
+
+	return false
+}
+
+type EmailDomainPolicy struct {
+	cfg EmailDomainPolicyConfig
+
+	mu         sync.RWMutex
+	allow      domainSet
+	deny       domainSet
+	disposable domainSet
+	modTimes   map[string]time.Time
+}
+
+func NewEmailDomainPolicy(cfg EmailDomainPolicyConfig) (*EmailDomainPolicy, error) {
+	p := &EmailDomainPolicy{
+		cfg: cfg,
+	}
+
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Check returns one of EmailDomainNotAllowed, EmailDomainDenied and EmailDomainDisposable,
+// or an empty string when the email may be used. The deny list wins over the allow list.
+func (p *EmailDomainPolicy) Check(email string) string {
+	idx := strings.LastIndexByte(email, '@')
+	domain := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(email[idx+1:]), "."))
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.deny.contains(domain) {
+		return EmailDomainDenied
+	}
+
+	if len(p.allow) > 0 {
+		if p.allow.contains(domain) {
+			return ""
+		}
+
+		return EmailDomainNotAllowed
+	}
+
+	if p.cfg.BlockDisposable && p.disposable.contains(domain) {
+		return EmailDomainDisposable
+	}
+
+	return ""
+}
+
+// Reload reads every list again, the current lists are kept if any of the files is broken
+func (p *EmailDomainPolicy) Reload() error {
+	modTimes := make(map[string]time.Time)
+
+	allow, err := p.loadSet(p.cfg.Allow, p.cfg.AllowFile, nil, modTimes)
+	if err != nil {
+		return err
+	}
+
+	deny, err := p.loadSet(p.cfg.Deny, p.cfg.DenyFile, nil, modTimes)
+	if err != nil {
+		return err
+	}
+
+	disposable, err := p.loadSet(nil, p.cfg.DisposableFile, bundledDisposableDomains, modTimes)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.allow = allow
+	p.deny = deny
+	p.disposable = disposable
+	p.modTimes = modTimes
+
+	return nil
+}
+
+// Watch reloads the lists whenever one of the files changes, until ctx is done
+func (p *EmailDomainPolicy) Watch(ctx context.Context, interval time.Duration, logger *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !p.filesChanged() {
+				continue
+			}
+
+			if err := p.Reload(); err != nil {
+				logger.Warn(fmt.Sprintf("Could not reload email domain lists: %s", err))
+				continue
+			}
+
+			logger.Info("Email domain lists reloaded")
+		}
+	}
+}
+
+func (p *EmailDomainPolicy) filesChanged() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, path := range []string{p.cfg.AllowFile, p.cfg.DenyFile, p.cfg.DisposableFile} {
+		if path == "" {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			// a file being replaced may be missing for a moment, try again next time
+			continue
+		}
+
+		if !info.ModTime().Equal(p.modTimes[path]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *EmailDomainPolicy) loadSet(
+	inline []string,
+	path string,
+	fallback []byte,
+	modTimes map[string]time.Time,
+) (domainSet, error) {
+	set := make(domainSet)
+
+	for _, d := range inline {
+		addDomain(set, d)
+	}
+
+	var r io.Reader
+
+	switch {
+	case path != "":
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+
+		modTimes[path] = info.ModTime()
+		r = f
+	case fallback != nil:
+		r = bytes.NewReader(fallback)
+	default:
+		return set, nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		addDomain(set, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return set, nil
+}
+
+func addDomain(set domainSet, line string) {
+	domain := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(line), "."))
+	if domain == "" || strings.HasPrefix(domain, "#") {
+		return
+	}
+
+	set[strings.TrimPrefix(domain, "*.")] = struct{}{}
+}
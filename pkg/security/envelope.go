@@ -0,0 +1,152 @@
+package security
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// KeyBytes selects AES-256 for master and data keys, and is the size of blind index keys
+	KeyBytes = 32
+)
+
+// MasterKey only wraps data keys, it never encrypts data itself. Its ID is stored along
+// with the keys it wraps.
+type MasterKey struct {
+	ID  string
+	Key []byte
+}
+
+// ParseMasterKeys reads keys given as id:base64, separated by commas or new lines
+func ParseMasterKeys(s string) ([]MasterKey, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	})
+
+	keys := make([]MasterKey, 0, len(fields))
+	seen := make(map[string]bool, len(fields))
+
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(field, ":")
+		if !ok || id == "" {
+			return nil, errors.New("Master keys must be given as id:base64")
+		}
+
+		if seen[id] {
+			return nil, errors.Errorf("Master key %s is given twice", id)
+		}
+
+		key, err := ParseKey(encoded)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid master key %s", id)
+		}
+
+		seen[id] = true
+		keys = append(keys, MasterKey{ID: id, Key: key})
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("No master key given")
+	}
+
+	return keys, nil
+}
+
+// ParseKey decodes a standard base64 key of KeyBytes
+func ParseKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed while decoding key")
+	}
+
+	if len(key) != KeyBytes {
+		return nil, errors.Errorf("Invalid key size: %d bytes instead of %d", len(key), KeyBytes)
+	}
+
+	return key, nil
+}
+
+func NewDataKey() ([]byte, error) {
+	key := make([]byte, KeyBytes)
+	if _, err := rand.Read(key); err != nil {
+		return nil, errors.Wrap(err, "failed while reading random bytes")
+	}
+
+	return key, nil
+}
+
+// WrapKey encrypts a data key with the master key, the ID of the master key is
+// authenticated as well
+func WrapKey(master MasterKey, dataKey []byte) ([]byte, error) {
+	return Seal(master.Key, dataKey, []byte(master.ID))
+}
+
+func UnwrapKey(master MasterKey, wrapped []byte) ([]byte, error) {
+	return Open(master.Key, wrapped, []byte(master.ID))
+}
+
+// Seal encrypts with AES-GCM, the random nonce is prepended to the ciphertext. The
+// additional data isn't encrypted but has to be the same to open the result.
+func Seal(key []byte, plaintext []byte, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "failed while reading random bytes")
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func Open(key []byte, sealed []byte, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("Sealed value is too short")
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additionalData)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed while opening sealed value")
+	}
+
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed while creating cipher")
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// BlindIndex is a keyed hash of a value which has to be found while it's stored
+// encrypted, equal values have equal indexes. Unlike a plain hash, it can't be reversed
+// by hashing guesses without the key.
+func BlindIndex(key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -1,13 +1,132 @@
 package security
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"github.com/pkg/errors"
+)
 
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return string(bytes), err
+// HashAlgorithm is a single password hashing scheme which encodes its identifier and
+// parameters into the produced hash string, so that hashes stay verifiable after the
+// configuration changes
+type HashAlgorithm interface {
+	ID() string
+	Identifies(encoded string) bool
+	Hash(password string) (string, error)
+	Verify(password string, encoded string) (bool, error)
+	// Outdated reports hashes produced with parameters other than the configured ones
+	Outdated(encoded string) bool
 }
 
-func CheckPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+// Limits on the parameters read from hashes: they're verified on every sign-in attempt and
+// imported hashes come from other systems, so unbounded parameters would let anyone who knows
+// an email spend the server's CPU and memory
+const (
+	MinHashKeyLength = 16
+	MaxHashKeyLength = 64
+
+	MaxPbkdf2Iterations = 2_000_000
+
+	// MaxScryptMemory is in bytes, scrypt needs 128*N*r of them
+	MaxScryptMemory      = 256 << 20
+	MaxScryptParallelism = 16
+
+	// MaxArgon2idMemory is in KiB
+	MaxArgon2idMemory     = 256 * 1024
+	MaxArgon2idIterations = 16
+)
+
+// ValidatePbkdf2Params checks the parameters of a pbkdf2-sha256 hash against the limits
+func ValidatePbkdf2Params(iterations int, keyLength int) error {
+	if iterations <= 0 || iterations > MaxPbkdf2Iterations {
+		return errors.Errorf("iterations must be between 1 and %d", MaxPbkdf2Iterations)
+	}
+
+	return validateKeyLength(keyLength)
+}
+
+// ValidateScryptParams checks the parameters of a scrypt hash against the limits
+func ValidateScryptParams(n int, r int, p int, keyLength int) error {
+	if n <= 1 || n&(n-1) != 0 {
+		return errors.New("n must be a power of two")
+	}
+
+	if r <= 0 || p <= 0 || p > MaxScryptParallelism {
+		return errors.Errorf("r must be positive and p between 1 and %d", MaxScryptParallelism)
+	}
+
+	if n > MaxScryptMemory/128/r {
+		return errors.Errorf("n and r need more than %d bytes of memory", MaxScryptMemory)
+	}
+
+	return validateKeyLength(keyLength)
+}
+
+// ValidateArgon2idParams checks the parameters of an argon2id hash against the limits
+func ValidateArgon2idParams(params Argon2idParams) error {
+	if params.Parallelism == 0 || params.Iterations == 0 || params.Iterations > MaxArgon2idIterations {
+		return errors.Errorf("parallelism must be positive and iterations between 1 and %d", MaxArgon2idIterations)
+	}
+
+	if params.Memory < 8*uint32(params.Parallelism) || params.Memory > MaxArgon2idMemory {
+		return errors.Errorf("memory must be between 8 KiB per lane and %d KiB", MaxArgon2idMemory)
+	}
+
+	return validateKeyLength(int(params.KeyLength))
+}
+
+// validateKeyLength rejects empty keys as well, an empty key matches any password
+func validateKeyLength(keyLength int) error {
+	if keyLength < MinHashKeyLength || keyLength > MaxHashKeyLength {
+		return errors.Errorf("key must be between %d and %d bytes long", MinHashKeyLength, MaxHashKeyLength)
+	}
+
+	return nil
+}
+
+type UnknownHashError struct {
+	error
+}
+
+func (e *UnknownHashError) Error() string {
+	return "Password hash algorithm is unknown"
+}
+
+type PasswordHasher struct {
+	current HashAlgorithm
+	known   []HashAlgorithm
+}
+
+// NewPasswordHasher hashes new passwords with current, the legacy algorithms are
+// only used to verify hashes which were produced by them
+func NewPasswordHasher(current HashAlgorithm, legacy ...HashAlgorithm) *PasswordHasher {
+	return &PasswordHasher{
+		current: current,
+		known:   append([]HashAlgorithm{current}, legacy...),
+	}
+}
+
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+// Verify checks the password against the encoded hash, needsRehash is set when the
+// password is valid but the hash should be replaced with one from the current algorithm
+func (h *PasswordHasher) Verify(password string, encoded string) (ok bool, needsRehash bool, err error) {
+	for _, alg := range h.known {
+		if !alg.Identifies(encoded) {
+			continue
+		}
+
+		ok, err := alg.Verify(password, encoded)
+		if err != nil {
+			return false, false, errors.Wrapf(err, "failed while verifying %s hash", alg.ID())
+		}
+
+		if !ok {
+			return false, false, nil
+		}
+
+		return true, alg != h.current || h.current.Outdated(encoded), nil
+	}
+
+	return false, false, &UnknownHashError{}
 }
@@ -0,0 +1,75 @@
+package security
+
+import (
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	BcryptID = "bcrypt"
+	// BcryptMaxPasswordBytes is as much of a password as bcrypt reads, the rest is ignored
+	BcryptMaxPasswordBytes = 72
+)
+
+// PasswordTooLongError means the password is longer than what the algorithm reads, see
+// PasswordPolicyConfig.MaxBytes
+type PasswordTooLongError struct {
+	error
+}
+
+func (e *PasswordTooLongError) Error() string {
+	return "Password is too long for the hash algorithm"
+}
+
+type BcryptParams struct {
+	Cost int
+}
+
+type bcryptAlgorithm struct {
+	params BcryptParams
+}
+
+func NewBcryptAlgorithm(params BcryptParams) HashAlgorithm {
+	return &bcryptAlgorithm{
+		params: params,
+	}
+}
+
+func (a *bcryptAlgorithm) ID() string {
+	return BcryptID
+}
+
+func (a *bcryptAlgorithm) Identifies(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") ||
+		strings.HasPrefix(encoded, "$2b$") ||
+		strings.HasPrefix(encoded, "$2y$")
+}
+
+// Hash refuses passwords bcrypt would truncate, two passwords sharing their first 72 bytes
+// would both match the hash
+func (a *bcryptAlgorithm) Hash(password string) (string, error) {
+	if len(password) > BcryptMaxPasswordBytes {
+		return "", &PasswordTooLongError{}
+	}
+
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), a.params.Cost)
+	return string(bytes), err
+}
+
+// Verify still checks longer passwords on their first 72 bytes, they may have been set before
+// Hash refused them. Under another current algorithm they're rehashed on sign-in.
+func (a *bcryptAlgorithm) Verify(password string, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (a *bcryptAlgorithm) Outdated(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+
+	return err != nil || cost != a.params.Cost
+}
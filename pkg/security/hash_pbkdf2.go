@@ -0,0 +1,99 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	Pbkdf2Sha256ID = "pbkdf2-sha256"
+)
+
+type Pbkdf2Params struct {
+	Iterations int
+	SaltLength int
+	KeyLength  int
+}
+
+// pbkdf2Algorithm exists to verify hashes imported from legacy systems, it is never
+// configured as the current algorithm
+type pbkdf2Algorithm struct {
+	params Pbkdf2Params
+}
+
+func NewPbkdf2Sha256Algorithm(params Pbkdf2Params) HashAlgorithm {
+	return &pbkdf2Algorithm{
+		params: params,
+	}
+}
+
+// EncodePbkdf2Sha256 tags raw legacy material: $pbkdf2-sha256$i=<iterations>$<salt>$<key>
+func EncodePbkdf2Sha256(iterations int, salt []byte, key []byte) string {
+	return fmt.Sprintf(
+		"$%s$i=%d$%s$%s",
+		Pbkdf2Sha256ID,
+		iterations,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func (a *pbkdf2Algorithm) ID() string {
+	return Pbkdf2Sha256ID
+}
+
+func (a *pbkdf2Algorithm) Identifies(encoded string) bool {
+	return strings.HasPrefix(encoded, "$"+Pbkdf2Sha256ID+"$")
+}
+
+func (a *pbkdf2Algorithm) Hash(password string) (string, error) {
+	salt := make([]byte, a.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := pbkdf2.Key([]byte(password), salt, a.params.Iterations, a.params.KeyLength, sha256.New)
+
+	return EncodePbkdf2Sha256(a.params.Iterations, salt, key), nil
+}
+
+func (a *pbkdf2Algorithm) Verify(password string, encoded string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 {
+		return false, errors.New("Malformed pbkdf2-sha256 hash")
+	}
+
+	var iterations int
+	if _, err := fmt.Sscanf(parts[2], "i=%d", &iterations); err != nil {
+		return false, errors.New("Malformed pbkdf2-sha256 iterations")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false, errors.Wrap(err, "malformed pbkdf2-sha256 salt")
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, errors.Wrap(err, "malformed pbkdf2-sha256 key")
+	}
+
+	if err := ValidatePbkdf2Params(iterations, len(key)); err != nil {
+		return false, errors.Wrap(err, "pbkdf2-sha256 parameters out of range")
+	}
+
+	actual := pbkdf2.Key([]byte(password), salt, iterations, len(key), sha256.New)
+
+	return subtle.ConstantTimeCompare(actual, key) == 1, nil
+}
+
+func (a *pbkdf2Algorithm) Outdated(encoded string) bool {
+	return true
+}
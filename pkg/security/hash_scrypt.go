@@ -0,0 +1,108 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	ScryptID = "scrypt"
+)
+
+type ScryptParams struct {
+	N          int
+	R          int
+	P          int
+	SaltLength int
+	KeyLength  int
+}
+
+// scryptAlgorithm exists to verify hashes imported from legacy systems, it is never
+// configured as the current algorithm
+type scryptAlgorithm struct {
+	params ScryptParams
+}
+
+func NewScryptAlgorithm(params ScryptParams) HashAlgorithm {
+	return &scryptAlgorithm{
+		params: params,
+	}
+}
+
+// EncodeScrypt tags raw legacy material: $scrypt$n=<N>,r=<r>,p=<p>$<salt>$<key>
+func EncodeScrypt(n int, r int, p int, salt []byte, key []byte) string {
+	return fmt.Sprintf(
+		"$%s$n=%d,r=%d,p=%d$%s$%s",
+		ScryptID,
+		n,
+		r,
+		p,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func (a *scryptAlgorithm) ID() string {
+	return ScryptID
+}
+
+func (a *scryptAlgorithm) Identifies(encoded string) bool {
+	return strings.HasPrefix(encoded, "$"+ScryptID+"$")
+}
+
+func (a *scryptAlgorithm) Hash(password string) (string, error) {
+	salt := make([]byte, a.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key, err := scrypt.Key([]byte(password), salt, a.params.N, a.params.R, a.params.P, a.params.KeyLength)
+	if err != nil {
+		return "", err
+	}
+
+	return EncodeScrypt(a.params.N, a.params.R, a.params.P, salt, key), nil
+}
+
+func (a *scryptAlgorithm) Verify(password string, encoded string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 {
+		return false, errors.New("Malformed scrypt hash")
+	}
+
+	var n, r, p int
+	if _, err := fmt.Sscanf(parts[2], "n=%d,r=%d,p=%d", &n, &r, &p); err != nil {
+		return false, errors.Wrap(err, "malformed scrypt parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false, errors.Wrap(err, "malformed scrypt salt")
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, errors.Wrap(err, "malformed scrypt key")
+	}
+
+	if err := ValidateScryptParams(n, r, p, len(key)); err != nil {
+		return false, errors.Wrap(err, "scrypt parameters out of range")
+	}
+
+	actual, err := scrypt.Key([]byte(password), salt, n, r, p, len(key))
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare(actual, key) == 1, nil
+}
+
+func (a *scryptAlgorithm) Outdated(encoded string) bool {
+	return true
+}
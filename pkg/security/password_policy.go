@@ -0,0 +1,223 @@
+package security
+
+import (
+	"fmt"
+	"math"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// MaxAcceptedPasswordLength caps any password the API accepts, no matter the policy,
+	// so that hashing can not be abused with huge payloads
+	MaxAcceptedPasswordLength = 256
+)
+
+// PasswordPolicyConfig limits lengths in characters, MaxBytes limits the UTF-8 length as well
+// when it's positive, for hash algorithms which ignore what's beyond, see BcryptMaxPasswordBytes
+type PasswordPolicyConfig struct {
+	MinLength      int
+	MaxLength      int
+	MaxBytes       int
+	RequireLower   bool
+	RequireUpper   bool
+	RequireDigit   bool
+	RequireSymbol  bool
+	MinCharClasses int
+	MinEntropyBits float64
+}
+
+var DefaultPasswordPolicyConfig = PasswordPolicyConfig{
+	MinLength:      8,
+	MaxLength:      128,
+	MinEntropyBits: 28,
+}
+
+type PasswordViolation struct {
+	Code    string
+	Message string
+}
+
+type PasswordPolicy struct {
+	cfg      PasswordPolicyConfig
+	breached BreachedPasswordChecker
+}
+
+// NewPasswordPolicy builds a policy, breached may be nil when no corpus is configured
+func NewPasswordPolicy(cfg PasswordPolicyConfig, breached BreachedPasswordChecker) *PasswordPolicy {
+	if cfg.MaxLength <= 0 || cfg.MaxLength > MaxAcceptedPasswordLength {
+		cfg.MaxLength = MaxAcceptedPasswordLength
+	}
+
+	return &PasswordPolicy{
+		cfg:      cfg,
+		breached: breached,
+	}
+}
+
+func (p *PasswordPolicy) Check(password string) []PasswordViolation {
+	violations := make([]PasswordViolation, 0)
+
+	length := utf8.RuneCountInString(password)
+	if length < p.cfg.MinLength {
+		violations = append(violations, PasswordViolation{
+			Code:    "too_short",
+			Message: fmt.Sprintf("must be at least %d characters long", p.cfg.MinLength),
+		})
+	}
+
+	if length > p.cfg.MaxLength || (p.cfg.MaxBytes > 0 && len(password) > p.cfg.MaxBytes) {
+		message := fmt.Sprintf("must be at most %d characters long", p.cfg.MaxLength)
+		if length <= p.cfg.MaxLength {
+			message = fmt.Sprintf("must be at most %d bytes long", p.cfg.MaxBytes)
+		}
+
+		violations = append(violations, PasswordViolation{
+			Code:    "too_long",
+			Message: message,
+		})
+
+		// the rest of the checks are pointless for a password which is going to be rejected anyway
+		return violations
+	}
+
+	classes := detectCharClasses(password)
+
+	if p.cfg.RequireLower && !classes.lower {
+		violations = append(violations, PasswordViolation{
+			Code:    "missing_lowercase",
+			Message: "must contain a lowercase letter",
+		})
+	}
+
+	if p.cfg.RequireUpper && !classes.upper {
+		violations = append(violations, PasswordViolation{
+			Code:    "missing_uppercase",
+			Message: "must contain an uppercase letter",
+		})
+	}
+
+	if p.cfg.RequireDigit && !classes.digit {
+		violations = append(violations, PasswordViolation{
+			Code:    "missing_digit",
+			Message: "must contain a digit",
+		})
+	}
+
+	if p.cfg.RequireSymbol && !classes.symbol {
+		violations = append(violations, PasswordViolation{
+			Code:    "missing_symbol",
+			Message: "must contain a symbol",
+		})
+	}
+
+	if classes.count() < p.cfg.MinCharClasses {
+		violations = append(violations, PasswordViolation{
+			Code:    "not_enough_char_classes",
+			Message: fmt.Sprintf("must contain at least %d of lowercase, uppercase, digits and symbols", p.cfg.MinCharClasses),
+		})
+	}
+
+	if p.cfg.MinEntropyBits > 0 && estimateEntropy(password, classes) < p.cfg.MinEntropyBits {
+		violations = append(violations, PasswordViolation{
+			Code:    "too_weak",
+			Message: "is too easy to guess",
+		})
+	}
+
+	if p.breached != nil && p.breached.IsBreached(password) {
+		violations = append(violations, PasswordViolation{
+			Code:    "breached",
+			Message: "has appeared in a data breach, choose another one",
+		})
+	}
+
+	return violations
+}
+
+type charClasses struct {
+	lower  bool
+	upper  bool
+	digit  bool
+	symbol bool
+	other  bool
+}
+
+func (c charClasses) count() int {
+	n := 0
+	for _, present := range []bool{c.lower, c.upper, c.digit, c.symbol || c.other} {
+		if present {
+			n++
+		}
+	}
+
+	return n
+}
+
+func detectCharClasses(password string) charClasses {
+	var c charClasses
+
+	for _, r := range password {
+		switch {
+		case r < unicode.MaxASCII && unicode.IsLower(r):
+			c.lower = true
+		case r < unicode.MaxASCII && unicode.IsUpper(r):
+			c.upper = true
+		case r < unicode.MaxASCII && unicode.IsDigit(r):
+			c.digit = true
+		case r < unicode.MaxASCII && (unicode.IsPunct(r) || unicode.IsSymbol(r) || r == ' '):
+			c.symbol = true
+		default:
+			c.other = true
+		}
+	}
+
+	return c
+}
+
+// estimateEntropy is a naive brute-force estimate: the size of the alphabet implied by
+// the char classes in use, raised to the number of characters. A character repeating the
+// previous one adds nothing and other repeats count half, so that "aaaaaaaaaaaa" is not
+// considered strong.
+func estimateEntropy(password string, classes charClasses) float64 {
+	pool := 0
+	if classes.lower {
+		pool += 26
+	}
+	if classes.upper {
+		pool += 26
+	}
+	if classes.digit {
+		pool += 10
+	}
+	if classes.symbol {
+		pool += 33
+	}
+	if classes.other {
+		pool += 100
+	}
+
+	if pool == 0 {
+		return 0
+	}
+
+	var (
+		effectiveLength float64
+		prev            rune
+	)
+
+	seen := make(map[rune]struct{})
+
+	for i, r := range password {
+		if _, ok := seen[r]; !ok {
+			effectiveLength++
+		} else if i > 0 && r != prev {
+			effectiveLength += 0.5
+		}
+
+		seen[r] = struct{}{}
+		prev = r
+	}
+
+	return effectiveLength * math.Log2(float64(pool))
+}
@@ -0,0 +1,72 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultTokenBytes gives 256 bits of entropy, enough for any bearer-like token
+	DefaultTokenBytes = 32
+)
+
+// SecretGenerator produces values which must not be guessable: tokens handed to clients
+// and codes sent by email
+type SecretGenerator interface {
+	// Token returns n random bytes encoded as unpadded URL-safe base64
+	Token(n int) (string, error)
+	// NumericCode returns a zero-padded code of the given number of digits
+	NumericCode(digits int) (string, error)
+}
+
+type cryptoSecretGenerator struct{}
+
+func NewSecretGenerator() SecretGenerator {
+	return &cryptoSecretGenerator{}
+}
+
+func (g *cryptoSecretGenerator) Token(n int) (string, error) {
+	if n <= 0 {
+		return "", errors.Errorf("Invalid token size: %d", n)
+	}
+
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed while reading random bytes")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// NumericCode draws uniformly from [0, 10^digits), rand.Int rejects out of range samples
+// so that there is no modulo bias
+func (g *cryptoSecretGenerator) NumericCode(digits int) (string, error) {
+	if digits <= 0 || digits > 18 {
+		return "", errors.Errorf("Invalid code length: %d", digits)
+	}
+
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", errors.Wrap(err, "failed while reading random number")
+	}
+
+	code := n.String()
+
+	return strings.Repeat("0", digits-len(code)) + code, nil
+}
+
+// HashToken is what gets stored in place of a high-entropy token, a plain SHA-256 is enough
+// since such tokens can't be brute-forced the way passwords can
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
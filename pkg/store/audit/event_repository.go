@@ -0,0 +1,163 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type EventType string
+
+type Outcome string
+
+const (
+	CollectionName = "audit_events"
+)
+
+var (
+	TypeSignUp         EventType = "sign_up"
+	TypeSignUpConfirm  EventType = "sign_up_confirm"
+	TypeSignUpResend   EventType = "sign_up_resend"
+	TypeSignIn         EventType = "sign_in"
+	TypePasswordRehash EventType = "password_rehash"
+	TypeDeviceReported EventType = "device_reported"
+	TypePasswordReset  EventType = "password_reset"
+	TypeReauthenticate EventType = "reauthenticate"
+	TypeAccountDelete  EventType = "account_delete"
+	TypeAccountRestore EventType = "account_restore"
+
+	OutcomeSuccess Outcome = "success"
+	OutcomeFailure Outcome = "failure"
+)
+
+// Event is never updated nor deleted by the application, documents go away once
+// ExpiresAt passes thanks to the TTL index. Email is kept in plaintext so that events can
+// be filtered by it, events of unknown emails have no user to read it from.
+type Event struct {
+	UID       string    `bson:"_id"`
+	Type      EventType `bson:"type"`
+	UserUID   string    `bson:"userUid,omitempty"`
+	Email     string    `bson:"email,omitempty"`
+	IP        string    `bson:"ip,omitempty"`
+	UserAgent string    `bson:"userAgent,omitempty"`
+	TraceID   string    `bson:"traceId,omitempty"`
+	Outcome   Outcome   `bson:"outcome"`
+	Reason    string    `bson:"reason,omitempty"`
+	CreatedAt time.Time `bson:"createdAt"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// EventFilter narrows a query, zero values are not applied
+type EventFilter struct {
+	Type    EventType
+	UserUID string
+	Email   string
+	Outcome Outcome
+	From    *time.Time
+	To      *time.Time
+}
+
+type EventRepository interface {
+	Create(ctx context.Context, model *Event) error
+	Find(ctx context.Context, filter EventFilter, offset int64, limit int64) ([]Event, error)
+	Count(ctx context.Context, filter EventFilter) (int64, error)
+}
+
+type mongoEventRepository struct {
+	db *mongo.Database
+}
+
+func NewEventRepository(db *mongo.Database) EventRepository {
+	return &mongoEventRepository{
+		db: db,
+	}
+}
+
+func (r *mongoEventRepository) Create(ctx context.Context, model *Event) error {
+	doc, err := bson.Marshal(model)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Collection(CollectionName).InsertOne(ctx, doc)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Find returns the newest events first
+func (r *mongoEventRepository) Find(ctx context.Context, filter EventFilter, offset int64, limit int64) ([]Event, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(offset).
+		SetLimit(limit)
+
+	cursor, err := r.db.Collection(CollectionName).Find(ctx, filterToQuery(filter), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close(ctx)
+
+	models := make([]Event, 0)
+
+	for cursor.Next(ctx) {
+		var model Event
+
+		if err := cursor.Decode(&model); err != nil {
+			return nil, err
+		}
+
+		models = append(models, model)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return models, nil
+}
+
+func (r *mongoEventRepository) Count(ctx context.Context, filter EventFilter) (int64, error) {
+	return r.db.Collection(CollectionName).CountDocuments(ctx, filterToQuery(filter))
+}
+
+func filterToQuery(filter EventFilter) bson.M {
+	query := bson.M{}
+
+	if filter.Type != "" {
+		query["type"] = filter.Type
+	}
+
+	if filter.UserUID != "" {
+		query["userUid"] = filter.UserUID
+	}
+
+	if filter.Email != "" {
+		query["email"] = filter.Email
+	}
+
+	if filter.Outcome != "" {
+		query["outcome"] = filter.Outcome
+	}
+
+	createdAt := bson.M{}
+
+	if filter.From != nil {
+		createdAt["$gte"] = *filter.From
+	}
+
+	if filter.To != nil {
+		createdAt["$lt"] = *filter.To
+	}
+
+	if len(createdAt) > 0 {
+		query["createdAt"] = createdAt
+	}
+
+	return query
+}
@@ -0,0 +1,109 @@
+package challenge
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	CollectionName = "challenges"
+)
+
+// Challenge is a proof-of-work puzzle, it has to be solved and is then spent by a single
+// request to a protected route
+type Challenge struct {
+	UID        string     `bson:"_id"`
+	Difficulty int        `bson:"difficulty"`
+	CreatedAt  time.Time  `bson:"createdAt"`
+	ExpiresAt  time.Time  `bson:"expiresAt"`
+	SolvedAt   *time.Time `bson:"solvedAt"`
+	SpentAt    *time.Time `bson:"spentAt"`
+}
+
+type ChallengeRepository interface {
+	Create(ctx context.Context, model *Challenge) error
+	FindByUID(ctx context.Context, uid string) (*Challenge, error)
+	// MarkSolved returns false when the challenge is already solved or has expired
+	MarkSolved(ctx context.Context, uid string, t time.Time) (bool, error)
+	// Spend returns false unless the challenge is solved, not spent yet and not expired
+	Spend(ctx context.Context, uid string, t time.Time) (bool, error)
+}
+
+type mongoChallengeRepository struct {
+	db *mongo.Database
+}
+
+func NewChallengeRepository(db *mongo.Database) ChallengeRepository {
+	return &mongoChallengeRepository{
+		db: db,
+	}
+}
+
+func (r *mongoChallengeRepository) Create(ctx context.Context, model *Challenge) error {
+	doc, err := bson.Marshal(model)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Collection(CollectionName).InsertOne(ctx, doc)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *mongoChallengeRepository) FindByUID(ctx context.Context, uid string) (*Challenge, error) {
+	singleResult := r.db.Collection(CollectionName).FindOne(ctx, bson.M{
+		"_id": uid,
+	})
+	if err := singleResult.Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var model Challenge
+
+	if err := singleResult.Decode(&model); err != nil {
+		return nil, err
+	}
+
+	return &model, nil
+}
+
+func (r *mongoChallengeRepository) MarkSolved(ctx context.Context, uid string, t time.Time) (bool, error) {
+	result, err := r.db.Collection(CollectionName).UpdateOne(ctx, bson.M{
+		"_id":       uid,
+		"solvedAt":  nil,
+		"expiresAt": bson.M{"$gt": t},
+	}, bson.M{
+		"$set": bson.M{"solvedAt": t},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+func (r *mongoChallengeRepository) Spend(ctx context.Context, uid string, t time.Time) (bool, error) {
+	result, err := r.db.Collection(CollectionName).UpdateOne(ctx, bson.M{
+		"_id":       uid,
+		"solvedAt":  bson.M{"$ne": nil},
+		"spentAt":   nil,
+		"expiresAt": bson.M{"$gt": t},
+	}, bson.M{
+		"$set": bson.M{"spentAt": t},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
@@ -0,0 +1,105 @@
+package datakey
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type DataKeyDuplicateError struct {
+	error
+}
+
+const (
+	CollectionName = "data_keys"
+)
+
+// DataKey encrypts PII, it's stored wrapped by a master key which is never stored. Data
+// keys are kept after they're rotated, values encrypted with them are still read.
+type DataKey struct {
+	// Generation is incremented with every rotation, the highest one is the active key
+	Generation  int    `bson:"_id"`
+	MasterKeyID string `bson:"masterKeyId"`
+	// WrappedKey is the base64 of the data key sealed with the master key
+	WrappedKey string    `bson:"wrappedKey"`
+	CreatedAt  time.Time `bson:"createdAt"`
+}
+
+type DataKeyRepository interface {
+	// Create fails with DataKeyDuplicateError when the generation exists, another replica
+	// rotated the key first
+	Create(ctx context.Context, model *DataKey) error
+	// FindAll returns the keys by generation
+	FindAll(ctx context.Context) ([]*DataKey, error)
+	// Rewrap replaces the wrapped key unless it was wrapped again since it was read
+	Rewrap(ctx context.Context, generation int, fromMasterKeyID string, masterKeyID string, wrappedKey string) error
+}
+
+type mongoDataKeyRepository struct {
+	db *mongo.Database
+}
+
+func NewDataKeyRepository(db *mongo.Database) DataKeyRepository {
+	return &mongoDataKeyRepository{
+		db: db,
+	}
+}
+
+func (r *mongoDataKeyRepository) Create(ctx context.Context, model *DataKey) error {
+	doc, err := bson.Marshal(model)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Collection(CollectionName).InsertOne(ctx, doc)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return &DataKeyDuplicateError{}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (r *mongoDataKeyRepository) FindAll(ctx context.Context) ([]*DataKey, error) {
+	cursor, err := r.db.Collection(CollectionName).Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*DataKey
+
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (r *mongoDataKeyRepository) Rewrap(
+	ctx context.Context,
+	generation int,
+	fromMasterKeyID string,
+	masterKeyID string,
+	wrappedKey string,
+) error {
+	_, err := r.db.Collection(CollectionName).UpdateOne(ctx, bson.M{
+		"_id":         generation,
+		"masterKeyId": fromMasterKeyID,
+	}, bson.M{
+		"$set": bson.M{
+			"masterKeyId": masterKeyID,
+			"wrappedKey":  wrappedKey,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package datakey
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// memoryDataKeyRepository keeps data keys in memory, they're lost with the values they
+// encrypted when the app stops
+type memoryDataKeyRepository struct {
+	mu   sync.Mutex
+	keys map[int]DataKey
+}
+
+func NewMemoryDataKeyRepository() DataKeyRepository {
+	return &memoryDataKeyRepository{
+		keys: make(map[int]DataKey),
+	}
+}
+
+func (r *memoryDataKeyRepository) Create(_ context.Context, model *DataKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.keys[model.Generation]; ok {
+		return &DataKeyDuplicateError{}
+	}
+
+	r.keys[model.Generation] = *model
+
+	return nil
+}
+
+func (r *memoryDataKeyRepository) FindAll(_ context.Context) ([]*DataKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := make([]*DataKey, 0, len(r.keys))
+
+	for _, k := range r.keys {
+		k := k
+		keys = append(keys, &k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Generation < keys[j].Generation
+	})
+
+	return keys, nil
+}
+
+func (r *memoryDataKeyRepository) Rewrap(
+	_ context.Context,
+	generation int,
+	fromMasterKeyID string,
+	masterKeyID string,
+	wrappedKey string,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k, ok := r.keys[generation]
+	if !ok || k.MasterKeyID != fromMasterKeyID {
+		return nil
+	}
+
+	k.MasterKeyID = masterKeyID
+	k.WrappedKey = wrappedKey
+	r.keys[generation] = k
+
+	return nil
+}
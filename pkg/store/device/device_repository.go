@@ -0,0 +1,134 @@
+package device
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type KnownDeviceDuplicateError struct {
+	error
+}
+
+const (
+	CollectionName = "known_devices"
+)
+
+// KnownDevice is a device the user has signed in from, see security.DeviceIdentity
+type KnownDevice struct {
+	UID         string `bson:"_id"`
+	UserUID     string `bson:"userUid"`
+	Fingerprint string `bson:"fingerprint"`
+	Family      string `bson:"family"`
+	IPPrefix    string `bson:"ipPrefix"`
+	// RevokeToken is the SHA-256 of the token sent in the new device email
+	RevokeToken          string    `bson:"revokeToken"`
+	RevokeTokenExpiresAt time.Time `bson:"revokeTokenExpiresAt"`
+	FirstSeenAt          time.Time `bson:"firstSeenAt"`
+	LastSeenAt           time.Time `bson:"lastSeenAt"`
+}
+
+type KnownDeviceRepository interface {
+	Create(ctx context.Context, model *KnownDevice) error
+	FindByUserAndFingerprint(ctx context.Context, userUID string, fingerprint string) (*KnownDevice, error)
+	FindByRevokeToken(ctx context.Context, token string) (*KnownDevice, error)
+	CountByUser(ctx context.Context, userUID string) (int64, error)
+	SaveLastSeen(ctx context.Context, uid string, t time.Time) error
+	DeleteAllOfUser(ctx context.Context, userUID string) error
+}
+
+type mongoKnownDeviceRepository struct {
+	db *mongo.Database
+}
+
+func NewKnownDeviceRepository(db *mongo.Database) KnownDeviceRepository {
+	return &mongoKnownDeviceRepository{
+		db: db,
+	}
+}
+
+func (r *mongoKnownDeviceRepository) Create(ctx context.Context, model *KnownDevice) error {
+	doc, err := bson.Marshal(model)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Collection(CollectionName).InsertOne(ctx, doc)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return &KnownDeviceDuplicateError{}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (r *mongoKnownDeviceRepository) FindByUserAndFingerprint(
+	ctx context.Context,
+	userUID string,
+	fingerprint string,
+) (*KnownDevice, error) {
+	return r.findOne(ctx, bson.M{
+		"userUid":     userUID,
+		"fingerprint": fingerprint,
+	})
+}
+
+func (r *mongoKnownDeviceRepository) FindByRevokeToken(ctx context.Context, token string) (*KnownDevice, error) {
+	return r.findOne(ctx, bson.M{
+		"revokeToken": token,
+	})
+}
+
+func (r *mongoKnownDeviceRepository) findOne(ctx context.Context, filter bson.M) (*KnownDevice, error) {
+	singleResult := r.db.Collection(CollectionName).FindOne(ctx, filter)
+	if err := singleResult.Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var model KnownDevice
+
+	if err := singleResult.Decode(&model); err != nil {
+		return nil, err
+	}
+
+	return &model, nil
+}
+
+func (r *mongoKnownDeviceRepository) CountByUser(ctx context.Context, userUID string) (int64, error) {
+	return r.db.Collection(CollectionName).CountDocuments(ctx, bson.M{
+		"userUid": userUID,
+	})
+}
+
+func (r *mongoKnownDeviceRepository) SaveLastSeen(ctx context.Context, uid string, t time.Time) error {
+	_, err := r.db.Collection(CollectionName).UpdateOne(ctx, bson.M{
+		"_id": uid,
+	}, bson.M{
+		"$set": bson.M{"lastSeenAt": t},
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *mongoKnownDeviceRepository) DeleteAllOfUser(ctx context.Context, userUID string) error {
+	_, err := r.db.Collection(CollectionName).DeleteMany(ctx, bson.M{
+		"userUid": userUID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
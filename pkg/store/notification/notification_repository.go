@@ -0,0 +1,109 @@
+package notification
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type NotificationType string
+
+const (
+	CollectionName = "notifications"
+	// Retention is how long notifications are kept, whether they were sent or not
+	Retention = time.Hour * 24 * 30
+)
+
+var (
+	TypeSignUpAttempt NotificationType = "sign_up_attempt"
+	TypeNewDevice     NotificationType = "new_device"
+	TypePasswordReset NotificationType = "password_reset"
+)
+
+// Notification is an email queued by the API for the worker to send. The token of Data is
+// a live secret, it's removed once the email is sent. Email stays in plaintext until the
+// notification expires.
+type Notification struct {
+	UID       string            `bson:"_id"`
+	Type      NotificationType  `bson:"type"`
+	Email     string            `bson:"email"`
+	Data      map[string]string `bson:"data,omitempty"`
+	CreatedAt time.Time         `bson:"createdAt"`
+	SentAt    *time.Time        `bson:"sentAt"`
+	ExpiresAt time.Time         `bson:"expiresAt"`
+}
+
+type NotificationRepository interface {
+	Create(ctx context.Context, model *Notification) error
+	FindAllNotSent(ctx context.Context) ([]Notification, error)
+	SaveSentTime(ctx context.Context, uid string, t time.Time) error
+}
+
+type mongoNotificationRepository struct {
+	db *mongo.Database
+}
+
+func NewNotificationRepository(db *mongo.Database) NotificationRepository {
+	return &mongoNotificationRepository{
+		db: db,
+	}
+}
+
+func (r *mongoNotificationRepository) Create(ctx context.Context, model *Notification) error {
+	doc, err := bson.Marshal(model)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Collection(CollectionName).InsertOne(ctx, doc)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *mongoNotificationRepository) FindAllNotSent(ctx context.Context) ([]Notification, error) {
+	cursor, err := r.db.Collection(CollectionName).Find(ctx, bson.M{
+		"sentAt": nil,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close(ctx)
+
+	models := make([]Notification, 0)
+
+	for cursor.Next(ctx) {
+		var model Notification
+
+		if err := cursor.Decode(&model); err != nil {
+			return nil, err
+		}
+
+		models = append(models, model)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return models, nil
+}
+
+// SaveSentTime also removes the token, the email is the only place it's needed
+func (r *mongoNotificationRepository) SaveSentTime(ctx context.Context, uid string, t time.Time) error {
+	_, err := r.db.Collection(CollectionName).UpdateOne(ctx, bson.M{
+		"_id": uid,
+	}, bson.M{
+		"$set":   bson.M{"sentAt": t},
+		"$unset": bson.M{"data.token": ""},
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
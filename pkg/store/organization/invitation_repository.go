@@ -0,0 +1,178 @@
+package organization
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type InvitationStatus string
+
+const (
+	InvitationsCollectionName = "invitations"
+)
+
+var (
+	InvitationStatusPending  InvitationStatus = "pending"
+	InvitationStatusAccepted InvitationStatus = "accepted"
+)
+
+// Invitation keeps the SHA-256 of the token mailed to the invitee as Token, see
+// security.HashToken, and the token itself as MailToken until the invitation is mailed.
+// Invitations created before tokens were hashed keep Token in plaintext until they expire.
+// Email is in plaintext, the invitee may not have signed up yet.
+type Invitation struct {
+	UID             string           `bson:"_id"`
+	OrganizationUID string           `bson:"organizationUid"`
+	Email           string           `bson:"email"`
+	Role            Role             `bson:"role"`
+	Token           string           `bson:"token"`
+	MailToken       string           `bson:"mailToken,omitempty"`
+	InvitedBy       string           `bson:"invitedBy"`
+	Status          InvitationStatus `bson:"status"`
+	CreatedAt       time.Time        `bson:"createdAt"`
+	ExpiresAt       time.Time        `bson:"expiresAt"`
+	NotifiedAt      *time.Time       `bson:"notifiedAt"`
+	AcceptedAt      *time.Time       `bson:"acceptedAt"`
+	AcceptedBy      string           `bson:"acceptedBy,omitempty"`
+}
+
+type InvitationRepository interface {
+	Create(ctx context.Context, model *Invitation) error
+	FindByUID(ctx context.Context, uid string) (*Invitation, error)
+	FindByToken(ctx context.Context, token string) (*Invitation, error)
+	FindAllNotNotified(ctx context.Context) ([]Invitation, error)
+	SaveNotifiedTime(ctx context.Context, uid string, t time.Time) error
+	MarkAccepted(ctx context.Context, uid string, userUID string) (bool, error)
+	DeleteAllByOrganization(ctx context.Context, organizationUID string) error
+}
+
+type mongoInvitationRepository struct {
+	db *mongo.Database
+}
+
+func NewInvitationRepository(db *mongo.Database) InvitationRepository {
+	return &mongoInvitationRepository{
+		db: db,
+	}
+}
+
+func (r *mongoInvitationRepository) Create(ctx context.Context, model *Invitation) error {
+	doc, err := bson.Marshal(model)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Collection(InvitationsCollectionName).InsertOne(ctx, doc)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *mongoInvitationRepository) FindByUID(ctx context.Context, uid string) (*Invitation, error) {
+	return r.findOne(ctx, bson.M{
+		"_id": uid,
+	})
+}
+
+func (r *mongoInvitationRepository) FindByToken(ctx context.Context, token string) (*Invitation, error) {
+	return r.findOne(ctx, bson.M{
+		"token": token,
+	})
+}
+
+func (r *mongoInvitationRepository) findOne(ctx context.Context, filter bson.M) (*Invitation, error) {
+	singleResult := r.db.Collection(InvitationsCollectionName).FindOne(ctx, filter)
+	if err := singleResult.Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var inv Invitation
+
+	if err := singleResult.Decode(&inv); err != nil {
+		return nil, err
+	}
+
+	return &inv, nil
+}
+
+func (r *mongoInvitationRepository) FindAllNotNotified(ctx context.Context) ([]Invitation, error) {
+	cursor, err := r.db.Collection(InvitationsCollectionName).Find(ctx, bson.M{
+		"status":     InvitationStatusPending,
+		"notifiedAt": nil,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close(ctx)
+
+	models := make([]Invitation, 0)
+
+	for cursor.Next(ctx) {
+		var model Invitation
+
+		if err := cursor.Decode(&model); err != nil {
+			return nil, err
+		}
+
+		models = append(models, model)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return models, nil
+}
+
+// SaveNotifiedTime removes the mail token as well, the invitation can't be mailed again
+func (r *mongoInvitationRepository) SaveNotifiedTime(ctx context.Context, uid string, t time.Time) error {
+	_, err := r.db.Collection(InvitationsCollectionName).UpdateOne(ctx, bson.M{
+		"_id": uid,
+	}, bson.M{
+		"$set":   bson.M{"notifiedAt": t},
+		"$unset": bson.M{"mailToken": ""},
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *mongoInvitationRepository) MarkAccepted(ctx context.Context, uid string, userUID string) (bool, error) {
+	res, err := r.db.Collection(InvitationsCollectionName).UpdateOne(ctx, bson.M{
+		"_id":    uid,
+		"status": InvitationStatusPending,
+	}, bson.M{
+		"$set": bson.M{
+			"status":     InvitationStatusAccepted,
+			"acceptedAt": time.Now(),
+			"acceptedBy": userUID,
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return res.ModifiedCount > 0, nil
+}
+
+func (r *mongoInvitationRepository) DeleteAllByOrganization(ctx context.Context, organizationUID string) error {
+	_, err := r.db.Collection(InvitationsCollectionName).DeleteMany(ctx, bson.M{
+		"organizationUid": organizationUID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package organization
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MembershipDuplicateError struct {
+	error
+}
+
+type Role string
+
+const (
+	MembershipsCollectionName = "memberships"
+)
+
+var (
+	RoleOwner  Role = "owner"
+	RoleAdmin  Role = "admin"
+	RoleMember Role = "member"
+)
+
+var Roles = []Role{RoleOwner, RoleAdmin, RoleMember}
+
+func (r Role) CanInvite() bool {
+	return r == RoleOwner || r == RoleAdmin
+}
+
+// Membership keeps the UID of the invitation it was created by as InvitationUID, if any
+type Membership struct {
+	UID             string    `bson:"_id"`
+	OrganizationUID string    `bson:"organizationUid"`
+	UserUID         string    `bson:"userUid"`
+	Role            Role      `bson:"role"`
+	InvitationUID   string    `bson:"invitationUid,omitempty"`
+	CreatedAt       time.Time `bson:"createdAt"`
+}
+
+type MembershipRepository interface {
+	Create(ctx context.Context, model *Membership) error
+	FindByOrganizationAndUser(ctx context.Context, organizationUID string, userUID string) (*Membership, error)
+	FindAllByUser(ctx context.Context, userUID string) ([]Membership, error)
+	// FindAllByOrganization returns the memberships from the oldest
+	FindAllByOrganization(ctx context.Context, organizationUID string) ([]Membership, error)
+	UpdateRole(ctx context.Context, uid string, role Role) error
+	DeleteAllByUser(ctx context.Context, userUID string) error
+}
+
+type mongoMembershipRepository struct {
+	db *mongo.Database
+}
+
+func NewMembershipRepository(db *mongo.Database) MembershipRepository {
+	return &mongoMembershipRepository{
+		db: db,
+	}
+}
+
+func (r *mongoMembershipRepository) Create(ctx context.Context, model *Membership) error {
+	doc, err := bson.Marshal(model)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Collection(MembershipsCollectionName).InsertOne(ctx, doc)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return &MembershipDuplicateError{}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (r *mongoMembershipRepository) FindByOrganizationAndUser(
+	ctx context.Context,
+	organizationUID string,
+	userUID string,
+) (*Membership, error) {
+	singleResult := r.db.Collection(MembershipsCollectionName).FindOne(ctx, bson.M{
+		"organizationUid": organizationUID,
+		"userUid":         userUID,
+	})
+	if err := singleResult.Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var m Membership
+
+	if err := singleResult.Decode(&m); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+func (r *mongoMembershipRepository) FindAllByUser(ctx context.Context, userUID string) ([]Membership, error) {
+	return r.findAll(ctx, bson.M{
+		"userUid": userUID,
+	})
+}
+
+func (r *mongoMembershipRepository) FindAllByOrganization(
+	ctx context.Context,
+	organizationUID string,
+) ([]Membership, error) {
+	return r.findAll(ctx, bson.M{
+		"organizationUid": organizationUID,
+	}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}))
+}
+
+func (r *mongoMembershipRepository) findAll(
+	ctx context.Context,
+	filter bson.M,
+	opts ...*options.FindOptions,
+) ([]Membership, error) {
+	cursor, err := r.db.Collection(MembershipsCollectionName).Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close(ctx)
+
+	models := make([]Membership, 0)
+
+	for cursor.Next(ctx) {
+		var model Membership
+
+		if err := cursor.Decode(&model); err != nil {
+			return nil, err
+		}
+
+		models = append(models, model)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return models, nil
+}
+
+func (r *mongoMembershipRepository) UpdateRole(ctx context.Context, uid string, role Role) error {
+	_, err := r.db.Collection(MembershipsCollectionName).UpdateOne(ctx, bson.M{
+		"_id": uid,
+	}, bson.M{
+		"$set": bson.M{"role": role},
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *mongoMembershipRepository) DeleteAllByUser(ctx context.Context, userUID string) error {
+	_, err := r.db.Collection(MembershipsCollectionName).DeleteMany(ctx, bson.M{
+		"userUid": userUID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
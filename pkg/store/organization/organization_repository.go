@@ -0,0 +1,111 @@
+package organization
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	CollectionName = "organizations"
+)
+
+type Organization struct {
+	UID       string    `bson:"_id"`
+	Name      string    `bson:"name"`
+	CreatedBy string    `bson:"createdBy"`
+	CreatedAt time.Time `bson:"createdAt"`
+}
+
+type OrganizationRepository interface {
+	Create(ctx context.Context, model *Organization) error
+	FindByUID(ctx context.Context, uid string) (*Organization, error)
+	FindByUIDs(ctx context.Context, uids []string) ([]Organization, error)
+	Delete(ctx context.Context, uid string) error
+}
+
+type mongoOrganizationRepository struct {
+	db *mongo.Database
+}
+
+func NewOrganizationRepository(db *mongo.Database) OrganizationRepository {
+	return &mongoOrganizationRepository{
+		db: db,
+	}
+}
+
+func (r *mongoOrganizationRepository) Create(ctx context.Context, model *Organization) error {
+	doc, err := bson.Marshal(model)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Collection(CollectionName).InsertOne(ctx, doc)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *mongoOrganizationRepository) FindByUID(ctx context.Context, uid string) (*Organization, error) {
+	singleResult := r.db.Collection(CollectionName).FindOne(ctx, bson.M{
+		"_id": uid,
+	})
+	if err := singleResult.Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var o Organization
+
+	if err := singleResult.Decode(&o); err != nil {
+		return nil, err
+	}
+
+	return &o, nil
+}
+
+func (r *mongoOrganizationRepository) FindByUIDs(ctx context.Context, uids []string) ([]Organization, error) {
+	cursor, err := r.db.Collection(CollectionName).Find(ctx, bson.M{
+		"_id": bson.M{"$in": uids},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close(ctx)
+
+	models := make([]Organization, 0)
+
+	for cursor.Next(ctx) {
+		var model Organization
+
+		if err := cursor.Decode(&model); err != nil {
+			return nil, err
+		}
+
+		models = append(models, model)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return models, nil
+}
+
+func (r *mongoOrganizationRepository) Delete(ctx context.Context, uid string) error {
+	_, err := r.db.Collection(CollectionName).DeleteOne(ctx, bson.M{
+		"_id": uid,
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
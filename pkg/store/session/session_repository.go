@@ -0,0 +1,144 @@
+package session
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	CollectionName = "sessions"
+)
+
+// Session backs a browser session cookie, it holds what a bearer token would carry but the
+// profile of the user, which is read from the user so that no copy of their PII is kept
+type Session struct {
+	// UID is the SHA-256 of the cookie value, a leaked collection can't be replayed
+	UID             string    `bson:"_id"`
+	UserUID         string    `bson:"userUid"`
+	OrganizationUID string    `bson:"organizationUid,omitempty"`
+	Role            string    `bson:"role,omitempty"`
+	Admin           bool      `bson:"admin,omitempty"`
+	AuthTime        time.Time `bson:"authTime"`
+	AMR             []string  `bson:"amr,omitempty"`
+	// CSRFToken is the SHA-256 of the token of the double-submit cookie
+	CSRFToken  string    `bson:"csrfToken"`
+	IP         string    `bson:"ip,omitempty"`
+	UserAgent  string    `bson:"userAgent,omitempty"`
+	CreatedAt  time.Time `bson:"createdAt"`
+	LastSeenAt time.Time `bson:"lastSeenAt"`
+	ExpiresAt  time.Time `bson:"expiresAt"`
+}
+
+type SessionRepository interface {
+	Create(ctx context.Context, model *Session) error
+	FindByUID(ctx context.Context, uid string) (*Session, error)
+	Touch(ctx context.Context, uid string, lastSeenAt time.Time, expiresAt time.Time) error
+	SaveOrganization(ctx context.Context, uid string, organizationUID string, role string) error
+	SaveAuthentication(ctx context.Context, uid string, authTime time.Time, amr []string) error
+	Delete(ctx context.Context, uid string) error
+	DeleteAllOfUser(ctx context.Context, userUID string) error
+}
+
+type mongoSessionRepository struct {
+	db *mongo.Database
+}
+
+func NewSessionRepository(db *mongo.Database) SessionRepository {
+	return &mongoSessionRepository{
+		db: db,
+	}
+}
+
+func (r *mongoSessionRepository) Create(ctx context.Context, model *Session) error {
+	doc, err := bson.Marshal(model)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Collection(CollectionName).InsertOne(ctx, doc)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *mongoSessionRepository) FindByUID(ctx context.Context, uid string) (*Session, error) {
+	singleResult := r.db.Collection(CollectionName).FindOne(ctx, bson.M{
+		"_id": uid,
+	})
+	if err := singleResult.Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var model Session
+
+	if err := singleResult.Decode(&model); err != nil {
+		return nil, err
+	}
+
+	return &model, nil
+}
+
+func (r *mongoSessionRepository) Touch(ctx context.Context, uid string, lastSeenAt time.Time, expiresAt time.Time) error {
+	return r.set(ctx, uid, bson.M{
+		"lastSeenAt": lastSeenAt,
+		"expiresAt":  expiresAt,
+	})
+}
+
+func (r *mongoSessionRepository) SaveOrganization(ctx context.Context, uid string, organizationUID string, role string) error {
+	return r.set(ctx, uid, bson.M{
+		"organizationUid": organizationUID,
+		"role":            role,
+	})
+}
+
+func (r *mongoSessionRepository) SaveAuthentication(ctx context.Context, uid string, authTime time.Time, amr []string) error {
+	return r.set(ctx, uid, bson.M{
+		"authTime": authTime,
+		"amr":      amr,
+	})
+}
+
+func (r *mongoSessionRepository) Delete(ctx context.Context, uid string) error {
+	_, err := r.db.Collection(CollectionName).DeleteOne(ctx, bson.M{
+		"_id": uid,
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *mongoSessionRepository) DeleteAllOfUser(ctx context.Context, userUID string) error {
+	_, err := r.db.Collection(CollectionName).DeleteMany(ctx, bson.M{
+		"userUid": userUID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *mongoSessionRepository) set(ctx context.Context, uid string, fields bson.M) error {
+	_, err := r.db.Collection(CollectionName).UpdateOne(ctx, bson.M{
+		"_id": uid,
+	}, bson.M{
+		"$set": fields,
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
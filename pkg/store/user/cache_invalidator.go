@@ -0,0 +1,91 @@
+package user
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	invalidatorRetryDelay = time.Second
+)
+
+// CacheInvalidator drops users from the cache as soon as any replica changes them, from a
+// change stream of the users collection. Change streams need Mongo to run as a replica set.
+type CacheInvalidator struct {
+	db    *mongo.Database
+	cache *CachedUserRepository
+	// onError is told about failures of the stream, it's opened again after a delay
+	onError func(err error)
+}
+
+func NewCacheInvalidator(db *mongo.Database, cache *CachedUserRepository, onError func(err error)) *CacheInvalidator {
+	return &CacheInvalidator{
+		db:      db,
+		cache:   cache,
+		onError: onError,
+	}
+}
+
+type changeEvent struct {
+	OperationType string `bson:"operationType"`
+	DocumentKey   struct {
+		UID string `bson:"_id"`
+	} `bson:"documentKey"`
+}
+
+// Run watches until ctx is done. The cache is purged whenever the stream is opened, since
+// changes made while it was closed are unknown.
+func (i *CacheInvalidator) Run(ctx context.Context) {
+	for {
+		err := i.watch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		// the stream also ends without error after the collection is dropped or renamed
+		if err != nil {
+			i.onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(invalidatorRetryDelay):
+		}
+	}
+}
+
+func (i *CacheInvalidator) watch(ctx context.Context) error {
+	stream, err := i.db.Collection(CollectionName).Watch(ctx, mongo.Pipeline{
+		{{"$project", bson.M{"operationType": 1, "documentKey": 1}}},
+	}, options.ChangeStream())
+	if err != nil {
+		return err
+	}
+
+	defer stream.Close(context.Background())
+
+	i.cache.Purge()
+
+	for stream.Next(ctx) {
+		var event changeEvent
+
+		if err := stream.Decode(&event); err != nil {
+			return err
+		}
+
+		switch event.OperationType {
+		case "insert", "update", "replace", "delete":
+			i.cache.Invalidate(event.DocumentKey.UID)
+		default:
+			// drop, rename and invalidate end the stream
+			i.cache.Purge()
+		}
+	}
+
+	return stream.Err()
+}
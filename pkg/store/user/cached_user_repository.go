@@ -0,0 +1,338 @@
+package user
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type CacheSettings struct {
+	// Size is the number of users kept, the least recently used one is evicted first
+	Size int
+	// TTL bounds how long a user changed by another replica can be served, unless the
+	// CacheInvalidator runs
+	TTL time.Duration
+}
+
+var DefaultCacheSettings = CacheSettings{
+	Size: 10000,
+	TTL:  time.Minute,
+}
+
+// CacheStats are counted since the cache was created
+type CacheStats struct {
+	Hits          uint64
+	Misses        uint64
+	Evictions     uint64
+	Invalidations uint64
+	Size          int
+}
+
+type cacheEntry struct {
+	user      *User
+	expiresAt time.Time
+}
+
+// CachedUserRepository serves FindByUID and FindByEmailKey from memory and reads through
+// to the decorated repository on a miss. Every write invalidates the user it changes, only
+// users found are cached.
+type CachedUserRepository struct {
+	next     UserRepository
+	settings CacheSettings
+
+	mu         sync.Mutex
+	lru        *list.List
+	byUID      map[string]*list.Element
+	byEmailKey map[string]string
+	// generation changes with every invalidation, a read which started before one isn't
+	// cached since it may have returned the user as it was before the write
+	generation uint64
+
+	hits          uint64
+	misses        uint64
+	evictions     uint64
+	invalidations uint64
+}
+
+func NewCachedUserRepository(next UserRepository, settings CacheSettings) *CachedUserRepository {
+	return &CachedUserRepository{
+		next:       next,
+		settings:   settings,
+		lru:        list.New(),
+		byUID:      make(map[string]*list.Element),
+		byEmailKey: make(map[string]string),
+	}
+}
+
+func (r *CachedUserRepository) Stats() CacheStats {
+	r.mu.Lock()
+	size := r.lru.Len()
+	r.mu.Unlock()
+
+	return CacheStats{
+		Hits:          atomic.LoadUint64(&r.hits),
+		Misses:        atomic.LoadUint64(&r.misses),
+		Evictions:     atomic.LoadUint64(&r.evictions),
+		Invalidations: atomic.LoadUint64(&r.invalidations),
+		Size:          size,
+	}
+}
+
+// Invalidate drops the user from the cache, it's called after every write and by the
+// CacheInvalidator for writes of other replicas
+func (r *CachedUserRepository) Invalidate(uid string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.generation++
+
+	if elem, ok := r.byUID[uid]; ok {
+		r.remove(elem)
+		atomic.AddUint64(&r.invalidations, 1)
+	}
+}
+
+// Purge drops every user, for writes whose users aren't known
+func (r *CachedUserRepository) Purge() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.generation++
+
+	atomic.AddUint64(&r.invalidations, uint64(r.lru.Len()))
+
+	r.lru.Init()
+	r.byUID = make(map[string]*list.Element)
+	r.byEmailKey = make(map[string]string)
+}
+
+func (r *CachedUserRepository) FindByUID(ctx context.Context, uid string) (*User, error) {
+	if u, ok := r.get(uid); ok {
+		return u, nil
+	}
+
+	generation := r.currentGeneration()
+
+	u, err := r.next.FindByUID(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	r.put(u, generation)
+
+	return u, nil
+}
+
+func (r *CachedUserRepository) FindByEmailKey(ctx context.Context, emailKey string) (*User, error) {
+	r.mu.Lock()
+	uid, ok := r.byEmailKey[emailKey]
+	r.mu.Unlock()
+
+	if ok {
+		if u, ok := r.get(uid); ok {
+			return u, nil
+		}
+	} else {
+		atomic.AddUint64(&r.misses, 1)
+	}
+
+	generation := r.currentGeneration()
+
+	u, err := r.next.FindByEmailKey(ctx, emailKey)
+	if err != nil || u == nil {
+		return u, err
+	}
+
+	r.put(u, generation)
+
+	return u, nil
+}
+
+// FindDeletedByUID isn't cached, deleted users are only looked up by admins
+func (r *CachedUserRepository) FindDeletedByUID(ctx context.Context, uid string) (*User, error) {
+	return r.next.FindDeletedByUID(ctx, uid)
+}
+
+func (r *CachedUserRepository) Restore(ctx context.Context, uid string, deletedAfter time.Time) error {
+	defer r.Invalidate(uid)
+
+	return r.next.Restore(ctx, uid, deletedAfter)
+}
+
+// FindUIDsDeletedBefore and PurgeDeleted work on deleted users, they aren't cached
+
+func (r *CachedUserRepository) FindUIDsDeletedBefore(ctx context.Context, t time.Time, limit int) ([]string, error) {
+	return r.next.FindUIDsDeletedBefore(ctx, t, limit)
+}
+
+func (r *CachedUserRepository) PurgeDeleted(ctx context.Context, uid string, t time.Time) (bool, error) {
+	return r.next.PurgeDeleted(ctx, uid, t)
+}
+
+func (r *CachedUserRepository) Delete(
+	ctx context.Context,
+	uid string,
+	version int,
+	deletedBy string,
+	t time.Time,
+) error {
+	defer r.Invalidate(uid)
+
+	return r.next.Delete(ctx, uid, version, deletedBy, t)
+}
+
+func (r *CachedUserRepository) DeleteAllPendingOlderThan(ctx context.Context, t time.Time, except []string) (int, error) {
+	defer r.Purge()
+
+	return r.next.DeleteAllPendingOlderThan(ctx, t, except)
+}
+
+func (r *CachedUserRepository) Create(ctx context.Context, model *User) error {
+	defer r.Invalidate(model.UID)
+
+	return r.next.Create(ctx, model)
+}
+
+func (r *CachedUserRepository) Confirm(ctx context.Context, uid string, version int) (bool, error) {
+	defer r.Invalidate(uid)
+
+	return r.next.Confirm(ctx, uid, version)
+}
+
+func (r *CachedUserRepository) UpdatePasswordHash(
+	ctx context.Context,
+	uid string,
+	version int,
+	passwordHash string,
+) error {
+	defer r.Invalidate(uid)
+
+	return r.next.UpdatePasswordHash(ctx, uid, version, passwordHash)
+}
+
+func (r *CachedUserRepository) RequirePasswordReset(
+	ctx context.Context,
+	uid string,
+	version int,
+	revokeSessions bool,
+	t time.Time,
+) error {
+	defer r.Invalidate(uid)
+
+	return r.next.RequirePasswordReset(ctx, uid, version, revokeSessions, t)
+}
+
+func (r *CachedUserRepository) CompletePasswordReset(
+	ctx context.Context,
+	uid string,
+	version int,
+	passwordHash string,
+) error {
+	defer r.Invalidate(uid)
+
+	return r.next.CompletePasswordReset(ctx, uid, version, passwordHash)
+}
+
+func (r *CachedUserRepository) UpdateProfile(
+	ctx context.Context,
+	uid string,
+	version int,
+	update ProfileUpdate,
+	t time.Time,
+) error {
+	defer r.Invalidate(uid)
+
+	return r.next.UpdateProfile(ctx, uid, version, update, t)
+}
+
+func (r *CachedUserRepository) FindWithOtherKeyGeneration(
+	ctx context.Context,
+	generation int,
+	afterUID string,
+	limit int,
+) ([]*User, error) {
+	// stored values aren't cached
+	return r.next.FindWithOtherKeyGeneration(ctx, generation, afterUID, limit)
+}
+
+func (r *CachedUserRepository) UpdatePII(ctx context.Context, uid string, version int, pii PII) error {
+	defer r.Invalidate(uid)
+
+	return r.next.UpdatePII(ctx, uid, version, pii)
+}
+
+func (r *CachedUserRepository) currentGeneration() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.generation
+}
+
+// get counts a hit or a miss, expired users are dropped
+func (r *CachedUserRepository) get(uid string) (*User, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	elem, ok := r.byUID[uid]
+	if !ok {
+		atomic.AddUint64(&r.misses, 1)
+
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+
+	if !time.Now().Before(entry.expiresAt) {
+		r.remove(elem)
+		atomic.AddUint64(&r.misses, 1)
+
+		return nil, false
+	}
+
+	r.lru.MoveToFront(elem)
+	atomic.AddUint64(&r.hits, 1)
+
+	return cloneUser(entry.user), true
+}
+
+// put caches a user read at generation, unless it was invalidated since
+func (r *CachedUserRepository) put(u *User, generation uint64) {
+	if r.settings.Size <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.generation != generation {
+		return
+	}
+
+	if elem, ok := r.byUID[u.UID]; ok {
+		r.remove(elem)
+	}
+
+	r.byUID[u.UID] = r.lru.PushFront(&cacheEntry{
+		user:      cloneUser(u),
+		expiresAt: time.Now().Add(r.settings.TTL),
+	})
+	r.byEmailKey[u.EmailKey] = u.UID
+
+	for r.lru.Len() > r.settings.Size {
+		r.remove(r.lru.Back())
+		atomic.AddUint64(&r.evictions, 1)
+	}
+}
+
+// remove has to be called with the lock held
+func (r *CachedUserRepository) remove(elem *list.Element) {
+	entry := r.lru.Remove(elem).(*cacheEntry)
+
+	delete(r.byUID, entry.user.UID)
+
+	if r.byEmailKey[entry.user.EmailKey] == entry.user.UID {
+		delete(r.byEmailKey, entry.user.EmailKey)
+	}
+}
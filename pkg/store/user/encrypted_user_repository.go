@@ -0,0 +1,212 @@
+package user
+
+import (
+	"context"
+	"time"
+)
+
+// encryptedUserRepository stores the name and the email of users encrypted with the keyring.
+// The email key is replaced by its blind index, users are still found by email and the
+// unique index still applies. Users stored in plaintext are read as they are until they're
+// encrypted again, see Keyring.ReEncrypt.
+//
+// The EmailKey of found users is the stored blind index, unless they're found by email key.
+//
+// Sessions read the profile from the user. Emails are still copied in plaintext by
+// invitations, notifications and audit events, none of which the keyring covers: they're
+// needed to mail and to look up events, and they go away when these documents expire.
+type encryptedUserRepository struct {
+	next    UserRepository
+	keyring *Keyring
+}
+
+func NewEncryptedUserRepository(next UserRepository, keyring *Keyring) UserRepository {
+	return &encryptedUserRepository{
+		next:    next,
+		keyring: keyring,
+	}
+}
+
+// Create checks the email against users stored in plaintext beforehand, they aren't covered
+// by the unique index of blind indexes. It's a limitation of the migration period: the check
+// races with replicas which still store users in plaintext, the same email can then be
+// signed up twice. ReEncryptWorker reports the plaintext user as a duplicate and leaves it as
+// it is, it has to be resolved by hand. Once every replica encrypts, the unique index covers
+// every new user.
+func (r *encryptedUserRepository) Create(ctx context.Context, model *User) error {
+	existing, err := r.next.FindByEmailKey(ctx, model.EmailKey)
+	if err != nil {
+		return err
+	}
+
+	if existing != nil {
+		return &UserDuplicateError{}
+	}
+
+	stored := *model
+	generation, _ := r.keyring.Active()
+
+	if stored.Name, err = r.keyring.Encrypt(model.UID, "name", model.Name); err != nil {
+		return err
+	}
+
+	if stored.Email, err = r.keyring.Encrypt(model.UID, "email", model.Email); err != nil {
+		return err
+	}
+
+	stored.EmailKey = r.keyring.BlindIndex(model.EmailKey)
+	stored.KeyGeneration = generation
+
+	return r.next.Create(ctx, &stored)
+}
+
+func (r *encryptedUserRepository) FindByUID(ctx context.Context, uid string) (*User, error) {
+	u, err := r.next.FindByUID(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.decrypt(ctx, u)
+}
+
+// FindByEmailKey looks up the key itself when its blind index isn't found, for users stored
+// in plaintext
+func (r *encryptedUserRepository) FindByEmailKey(ctx context.Context, emailKey string) (*User, error) {
+	u, err := r.next.FindByEmailKey(ctx, r.keyring.BlindIndex(emailKey))
+	if err != nil {
+		return nil, err
+	}
+
+	if u == nil {
+		u, err = r.next.FindByEmailKey(ctx, emailKey)
+		if err != nil || u == nil {
+			return nil, err
+		}
+	}
+
+	u, err = r.decrypt(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	u.EmailKey = emailKey
+
+	return u, nil
+}
+
+func (r *encryptedUserRepository) FindDeletedByUID(ctx context.Context, uid string) (*User, error) {
+	u, err := r.next.FindDeletedByUID(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.decrypt(ctx, u)
+}
+
+func (r *encryptedUserRepository) UpdateProfile(
+	ctx context.Context,
+	uid string,
+	version int,
+	update ProfileUpdate,
+	t time.Time,
+) error {
+	if update.Name != nil {
+		name, err := r.keyring.Encrypt(uid, "name", *update.Name)
+		if err != nil {
+			return err
+		}
+
+		update.Name = &name
+	}
+
+	return r.next.UpdateProfile(ctx, uid, version, update, t)
+}
+
+func (r *encryptedUserRepository) decrypt(ctx context.Context, u *User) (*User, error) {
+	var err error
+
+	if u.Name, err = r.keyring.Decrypt(ctx, u.UID, "name", u.Name); err != nil {
+		return nil, err
+	}
+
+	if u.Email, err = r.keyring.Decrypt(ctx, u.UID, "email", u.Email); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// the methods below don't read or write PII
+
+func (r *encryptedUserRepository) DeleteAllPendingOlderThan(ctx context.Context, t time.Time, except []string) (int, error) {
+	return r.next.DeleteAllPendingOlderThan(ctx, t, except)
+}
+
+func (r *encryptedUserRepository) Restore(ctx context.Context, uid string, deletedAfter time.Time) error {
+	return r.next.Restore(ctx, uid, deletedAfter)
+}
+
+func (r *encryptedUserRepository) FindUIDsDeletedBefore(ctx context.Context, t time.Time, limit int) ([]string, error) {
+	return r.next.FindUIDsDeletedBefore(ctx, t, limit)
+}
+
+func (r *encryptedUserRepository) PurgeDeleted(ctx context.Context, uid string, t time.Time) (bool, error) {
+	return r.next.PurgeDeleted(ctx, uid, t)
+}
+
+func (r *encryptedUserRepository) Confirm(ctx context.Context, uid string, version int) (bool, error) {
+	return r.next.Confirm(ctx, uid, version)
+}
+
+func (r *encryptedUserRepository) UpdatePasswordHash(
+	ctx context.Context,
+	uid string,
+	version int,
+	passwordHash string,
+) error {
+	return r.next.UpdatePasswordHash(ctx, uid, version, passwordHash)
+}
+
+func (r *encryptedUserRepository) RequirePasswordReset(
+	ctx context.Context,
+	uid string,
+	version int,
+	revokeSessions bool,
+	t time.Time,
+) error {
+	return r.next.RequirePasswordReset(ctx, uid, version, revokeSessions, t)
+}
+
+func (r *encryptedUserRepository) CompletePasswordReset(
+	ctx context.Context,
+	uid string,
+	version int,
+	passwordHash string,
+) error {
+	return r.next.CompletePasswordReset(ctx, uid, version, passwordHash)
+}
+
+func (r *encryptedUserRepository) Delete(
+	ctx context.Context,
+	uid string,
+	version int,
+	deletedBy string,
+	t time.Time,
+) error {
+	return r.next.Delete(ctx, uid, version, deletedBy, t)
+}
+
+// FindWithOtherKeyGeneration and UpdatePII work on stored values, they're passed on as they are
+
+func (r *encryptedUserRepository) FindWithOtherKeyGeneration(
+	ctx context.Context,
+	generation int,
+	afterUID string,
+	limit int,
+) ([]*User, error) {
+	return r.next.FindWithOtherKeyGeneration(ctx, generation, afterUID, limit)
+}
+
+func (r *encryptedUserRepository) UpdatePII(ctx context.Context, uid string, version int, pii PII) error {
+	return r.next.UpdatePII(ctx, uid, version, pii)
+}
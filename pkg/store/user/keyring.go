@@ -0,0 +1,308 @@
+package user
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"apart-deal-api/pkg/security"
+	"apart-deal-api/pkg/store/datakey"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// encryptedPrefix starts encrypted values, it's followed by the generation of the data
+	// key and the base64 of the sealed value
+	encryptedPrefix = "enc:v1:"
+)
+
+type KeyringSettings struct {
+	// MasterKeys wrap the data keys, the first one wraps new keys. The others are only needed
+	// until Load wrapped their keys again with the first one.
+	MasterKeys []security.MasterKey
+	// IndexKey is the HMAC key of the blind index of email keys, users aren't found by email
+	// anymore once it's changed
+	IndexKey []byte
+	// Rotation is the age of the active data key after which Rotate creates a new one, 0
+	// never rotates
+	Rotation time.Duration
+}
+
+// Keyring holds the unwrapped data keys. Values are encrypted with the active key, the one
+// of the highest generation, and bound to the user and field they belong to.
+type Keyring struct {
+	repo     datakey.DataKeyRepository
+	settings KeyringSettings
+
+	mu              sync.RWMutex
+	keys            map[int][]byte
+	active          int
+	activeCreatedAt time.Time
+}
+
+func NewKeyring(repo datakey.DataKeyRepository, settings KeyringSettings) *Keyring {
+	return &Keyring{
+		repo:     repo,
+		settings: settings,
+		keys:     make(map[int][]byte),
+	}
+}
+
+// Load reads the data keys, the first one is created when there is none. Keys wrapped by
+// another master key than the first one are wrapped again with it.
+func (k *Keyring) Load(ctx context.Context) error {
+	stored, err := k.repo.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(stored) == 0 {
+		if err := k.create(ctx, 1); err != nil {
+			return err
+		}
+
+		return k.Load(ctx)
+	}
+
+	current := k.settings.MasterKeys[0]
+	keys := make(map[int][]byte, len(stored))
+
+	for _, s := range stored {
+		master, ok := k.masterKey(s.MasterKeyID)
+		if !ok {
+			return errors.Errorf("Data key %d is wrapped by unknown master key %s", s.Generation, s.MasterKeyID)
+		}
+
+		wrapped, err := base64.StdEncoding.DecodeString(s.WrappedKey)
+		if err != nil {
+			return errors.Wrapf(err, "failed while decoding data key %d", s.Generation)
+		}
+
+		key, err := security.UnwrapKey(master, wrapped)
+		if err != nil {
+			return errors.Wrapf(err, "failed while unwrapping data key %d", s.Generation)
+		}
+
+		if master.ID != current.ID {
+			if err := k.rewrap(ctx, s, key); err != nil {
+				return err
+			}
+		}
+
+		keys[s.Generation] = key
+	}
+
+	last := stored[len(stored)-1]
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys = keys
+	k.active = last.Generation
+	k.activeCreatedAt = last.CreatedAt
+
+	return nil
+}
+
+// Rotate loads the keys of other replicas and creates a new active key when the active one
+// is older than the rotation, true is returned then. Values encrypted with older keys are
+// still read, see ReEncrypt.
+func (k *Keyring) Rotate(ctx context.Context) (bool, error) {
+	if err := k.Load(ctx); err != nil {
+		return false, err
+	}
+
+	active, createdAt := k.Active()
+
+	if k.settings.Rotation <= 0 || time.Since(createdAt) < k.settings.Rotation {
+		return false, nil
+	}
+
+	if err := k.create(ctx, active+1); err != nil {
+		return false, err
+	}
+
+	return true, k.Load(ctx)
+}
+
+// Active returns the generation of the key values are encrypted with and its creation time
+func (k *Keyring) Active() (int, time.Time) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.active, k.activeCreatedAt
+}
+
+// Encrypt seals the field of the user with the active key, the result can't be moved to
+// another user or field
+func (k *Keyring) Encrypt(uid string, field string, value string) (string, error) {
+	k.mu.RLock()
+	generation := k.active
+	key := k.keys[generation]
+	k.mu.RUnlock()
+
+	sealed, err := security.Seal(key, []byte(value), additionalData(uid, field))
+	if err != nil {
+		return "", err
+	}
+
+	return encryptedPrefix + strconv.Itoa(generation) + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns values which aren't encrypted as they are, keys created by other replicas
+// since the last Load are loaded on demand
+func (k *Keyring) Decrypt(ctx context.Context, uid string, field string, value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+
+	encodedGeneration, encoded, ok := strings.Cut(strings.TrimPrefix(value, encryptedPrefix), ":")
+	if !ok {
+		return "", errors.Errorf("Invalid encrypted %s of user %s", field, uid)
+	}
+
+	generation, err := strconv.Atoi(encodedGeneration)
+	if err != nil {
+		return "", errors.Errorf("Invalid key generation of the %s of user %s", field, uid)
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed while decoding the %s of user %s", field, uid)
+	}
+
+	key, err := k.key(ctx, generation)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := security.Open(key, sealed, additionalData(uid, field))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed while decrypting the %s of user %s", field, uid)
+	}
+
+	return string(plaintext), nil
+}
+
+// BlindIndex stands for an email key, it's stored and looked up in its place
+func (k *Keyring) BlindIndex(emailKey string) string {
+	return security.BlindIndex(k.settings.IndexKey, emailKey)
+}
+
+// ReEncrypt returns the PII of a stored user encrypted with the active key, users stored in
+// plaintext are encrypted
+func (k *Keyring) ReEncrypt(ctx context.Context, u *User) (PII, error) {
+	generation, _ := k.Active()
+
+	name, err := k.reEncrypt(ctx, u.UID, "name", u.Name)
+	if err != nil {
+		return PII{}, err
+	}
+
+	email, err := k.reEncrypt(ctx, u.UID, "email", u.Email)
+	if err != nil {
+		return PII{}, err
+	}
+
+	emailKey := u.EmailKey
+	if u.KeyGeneration == 0 {
+		emailKey = k.BlindIndex(u.EmailKey)
+	}
+
+	return PII{
+		Name:          name,
+		Email:         email,
+		EmailKey:      emailKey,
+		KeyGeneration: generation,
+	}, nil
+}
+
+func (k *Keyring) reEncrypt(ctx context.Context, uid string, field string, value string) (string, error) {
+	plaintext, err := k.Decrypt(ctx, uid, field, value)
+	if err != nil {
+		return "", err
+	}
+
+	return k.Encrypt(uid, field, plaintext)
+}
+
+func (k *Keyring) key(ctx context.Context, generation int) ([]byte, error) {
+	k.mu.RLock()
+	key, ok := k.keys[generation]
+	k.mu.RUnlock()
+
+	if ok {
+		return key, nil
+	}
+
+	if err := k.Load(ctx); err != nil {
+		return nil, err
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if key, ok := k.keys[generation]; ok {
+		return key, nil
+	}
+
+	return nil, errors.Errorf("Unknown data key %d", generation)
+}
+
+// create stores the key of the generation, nothing is done when another replica created it
+// first
+func (k *Keyring) create(ctx context.Context, generation int) error {
+	key, err := security.NewDataKey()
+	if err != nil {
+		return err
+	}
+
+	current := k.settings.MasterKeys[0]
+
+	wrapped, err := security.WrapKey(current, key)
+	if err != nil {
+		return err
+	}
+
+	err = k.repo.Create(ctx, &datakey.DataKey{
+		Generation:  generation,
+		MasterKeyID: current.ID,
+		WrappedKey:  base64.StdEncoding.EncodeToString(wrapped),
+		CreatedAt:   time.Now(),
+	})
+	if _, ok := err.(*datakey.DataKeyDuplicateError); ok {
+		return nil
+	}
+
+	return err
+}
+
+func (k *Keyring) rewrap(ctx context.Context, stored *datakey.DataKey, key []byte) error {
+	current := k.settings.MasterKeys[0]
+
+	wrapped, err := security.WrapKey(current, key)
+	if err != nil {
+		return err
+	}
+
+	return k.repo.Rewrap(ctx, stored.Generation, stored.MasterKeyID, current.ID, base64.StdEncoding.EncodeToString(wrapped))
+}
+
+func (k *Keyring) masterKey(id string) (security.MasterKey, bool) {
+	for _, m := range k.settings.MasterKeys {
+		if m.ID == id {
+			return m, true
+		}
+	}
+
+	return security.MasterKey{}, false
+}
+
+func additionalData(uid string, field string) []byte {
+	return []byte(fmt.Sprintf("%s/%s", uid, field))
+}
@@ -0,0 +1,414 @@
+package user
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// memoryUserRepository keeps users in memory with the semantics of the Mongo repository,
+// including its unique indexes, so that tests and local runs don't need a database.
+// Users are copied in and out, callers can't change the stored ones.
+type memoryUserRepository struct {
+	mu    sync.RWMutex
+	users map[string]*User
+}
+
+func NewMemoryUserRepository() UserRepository {
+	return &memoryUserRepository{
+		users: make(map[string]*User),
+	}
+}
+
+func (r *memoryUserRepository) DeleteAllPendingOlderThan(_ context.Context, t time.Time, except []string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := make(map[string]struct{}, len(except))
+	for _, uid := range except {
+		kept[uid] = struct{}{}
+	}
+
+	now := time.Now()
+	deleted := 0
+
+	for _, u := range r.users {
+		if _, ok := kept[u.UID]; ok {
+			continue
+		}
+
+		if u.DeletedAt == nil && u.Status == StatusPending && u.CreatedAt.Before(t) {
+			r.delete(u, DeletedBySystem, now)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func (r *memoryUserRepository) Create(_ context.Context, model *User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[model.UID]; ok {
+		return &UserDuplicateError{}
+	}
+
+	if r.emailTaken(model) {
+		return &UserDuplicateError{}
+	}
+
+	r.users[model.UID] = cloneUser(model)
+
+	return nil
+}
+
+// emailTaken follows the uniq_email and uniq_email_key indexes, emails are unique among
+// users which aren't deleted. The caller has to hold the lock.
+func (r *memoryUserRepository) emailTaken(model *User) bool {
+	for uid, u := range r.users {
+		if uid == model.UID || u.DeletedAt != nil {
+			continue
+		}
+
+		if u.Email == model.Email || u.EmailKey == model.EmailKey {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *memoryUserRepository) Confirm(_ context.Context, uid string, version int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, err := r.atVersion(uid, version)
+	if err != nil {
+		return false, err
+	}
+
+	if u.Status != StatusPending {
+		return false, nil
+	}
+
+	now := time.Now()
+	u.ConfirmedAt = &now
+	u.Status = StatusConfirmed
+	u.Version++
+
+	return true, nil
+}
+
+func (r *memoryUserRepository) FindByUID(_ context.Context, uid string) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u, ok := r.users[uid]
+	if !ok || u.DeletedAt != nil {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	return cloneUser(u), nil
+}
+
+func (r *memoryUserRepository) FindDeletedByUID(_ context.Context, uid string) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u, ok := r.users[uid]
+	if !ok || u.DeletedAt == nil {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	return cloneUser(u), nil
+}
+
+func (r *memoryUserRepository) Restore(_ context.Context, uid string, deletedAfter time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[uid]
+	if !ok || u.DeletedAt == nil || u.DeletedAt.Before(deletedAfter) {
+		return mongo.ErrNoDocuments
+	}
+
+	if r.emailTaken(u) {
+		return &UserDuplicateError{}
+	}
+
+	u.DeletedAt = nil
+	u.DeletedBy = ""
+	u.Version++
+
+	return nil
+}
+
+func (r *memoryUserRepository) FindUIDsDeletedBefore(_ context.Context, t time.Time, limit int) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var uids []string
+
+	for uid, u := range r.users {
+		if len(uids) == limit {
+			break
+		}
+
+		if u.DeletedAt != nil && u.DeletedAt.Before(t) {
+			uids = append(uids, uid)
+		}
+	}
+
+	return uids, nil
+}
+
+func (r *memoryUserRepository) PurgeDeleted(_ context.Context, uid string, t time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[uid]
+	if !ok || u.DeletedAt == nil || !u.DeletedAt.Before(t) {
+		return false, nil
+	}
+
+	delete(r.users, uid)
+
+	return true, nil
+}
+
+func (r *memoryUserRepository) FindByEmailKey(_ context.Context, emailKey string) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, u := range r.users {
+		if u.DeletedAt == nil && u.EmailKey == emailKey {
+			return cloneUser(u), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (r *memoryUserRepository) UpdatePasswordHash(
+	_ context.Context,
+	uid string,
+	version int,
+	passwordHash string,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, err := r.atVersion(uid, version)
+	if err != nil {
+		return err
+	}
+
+	u.PasswordHash = passwordHash
+	u.Version++
+
+	return nil
+}
+
+func (r *memoryUserRepository) RequirePasswordReset(
+	_ context.Context,
+	uid string,
+	version int,
+	revokeSessions bool,
+	t time.Time,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, err := r.atVersion(uid, version)
+	if err != nil {
+		return err
+	}
+
+	u.PasswordResetRequired = true
+
+	if revokeSessions {
+		u.SessionsRevokedAt = &t
+	}
+
+	u.Version++
+
+	return nil
+}
+
+func (r *memoryUserRepository) CompletePasswordReset(
+	_ context.Context,
+	uid string,
+	version int,
+	passwordHash string,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, err := r.atVersion(uid, version)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	u.PasswordHash = passwordHash
+	u.SessionsRevokedAt = &now
+	u.PasswordResetRequired = false
+	u.Version++
+
+	return nil
+}
+
+func (r *memoryUserRepository) UpdateProfile(
+	_ context.Context,
+	uid string,
+	version int,
+	update ProfileUpdate,
+	t time.Time,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, err := r.atVersion(uid, version)
+	if err != nil {
+		return err
+	}
+
+	if update.Name != nil {
+		u.Name = *update.Name
+	}
+
+	// an empty value clears the field, which is the zero value here as well
+	if update.Locale != nil {
+		u.Locale = *update.Locale
+	}
+
+	if update.Timezone != nil {
+		u.Timezone = *update.Timezone
+	}
+
+	if update.AvatarURL != nil {
+		u.AvatarURL = *update.AvatarURL
+	}
+
+	u.ProfileUpdatedAt = &t
+	u.Version++
+
+	return nil
+}
+
+func (r *memoryUserRepository) Delete(
+	_ context.Context,
+	uid string,
+	version int,
+	deletedBy string,
+	t time.Time,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, err := r.atVersion(uid, version)
+	if err != nil {
+		return err
+	}
+
+	r.delete(u, deletedBy, t)
+
+	return nil
+}
+
+func (r *memoryUserRepository) FindWithOtherKeyGeneration(
+	_ context.Context,
+	generation int,
+	afterUID string,
+	limit int,
+) ([]*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var users []*User
+
+	for _, u := range r.users {
+		if u.KeyGeneration != generation && u.UID > afterUID {
+			users = append(users, cloneUser(u))
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].UID < users[j].UID
+	})
+
+	if len(users) > limit {
+		users = users[:limit]
+	}
+
+	return users, nil
+}
+
+func (r *memoryUserRepository) UpdatePII(_ context.Context, uid string, version int, pii PII) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[uid]
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+
+	if u.Version != version {
+		return &ConcurrentModificationError{}
+	}
+
+	if u.EmailKey != pii.EmailKey && u.DeletedAt == nil {
+		changed := cloneUser(u)
+		changed.EmailKey = pii.EmailKey
+
+		if r.emailTaken(changed) {
+			return &UserDuplicateError{}
+		}
+	}
+
+	u.Name = pii.Name
+	u.Email = pii.Email
+	u.EmailKey = pii.EmailKey
+	u.KeyGeneration = pii.KeyGeneration
+
+	return nil
+}
+
+// delete has to be called with the write lock held
+func (r *memoryUserRepository) delete(u *User, deletedBy string, t time.Time) {
+	u.DeletedAt = &t
+	u.DeletedBy = deletedBy
+	u.SessionsRevokedAt = &t
+	u.Version++
+}
+
+// atVersion returns the stored user to update, the caller has to hold the write lock
+func (r *memoryUserRepository) atVersion(uid string, version int) (*User, error) {
+	u, ok := r.users[uid]
+	if !ok || u.DeletedAt != nil {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	if u.Version != version {
+		return nil, &ConcurrentModificationError{}
+	}
+
+	return u, nil
+}
+
+func cloneUser(u *User) *User {
+	c := *u
+
+	for _, t := range []**time.Time{&c.ConfirmedAt, &c.SessionsRevokedAt, &c.ProfileUpdatedAt, &c.DeletedAt} {
+		if *t != nil {
+			v := **t
+			*t = &v
+		}
+	}
+
+	return &c
+}
@@ -0,0 +1,40 @@
+package user
+
+import (
+	"context"
+)
+
+// DefaultRetryAttempts bounds RetryOnConflict, conflicts on a single user are rare enough
+// that running out of attempts points to a bug rather than contention
+const DefaultRetryAttempts = 3
+
+// RetryOnConflict reads the user and calls update with it until update doesn't fail with
+// ConcurrentModificationError, at most attempts times. update has to decide again from the
+// user it's given, since the previous read is stale. The last error is returned when every
+// attempt conflicted.
+func RetryOnConflict(
+	ctx context.Context,
+	repo UserRepository,
+	uid string,
+	attempts int,
+	update func(u *User) error,
+) error {
+	var err error
+
+	for i := 0; i < attempts; i++ {
+		var u *User
+
+		u, err = repo.FindByUID(ctx, uid)
+		if err != nil {
+			return err
+		}
+
+		err = update(u)
+
+		if _, ok := err.(*ConcurrentModificationError); !ok {
+			return err
+		}
+	}
+
+	return err
+}
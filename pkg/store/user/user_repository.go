@@ -6,16 +6,30 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type UserDuplicateError struct {
 	error
 }
 
+// ConcurrentModificationError means the user was updated since it was read, the update has
+// to be applied again on the latest version, see RetryOnConflict
+type ConcurrentModificationError struct {
+	error
+}
+
+func (e *ConcurrentModificationError) Error() string {
+	return "user was modified concurrently"
+}
+
 type UserStatus string
 
 const (
 	CollectionName = "users"
+
+	// DeletedBySystem is the DeletedBy of users deleted by workers rather than by an admin
+	DeletedBySystem = "system"
 )
 
 var (
@@ -23,32 +37,99 @@ var (
 	StatusConfirmed UserStatus = "confirmed"
 )
 
-type SignUpRequest struct {
-	Token      string     `bson:"token"`
-	Code       string     `bson:"code"`
-	NotifiedAt *time.Time `bson:"notifiedAt"`
+type User struct {
+	UID          string     `bson:"_id"`
+	Name         string     `bson:"name"`
+	Email        string     `bson:"email"`
+	EmailKey     string     `bson:"emailKey"` // identifies the user, see identity.EmailNormalizer
+	Status       UserStatus `bson:"status"`
+	PasswordHash string     `bson:"passwordHash"`
+	CreatedAt    time.Time  `bson:"createdAt"`
+	ConfirmedAt  *time.Time `bson:"confirmedAt"`
+	// Admin is granted directly in the database, there is no API to change it
+	Admin bool `bson:"admin,omitempty"`
+
+	// SessionsRevokedAt invalidates every token issued before it
+	SessionsRevokedAt *time.Time `bson:"sessionsRevokedAt,omitempty"`
+	// PasswordResetRequired blocks sign-in until the password is reset with a verification
+	// request of type password_reset
+	PasswordResetRequired bool `bson:"passwordResetRequired,omitempty"`
+
+	Locale    string `bson:"locale,omitempty"`
+	Timezone  string `bson:"timezone,omitempty"`
+	AvatarURL string `bson:"avatarUrl,omitempty"`
+	// ProfileUpdatedAt is the time of the last profile update
+	ProfileUpdatedAt *time.Time `bson:"profileUpdatedAt,omitempty"`
+
+	// Version is incremented by every update, updates are only applied to the version
+	// they were based on
+	Version int `bson:"version"`
+
+	// DeletedAt hides the user until it's restored or purged, its email can be used by a
+	// new user meanwhile
+	DeletedAt *time.Time `bson:"deletedAt,omitempty"`
+	// DeletedBy is the uid of the admin who deleted the user or DeletedBySystem
+	DeletedBy string `bson:"deletedBy,omitempty"`
+
+	// KeyGeneration is the data key the PII was last encrypted with as a whole, users stored
+	// in plaintext have none, see NewEncryptedUserRepository
+	KeyGeneration int `bson:"keyGeneration,omitempty"`
 }
 
-type User struct {
-	UID          string         `bson:"_id"`
-	Name         string         `bson:"name"`
-	Email        string         `bson:"email"`
-	Status       UserStatus     `bson:"status"`
-	PasswordHash string         `bson:"passwordHash"`
-	CreatedAt    time.Time      `bson:"createdAt"`
-	ConfirmedAt  *time.Time     `bson:"confirmedAt"`
-	SignUpReq    *SignUpRequest `bson:"signUpReq"`
+// PII holds the stored values of the personal fields of a user, they're encrypted with the
+// data key of KeyGeneration
+type PII struct {
+	Name          string
+	Email         string
+	EmailKey      string
+	KeyGeneration int
 }
 
+// ProfileUpdate holds the profile fields to change, nil fields are left as they are
+type ProfileUpdate struct {
+	Name      *string
+	Locale    *string
+	Timezone  *string
+	AvatarURL *string
+}
+
+// UserRepository hides deleted users from every method but FindDeletedByUID, Restore,
+// FindUIDsDeletedBefore and PurgeDeleted, deleting only marks users as deleted
 type UserRepository interface {
-	FindAllNotNotifiedSignUpRequests(ctx context.Context) ([]User, error)
-	DeleteAllPendingOlderThan(ctx context.Context, t time.Time) (int, error)
-	SaveNotifiedSignUpReqTime(ctx context.Context, uid string, t time.Time) error
-	FindBySignUpReqToken(ctx context.Context, token string) (*User, error)
+	// DeleteAllPendingOlderThan deletes the pending users created before t but the except ones
+	DeleteAllPendingOlderThan(ctx context.Context, t time.Time, except []string) (int, error)
 	Create(ctx context.Context, model *User) error
-	ConfirmAndDeleteSignUpReq(ctx context.Context, uid string) (bool, error)
 	FindByUID(ctx context.Context, uid string) (*User, error)
-	FindByEmail(ctx context.Context, email string) (*User, error)
+	FindByEmailKey(ctx context.Context, emailKey string) (*User, error)
+	FindDeletedByUID(ctx context.Context, uid string) (*User, error)
+	// Restore fails with mongo.ErrNoDocuments when the user isn't deleted or was deleted before
+	// deletedAfter, and with UserDuplicateError when its email is used by another user
+	Restore(ctx context.Context, uid string, deletedAfter time.Time) error
+	// FindUIDsDeletedBefore returns up to limit users deleted before t
+	FindUIDsDeletedBefore(ctx context.Context, t time.Time, limit int) ([]string, error)
+	// PurgeDeleted removes the user for good if it was deleted before t, false means it wasn't
+	PurgeDeleted(ctx context.Context, uid string, t time.Time) (bool, error)
+
+	// updates below fail with ConcurrentModificationError when the user isn't at version
+	// anymore and with mongo.ErrNoDocuments when it doesn't exist
+
+	// Confirm returns false when the user isn't pending anymore
+	Confirm(ctx context.Context, uid string, version int) (bool, error)
+	UpdatePasswordHash(ctx context.Context, uid string, version int, passwordHash string) error
+	RequirePasswordReset(ctx context.Context, uid string, version int, revokeSessions bool, t time.Time) error
+	CompletePasswordReset(ctx context.Context, uid string, version int, passwordHash string) error
+	UpdateProfile(ctx context.Context, uid string, version int, update ProfileUpdate, t time.Time) error
+	// Delete also revokes the sessions of the user, so that they stay revoked after a restore
+	Delete(ctx context.Context, uid string, version int, deletedBy string, t time.Time) error
+
+	// the methods below work on stored values, deleted users included, to encrypt users
+	// again, see Keyring.ReEncrypt
+
+	// FindWithOtherKeyGeneration returns up to limit users whose KeyGeneration isn't generation,
+	// ordered by UID and starting after afterUID so that users left as they are can be paged over
+	FindWithOtherKeyGeneration(ctx context.Context, generation int, afterUID string, limit int) ([]*User, error)
+	// UpdatePII doesn't increment the version, users don't change for callers
+	UpdatePII(ctx context.Context, uid string, version int, pii PII) error
 }
 
 type mongoUserRepository struct {
@@ -61,150 +142,386 @@ func NewUserRepository(db *mongo.Database) UserRepository {
 	}
 }
 
-func (r *mongoUserRepository) FindAllNotNotifiedSignUpRequests(ctx context.Context) ([]User, error) {
-	cursor, err := r.db.Collection(CollectionName).Find(ctx, bson.D{
-		{"signUpReq.notifiedAt", nil},
-		{"signUpReq", bson.M{"$ne": nil}},
+func (r *mongoUserRepository) DeleteAllPendingOlderThan(ctx context.Context, t time.Time, except []string) (int, error) {
+	now := time.Now()
+
+	filter := bson.D{
+		{"status", StatusPending},
+		{"createdAt", bson.M{"$lt": t}},
+		{"deletedAt", nil},
+	}
+
+	if len(except) > 0 {
+		filter = append(filter, bson.E{Key: "_id", Value: bson.M{"$nin": except}})
+	}
+
+	res, err := r.db.Collection(CollectionName).UpdateMany(ctx, filter, bson.M{
+		"$set": bson.M{
+			"deletedAt":         now,
+			"deletedBy":         DeletedBySystem,
+			"sessionsRevokedAt": now,
+		},
+		"$inc": bson.M{"version": 1},
 	})
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	defer cursor.Close(ctx)
+	return int(res.ModifiedCount), nil
+}
 
-	models := make([]User, 0)
+func (r *mongoUserRepository) Confirm(ctx context.Context, uid string, version int) (bool, error) {
+	return r.updateVersioned(ctx, uid, version, bson.M{
+		"status": StatusPending,
+	}, bson.M{
+		"$set": bson.M{
+			"confirmedAt": time.Now(),
+			"status":      StatusConfirmed,
+		},
+	})
+}
 
-	for cursor.Next(ctx) {
-		var model User
+func (r *mongoUserRepository) FindByUID(ctx context.Context, uid string) (*User, error) {
+	return r.findOne(ctx, bson.M{
+		"_id":       uid,
+		"deletedAt": nil,
+	})
+}
 
-		err := cursor.Decode(&model)
-		if err != nil {
-			return nil, err
-		}
+func (r *mongoUserRepository) FindDeletedByUID(ctx context.Context, uid string) (*User, error) {
+	return r.findOne(ctx, bson.M{
+		"_id":       uid,
+		"deletedAt": bson.M{"$ne": nil},
+	})
+}
 
-		models = append(models, model)
+func (r *mongoUserRepository) findOne(ctx context.Context, filter bson.M) (*User, error) {
+	singleResult := r.db.Collection(CollectionName).FindOne(ctx, filter)
+	if err := singleResult.Err(); err != nil {
+		return nil, err
 	}
-	if err := cursor.Err(); err != nil {
+
+	var u User
+
+	if err := singleResult.Decode(&u); err != nil {
 		return nil, err
 	}
 
-	return models, nil
+	return &u, nil
 }
 
-func (r *mongoUserRepository) DeleteAllPendingOlderThan(ctx context.Context, t time.Time) (int, error) {
-	res, err := r.db.Collection(CollectionName).DeleteMany(ctx, bson.D{
-		{"status", StatusPending},
-		{"createdAt", bson.M{"$lt": t}},
+func (r *mongoUserRepository) FindByEmailKey(ctx context.Context, emailKey string) (*User, error) {
+	u, err := r.findOne(ctx, bson.M{
+		"emailKey":  emailKey,
+		"deletedAt": nil,
 	})
-	if err != nil {
-		return 0, err
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
 	}
 
-	return int(res.DeletedCount), nil
+	return u, err
 }
 
-func (r *mongoUserRepository) SaveNotifiedSignUpReqTime(ctx context.Context, uid string, t time.Time) error {
-	_, err := r.db.Collection(CollectionName).UpdateOne(ctx, bson.M{
-		"_id": uid,
+func (r *mongoUserRepository) Restore(ctx context.Context, uid string, deletedAfter time.Time) error {
+	res, err := r.db.Collection(CollectionName).UpdateOne(ctx, bson.M{
+		"_id":       uid,
+		"deletedAt": bson.M{"$gte": deletedAfter},
 	}, bson.M{
-		"$set": bson.M{"signUpReq.notifiedAt": t},
+		"$unset": bson.M{
+			"deletedAt": "",
+			"deletedBy": "",
+		},
+		"$inc": bson.M{"version": 1},
 	})
 	if err != nil {
-		return err
+		return mapError(err)
+	}
+
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
 	}
 
 	return nil
 }
 
-func (r *mongoUserRepository) FindBySignUpReqToken(ctx context.Context, token string) (*User, error) {
-	singleResult := r.db.Collection(CollectionName).FindOne(ctx, bson.D{
-		{"signUpReq.token", token},
-	})
-	if err := singleResult.Err(); err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, nil
-		}
-
+func (r *mongoUserRepository) FindUIDsDeletedBefore(ctx context.Context, t time.Time, limit int) ([]string, error) {
+	cursor, err := r.db.Collection(CollectionName).Find(ctx, bson.M{
+		"deletedAt": bson.M{"$lt": t},
+	}, options.Find().SetProjection(bson.M{"_id": 1}).SetLimit(int64(limit)))
+	if err != nil {
 		return nil, err
 	}
 
-	var u User
+	var docs []struct {
+		UID string `bson:"_id"`
+	}
 
-	if err := singleResult.Decode(&u); err != nil {
+	if err := cursor.All(ctx, &docs); err != nil {
 		return nil, err
 	}
 
-	return &u, nil
+	uids := make([]string, 0, len(docs))
+
+	for _, doc := range docs {
+		uids = append(uids, doc.UID)
+	}
+
+	return uids, nil
 }
 
-func (r *mongoUserRepository) ConfirmAndDeleteSignUpReq(ctx context.Context, uid string) (bool, error) {
-	res, err := r.db.Collection(CollectionName).UpdateOne(ctx, bson.D{
-		{"_id", uid},
-		{"status", StatusPending},
-	}, bson.M{
-		"$set": bson.M{
-			"signUpReq":   nil,
-			"confirmedAt": time.Now(),
-			"status":      StatusConfirmed,
-		},
+func (r *mongoUserRepository) PurgeDeleted(ctx context.Context, uid string, t time.Time) (bool, error) {
+	res, err := r.db.Collection(CollectionName).DeleteOne(ctx, bson.M{
+		"_id":       uid,
+		"deletedAt": bson.M{"$lt": t},
 	})
 	if err != nil {
 		return false, err
 	}
 
-	return res.ModifiedCount > 0, nil
+	return res.DeletedCount > 0, nil
 }
 
-func (r *mongoUserRepository) FindByUID(ctx context.Context, uid string) (*User, error) {
-	singleResult := r.db.Collection(CollectionName).FindOne(ctx, bson.D{
-		{"_id", uid},
-	})
-	if err := singleResult.Err(); err != nil {
-		return nil, err
+func (r *mongoUserRepository) Create(ctx context.Context, model *User) error {
+	doc, err := bson.Marshal(model)
+	if err != nil {
+		return err
 	}
 
-	var u User
+	_, err = r.db.Collection(CollectionName).InsertOne(ctx, doc)
+	if err != nil {
+		return mapError(err)
+	}
 
-	if err := singleResult.Decode(&u); err != nil {
-		return nil, err
+	return nil
+}
+
+func (r *mongoUserRepository) UpdatePasswordHash(
+	ctx context.Context,
+	uid string,
+	version int,
+	passwordHash string,
+) error {
+	_, err := r.updateVersioned(ctx, uid, version, nil, bson.M{
+		"$set": bson.M{"passwordHash": passwordHash},
+	})
+
+	return err
+}
+
+// RequirePasswordReset blocks sign-in until the password is reset, revokeSessions also
+// invalidates every token issued so far
+func (r *mongoUserRepository) RequirePasswordReset(
+	ctx context.Context,
+	uid string,
+	version int,
+	revokeSessions bool,
+	t time.Time,
+) error {
+	set := bson.M{
+		"passwordResetRequired": true,
 	}
 
-	return &u, nil
+	if revokeSessions {
+		set["sessionsRevokedAt"] = t
+	}
+
+	_, err := r.updateVersioned(ctx, uid, version, nil, bson.M{
+		"$set": set,
+	})
+
+	return err
 }
 
-func (r *mongoUserRepository) FindByEmail(ctx context.Context, email string) (*User, error) {
-	singleResult := r.db.Collection(CollectionName).FindOne(ctx, bson.D{
-		{"email", email},
+// CompletePasswordReset sets the new password and revokes every session
+func (r *mongoUserRepository) CompletePasswordReset(
+	ctx context.Context,
+	uid string,
+	version int,
+	passwordHash string,
+) error {
+	_, err := r.updateVersioned(ctx, uid, version, nil, bson.M{
+		"$set": bson.M{
+			"passwordHash":      passwordHash,
+			"sessionsRevokedAt": time.Now(),
+		},
+		"$unset": bson.M{
+			"passwordResetRequired": "",
+		},
 	})
-	if err := singleResult.Err(); err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, nil
+
+	return err
+}
+
+func (r *mongoUserRepository) UpdateProfile(
+	ctx context.Context,
+	uid string,
+	version int,
+	update ProfileUpdate,
+	t time.Time,
+) error {
+	set := bson.M{
+		"profileUpdatedAt": t,
+	}
+	unset := bson.M{}
+
+	for field, value := range map[string]*string{
+		"locale":    update.Locale,
+		"timezone":  update.Timezone,
+		"avatarUrl": update.AvatarURL,
+	} {
+		if value == nil {
+			continue
 		}
 
+		// an empty value clears the field, it's stored the same way as never set
+		if *value == "" {
+			unset[field] = ""
+		} else {
+			set[field] = *value
+		}
+	}
+
+	if update.Name != nil {
+		set["name"] = *update.Name
+	}
+
+	doc := bson.M{
+		"$set": set,
+	}
+
+	if len(unset) > 0 {
+		doc["$unset"] = unset
+	}
+
+	_, err := r.updateVersioned(ctx, uid, version, nil, doc)
+
+	return err
+}
+
+func (r *mongoUserRepository) Delete(
+	ctx context.Context,
+	uid string,
+	version int,
+	deletedBy string,
+	t time.Time,
+) error {
+	_, err := r.updateVersioned(ctx, uid, version, nil, bson.M{
+		"$set": bson.M{
+			"deletedAt":         t,
+			"deletedBy":         deletedBy,
+			"sessionsRevokedAt": t,
+		},
+	})
+
+	return err
+}
+
+// FindWithOtherKeyGeneration is served by the key_generation_id index, users stored in
+// plaintext have no keyGeneration and are found as well
+func (r *mongoUserRepository) FindWithOtherKeyGeneration(
+	ctx context.Context,
+	generation int,
+	afterUID string,
+	limit int,
+) ([]*User, error) {
+	cursor, err := r.db.Collection(CollectionName).Find(ctx, bson.M{
+		"keyGeneration": bson.M{"$ne": generation},
+		"_id":           bson.M{"$gt": afterUID},
+	}, options.Find().SetSort(bson.M{"_id": 1}).SetLimit(int64(limit)))
+	if err != nil {
 		return nil, err
 	}
 
-	var u User
+	var users []*User
 
-	if err := singleResult.Decode(&u); err != nil {
+	if err := cursor.All(ctx, &users); err != nil {
 		return nil, err
 	}
 
-	return &u, nil
+	return users, nil
 }
 
-func (r *mongoUserRepository) Create(ctx context.Context, model *User) error {
-	doc, err := bson.Marshal(model)
+// UpdatePII replaces the stored PII if the user is still at version, deleted or not
+func (r *mongoUserRepository) UpdatePII(ctx context.Context, uid string, version int, pii PII) error {
+	filter := bson.M{
+		"_id":     uid,
+		"version": version,
+	}
+
+	if version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+
+	res, err := r.db.Collection(CollectionName).UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{
+			"name":          pii.Name,
+			"email":         pii.Email,
+			"emailKey":      pii.EmailKey,
+			"keyGeneration": pii.KeyGeneration,
+		},
+	})
 	if err != nil {
+		return mapError(err)
+	}
+
+	if res.MatchedCount > 0 {
+		return nil
+	}
+
+	// deleted users are updated as well, so they aren't ignored here as by updateVersioned
+	if _, err := r.findOne(ctx, bson.M{"_id": uid}); err != nil {
 		return err
 	}
 
-	_, err = r.db.Collection(CollectionName).InsertOne(ctx, doc)
+	return &ConcurrentModificationError{}
+}
+
+// updateVersioned applies update only if the user is still at version and matches condition,
+// and increments the version. False means the condition didn't match at version.
+func (r *mongoUserRepository) updateVersioned(
+	ctx context.Context,
+	uid string,
+	version int,
+	condition bson.M,
+	update bson.M,
+) (bool, error) {
+	filter := bson.M{
+		"_id":       uid,
+		"version":   version,
+		"deletedAt": nil,
+	}
+
+	// users created before versions have none until the migration user_versions ran
+	if version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+
+	for field, value := range condition {
+		filter[field] = value
+	}
+
+	update["$inc"] = bson.M{"version": 1}
+
+	res, err := r.db.Collection(CollectionName).UpdateOne(ctx, filter, update)
 	if err != nil {
-		return mapError(err)
+		return false, err
 	}
 
-	return nil
+	if res.MatchedCount > 0 {
+		return true, nil
+	}
+
+	// tells a stale version apart from a user who doesn't exist anymore or doesn't match
+	current, err := r.FindByUID(ctx, uid)
+	if err != nil {
+		return false, err
+	}
+
+	if current.Version != version {
+		return false, &ConcurrentModificationError{}
+	}
+
+	return false, nil
 }
 
 func mapError(err error) error {
@@ -0,0 +1,282 @@
+package verification
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	CollectionName = "verification_requests"
+)
+
+type RequestType string
+
+const (
+	TypeSignUp        RequestType = "sign_up"
+	TypePasswordReset RequestType = "password_reset"
+	TypeEmailChange   RequestType = "email_change"
+)
+
+// Request is what a user proves to own by a token and possibly a code, requests are
+// removed by the TTL index once expired
+type Request struct {
+	UID     string      `bson:"_id"`
+	Type    RequestType `bson:"type"`
+	UserUID string      `bson:"userUid"`
+	// Token is the SHA-256 of the token given to the client, see security.HashToken
+	Token string `bson:"token"`
+	Code  string `bson:"code,omitempty"`
+	// Attempts counts the codes tried since the code was issued
+	Attempts int `bson:"attempts"`
+	// Data holds what is specific to a flow, e.g. the invitation token of a sign-up
+	Data map[string]string `bson:"data,omitempty"`
+
+	// NotifiedAt is set once the code has been sent, see ForEachNotNotifiedBatch
+	NotifiedAt *time.Time `bson:"notifiedAt"`
+
+	// ResentAt is the time the current code was issued by a resend,
+	// ResendCount counts resends since ResendWindowStart
+	ResentAt          *time.Time `bson:"resentAt,omitempty"`
+	ResendWindowStart *time.Time `bson:"resendWindowStart,omitempty"`
+	ResendCount       int        `bson:"resendCount"`
+
+	CreatedAt time.Time `bson:"createdAt"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// CodeRenewal is a new code issued by a resend
+type CodeRenewal struct {
+	Code              string
+	ResentAt          time.Time
+	ResendWindowStart time.Time
+	ResendCount       int
+	ExpiresAt         time.Time
+}
+
+// RequestRepository is shared by every verification flow, requests are always looked up
+// together with their type so that a token of one flow can't be used in another
+type RequestRepository interface {
+	Create(ctx context.Context, model *Request) error
+	FindByToken(ctx context.Context, t RequestType, token string) (*Request, error)
+	IncrementAttempts(ctx context.Context, uid string, maxAttempts int) (*Request, error)
+	RenewCode(ctx context.Context, current *Request, renewal CodeRenewal) (bool, error)
+	SaveNotifiedAt(ctx context.Context, uid string, t time.Time) error
+	ForEachNotNotifiedBatch(ctx context.Context, t RequestType, batchSize int, fn func(requests []Request) error) error
+	Delete(ctx context.Context, uid string) (bool, error)
+	DeleteAllOfUser(ctx context.Context, t RequestType, userUID string) error
+	FindUserUIDsWithLive(ctx context.Context, t RequestType) ([]string, error)
+}
+
+type mongoRequestRepository struct {
+	db *mongo.Database
+}
+
+func NewRequestRepository(db *mongo.Database) RequestRepository {
+	return &mongoRequestRepository{
+		db: db,
+	}
+}
+
+func (r *mongoRequestRepository) Create(ctx context.Context, model *Request) error {
+	doc, err := bson.Marshal(model)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Collection(CollectionName).InsertOne(ctx, doc)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FindByToken returns expired requests as well, the TTL monitor only runs once a minute
+// and flows tell an expired request apart from an unknown one
+func (r *mongoRequestRepository) FindByToken(ctx context.Context, t RequestType, token string) (*Request, error) {
+	singleResult := r.db.Collection(CollectionName).FindOne(ctx, bson.M{
+		"type":  t,
+		"token": token,
+	})
+	if err := singleResult.Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var model Request
+
+	if err := singleResult.Decode(&model); err != nil {
+		return nil, err
+	}
+
+	return &model, nil
+}
+
+// IncrementAttempts counts an attempt before the code is compared, so that concurrent
+// attempts can't exceed maxAttempts. It returns the request with the attempt counted, or
+// nil when maxAttempts was already reached or the request is gone.
+func (r *mongoRequestRepository) IncrementAttempts(ctx context.Context, uid string, maxAttempts int) (*Request, error) {
+	singleResult := r.db.Collection(CollectionName).FindOneAndUpdate(ctx, bson.M{
+		"_id":      uid,
+		"attempts": bson.M{"$lt": maxAttempts},
+	}, bson.M{
+		"$inc": bson.M{"attempts": 1},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After))
+	if err := singleResult.Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var model Request
+
+	if err := singleResult.Decode(&model); err != nil {
+		return nil, err
+	}
+
+	return &model, nil
+}
+
+// RenewCode replaces the code of the current request, the worker picks it up again because
+// notifiedAt is reset. False means the request is gone or was renewed since it was read.
+func (r *mongoRequestRepository) RenewCode(ctx context.Context, current *Request, renewal CodeRenewal) (bool, error) {
+	res, err := r.db.Collection(CollectionName).UpdateOne(ctx, bson.M{
+		"_id":         current.UID,
+		"resentAt":    current.ResentAt,
+		"resendCount": current.ResendCount,
+	}, bson.M{
+		"$set": bson.M{
+			"code":              renewal.Code,
+			"notifiedAt":        nil,
+			"resentAt":          renewal.ResentAt,
+			"resendWindowStart": renewal.ResendWindowStart,
+			"resendCount":       renewal.ResendCount,
+			"expiresAt":         renewal.ExpiresAt,
+			"attempts":          0,
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return res.ModifiedCount > 0, nil
+}
+
+func (r *mongoRequestRepository) SaveNotifiedAt(ctx context.Context, uid string, t time.Time) error {
+	_, err := r.db.Collection(CollectionName).UpdateOne(ctx, bson.M{
+		"_id": uid,
+	}, bson.M{
+		"$set": bson.M{"notifiedAt": t},
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ForEachNotNotifiedBatch streams the requests of type t whose code hasn't been sent yet,
+// oldest first, and hands them to fn by batches of at most batchSize. Iteration stops at the
+// first error of fn.
+func (r *mongoRequestRepository) ForEachNotNotifiedBatch(
+	ctx context.Context,
+	t RequestType,
+	batchSize int,
+	fn func(requests []Request) error,
+) error {
+	cursor, err := r.db.Collection(CollectionName).Find(ctx, bson.M{
+		"type":       t,
+		"notifiedAt": nil,
+		"expiresAt":  bson.M{"$gt": time.Now()},
+	}, options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}}).
+		SetBatchSize(int32(batchSize)))
+	if err != nil {
+		return err
+	}
+
+	defer cursor.Close(ctx)
+
+	batch := make([]Request, 0, batchSize)
+
+	for cursor.Next(ctx) {
+		var model Request
+
+		if err := cursor.Decode(&model); err != nil {
+			return err
+		}
+
+		batch = append(batch, model)
+
+		if len(batch) == batchSize {
+			if err := fn(batch); err != nil {
+				return err
+			}
+
+			batch = make([]Request, 0, batchSize)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+
+	return nil
+}
+
+// Delete consumes a request, false means it was already used or has expired in the meantime
+func (r *mongoRequestRepository) Delete(ctx context.Context, uid string) (bool, error) {
+	res, err := r.db.Collection(CollectionName).DeleteOne(ctx, bson.M{
+		"_id": uid,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return res.DeletedCount > 0, nil
+}
+
+func (r *mongoRequestRepository) DeleteAllOfUser(ctx context.Context, t RequestType, userUID string) error {
+	_, err := r.db.Collection(CollectionName).DeleteMany(ctx, bson.M{
+		"type":    t,
+		"userUid": userUID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FindUserUIDsWithLive returns the users who have a request of type t which hasn't expired
+func (r *mongoRequestRepository) FindUserUIDsWithLive(ctx context.Context, t RequestType) ([]string, error) {
+	values, err := r.db.Collection(CollectionName).Distinct(ctx, "userUid", bson.M{
+		"type":      t,
+		"expiresAt": bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	uids := make([]string, 0, len(values))
+
+	for _, v := range values {
+		if uid, ok := v.(string); ok {
+			uids = append(uids, uid)
+		}
+	}
+
+	return uids, nil
+}
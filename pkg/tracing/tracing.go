@@ -4,8 +4,32 @@ import "context"
 
 const (
 	traceIDCtxKey = "traceID"
+	clientCtxKey  = "client"
 )
 
+// Client describes where a request came from
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
 func WithTraceID(ctx context.Context, traceID string) context.Context {
 	return context.WithValue(ctx, traceIDCtxKey, traceID)
 }
+
+func TraceIDFromContext(ctx context.Context) string {
+	traceID, _ := ctx.Value(traceIDCtxKey).(string)
+
+	return traceID
+}
+
+func WithClient(ctx context.Context, client Client) context.Context {
+	return context.WithValue(ctx, clientCtxKey, client)
+}
+
+// ClientFromContext returns an empty Client for contexts which didn't come from a request
+func ClientFromContext(ctx context.Context) Client {
+	client, _ := ctx.Value(clientCtxKey).(Client)
+
+	return client
+}
@@ -0,0 +1,34 @@
+package account
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	accountDomain "apart-deal-api/pkg/domain/account"
+)
+
+// PurgeWorker removes for good the users deleted longer than the retention ago, they can't be
+// restored afterwards
+type PurgeWorker struct {
+	logger    *zap.Logger
+	purgeSvc  *accountDomain.PurgeService
+	retention time.Duration
+}
+
+func NewPurgeWorker(purgeSvc *accountDomain.PurgeService, retention time.Duration, logger *zap.Logger) *PurgeWorker {
+	return &PurgeWorker{
+		logger:    logger,
+		purgeSvc:  purgeSvc,
+		retention: retention,
+	}
+}
+
+func (w *PurgeWorker) Process(ctx context.Context) error {
+	purged, err := w.purgeSvc.Purge(ctx, time.Now().Add(-w.retention))
+
+	w.logger.With(zap.Int("count", purged)).Info("Purged deleted users")
+
+	return err
+}
@@ -0,0 +1,105 @@
+package account
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+
+	userStore "apart-deal-api/pkg/store/user"
+)
+
+// ReEncryptWorker rotates the data key when it's due and encrypts again the users whose PII
+// isn't encrypted with the active key, users stored in plaintext included. Users are only
+// encrypted with a new key once it's older than settle, by then every replica has loaded
+// it and doesn't encrypt with the previous one anymore.
+type ReEncryptWorker struct {
+	logger    *zap.Logger
+	userRepo  userStore.UserRepository
+	keyring   *userStore.Keyring
+	batchSize int
+	settle    time.Duration
+}
+
+func NewReEncryptWorker(
+	userRepo userStore.UserRepository,
+	keyring *userStore.Keyring,
+	batchSize int,
+	settle time.Duration,
+	logger *zap.Logger,
+) *ReEncryptWorker {
+	return &ReEncryptWorker{
+		logger:    logger,
+		userRepo:  userRepo,
+		keyring:   keyring,
+		batchSize: batchSize,
+		settle:    settle,
+	}
+}
+
+func (w *ReEncryptWorker) Process(ctx context.Context) error {
+	rotated, err := w.keyring.Rotate(ctx)
+	if err != nil {
+		return err
+	}
+
+	generation, createdAt := w.keyring.Active()
+
+	if rotated {
+		w.logger.With(zap.Int("generation", generation)).Info("Rotated the data key")
+	}
+
+	if time.Since(createdAt) < w.settle {
+		return nil
+	}
+
+	total := 0
+	// users left as they are stay at another generation, batches start after them so that
+	// they're only found again by the next run
+	lastUID := ""
+
+	for {
+		users, err := w.userRepo.FindWithOtherKeyGeneration(ctx, generation, lastUID, w.batchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, u := range users {
+			lastUID = u.UID
+
+			pii, err := w.keyring.ReEncrypt(ctx, u)
+			if err != nil {
+				return err
+			}
+
+			if err := w.userRepo.UpdatePII(ctx, u.UID, u.Version, pii); err != nil {
+				// the user changed or was purged meanwhile, it's left to the next run
+				if _, ok := err.(*userStore.ConcurrentModificationError); ok || err == mongo.ErrNoDocuments {
+					continue
+				}
+
+				// a user in plaintext shares its email with a user signed up meanwhile
+				if _, ok := err.(*userStore.UserDuplicateError); ok {
+					w.logger.With(zap.String("uid", u.UID)).Warn("Could not encrypt user, its email is used by another user")
+
+					continue
+				}
+
+				return err
+			}
+
+			total++
+		}
+
+		if len(users) < w.batchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		w.logger.With(zap.Int("count", total), zap.Int("generation", generation)).Info("Encrypted users again")
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package invitation
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"apart-deal-api/pkg/mail"
+
+	"go.uber.org/zap"
+
+	orgStore "apart-deal-api/pkg/store/organization"
+)
+
+type NotificationHandler struct {
+	mailer         mail.Mailer
+	orgRepo        orgStore.OrganizationRepository
+	invitationRepo orgStore.InvitationRepository
+	logger         *zap.Logger
+}
+
+func NewNotificationHandler(
+	mailer mail.Mailer,
+	orgRepo orgStore.OrganizationRepository,
+	invitationRepo orgStore.InvitationRepository,
+	logger *zap.Logger,
+) *NotificationHandler {
+	return &NotificationHandler{
+		mailer:         mailer,
+		orgRepo:        orgRepo,
+		invitationRepo: invitationRepo,
+		logger:         logger,
+	}
+}
+
+func (h *NotificationHandler) Handle(ctx context.Context, invitation *orgStore.Invitation) error {
+	h.logger.
+		With(zap.String("email", invitation.Email)).
+		Info(fmt.Sprintf("Invitation NotificationHandler is starting"))
+
+	org, err := h.orgRepo.FindByUID(ctx, invitation.OrganizationUID)
+	if err != nil {
+		return err
+	}
+
+	if org != nil {
+		if err := h.sendNotification(ctx, org, invitation); err != nil {
+			return err
+		}
+	}
+
+	if err := h.invitationRepo.SaveNotifiedTime(ctx, invitation.UID, time.Now()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (h *NotificationHandler) sendNotification(
+	ctx context.Context,
+	org *orgStore.Organization,
+	invitation *orgStore.Invitation,
+) error {
+	// invitations created before tokens were hashed have no mail token
+	token := invitation.MailToken
+	if token == "" {
+		token = invitation.Token
+	}
+
+	body := fmt.Sprintf(
+		`Hello!
+You have been invited to join %s as %s.
+Here's your invitation token: %s
+Use it while signing up or accept it after signing in.`,
+		org.Name,
+		invitation.Role,
+		token,
+	)
+
+	if err := h.mailer.Send(ctx, mail.Letter{
+		To:      []string{invitation.Email},
+		Subject: fmt.Sprintf("Invitation to %s", org.Name),
+		Body:    body,
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package invitation
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	orgStore "apart-deal-api/pkg/store/organization"
+)
+
+type NotificationWorker struct {
+	logger         *zap.Logger
+	handler        *NotificationHandler
+	invitationRepo orgStore.InvitationRepository
+}
+
+func NewNotificationWorker(
+	invitationRepo orgStore.InvitationRepository,
+	handler *NotificationHandler,
+	logger *zap.Logger,
+) *NotificationWorker {
+	return &NotificationWorker{
+		invitationRepo: invitationRepo,
+		handler:        handler,
+		logger:         logger,
+	}
+}
+
+func (w *NotificationWorker) Process(ctx context.Context) error {
+	invitations, err := w.invitationRepo.FindAllNotNotified(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, invitation := range invitations {
+		w.logger.With(zap.String("email", invitation.Email)).Info("Sending invitation notifications")
+		if err := w.processItem(ctx, &invitation); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *NotificationWorker) processItem(ctx context.Context, invitation *orgStore.Invitation) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	if err := w.handler.Handle(childCtx, invitation); err != nil {
+		return err
+	}
+
+	return nil
+}
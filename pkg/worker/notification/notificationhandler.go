@@ -0,0 +1,104 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"apart-deal-api/pkg/config"
+	"apart-deal-api/pkg/mail"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	notificationStore "apart-deal-api/pkg/store/notification"
+)
+
+type NotificationHandler struct {
+	mailer           mail.Mailer
+	notificationRepo notificationStore.NotificationRepository
+	cfg              *config.Config
+	logger           *zap.Logger
+}
+
+func NewNotificationHandler(
+	mailer mail.Mailer,
+	notificationRepo notificationStore.NotificationRepository,
+	cfg *config.Config,
+	logger *zap.Logger,
+) *NotificationHandler {
+	return &NotificationHandler{
+		mailer:           mailer,
+		notificationRepo: notificationRepo,
+		cfg:              cfg,
+		logger:           logger,
+	}
+}
+
+func (h *NotificationHandler) Handle(ctx context.Context, notification *notificationStore.Notification) error {
+	h.logger.
+		With(zap.String("email", notification.Email)).
+		With(zap.String("type", string(notification.Type))).
+		Info(fmt.Sprintf("Notification handler is starting"))
+
+	letter, err := buildLetter(notification, h.cfg.AppURL)
+	if err != nil {
+		return err
+	}
+
+	if err := h.mailer.Send(ctx, letter); err != nil {
+		return err
+	}
+
+	if err := h.notificationRepo.SaveSentTime(ctx, notification.UID, time.Now()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func buildLetter(notification *notificationStore.Notification, appURL string) (mail.Letter, error) {
+	switch notification.Type {
+	case notificationStore.TypeSignUpAttempt:
+		return mail.Letter{
+			To:      []string{notification.Email},
+			Subject: "Someone tried to register with your email",
+			Body: `Hello!
+Someone has just tried to create an account with your email, but you already have one.
+If it was you, just sign in or reset your password. Otherwise you can safely ignore this letter.`,
+		}, nil
+	case notificationStore.TypeNewDevice:
+		return mail.Letter{
+			To:      []string{notification.Email},
+			Subject: "New sign-in to your account",
+			Body: fmt.Sprintf(`Hello!
+Your account has just been accessed from a new device.
+Device: %s
+IP address: %s
+Time: %s
+If it was you, there's nothing to do. Otherwise sign out everywhere and reset your password here:
+%s/not-me?token=%s`,
+				notification.Data["device"],
+				notification.Data["ip"],
+				notification.Data["signedInAt"],
+				appURL,
+				url.QueryEscape(notification.Data["token"]),
+			),
+		}, nil
+	case notificationStore.TypePasswordReset:
+		return mail.Letter{
+			To:      []string{notification.Email},
+			Subject: "Reset your password",
+			Body: fmt.Sprintf(`Hello!
+A new password has to be set for your account before you can sign in again.
+Follow this link within an hour to choose it:
+%s/password-reset?token=%s`,
+				appURL,
+				url.QueryEscape(notification.Data["token"]),
+			),
+		}, nil
+	default:
+		return mail.Letter{}, errors.Errorf("Unknown notification type: %s", notification.Type)
+	}
+}
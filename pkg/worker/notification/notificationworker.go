@@ -0,0 +1,55 @@
+package notification
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	notificationStore "apart-deal-api/pkg/store/notification"
+)
+
+type NotificationWorker struct {
+	logger           *zap.Logger
+	handler          *NotificationHandler
+	notificationRepo notificationStore.NotificationRepository
+}
+
+func NewNotificationWorker(
+	notificationRepo notificationStore.NotificationRepository,
+	handler *NotificationHandler,
+	logger *zap.Logger,
+) *NotificationWorker {
+	return &NotificationWorker{
+		notificationRepo: notificationRepo,
+		handler:          handler,
+		logger:           logger,
+	}
+}
+
+func (w *NotificationWorker) Process(ctx context.Context) error {
+	notifications, err := w.notificationRepo.FindAllNotSent(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, notification := range notifications {
+		w.logger.With(zap.String("email", notification.Email)).Info("Sending notifications")
+		if err := w.processItem(ctx, &notification); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *NotificationWorker) processItem(ctx context.Context, notification *notificationStore.Notification) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	if err := w.handler.Handle(childCtx, notification); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -10,48 +10,49 @@ import (
 	"go.uber.org/zap"
 
 	userStore "apart-deal-api/pkg/store/user"
+	verificationStore "apart-deal-api/pkg/store/verification"
 )
 
 type NotificationHandler struct {
-	mailer   mail.Mailer
-	userRepo userStore.UserRepository
-	logger   *zap.Logger
+	mailer      mail.Mailer
+	requestRepo verificationStore.RequestRepository
+	logger      *zap.Logger
 }
 
 func NewNotificationHandler(
 	mailer mail.Mailer,
-	userRepo userStore.UserRepository,
+	requestRepo verificationStore.RequestRepository,
 	logger *zap.Logger,
 ) *NotificationHandler {
 	return &NotificationHandler{
-		mailer:   mailer,
-		logger:   logger,
-		userRepo: userRepo,
+		mailer:      mailer,
+		logger:      logger,
+		requestRepo: requestRepo,
 	}
 }
 
-func (h *NotificationHandler) Handle(ctx context.Context, user *userStore.User) error {
+func (h *NotificationHandler) Handle(ctx context.Context, req *verificationStore.Request, user *userStore.User) error {
 	h.logger.
 		With(zap.String("email", user.Email)).
 		Info(fmt.Sprintf("NotificationHandler is starting"))
 
-	if err := h.sendNotification(ctx, user); err != nil {
+	if err := h.sendNotification(ctx, req, user); err != nil {
 		return err
 	}
 
-	if err := h.userRepo.SaveNotifiedSignUpReqTime(ctx, user.UID, time.Now()); err != nil {
+	if err := h.requestRepo.SaveNotifiedAt(ctx, req.UID, time.Now()); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (h *NotificationHandler) sendNotification(ctx context.Context, user *userStore.User) error {
+func (h *NotificationHandler) sendNotification(ctx context.Context, req *verificationStore.Request, user *userStore.User) error {
 	body := fmt.Sprintf(
 		`Hello dear %s!
 Here's your confirmation code: %s`,
 		user.Name,
-		user.SignUpReq.Code,
+		req.Code,
 	)
 
 	if err := h.mailer.Send(ctx, mail.Letter{
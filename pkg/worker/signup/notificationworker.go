@@ -4,50 +4,73 @@ import (
 	"context"
 	"time"
 
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.uber.org/zap"
 
 	userStore "apart-deal-api/pkg/store/user"
+	verificationStore "apart-deal-api/pkg/store/verification"
+)
+
+const (
+	// NotificationBatchSize bounds how many pending requests are held in memory at once
+	NotificationBatchSize = 100
 )
 
 type NotificationWorker struct {
-	logger   *zap.Logger
-	handler  *NotificationHandler
-	userRepo userStore.UserRepository
+	logger      *zap.Logger
+	handler     *NotificationHandler
+	userRepo    userStore.UserRepository
+	requestRepo verificationStore.RequestRepository
 }
 
 func NewNotificationWorker(
 	userRepo userStore.UserRepository,
+	requestRepo verificationStore.RequestRepository,
 	handler *NotificationHandler,
 	logger *zap.Logger,
 ) *NotificationWorker {
 	return &NotificationWorker{
-		userRepo: userRepo,
-		handler:  handler,
-		logger:   logger,
+		userRepo:    userRepo,
+		requestRepo: requestRepo,
+		handler:     handler,
+		logger:      logger,
 	}
 }
 
 func (w *NotificationWorker) Process(ctx context.Context) error {
-	users, err := w.userRepo.FindAllNotNotifiedSignUpRequests(ctx)
-	if err != nil {
-		return err
-	}
-
-	for _, user := range users {
-		w.logger.With(zap.String("email", user.Email)).Info("Sending sign-up notifications")
-		if err := w.processItem(ctx, &user); err != nil {
-			return err
-		}
-	}
+	return w.requestRepo.ForEachNotNotifiedBatch(
+		ctx,
+		verificationStore.TypeSignUp,
+		NotificationBatchSize,
+		func(requests []verificationStore.Request) error {
+			for i := range requests {
+				if err := w.processItem(ctx, &requests[i]); err != nil {
+					return err
+				}
+			}
 
-	return nil
+			return nil
+		},
+	)
 }
 
-func (w *NotificationWorker) processItem(ctx context.Context, user *userStore.User) error {
+func (w *NotificationWorker) processItem(ctx context.Context, req *verificationStore.Request) error {
 	childCtx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 
-	if err := w.handler.Handle(childCtx, user); err != nil {
+	user, err := w.userRepo.FindByUID(childCtx, req.UserUID)
+	if err != nil {
+		// the pending user has been deleted, the request expires on its own
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+
+		return err
+	}
+
+	w.logger.With(zap.String("email", user.Email)).Info("Sending sign-up notifications")
+
+	if err := w.handler.Handle(childCtx, req, user); err != nil {
 		return err
 	}
 
@@ -6,27 +6,40 @@ import (
 
 	"go.uber.org/zap"
 
+	authDomain "apart-deal-api/pkg/domain/auth"
 	userStore "apart-deal-api/pkg/store/user"
+	verificationStore "apart-deal-api/pkg/store/verification"
 )
 
-const (
-	SignUpReqExpiration = time.Minute * 15
-)
-
+// ObsoleteReqWorker deletes the pending users whose sign-up has expired, they're purged along
+// with other deleted users. Their requests are removed by the TTL index of verification_requests.
+// Users whose request was extended by a resend are kept until it expires.
 type ObsoleteReqWorker struct {
-	logger   *zap.Logger
-	userRepo userStore.UserRepository
+	logger      *zap.Logger
+	userRepo    userStore.UserRepository
+	requestRepo verificationStore.RequestRepository
 }
 
-func NewObsoleteReqWorker(userRepo userStore.UserRepository, logger *zap.Logger) *ObsoleteReqWorker {
+func NewObsoleteReqWorker(
+	userRepo userStore.UserRepository,
+	requestRepo verificationStore.RequestRepository,
+	logger *zap.Logger,
+) *ObsoleteReqWorker {
 	return &ObsoleteReqWorker{
-		logger:   logger,
-		userRepo: userRepo,
+		logger:      logger,
+		userRepo:    userRepo,
+		requestRepo: requestRepo,
 	}
 }
 
 func (w *ObsoleteReqWorker) Process(ctx context.Context) error {
-	deleted, err := w.userRepo.DeleteAllPendingOlderThan(ctx, time.Now().Truncate(SignUpReqExpiration))
+	// requests live SignUpMaxLifetime at most, so these are only the recent sign-ups
+	live, err := w.requestRepo.FindUserUIDsWithLive(ctx, verificationStore.TypeSignUp)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := w.userRepo.DeleteAllPendingOlderThan(ctx, time.Now().Add(-authDomain.SignUpExpiration), live)
 	if err != nil {
 		return err
 	}
@@ -5,9 +5,26 @@ import (
 	"testing"
 
 	"apart-deal-api/dependencies"
+	"apart-deal-api/tests/suits/account"
+	"apart-deal-api/tests/suits/audit"
+	"apart-deal-api/tests/suits/challenge"
+	"apart-deal-api/tests/suits/device"
+	"apart-deal-api/tests/suits/enumeration_safe"
+	"apart-deal-api/tests/suits/indexes"
+	"apart-deal-api/tests/suits/migration"
+	"apart-deal-api/tests/suits/organization"
+	"apart-deal-api/tests/suits/passwordhash"
+	"apart-deal-api/tests/suits/passwordpolicy"
+	"apart-deal-api/tests/suits/profile"
+	"apart-deal-api/tests/suits/session"
 	"apart-deal-api/tests/suits/signin"
 	"apart-deal-api/tests/suits/signup"
 	"apart-deal-api/tests/suits/signup_confirm"
+	"apart-deal-api/tests/suits/signup_notification"
+	"apart-deal-api/tests/suits/stepup"
+	"apart-deal-api/tests/suits/userimport"
+	"apart-deal-api/tests/suits/userrepository"
+	"apart-deal-api/tests/suits/validators"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -32,6 +49,24 @@ func TestEverything(t *testing.T) {
 	signup.RegisterSuite(db)
 	signup_confirm.RegisterSuite(db)
 	signin.RegisterSuite(t, db)
+	organization.RegisterSuite(db)
+	userimport.RegisterSuite(db)
+	enumeration_safe.RegisterSuite(db)
+	audit.RegisterSuite(db)
+	device.RegisterSuite(db)
+	challenge.RegisterSuite(db)
+	stepup.RegisterSuite(db)
+	session.RegisterSuite(db)
+	profile.RegisterSuite(db)
+	signup_notification.RegisterSuite(db)
+	migration.RegisterSuite(db)
+	indexes.RegisterSuite(db)
+	validators.RegisterSuite(db)
+	userrepository.RegisterSuite(db)
+	userrepository.RegisterMemorySuite()
+	account.RegisterSuite(db)
+	passwordpolicy.RegisterSuite()
+	passwordhash.RegisterSuite()
 
 	RunSpecs(t, "Everything")
 }
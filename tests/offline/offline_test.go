@@ -0,0 +1,29 @@
+package offline
+
+import (
+	"fmt"
+	"testing"
+
+	"apart-deal-api/tests/suits/passwordhash"
+	"apart-deal-api/tests/suits/passwordpolicy"
+	"apart-deal-api/tests/suits/userrepository"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// TestOffline runs the suites which need no database, they're also part of TestEverything
+func TestOffline(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RegisterTestingT(t)
+
+	BeforeEach(func() {
+		fmt.Println(CurrentSpecReport().LeafNodeText)
+	})
+
+	userrepository.RegisterMemorySuite()
+	passwordpolicy.RegisterSuite()
+	passwordhash.RegisterSuite()
+
+	RunSpecs(t, "Offline")
+}
@@ -0,0 +1,426 @@
+package account
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"apart-deal-api/dependencies"
+	"apart-deal-api/pkg/api/auth"
+	"apart-deal-api/pkg/config"
+	"apart-deal-api/pkg/mongo/schema"
+	"apart-deal-api/pkg/store/audit"
+	"apart-deal-api/pkg/store/device"
+	"apart-deal-api/pkg/store/organization"
+	"apart-deal-api/pkg/store/session"
+	"apart-deal-api/pkg/store/user"
+	"apart-deal-api/pkg/store/verification"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	accountHandlers "apart-deal-api/pkg/api/handlers/account"
+	apiServer "apart-deal-api/pkg/api/server"
+	accountDomain "apart-deal-api/pkg/domain/account"
+	auditDomain "apart-deal-api/pkg/domain/audit"
+	identityDomain "apart-deal-api/pkg/domain/identity"
+	pkgTools "apart-deal-api/pkg/tools"
+	testTools "apart-deal-api/tests/tools"
+)
+
+type specContainer struct {
+	fx.In
+
+	Echo             *echo.Echo
+	AuthSvc          *auth.AuthenticationService
+	PurgeSvc         *accountDomain.PurgeService
+	UserRepo         user.UserRepository
+	MembershipRepo   organization.MembershipRepository
+	OrganizationRepo organization.OrganizationRepository
+	InvitationRepo   organization.InvitationRepository
+	SessionRepo      session.SessionRepository
+	DeviceRepo       device.KnownDeviceRepository
+	RequestRepo      verification.RequestRepository
+}
+
+var constModule = fx.Options(
+	fx.NopLogger,
+	fx.Supply(&config.Config{
+		IsDebug: true,
+	}),
+	fx.Supply(&dependencies.ApiConfig{
+		Port:        38000 + GinkgoParallelProcess(),
+		TokenSecret: "foobar",
+	}),
+	fx.Supply(testTools.NewFastPasswordHasher()),
+	fx.Supply(auditDomain.DefaultSettings),
+	fx.Provide(apiServer.NewServer),
+	fx.Provide(apiServer.NewAccountRouteGroup),
+	fx.Provide(user.NewUserRepository),
+	fx.Provide(audit.NewEventRepository),
+	fx.Provide(auditDomain.NewAuditService),
+	fx.Supply(identityDomain.NewEmailNormalizer(identityDomain.DefaultEmailSettings)),
+	fx.Provide(dependencies.NewAuthenticationService),
+	fx.Supply(auth.DefaultSessionSettings),
+	fx.Provide(session.NewSessionRepository),
+	fx.Provide(auth.NewSessionService),
+	fx.Provide(organization.NewMembershipRepository),
+	fx.Provide(organization.NewOrganizationRepository),
+	fx.Provide(organization.NewInvitationRepository),
+	fx.Provide(device.NewKnownDeviceRepository),
+	fx.Provide(verification.NewRequestRepository),
+	fx.Supply(accountDomain.DefaultSettings),
+	fx.Provide(accountDomain.NewAccountService),
+	fx.Provide(accountDomain.NewPurgeService),
+	fx.Provide(accountHandlers.NewDeleteAccountHandler),
+	fx.Provide(accountHandlers.NewRestoreAccountHandler),
+	fx.Supply(auth.DefaultStepUpRequirement),
+	fx.Invoke(accountHandlers.RegisterDeleteAccountRoute),
+	fx.Invoke(accountHandlers.RegisterRestoreAccountRoute),
+)
+
+func RegisterSuite(db *mongo.Database) {
+	Describe("Account", func() {
+		loggerLvl := zap.NewAtomicLevelAt(zap.ErrorLevel)
+		logger := dependencies.NewLogger(&loggerLvl)
+
+		var (
+			ctx    context.Context
+			cancel context.CancelFunc
+			app    *fx.App
+			spec   *specContainer
+		)
+
+		createUser := func(email string, admin bool) string {
+			userUID := pkgTools.NewUUID().String()
+
+			_, err := db.Collection(user.CollectionName).InsertOne(ctx, user.User{
+				UID:      userUID,
+				Name:     "Foo",
+				Email:    email,
+				EmailKey: email,
+				Status:   user.StatusConfirmed,
+				Admin:    admin,
+			})
+			Expect(err).To(Succeed())
+
+			return userUID
+		}
+
+		tokenOf := func(userUID string, admin bool) string {
+			token, err := spec.AuthSvc.Sign(auth.TokenPayload{UserID: userUID, Admin: admin})
+			Expect(err).To(Succeed())
+
+			return token
+		}
+
+		request := func(method string, path string, token string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, "/api/v1/admin/users"+path, nil)
+			req.Header.Add("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			return rec
+		}
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+
+			for _, collection := range []string{
+				user.CollectionName,
+				"audit_events",
+				organization.CollectionName,
+				organization.MembershipsCollectionName,
+				organization.InvitationsCollectionName,
+				session.CollectionName,
+				device.CollectionName,
+				"verification_requests",
+			} {
+				_, err := db.Collection(collection).DeleteMany(ctx, bson.M{})
+				Expect(err).To(Succeed())
+			}
+
+			// emails are unique among live users only with the declared indexes
+			var declared []schema.CollectionIndexes
+			for _, c := range schema.Indexes() {
+				if c.Collection == user.CollectionName {
+					declared = append(declared, c)
+				}
+			}
+
+			reconciler := schema.NewIndexReconciler(db, declared, schema.IndexReconcilerSettings{DropUnknown: true})
+			changes, err := reconciler.Plan(ctx)
+			Expect(err).To(Succeed())
+			Expect(reconciler.Apply(ctx, changes)).To(Succeed())
+
+			app = fx.New(
+				fx.Supply(logger),
+				fx.Supply(db),
+				constModule,
+				fx.Invoke(func(s specContainer) {
+					spec = &s
+				}),
+			)
+
+			appStartCtx, appStartCancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer appStartCancel()
+
+			err = app.Start(appStartCtx)
+			Expect(err).To(Succeed())
+		})
+
+		AfterEach(func() {
+			appStopCtx, appStopCancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer appStopCancel()
+
+			err := app.Stop(appStopCtx)
+			Expect(err).To(Succeed())
+
+			cancel()
+		})
+
+		It("Deleted accounts can't sign in until they're restored", func() {
+			adminUID := createUser("admin@bar.baz", true)
+			userUID := createUser("foo@bar.baz", false)
+
+			rec := request(http.MethodDelete, "/"+userUID, tokenOf(adminUID, true))
+			Expect(rec.Code).To(Equal(http.StatusNoContent))
+
+			_, err := spec.UserRepo.FindByUID(ctx, userUID)
+			Expect(err).To(Equal(mongo.ErrNoDocuments))
+
+			deleted, err := spec.UserRepo.FindDeletedByUID(ctx, userUID)
+			Expect(err).To(Succeed())
+			Expect(deleted.DeletedBy).To(Equal(adminUID))
+
+			Expect(spec.AuthSvc.CheckSession(ctx, &auth.TokenPayload{UserID: userUID, IssuedAt: time.Now()})).
+				To(BeAssignableToTypeOf(&auth.TokenInvalidError{}))
+
+			rec = request(http.MethodPost, "/"+userUID+"/restore", tokenOf(adminUID, true))
+			Expect(rec.Code).To(Equal(http.StatusNoContent))
+
+			restored, err := spec.UserRepo.FindByUID(ctx, userUID)
+			Expect(err).To(Succeed())
+			Expect(restored.DeletedAt).To(BeNil())
+
+			// tokens issued before the deletion stay revoked
+			Expect(spec.AuthSvc.CheckSession(ctx, &auth.TokenPayload{UserID: userUID, IssuedAt: time.Now().Add(-time.Minute)})).
+				To(BeAssignableToTypeOf(&auth.SessionRevokedError{}))
+
+			var events []audit.Event
+			cursor, err := db.Collection("audit_events").Find(ctx, bson.M{"userUid": userUID})
+			Expect(err).To(Succeed())
+			Expect(cursor.All(ctx, &events)).To(Succeed())
+			Expect(events).To(HaveLen(2))
+		})
+
+		It("Unknown accounts aren't found", func() {
+			adminUID := createUser("admin@bar.baz", true)
+
+			rec := request(http.MethodDelete, "/"+pkgTools.NewUUID().String(), tokenOf(adminUID, true))
+			Expect(rec.Code).To(Equal(http.StatusNotFound))
+
+			rec = request(http.MethodPost, "/"+adminUID+"/restore", tokenOf(adminUID, true))
+			Expect(rec.Code).To(Equal(http.StatusNotFound))
+		})
+
+		It("Admins can't delete their own account", func() {
+			adminUID := createUser("admin@bar.baz", true)
+
+			rec := request(http.MethodDelete, "/"+adminUID, tokenOf(adminUID, true))
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("Accounts whose email was taken can't be restored", func() {
+			adminUID := createUser("admin@bar.baz", true)
+			userUID := createUser("foo@bar.baz", false)
+
+			rec := request(http.MethodDelete, "/"+userUID, tokenOf(adminUID, true))
+			Expect(rec.Code).To(Equal(http.StatusNoContent))
+
+			createUser("foo@bar.baz", false)
+
+			rec = request(http.MethodPost, "/"+userUID+"/restore", tokenOf(adminUID, true))
+			Expect(rec.Code).To(Equal(http.StatusConflict))
+		})
+
+		It("Deleting and restoring accounts needs a recent authentication", func() {
+			adminUID := createUser("admin@bar.baz", true)
+			userUID := createUser("foo@bar.baz", false)
+
+			stale, err := spec.AuthSvc.Sign(auth.TokenPayload{
+				UserID:   adminUID,
+				Admin:    true,
+				AuthTime: time.Now().Add(-time.Minute * 10),
+			})
+			Expect(err).To(Succeed())
+
+			rec := request(http.MethodDelete, "/"+userUID, stale)
+			Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+			Expect(rec.Body.String()).To(ContainSubstring(`"reason":"step_up_required"`))
+
+			_, err = spec.UserRepo.FindByUID(ctx, userUID)
+			Expect(err).To(Succeed())
+
+			rec = request(http.MethodDelete, "/"+userUID, tokenOf(adminUID, true))
+			Expect(rec.Code).To(Equal(http.StatusNoContent))
+
+			rec = request(http.MethodPost, "/"+userUID+"/restore", stale)
+			Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+			Expect(rec.Body.String()).To(ContainSubstring(`"reason":"step_up_required"`))
+		})
+
+		It("Accounts past the retention can't be restored", func() {
+			adminUID := createUser("admin@bar.baz", true)
+			userUID := createUser("foo@bar.baz", false)
+
+			deletedAt := time.Now().Add(-accountDomain.DefaultSettings.DeletedRetention - time.Minute)
+			Expect(spec.UserRepo.Delete(ctx, userUID, 0, adminUID, deletedAt)).To(Succeed())
+
+			rec := request(http.MethodPost, "/"+userUID+"/restore", tokenOf(adminUID, true))
+			Expect(rec.Code).To(Equal(http.StatusNotFound))
+
+			_, err := spec.UserRepo.FindDeletedByUID(ctx, userUID)
+			Expect(err).To(Succeed())
+		})
+
+		It("Purged accounts take their memberships, sessions, devices and requests along", func() {
+			adminUID := createUser("admin@bar.baz", true)
+			purgedUID := createUser("purged@bar.baz", false)
+			recentUID := createUser("recent@bar.baz", false)
+			adminMemberUID := createUser("org-admin@bar.baz", false)
+			memberUID := createUser("member@bar.baz", false)
+
+			createdAt := time.Now().Add(-time.Hour)
+
+			join := func(organizationUID string, userUID string, role organization.Role) {
+				createdAt = createdAt.Add(time.Minute)
+
+				Expect(spec.MembershipRepo.Create(ctx, &organization.Membership{
+					UID:             pkgTools.NewUUID().String(),
+					OrganizationUID: organizationUID,
+					UserUID:         userUID,
+					Role:            role,
+					CreatedAt:       createdAt,
+				})).To(Succeed())
+			}
+
+			createOrganization := func(ownerUID string) string {
+				organizationUID := pkgTools.NewUUID().String()
+
+				Expect(spec.OrganizationRepo.Create(ctx, &organization.Organization{
+					UID:       organizationUID,
+					Name:      "Foo",
+					CreatedBy: ownerUID,
+					CreatedAt: time.Now(),
+				})).To(Succeed())
+
+				join(organizationUID, ownerUID, organization.RoleOwner)
+
+				return organizationUID
+			}
+
+			// handed over to the admin, even though the member joined first
+			sharedUID := createOrganization(purgedUID)
+			join(sharedUID, memberUID, organization.RoleMember)
+			join(sharedUID, adminMemberUID, organization.RoleAdmin)
+
+			// deleted, nobody else belongs to it
+			aloneUID := createOrganization(purgedUID)
+			Expect(spec.InvitationRepo.Create(ctx, &organization.Invitation{
+				UID:             pkgTools.NewUUID().String(),
+				OrganizationUID: aloneUID,
+				Email:           "invited@bar.baz",
+				Role:            organization.RoleMember,
+				Token:           pkgTools.NewUUID().String(),
+				InvitedBy:       purgedUID,
+				Status:          organization.InvitationStatusPending,
+				ExpiresAt:       time.Now().Add(time.Hour),
+			})).To(Succeed())
+
+			// left as it is, the purged user is a member only
+			otherUID := createOrganization(memberUID)
+			join(otherUID, purgedUID, organization.RoleMember)
+
+			Expect(spec.SessionRepo.Create(ctx, &session.Session{
+				UID:       pkgTools.NewUUID().String(),
+				UserUID:   purgedUID,
+				ExpiresAt: time.Now().Add(time.Hour),
+			})).To(Succeed())
+			Expect(spec.DeviceRepo.Create(ctx, &device.KnownDevice{
+				UID:         pkgTools.NewUUID().String(),
+				UserUID:     purgedUID,
+				Fingerprint: "fingerprint",
+				RevokeToken: pkgTools.NewUUID().String(),
+			})).To(Succeed())
+			Expect(spec.RequestRepo.Create(ctx, &verification.Request{
+				UID:       pkgTools.NewUUID().String(),
+				Type:      verification.TypePasswordReset,
+				UserUID:   purgedUID,
+				Token:     pkgTools.NewUUID().String(),
+				ExpiresAt: time.Now().Add(time.Hour),
+			})).To(Succeed())
+
+			retention := accountDomain.DefaultSettings.DeletedRetention
+			Expect(spec.UserRepo.Delete(ctx, purgedUID, 0, adminUID, time.Now().Add(-retention-time.Minute))).To(Succeed())
+			Expect(spec.UserRepo.Delete(ctx, recentUID, 0, adminUID, time.Now())).To(Succeed())
+
+			purged, err := spec.PurgeSvc.Purge(ctx, time.Now().Add(-retention))
+			Expect(err).To(Succeed())
+			Expect(purged).To(Equal(1))
+
+			_, err = spec.UserRepo.FindDeletedByUID(ctx, purgedUID)
+			Expect(err).To(Equal(mongo.ErrNoDocuments))
+
+			_, err = spec.UserRepo.FindDeletedByUID(ctx, recentUID)
+			Expect(err).To(Succeed())
+
+			memberships, err := spec.MembershipRepo.FindAllByUser(ctx, purgedUID)
+			Expect(err).To(Succeed())
+			Expect(memberships).To(BeEmpty())
+
+			successor, err := spec.MembershipRepo.FindByOrganizationAndUser(ctx, sharedUID, adminMemberUID)
+			Expect(err).To(Succeed())
+			Expect(successor.Role).To(Equal(organization.RoleOwner))
+
+			member, err := spec.MembershipRepo.FindByOrganizationAndUser(ctx, sharedUID, memberUID)
+			Expect(err).To(Succeed())
+			Expect(member.Role).To(Equal(organization.RoleMember))
+
+			alone, err := spec.OrganizationRepo.FindByUID(ctx, aloneUID)
+			Expect(err).To(Succeed())
+			Expect(alone).To(BeNil())
+
+			for collection, filter := range map[string]bson.M{
+				organization.InvitationsCollectionName: {"organizationUid": aloneUID},
+				session.CollectionName:                 {"userUid": purgedUID},
+				device.CollectionName:                  {"userUid": purgedUID},
+				"verification_requests":                {"userUid": purgedUID},
+			} {
+				count, err := db.Collection(collection).CountDocuments(ctx, filter)
+				Expect(err).To(Succeed())
+				Expect(count).To(BeZero(), collection)
+			}
+
+			other, err := spec.MembershipRepo.FindAllByOrganization(ctx, otherUID)
+			Expect(err).To(Succeed())
+			Expect(other).To(HaveLen(1))
+			Expect(other[0].UserUID).To(Equal(memberUID))
+		})
+
+		It("Only admins delete accounts", func() {
+			userUID := createUser("foo@bar.baz", false)
+			otherUID := createUser("other@bar.baz", false)
+
+			rec := request(http.MethodDelete, "/"+otherUID, tokenOf(userUID, false))
+			Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+}
@@ -0,0 +1,248 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"apart-deal-api/dependencies"
+	"apart-deal-api/pkg/api/auth"
+	"apart-deal-api/pkg/config"
+	"apart-deal-api/pkg/security"
+	"apart-deal-api/pkg/store/audit"
+	"apart-deal-api/pkg/store/device"
+	"apart-deal-api/pkg/store/notification"
+	"apart-deal-api/pkg/store/session"
+	"apart-deal-api/pkg/store/user"
+	"apart-deal-api/pkg/store/verification"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	auditHandlers "apart-deal-api/pkg/api/handlers/audit"
+	authHandlers "apart-deal-api/pkg/api/handlers/auth"
+	challengeHandlers "apart-deal-api/pkg/api/handlers/challenge"
+	apiServer "apart-deal-api/pkg/api/server"
+	auditDomain "apart-deal-api/pkg/domain/audit"
+	authDomain "apart-deal-api/pkg/domain/auth"
+	deviceDomain "apart-deal-api/pkg/domain/device"
+	identityDomain "apart-deal-api/pkg/domain/identity"
+	pkgTools "apart-deal-api/pkg/tools"
+	testTools "apart-deal-api/tests/tools"
+	oas "gitlab.com/apart-deals/openapi/go/api"
+)
+
+type specContainer struct {
+	fx.In
+
+	Echo     *echo.Echo
+	AuthSvc  *auth.AuthenticationService
+	AuditSvc *auditDomain.AuditService
+	Hasher   *security.PasswordHasher
+}
+
+var constModule = fx.Options(
+	fx.NopLogger,
+	fx.Supply(&config.Config{
+		IsDebug: true,
+	}),
+	fx.Supply(&dependencies.ApiConfig{
+		Port:        37800 + GinkgoParallelProcess(),
+		TokenSecret: "foobar",
+	}),
+	fx.Supply(testTools.NewFastPasswordHasher()),
+	fx.Supply(auditDomain.DefaultSettings),
+	fx.Provide(apiServer.NewServer),
+	fx.Supply(challengeHandlers.NewGuard(nil, nil)),
+	fx.Provide(apiServer.NewAuthRouteGroup),
+	fx.Provide(apiServer.NewAuditRouteGroup),
+	fx.Provide(user.NewUserRepository),
+	fx.Provide(verification.NewRequestRepository),
+	fx.Provide(audit.NewEventRepository),
+	fx.Provide(auditDomain.NewAuditService),
+	fx.Provide(notification.NewNotificationRepository),
+	fx.Provide(security.NewSecretGenerator),
+	fx.Provide(device.NewKnownDeviceRepository),
+	fx.Provide(authDomain.NewPasswordResetService),
+	fx.Provide(deviceDomain.NewDeviceService),
+	fx.Supply(identityDomain.NewEmailNormalizer(identityDomain.DefaultEmailSettings)),
+	fx.Provide(dependencies.NewAuthenticationService),
+	fx.Supply(auth.DefaultSessionSettings),
+	fx.Provide(session.NewSessionRepository),
+	fx.Provide(auth.NewSessionService),
+	fx.Provide(authHandlers.NewSignInHandler),
+	fx.Provide(auditHandlers.NewListAuditEventsHandler),
+	fx.Invoke(authHandlers.RegisterSignInRoute),
+	fx.Invoke(auditHandlers.RegisterListAuditEventsRoute),
+)
+
+func RegisterSuite(db *mongo.Database) {
+	Describe("Audit", func() {
+		loggerLvl := zap.NewAtomicLevelAt(zap.ErrorLevel)
+		logger := dependencies.NewLogger(&loggerLvl)
+
+		var (
+			ctx    context.Context
+			cancel context.CancelFunc
+			app    *fx.App
+			spec   *specContainer
+		)
+
+		listEvents := func(query string, admin bool) *httptest.ResponseRecorder {
+			userUID := pkgTools.NewUUID().String()
+
+			_, err := db.Collection("users").InsertOne(ctx, user.User{
+				UID:      userUID,
+				Name:     "Foo",
+				Email:    userUID + "@bar.baz",
+				EmailKey: userUID + "@bar.baz",
+				Status:   user.StatusConfirmed,
+				Admin:    admin,
+			})
+			Expect(err).To(Succeed())
+
+			token, err := spec.AuthSvc.Sign(auth.TokenPayload{UserID: userUID, Admin: admin})
+			Expect(err).To(Succeed())
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/audit/events"+query, nil)
+			req.Header.Add("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			return rec
+		}
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+
+			for _, collection := range []string{"users", "audit_events", "known_devices", "notifications", verification.CollectionName} {
+				_, err := db.Collection(collection).DeleteMany(ctx, bson.M{})
+				Expect(err).To(Succeed())
+			}
+
+			app = fx.New(
+				fx.Supply(logger),
+				fx.Supply(db),
+				constModule,
+				fx.Invoke(func(s specContainer) {
+					spec = &s
+				}),
+			)
+
+			appStartCtx, appStartCancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer appStartCancel()
+
+			err := app.Start(appStartCtx)
+			Expect(err).To(Succeed())
+		})
+
+		AfterEach(func() {
+			appStopCtx, appStopCancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer appStopCancel()
+
+			err := app.Stop(appStopCtx)
+			Expect(err).To(Succeed())
+
+			cancel()
+		})
+
+		It("Sign in attempts are recorded with the client", func() {
+			passHash, err := spec.Hasher.Hash("my_secret")
+			Expect(err).To(Succeed())
+
+			userUID := pkgTools.NewUUID().String()
+			_, err = db.Collection("users").InsertOne(ctx, user.User{
+				UID:          userUID,
+				Name:         "Foo",
+				Email:        "foo@bar.baz",
+				EmailKey:     "foo@bar.baz",
+				PasswordHash: passHash,
+				Status:       user.StatusConfirmed,
+			})
+			Expect(err).To(Succeed())
+
+			for _, password := range []string{"wrong", "my_secret"} {
+				// recorded as foo@bar.baz so that filtering by email finds it
+				body := bytes.NewBuffer([]byte(`{"email":"Foo@BAR.baz","password":"` + password + `"}`))
+				req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/sign-in", body)
+				req.Header.Add("Content-Type", "application/json")
+				req.Header.Add("User-Agent", "spec-agent")
+				req.Header.Add("X-Trace-Id", "trace-"+password)
+				req.RemoteAddr = "10.0.0.1:40000"
+				// only trusted proxies may tell the client IP
+				req.Header.Add("X-Forwarded-For", "1.2.3.4")
+				rec := httptest.NewRecorder()
+				spec.Echo.ServeHTTP(rec, req)
+			}
+
+			var events []audit.Event
+			cursor, err := db.Collection("audit_events").Find(ctx, bson.M{"type": audit.TypeSignIn})
+			Expect(err).To(Succeed())
+			Expect(cursor.All(ctx, &events)).To(Succeed())
+
+			Expect(events).To(HaveLen(2))
+
+			for _, e := range events {
+				Expect(e.Email).To(Equal("foo@bar.baz"))
+				Expect(e.IP).To(Equal("10.0.0.1"))
+				Expect(e.UserAgent).To(Equal("spec-agent"))
+				Expect(e.ExpiresAt).To(BeTemporally("~", e.CreatedAt.Add(auditDomain.DefaultSettings.Retention), time.Second))
+
+				if e.TraceID == "trace-wrong" {
+					Expect(e.Outcome).To(Equal(audit.OutcomeFailure))
+					Expect(e.Reason).To(Equal("invalid_password"))
+				} else {
+					Expect(e.TraceID).To(Equal("trace-my_secret"))
+					Expect(e.Outcome).To(Equal(audit.OutcomeSuccess))
+					Expect(e.UserUID).To(Equal(userUID))
+				}
+			}
+		})
+
+		It("Only admins can query the log", func() {
+			rec := listEvents("", false)
+
+			Expect(rec.Code).To(Equal(401))
+			Expect(rec.Body.String()).To(ContainSubstring("not_admin"))
+		})
+
+		It("Log is filtered and paginated", func() {
+			for i := 0; i < 3; i++ {
+				spec.AuditSvc.Record(ctx, auditDomain.RecordInput{
+					Type:    audit.TypeSignIn,
+					UserUID: "foo",
+					Outcome: audit.OutcomeFailure,
+					Reason:  "invalid_password",
+				})
+			}
+
+			spec.AuditSvc.Record(ctx, auditDomain.RecordInput{
+				Type:    audit.TypeSignUp,
+				UserUID: "foo",
+				Outcome: audit.OutcomeSuccess,
+			})
+
+			rec := listEvents("?userUid=foo&outcome=failure&perPage=2&page=2", true)
+			Expect(rec.Code).To(Equal(200))
+
+			var page oas.AuditEventPage
+			Expect(json.Unmarshal(rec.Body.Bytes(), &page)).To(Succeed())
+			Expect(page.Total).To(Equal(int64(3)))
+			Expect(page.Page).To(Equal(int32(2)))
+			Expect(page.Items).To(HaveLen(1))
+			Expect(page.Items[0].Type).To(Equal(string(audit.TypeSignIn)))
+
+			rec = listEvents("?outcome=maybe", true)
+			Expect(rec.Code).To(Equal(400))
+		})
+	})
+}
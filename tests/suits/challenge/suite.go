@@ -0,0 +1,251 @@
+package challenge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	"apart-deal-api/dependencies"
+	"apart-deal-api/pkg/api/handlers/auth"
+	"apart-deal-api/pkg/config"
+	"apart-deal-api/pkg/security"
+	"apart-deal-api/pkg/store/audit"
+	"apart-deal-api/pkg/store/challenge"
+	"apart-deal-api/pkg/store/notification"
+	"apart-deal-api/pkg/store/organization"
+	"apart-deal-api/pkg/store/user"
+	"apart-deal-api/pkg/store/verification"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	challengeHandlers "apart-deal-api/pkg/api/handlers/challenge"
+	apiServer "apart-deal-api/pkg/api/server"
+	auditDomain "apart-deal-api/pkg/domain/audit"
+	authDomain "apart-deal-api/pkg/domain/auth"
+	challengeDomain "apart-deal-api/pkg/domain/challenge"
+	identityDomain "apart-deal-api/pkg/domain/identity"
+	orgDomain "apart-deal-api/pkg/domain/organization"
+	testTools "apart-deal-api/tests/tools"
+	oas "gitlab.com/apart-deals/openapi/go/api"
+)
+
+type specContainer struct {
+	fx.In
+
+	Echo *echo.Echo
+}
+
+var challengeConstModule = fx.Options(
+	fx.NopLogger,
+	fx.Supply(&config.Config{
+		IsDebug: true,
+	}),
+	fx.Supply(&dependencies.ApiConfig{
+		Port: 37800 + GinkgoParallelProcess(),
+	}),
+	fx.Supply(security.NewPasswordPolicy(security.DefaultPasswordPolicyConfig, nil)),
+	fx.Supply(testTools.NewFastPasswordHasher()),
+	fx.Provide(security.NewSecretGenerator),
+	fx.Provide(func() (*security.EmailDomainPolicy, error) {
+		return security.NewEmailDomainPolicy(security.EmailDomainPolicyConfig{})
+	}),
+	fx.Supply(challengeDomain.ProofOfWorkSettings{
+		Difficulty: 8,
+		TTL:        challengeDomain.DefaultProofOfWorkSettings.TTL,
+	}),
+	fx.Provide(challenge.NewChallengeRepository),
+	fx.Provide(challengeDomain.NewProofOfWorkService),
+	fx.Provide(func(powSvc *challengeDomain.ProofOfWorkService) *challengeHandlers.Guard {
+		return challengeHandlers.NewGuard(powSvc, []string{"/api/v1/auth/sign-up"})
+	}),
+	fx.Provide(apiServer.NewServer),
+	fx.Provide(apiServer.NewAuthRouteGroup),
+	fx.Provide(apiServer.NewChallengeRouteGroup),
+	fx.Provide(user.NewUserRepository),
+	fx.Provide(verification.NewRequestRepository),
+	fx.Supply(auditDomain.DefaultSettings),
+	fx.Provide(audit.NewEventRepository),
+	fx.Provide(auditDomain.NewAuditService),
+	fx.Provide(notification.NewNotificationRepository),
+	fx.Provide(organization.NewOrganizationRepository),
+	fx.Provide(organization.NewMembershipRepository),
+	fx.Provide(organization.NewInvitationRepository),
+	fx.Supply(identityDomain.NewEmailNormalizer(identityDomain.DefaultEmailSettings)),
+	fx.Provide(orgDomain.NewInvitationService),
+	fx.Provide(auth.NewSignUpHandler),
+	fx.Provide(authDomain.NewSignUpService),
+	fx.Provide(challengeHandlers.NewIssueChallengeHandler),
+	fx.Provide(challengeHandlers.NewVerifyChallengeHandler),
+	fx.Invoke(auth.RegisterSignUpRoute),
+	fx.Invoke(challengeHandlers.RegisterIssueChallengeRoute),
+	fx.Invoke(challengeHandlers.RegisterVerifyChallengeRoute),
+	fx.Invoke(func(guard *challengeHandlers.Guard, e *echo.Echo) error {
+		return guard.CheckRoutes(e.Routes())
+	}),
+)
+
+func solve(issued oas.Challenge) string {
+	for i := 0; ; i++ {
+		nonce := strconv.Itoa(i)
+		if challengeDomain.WorkBits(issued.Uid, nonce) >= int(issued.Difficulty) {
+			return nonce
+		}
+	}
+}
+
+func RegisterSuite(db *mongo.Database) {
+	Describe("Sign-up challenge", func() {
+
+		loggerLvl := zap.NewAtomicLevelAt(zap.ErrorLevel)
+		loggerCfg := zap.NewDevelopmentConfig()
+		loggerCfg.Level = loggerLvl
+		logger, _ := loggerCfg.Build()
+
+		var (
+			ctx    context.Context
+			cancel context.CancelFunc
+			app    *fx.App
+			spec   *specContainer
+		)
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+
+			_, err := db.Collection("users").DeleteMany(ctx, bson.M{})
+			Expect(err).To(Succeed())
+
+			_, err = db.Collection(verification.CollectionName).DeleteMany(ctx, bson.M{})
+			Expect(err).To(Succeed())
+
+			_, err = db.Collection(challenge.CollectionName).DeleteMany(ctx, bson.M{})
+			Expect(err).To(Succeed())
+
+			app = fx.New(
+				fx.Supply(logger),
+				fx.Supply(db),
+				challengeConstModule,
+				fx.Invoke(func(s specContainer) {
+					spec = &s
+				}),
+			)
+
+			err = app.Start(context.Background())
+			Expect(err).To(Succeed())
+		})
+
+		AfterEach(func() {
+			err := app.Stop(context.Background())
+			Expect(err).To(Succeed())
+
+			cancel()
+		})
+
+		issue := func() oas.Challenge {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/challenges", nil)
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(200))
+
+			var issued oas.Challenge
+			Expect(json.Unmarshal(rec.Body.Bytes(), &issued)).To(Succeed())
+			Expect(issued.Difficulty).To(Equal(int32(8)))
+
+			return issued
+		}
+
+		verify := func(uid string, nonce string) *httptest.ResponseRecorder {
+			body, _ := json.Marshal(oas.ChallengeSolution{Uid: uid, Nonce: nonce})
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/challenges/verify", bytes.NewBuffer(body))
+			req.Header.Add("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			return rec
+		}
+
+		signUp := func(response string) *httptest.ResponseRecorder {
+			body := bytes.NewBuffer([]byte(`{"name":"foo", "email": "foo@gmail.com", "password": "barbaris"}`))
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/sign-up", body)
+			req.Header.Add("Content-Type", "application/json")
+			if response != "" {
+				req.Header.Add(challengeHandlers.ResponseHeader, response)
+			}
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			return rec
+		}
+
+		It("Sign-up without a challenge is refused", func() {
+			rec := signUp("")
+
+			Expect(rec.Code).To(Equal(401))
+			Expect(rec.Body.String()).To(ContainSubstring(`"reason":"challenge_required"`))
+		})
+
+		It("Wrong solution is rejected", func() {
+			issued := issue()
+
+			nonce := 0
+			for challengeDomain.WorkBits(issued.Uid, strconv.Itoa(nonce)) >= int(issued.Difficulty) {
+				nonce++
+			}
+
+			rec := verify(issued.Uid, strconv.Itoa(nonce))
+
+			Expect(rec.Code).To(Equal(400))
+			Expect(rec.Body.String()).To(ContainSubstring(`"tag":"solution_invalid"`))
+		})
+
+		It("Unsolved challenge is not accepted", func() {
+			issued := issue()
+
+			rec := signUp(issued.Uid)
+
+			Expect(rec.Code).To(Equal(401))
+			Expect(rec.Body.String()).To(ContainSubstring(`"reason":"challenge_failed"`))
+		})
+
+		It("Solved challenge lets a single sign-up through", func() {
+			issued := issue()
+
+			rec := verify(issued.Uid, solve(issued))
+			Expect(rec.Code).To(Equal(204))
+
+			rec = signUp(issued.Uid)
+			Expect(rec.Code).To(Equal(200))
+
+			rec = signUp(issued.Uid)
+			Expect(rec.Code).To(Equal(401))
+			Expect(rec.Body.String()).To(ContainSubstring(`"reason":"challenge_failed"`))
+		})
+
+		It("Unknown challenge cannot be solved", func() {
+			rec := verify("nope", "1")
+
+			Expect(rec.Code).To(Equal(404))
+		})
+
+		It("Configured routes are trimmed and have to be registered", func() {
+			cfg := dependencies.ChallengeConfig{Routes: " /api/v1/auth/sign-up , ,/api/v1/auth/sign-in,"}
+			Expect(cfg.RouteList()).To(Equal([]string{"/api/v1/auth/sign-up", "/api/v1/auth/sign-in"}))
+
+			guard := challengeHandlers.NewGuard(nil, cfg.RouteList())
+			Expect(guard.CheckRoutes(spec.Echo.Routes())).To(MatchError(ContainSubstring("/api/v1/auth/sign-in")))
+
+			guard = challengeHandlers.NewGuard(nil, []string{"/api/v1/auth/sign-up"})
+			Expect(guard.CheckRoutes(spec.Echo.Routes())).To(Succeed())
+		})
+	})
+}
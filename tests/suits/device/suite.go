@@ -0,0 +1,331 @@
+package device
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"apart-deal-api/dependencies"
+	"apart-deal-api/pkg/api/auth"
+	"apart-deal-api/pkg/config"
+	"apart-deal-api/pkg/security"
+	"apart-deal-api/pkg/store/audit"
+	"apart-deal-api/pkg/store/device"
+	"apart-deal-api/pkg/store/notification"
+	"apart-deal-api/pkg/store/session"
+	"apart-deal-api/pkg/store/user"
+	"apart-deal-api/pkg/store/verification"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	authHandlers "apart-deal-api/pkg/api/handlers/auth"
+	challengeHandlers "apart-deal-api/pkg/api/handlers/challenge"
+	apiServer "apart-deal-api/pkg/api/server"
+	auditDomain "apart-deal-api/pkg/domain/audit"
+	authDomain "apart-deal-api/pkg/domain/auth"
+	deviceDomain "apart-deal-api/pkg/domain/device"
+	identityDomain "apart-deal-api/pkg/domain/identity"
+	pkgTools "apart-deal-api/pkg/tools"
+	testTools "apart-deal-api/tests/tools"
+	oas "gitlab.com/apart-deals/openapi/go/api"
+)
+
+const (
+	firefoxOnLinux = "Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/118.0"
+	chromeOnMac    = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36"
+)
+
+type specContainer struct {
+	fx.In
+
+	Echo             *echo.Echo
+	Hasher           *security.PasswordHasher
+	UserRepo         user.UserRepository
+	RequestRepo      verification.RequestRepository
+	NotificationRepo notification.NotificationRepository
+	Secrets          security.SecretGenerator
+	AuditSvc         *auditDomain.AuditService
+}
+
+// failingUserRepository fails the next password reset completions, as a lost connection would
+type failingUserRepository struct {
+	user.UserRepository
+	failures int
+}
+
+func (r *failingUserRepository) CompletePasswordReset(
+	ctx context.Context,
+	uid string,
+	version int,
+	passwordHash string,
+) error {
+	if r.failures > 0 {
+		r.failures--
+
+		return errors.New("connection reset")
+	}
+
+	return r.UserRepository.CompletePasswordReset(ctx, uid, version, passwordHash)
+}
+
+var constModule = fx.Options(
+	fx.NopLogger,
+	fx.Supply(&config.Config{
+		IsDebug: true,
+	}),
+	fx.Supply(&dependencies.ApiConfig{
+		Port:        37800 + GinkgoParallelProcess(),
+		TokenSecret: "foobar",
+	}),
+	fx.Supply(testTools.NewFastPasswordHasher()),
+	fx.Supply(security.NewPasswordPolicy(security.DefaultPasswordPolicyConfig, nil)),
+	fx.Supply(auditDomain.DefaultSettings),
+	fx.Provide(apiServer.NewServer),
+	fx.Supply(challengeHandlers.NewGuard(nil, nil)),
+	fx.Provide(apiServer.NewAuthRouteGroup),
+	fx.Provide(user.NewUserRepository),
+	fx.Provide(verification.NewRequestRepository),
+	fx.Provide(audit.NewEventRepository),
+	fx.Provide(device.NewKnownDeviceRepository),
+	fx.Provide(notification.NewNotificationRepository),
+	fx.Provide(security.NewSecretGenerator),
+	fx.Provide(auditDomain.NewAuditService),
+	fx.Provide(authDomain.NewPasswordResetService),
+	fx.Provide(deviceDomain.NewDeviceService),
+	fx.Supply(identityDomain.NewEmailNormalizer(identityDomain.DefaultEmailSettings)),
+	fx.Provide(dependencies.NewAuthenticationService),
+	fx.Supply(auth.DefaultSessionSettings),
+	fx.Provide(session.NewSessionRepository),
+	fx.Provide(auth.NewSessionService),
+	fx.Provide(authHandlers.NewSignInHandler),
+	fx.Provide(authHandlers.NewReportDeviceHandler),
+	fx.Provide(authHandlers.NewPasswordResetHandler),
+	fx.Invoke(authHandlers.RegisterSignInRoute),
+	fx.Invoke(authHandlers.RegisterReportDeviceRoute),
+	fx.Invoke(authHandlers.RegisterPasswordResetRoute),
+	fx.Invoke(func(e *echo.Echo, authSvc *auth.AuthenticationService, sessionSvc *auth.SessionService) {
+		e.GET("/protected", func(c echo.Context) error {
+			return c.NoContent(http.StatusNoContent)
+		}, auth.NewAuthMiddleware(authSvc, sessionSvc))
+	}),
+)
+
+func RegisterSuite(db *mongo.Database) {
+	Describe("Devices", func() {
+		loggerLvl := zap.NewAtomicLevelAt(zap.ErrorLevel)
+		logger := dependencies.NewLogger(&loggerLvl)
+
+		var (
+			ctx    context.Context
+			cancel context.CancelFunc
+			app    *fx.App
+			spec   *specContainer
+		)
+
+		post := func(path string, body string, userAgent string, ip string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, path, bytes.NewBuffer([]byte(body)))
+			req.Header.Add("Content-Type", "application/json")
+			req.Header.Add("User-Agent", userAgent)
+			req.RemoteAddr = ip + ":40000"
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			return rec
+		}
+
+		signIn := func(password string, userAgent string, ip string) *httptest.ResponseRecorder {
+			return post("/api/v1/auth/sign-in", `{"email":"foo@bar.baz","password":"`+password+`"}`, userAgent, ip)
+		}
+
+		findNotifications := func(t notification.NotificationType) []notification.Notification {
+			var found []notification.Notification
+
+			cursor, err := db.Collection("notifications").Find(ctx, bson.M{"type": t})
+			Expect(err).To(Succeed())
+			Expect(cursor.All(ctx, &found)).To(Succeed())
+
+			return found
+		}
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+
+			for _, collection := range []string{"users", "known_devices", "notifications", "audit_events", verification.CollectionName} {
+				_, err := db.Collection(collection).DeleteMany(ctx, bson.M{})
+				Expect(err).To(Succeed())
+			}
+
+			app = fx.New(
+				fx.Supply(logger),
+				fx.Supply(db),
+				constModule,
+				fx.Invoke(func(s specContainer) {
+					spec = &s
+				}),
+			)
+
+			appStartCtx, appStartCancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer appStartCancel()
+
+			err := app.Start(appStartCtx)
+			Expect(err).To(Succeed())
+
+			passHash, err := spec.Hasher.Hash("my_secret")
+			Expect(err).To(Succeed())
+
+			_, err = db.Collection("users").InsertOne(ctx, user.User{
+				UID:          pkgTools.NewUUID().String(),
+				Name:         "Foo",
+				Email:        "foo@bar.baz",
+				EmailKey:     "foo@bar.baz",
+				PasswordHash: passHash,
+				Status:       user.StatusConfirmed,
+			})
+			Expect(err).To(Succeed())
+		})
+
+		AfterEach(func() {
+			appStopCtx, appStopCancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer appStopCancel()
+
+			err := app.Stop(appStopCtx)
+			Expect(err).To(Succeed())
+
+			cancel()
+		})
+
+		It("First and known devices are not reported", func() {
+			Expect(signIn("my_secret", firefoxOnLinux, "10.0.0.1").Code).To(Equal(200))
+			Expect(signIn("my_secret", firefoxOnLinux, "10.0.0.2").Code).To(Equal(200))
+
+			Expect(findNotifications(notification.TypeNewDevice)).To(BeEmpty())
+		})
+
+		It("New device is reported", func() {
+			Expect(signIn("my_secret", firefoxOnLinux, "10.0.0.1").Code).To(Equal(200))
+			Expect(signIn("my_secret", chromeOnMac, "10.0.0.1").Code).To(Equal(200))
+
+			found := findNotifications(notification.TypeNewDevice)
+			Expect(found).To(HaveLen(1))
+			Expect(found[0].Email).To(Equal("foo@bar.baz"))
+			Expect(found[0].Data["device"]).To(Equal("Chrome on macOS"))
+			Expect(found[0].Data["token"]).NotTo(BeEmpty())
+			Expect(found[0].ExpiresAt).To(BeTemporally("~", time.Now().Add(notification.Retention), time.Minute))
+		})
+
+		It("Token of a sent notification is removed", func() {
+			Expect(signIn("my_secret", firefoxOnLinux, "10.0.0.1").Code).To(Equal(200))
+			Expect(signIn("my_secret", chromeOnMac, "10.0.0.1").Code).To(Equal(200))
+
+			found := findNotifications(notification.TypeNewDevice)
+			Expect(found).To(HaveLen(1))
+			Expect(spec.NotificationRepo.SaveSentTime(ctx, found[0].UID, time.Now())).To(Succeed())
+
+			found = findNotifications(notification.TypeNewDevice)
+			Expect(found[0].SentAt).NotTo(BeNil())
+			Expect(found[0].Data).NotTo(HaveKey("token"))
+			Expect(found[0].Data["device"]).To(Equal("Chrome on macOS"))
+		})
+
+		It("Expired revoke token is rejected", func() {
+			Expect(signIn("my_secret", firefoxOnLinux, "10.0.0.1").Code).To(Equal(200))
+			Expect(signIn("my_secret", chromeOnMac, "10.0.0.1").Code).To(Equal(200))
+
+			newDevice := findNotifications(notification.TypeNewDevice)
+			Expect(newDevice).To(HaveLen(1))
+
+			_, err := db.Collection("known_devices").UpdateMany(ctx, bson.M{}, bson.M{
+				"$set": bson.M{"revokeTokenExpiresAt": time.Now().Add(-time.Minute)},
+			})
+			Expect(err).To(Succeed())
+
+			rec := post("/api/v1/auth/not-me", `{"token":"`+newDevice[0].Data["token"]+`"}`, firefoxOnLinux, "10.0.0.1")
+			Expect(rec.Code).To(Equal(404))
+
+			Expect(signIn("my_secret", firefoxOnLinux, "10.0.0.1").Code).To(Equal(200))
+		})
+
+		It("Reporting a device revokes sessions until the password is reset", func() {
+			Expect(signIn("my_secret", firefoxOnLinux, "10.0.0.1").Code).To(Equal(200))
+
+			rec := signIn("my_secret", chromeOnMac, "192.168.1.1")
+			Expect(rec.Code).To(Equal(200))
+
+			var signedIn oas.SignedIn
+			Expect(json.Unmarshal(rec.Body.Bytes(), &signedIn)).To(Succeed())
+
+			newDevice := findNotifications(notification.TypeNewDevice)
+			Expect(newDevice).To(HaveLen(1))
+
+			// tokens carry a second precision
+			time.Sleep(time.Second)
+
+			rec = post("/api/v1/auth/not-me", `{"token":"`+newDevice[0].Data["token"]+`"}`, firefoxOnLinux, "10.0.0.1")
+			Expect(rec.Code).To(Equal(204))
+
+			req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+			req.Header.Add("Authorization", "Bearer "+signedIn.Token)
+			rec = httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(401))
+			Expect(rec.Body.String()).To(ContainSubstring("session_revoked"))
+
+			rec = signIn("my_secret", firefoxOnLinux, "10.0.0.1")
+			Expect(rec.Code).To(Equal(401))
+			Expect(rec.Body.String()).To(ContainSubstring("password_reset_required"))
+
+			reset := findNotifications(notification.TypePasswordReset)
+			Expect(reset).To(HaveLen(1))
+
+			rec = post("/api/v1/auth/password-reset", `{"token":"`+reset[0].Data["token"]+`","password":"brand new secret"}`, firefoxOnLinux, "10.0.0.1")
+			Expect(rec.Code).To(Equal(204))
+
+			time.Sleep(time.Second)
+
+			Expect(signIn("my_secret", firefoxOnLinux, "10.0.0.1").Code).To(Equal(401))
+			Expect(signIn("brand new secret", firefoxOnLinux, "10.0.0.1").Code).To(Equal(200))
+		})
+
+		It("Password reset can be tried again when the user update failed", func() {
+			failing := &failingUserRepository{UserRepository: spec.UserRepo, failures: 1}
+			resetSvc := authDomain.NewPasswordResetService(
+				failing,
+				spec.RequestRepo,
+				spec.NotificationRepo,
+				spec.Hasher,
+				spec.Secrets,
+				spec.AuditSvc,
+			)
+
+			u, err := spec.UserRepo.FindByEmailKey(ctx, "foo@bar.baz")
+			Expect(err).To(Succeed())
+			Expect(resetSvc.Require(ctx, u, false)).To(Succeed())
+
+			reset := findNotifications(notification.TypePasswordReset)
+			Expect(reset).To(HaveLen(1))
+
+			input := authDomain.PasswordResetInput{Token: reset[0].Data["token"], Password: "brand new secret"}
+			Expect(resetSvc.Reset(ctx, input)).To(MatchError("connection reset"))
+			Expect(signIn("my_secret", firefoxOnLinux, "10.0.0.1").Code).To(Equal(401))
+
+			Expect(resetSvc.Reset(ctx, input)).To(Succeed())
+			Expect(resetSvc.Reset(ctx, input)).To(BeAssignableToTypeOf(&authDomain.PasswordResetNotFound{}))
+
+			time.Sleep(time.Second)
+
+			Expect(signIn("brand new secret", firefoxOnLinux, "10.0.0.1").Code).To(Equal(200))
+		})
+	})
+}
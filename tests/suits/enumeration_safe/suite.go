@@ -0,0 +1,205 @@
+package enumeration_safe
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"apart-deal-api/dependencies"
+	"apart-deal-api/pkg/api/auth"
+	"apart-deal-api/pkg/config"
+	"apart-deal-api/pkg/security"
+	"apart-deal-api/pkg/store/audit"
+	"apart-deal-api/pkg/store/device"
+	"apart-deal-api/pkg/store/notification"
+	"apart-deal-api/pkg/store/organization"
+	"apart-deal-api/pkg/store/session"
+	"apart-deal-api/pkg/store/user"
+	"apart-deal-api/pkg/store/verification"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	authHandlers "apart-deal-api/pkg/api/handlers/auth"
+	challengeHandlers "apart-deal-api/pkg/api/handlers/challenge"
+	apiServer "apart-deal-api/pkg/api/server"
+	auditDomain "apart-deal-api/pkg/domain/audit"
+	authDomain "apart-deal-api/pkg/domain/auth"
+	deviceDomain "apart-deal-api/pkg/domain/device"
+	identityDomain "apart-deal-api/pkg/domain/identity"
+	orgDomain "apart-deal-api/pkg/domain/organization"
+	pkgTools "apart-deal-api/pkg/tools"
+	testTools "apart-deal-api/tests/tools"
+)
+
+type specContainer struct {
+	fx.In
+
+	Echo   *echo.Echo
+	Hasher *security.PasswordHasher
+}
+
+var constModule = fx.Options(
+	fx.NopLogger,
+	fx.Supply(&config.Config{
+		IsDebug:         true,
+		EnumerationSafe: true,
+	}),
+	fx.Supply(&dependencies.ApiConfig{
+		Port:        37800 + GinkgoParallelProcess(),
+		TokenSecret: "foobar",
+	}),
+	fx.Supply(testTools.NewFastPasswordHasher()),
+	fx.Supply(security.NewPasswordPolicy(security.DefaultPasswordPolicyConfig, nil)),
+	fx.Provide(func() (*security.EmailDomainPolicy, error) {
+		return security.NewEmailDomainPolicy(security.EmailDomainPolicyConfig{})
+	}),
+	fx.Provide(apiServer.NewServer),
+	fx.Supply(challengeHandlers.NewGuard(nil, nil)),
+	fx.Provide(apiServer.NewAuthRouteGroup),
+	fx.Provide(user.NewUserRepository),
+	fx.Provide(verification.NewRequestRepository),
+	fx.Supply(auditDomain.DefaultSettings),
+	fx.Provide(audit.NewEventRepository),
+	fx.Provide(auditDomain.NewAuditService),
+	fx.Provide(notification.NewNotificationRepository),
+	fx.Provide(organization.NewOrganizationRepository),
+	fx.Provide(organization.NewMembershipRepository),
+	fx.Provide(organization.NewInvitationRepository),
+	fx.Provide(security.NewSecretGenerator),
+	fx.Supply(identityDomain.NewEmailNormalizer(identityDomain.DefaultEmailSettings)),
+	fx.Provide(orgDomain.NewInvitationService),
+	fx.Provide(authDomain.NewSignUpService),
+	fx.Provide(device.NewKnownDeviceRepository),
+	fx.Provide(authDomain.NewPasswordResetService),
+	fx.Provide(deviceDomain.NewDeviceService),
+	fx.Provide(dependencies.NewAuthenticationService),
+	fx.Supply(auth.DefaultSessionSettings),
+	fx.Provide(session.NewSessionRepository),
+	fx.Provide(auth.NewSessionService),
+	fx.Provide(authHandlers.NewSignInHandler),
+	fx.Provide(authHandlers.NewSignUpHandler),
+	fx.Invoke(authHandlers.RegisterSignInRoute),
+	fx.Invoke(authHandlers.RegisterSignUpRoute),
+)
+
+func RegisterSuite(db *mongo.Database) {
+	Describe("Enumeration-safe mode", func() {
+		loggerLvl := zap.NewAtomicLevelAt(zap.ErrorLevel)
+		logger := dependencies.NewLogger(&loggerLvl)
+
+		var (
+			ctx    context.Context
+			cancel context.CancelFunc
+			app    *fx.App
+			spec   *specContainer
+		)
+
+		createUser := func(status user.UserStatus) {
+			passHash, err := spec.Hasher.Hash("my_secret")
+			Expect(err).To(Succeed())
+
+			_, err = db.Collection("users").InsertOne(ctx, user.User{
+				UID:          pkgTools.NewUUID().String(),
+				Name:         "Foo",
+				Email:        "foo@bar.baz",
+				EmailKey:     "foo@bar.baz",
+				PasswordHash: passHash,
+				Status:       status,
+			})
+			Expect(err).To(Succeed())
+		}
+
+		signIn := func(payload string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/sign-in", bytes.NewBufferString(payload))
+			req.Header.Add("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			return rec
+		}
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+
+			for _, collection := range []string{"users", "notifications", verification.CollectionName} {
+				_, err := db.Collection(collection).DeleteMany(ctx, bson.M{})
+				Expect(err).To(Succeed())
+			}
+
+			app = fx.New(
+				fx.Supply(logger),
+				fx.Supply(db),
+				constModule,
+				fx.Invoke(func(s specContainer) {
+					spec = &s
+				}),
+			)
+
+			appStartCtx, appStartCancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer appStartCancel()
+
+			err := app.Start(appStartCtx)
+			Expect(err).To(Succeed())
+		})
+
+		AfterEach(func() {
+			appStopCtx, appStopCancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer appStopCancel()
+
+			err := app.Stop(appStopCtx)
+			Expect(err).To(Succeed())
+
+			cancel()
+		})
+
+		It("Unknown email and wrong password look the same", func() {
+			createUser(user.StatusConfirmed)
+
+			unknown := signIn(`{"email":"nobody@bar.baz","password":"my_secret"}`)
+			wrongPass := signIn(`{"email":"foo@bar.baz","password":"secret"}`)
+
+			Expect(unknown.Code).To(Equal(401))
+			Expect(wrongPass.Code).To(Equal(401))
+			Expect(unknown.Body.String()).To(Equal(wrongPass.Body.String()))
+			Expect(unknown.Body.String()).To(ContainSubstring("invalid_credentials"))
+		})
+
+		It("Pending user gets the generic error", func() {
+			createUser(user.StatusPending)
+
+			rec := signIn(`{"email":"foo@bar.baz","password":"my_secret"}`)
+
+			Expect(rec.Code).To(Equal(401))
+			Expect(rec.Body.String()).To(ContainSubstring("invalid_credentials"))
+		})
+
+		It("Sign up with a taken email looks successful and notifies the owner", func() {
+			createUser(user.StatusConfirmed)
+
+			body := bytes.NewBuffer([]byte(`{"name":"foo", "email": "foo@bar.baz", "password": "barbaris"}`))
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/sign-up", body)
+			req.Header.Add("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(200))
+			Expect(rec.Body.String()).To(MatchRegexp(`{"token":".+"}`))
+
+			count, err := db.Collection("notifications").CountDocuments(ctx, bson.M{
+				"email": "foo@bar.baz",
+				"type":  notification.TypeSignUpAttempt,
+			})
+			Expect(err).To(Succeed())
+			Expect(count).To(Equal(int64(1)))
+		})
+	})
+}
@@ -0,0 +1,142 @@
+package indexes
+
+import (
+	"context"
+
+	"apart-deal-api/pkg/mongo/schema"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	collectionName = "index_specs"
+)
+
+func RegisterSuite(db *mongo.Database) {
+	Describe("Index reconciliation", func() {
+		var (
+			ctx    context.Context
+			cancel context.CancelFunc
+		)
+
+		declared := []schema.CollectionIndexes{
+			{
+				Collection: collectionName,
+				Indexes: []schema.IndexSpec{
+					{
+						Name:   "uniq_token",
+						Keys:   bson.D{{Key: "token", Value: 1}},
+						Unique: true,
+					},
+					{
+						Name:          "pending_created_at",
+						Keys:          bson.D{{Key: "createdAt", Value: 1}},
+						PartialFilter: bson.D{{Key: "status", Value: "pending"}},
+					},
+				},
+			},
+		}
+
+		reconcile := func(settings schema.IndexReconcilerSettings) []schema.IndexChange {
+			reconciler := schema.NewIndexReconciler(db, declared, settings)
+
+			changes, err := reconciler.Plan(ctx)
+			Expect(err).To(Succeed())
+			Expect(reconciler.Apply(ctx, changes)).To(Succeed())
+
+			return changes
+		}
+
+		indexNames := func() []string {
+			specs, err := db.Collection(collectionName).Indexes().ListSpecifications(ctx)
+			Expect(err).To(Succeed())
+
+			names := make([]string, 0, len(specs))
+			for _, spec := range specs {
+				names = append(names, spec.Name)
+			}
+
+			return names
+		}
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+
+			Expect(db.Collection(collectionName).Drop(ctx)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		It("Missing indexes are created and a second run has nothing to do", func() {
+			changes := reconcile(schema.IndexReconcilerSettings{})
+			Expect(changes).To(HaveLen(2))
+			Expect(changes[0].Type).To(Equal(schema.IndexCreate))
+			Expect(indexNames()).To(ConsistOf("_id_", "uniq_token", "pending_created_at"))
+
+			Expect(reconcile(schema.IndexReconcilerSettings{})).To(BeEmpty())
+		})
+
+		It("Plan alone doesn't change anything", func() {
+			changes, err := schema.NewIndexReconciler(db, declared, schema.IndexReconcilerSettings{}).Plan(ctx)
+			Expect(err).To(Succeed())
+			Expect(changes).To(HaveLen(2))
+
+			_, err = db.Collection(collectionName).InsertOne(ctx, bson.M{"token": "foo"})
+			Expect(err).To(Succeed())
+			Expect(indexNames()).To(ConsistOf("_id_"))
+		})
+
+		It("Drifted options are detected and the index is recreated", func() {
+			_, err := db.Collection(collectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "token", Value: 1}},
+				Options: options.Index().SetName("uniq_token"),
+			})
+			Expect(err).To(Succeed())
+
+			changes := reconcile(schema.IndexReconcilerSettings{})
+			Expect(changes).To(HaveLen(2))
+			Expect(changes[0].Type).To(Equal(schema.IndexRecreate))
+			Expect(changes[0].Name).To(Equal("uniq_token"))
+			Expect(changes[0].Reason).To(ContainSubstring("unique false instead of true"))
+
+			Expect(reconcile(schema.IndexReconcilerSettings{})).To(BeEmpty())
+		})
+
+		It("Unknown indexes are reported unless they may be dropped", func() {
+			_, err := db.Collection(collectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "legacy", Value: 1}},
+				Options: options.Index().SetName("legacy"),
+			})
+			Expect(err).To(Succeed())
+
+			changes := reconcile(schema.IndexReconcilerSettings{})
+			Expect(changes[0].Type).To(Equal(schema.IndexUnknown))
+			Expect(indexNames()).To(ContainElement("legacy"))
+
+			changes = reconcile(schema.IndexReconcilerSettings{DropUnknown: true})
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].Type).To(Equal(schema.IndexDrop))
+			Expect(indexNames()).NotTo(ContainElement("legacy"))
+		})
+
+		It("Every declared index of the app is consistent", func() {
+			for _, c := range schema.Indexes() {
+				names := map[string]bool{}
+
+				for _, spec := range c.Indexes {
+					Expect(names).NotTo(HaveKey(spec.Name), c.Collection+"."+spec.Name)
+					Expect(spec.Keys).NotTo(BeEmpty(), c.Collection+"."+spec.Name)
+
+					names[spec.Name] = true
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,177 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"apart-deal-api/pkg/mongo/schema"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func RegisterSuite(db *mongo.Database) {
+	Describe("Schema migrations", func() {
+		var (
+			ctx      context.Context
+			cancel   context.CancelFunc
+			calls    []string
+			migrator *schema.Migrator
+		)
+
+		step := func(name string) func(ctx context.Context, db *mongo.Database) error {
+			return func(ctx context.Context, db *mongo.Database) error {
+				calls = append(calls, name)
+
+				return nil
+			}
+		}
+
+		migrations := func() []schema.Migration {
+			return []schema.Migration{
+				{Version: 2, Name: "second", Up: step("up 2"), Down: step("down 2")},
+				{Version: 1, Name: "first", Up: step("up 1"), Down: step("down 1")},
+				{Version: 3, Name: "third", Up: step("up 3"), Down: step("down 3")},
+			}
+		}
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+
+			for _, collection := range []string{schema.MigrationsCollectionName, schema.MigrationsLockCollectionName} {
+				_, err := db.Collection(collection).DeleteMany(ctx, bson.M{})
+				Expect(err).To(Succeed())
+			}
+
+			calls = nil
+			migrator = schema.NewMigrator(db, migrations())
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		It("Up applies pending migrations in order and records them", func() {
+			applied, err := migrator.Up(ctx)
+			Expect(err).To(Succeed())
+			Expect(applied).To(HaveLen(3))
+			Expect(calls).To(Equal([]string{"up 1", "up 2", "up 3"}))
+
+			count, err := db.Collection(schema.MigrationsCollectionName).CountDocuments(ctx, bson.M{})
+			Expect(err).To(Succeed())
+			Expect(count).To(Equal(int64(3)))
+
+			calls = nil
+
+			applied, err = migrator.Up(ctx)
+			Expect(err).To(Succeed())
+			Expect(applied).To(BeEmpty())
+			Expect(calls).To(BeEmpty())
+		})
+
+		It("Down reverts the latest applied migration", func() {
+			_, err := migrator.Up(ctx)
+			Expect(err).To(Succeed())
+
+			calls = nil
+
+			reverted, err := migrator.Down(ctx)
+			Expect(err).To(Succeed())
+			Expect(reverted.Version).To(Equal(3))
+			Expect(calls).To(Equal([]string{"down 3"}))
+
+			statuses, err := migrator.Status(ctx)
+			Expect(err).To(Succeed())
+			Expect(statuses).To(HaveLen(3))
+			Expect(statuses[0].AppliedAt).NotTo(BeNil())
+			Expect(statuses[1].AppliedAt).NotTo(BeNil())
+			Expect(statuses[2].AppliedAt).To(BeNil())
+		})
+
+		It("To applies or reverts up to a version", func() {
+			_, err := migrator.To(ctx, 2)
+			Expect(err).To(Succeed())
+			Expect(calls).To(Equal([]string{"up 1", "up 2"}))
+
+			calls = nil
+
+			_, err = migrator.To(ctx, 0)
+			Expect(err).To(Succeed())
+			Expect(calls).To(Equal([]string{"down 2", "down 1"}))
+
+			_, err = migrator.To(ctx, 4)
+			Expect(err).To(BeAssignableToTypeOf(&schema.UnknownMigrationError{}))
+		})
+
+		It("Irreversible migrations stop a rollback before anything is run", func() {
+			list := migrations()
+			list[0].Down = nil
+			migrator = schema.NewMigrator(db, list)
+
+			_, err := migrator.Up(ctx)
+			Expect(err).To(Succeed())
+
+			calls = nil
+
+			_, err = migrator.To(ctx, 1)
+			Expect(err).To(BeAssignableToTypeOf(&schema.IrreversibleMigrationError{}))
+			Expect(calls).To(BeEmpty())
+		})
+
+		It("A failed migration is not recorded", func() {
+			list := migrations()
+			list[2].Up = func(ctx context.Context, db *mongo.Database) error {
+				return fmt.Errorf("boom")
+			}
+			migrator = schema.NewMigrator(db, list)
+
+			applied, err := migrator.Up(ctx)
+			Expect(err).To(MatchError(ContainSubstring("boom")))
+			Expect(applied).To(HaveLen(2))
+
+			Expect(migrator.Verify(ctx)).To(BeAssignableToTypeOf(&schema.SchemaOutdatedError{}))
+		})
+
+		It("Verify fails until every migration is applied", func() {
+			err := migrator.Verify(ctx)
+			Expect(err).To(BeAssignableToTypeOf(&schema.SchemaOutdatedError{}))
+			Expect(err.(*schema.SchemaOutdatedError).Pending).To(Equal([]int{1, 2, 3}))
+
+			_, err = migrator.Up(ctx)
+			Expect(err).To(Succeed())
+
+			Expect(migrator.Verify(ctx)).To(Succeed())
+		})
+
+		It("A held lock blocks other runs until it expires", func() {
+			_, err := db.Collection(schema.MigrationsLockCollectionName).InsertOne(ctx, bson.M{
+				"_id":       "lock",
+				"owner":     "another-replica",
+				"expiresAt": time.Now().Add(time.Minute),
+			})
+			Expect(err).To(Succeed())
+
+			_, err = migrator.Up(ctx)
+			Expect(err).To(BeAssignableToTypeOf(&schema.MigrationsLockedError{}))
+			Expect(calls).To(BeEmpty())
+
+			_, err = db.Collection(schema.MigrationsLockCollectionName).UpdateOne(ctx, bson.M{
+				"_id": "lock",
+			}, bson.M{
+				"$set": bson.M{"expiresAt": time.Now().Add(-time.Minute)},
+			})
+			Expect(err).To(Succeed())
+
+			_, err = migrator.Up(ctx)
+			Expect(err).To(Succeed())
+
+			count, err := db.Collection(schema.MigrationsLockCollectionName).CountDocuments(ctx, bson.M{})
+			Expect(err).To(Succeed())
+			Expect(count).To(BeZero())
+		})
+	})
+}
@@ -0,0 +1,504 @@
+package organization
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"apart-deal-api/dependencies"
+	"apart-deal-api/pkg/api/auth"
+	"apart-deal-api/pkg/config"
+	"apart-deal-api/pkg/mongo/schema"
+	"apart-deal-api/pkg/security"
+	"apart-deal-api/pkg/store/audit"
+	"apart-deal-api/pkg/store/device"
+	"apart-deal-api/pkg/store/notification"
+	"apart-deal-api/pkg/store/organization"
+	"apart-deal-api/pkg/store/session"
+	"apart-deal-api/pkg/store/user"
+	"apart-deal-api/pkg/store/verification"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	orgHandlers "apart-deal-api/pkg/api/handlers/organization"
+	apiServer "apart-deal-api/pkg/api/server"
+	auditDomain "apart-deal-api/pkg/domain/audit"
+	authDomain "apart-deal-api/pkg/domain/auth"
+	deviceDomain "apart-deal-api/pkg/domain/device"
+	identityDomain "apart-deal-api/pkg/domain/identity"
+	orgDomain "apart-deal-api/pkg/domain/organization"
+	pkgTools "apart-deal-api/pkg/tools"
+	testTools "apart-deal-api/tests/tools"
+)
+
+type specContainer struct {
+	fx.In
+
+	Echo           *echo.Echo
+	AuthSvc        *auth.AuthenticationService
+	MembershipRepo organization.MembershipRepository
+}
+
+var constModule = fx.Options(
+	fx.NopLogger,
+	fx.Supply(&config.Config{
+		IsDebug: true,
+	}),
+	fx.Supply(&dependencies.ApiConfig{
+		Port:        37800 + GinkgoParallelProcess(),
+		TokenSecret: "foobar",
+	}),
+	fx.Supply(testTools.NewFastPasswordHasher()),
+	fx.Provide(apiServer.NewServer),
+	fx.Provide(apiServer.NewOrganizationRouteGroup),
+	fx.Provide(user.NewUserRepository),
+	fx.Provide(verification.NewRequestRepository),
+	fx.Supply(auditDomain.DefaultSettings),
+	fx.Provide(audit.NewEventRepository),
+	fx.Provide(auditDomain.NewAuditService),
+	fx.Provide(organization.NewOrganizationRepository),
+	fx.Provide(organization.NewMembershipRepository),
+	fx.Provide(organization.NewInvitationRepository),
+	fx.Provide(notification.NewNotificationRepository),
+	fx.Provide(device.NewKnownDeviceRepository),
+	fx.Provide(authDomain.NewPasswordResetService),
+	fx.Provide(deviceDomain.NewDeviceService),
+	fx.Supply(identityDomain.NewEmailNormalizer(identityDomain.DefaultEmailSettings)),
+	fx.Provide(dependencies.NewAuthenticationService),
+	fx.Supply(auth.DefaultSessionSettings),
+	fx.Provide(session.NewSessionRepository),
+	fx.Provide(auth.NewSessionService),
+	fx.Provide(orgDomain.NewOrganizationService),
+	fx.Provide(security.NewSecretGenerator),
+	fx.Provide(orgDomain.NewInvitationService),
+	fx.Provide(orgHandlers.NewCreateOrganizationHandler),
+	fx.Provide(orgHandlers.NewInviteMemberHandler),
+	fx.Provide(orgHandlers.NewAcceptInvitationHandler),
+	fx.Provide(orgHandlers.NewSelectOrganizationHandler),
+	fx.Invoke(orgHandlers.RegisterCreateOrganizationRoute),
+	fx.Supply(auth.DefaultStepUpRequirement),
+	fx.Invoke(orgHandlers.RegisterInviteMemberRoute),
+	fx.Invoke(orgHandlers.RegisterAcceptInvitationRoute),
+	fx.Invoke(orgHandlers.RegisterSelectOrganizationRoute),
+)
+
+func RegisterSuite(db *mongo.Database) {
+	Describe("Organizations", func() {
+		loggerLvl := zap.NewAtomicLevelAt(zap.ErrorLevel)
+		logger := dependencies.NewLogger(&loggerLvl)
+
+		var (
+			ctx    context.Context
+			cancel context.CancelFunc
+			app    *fx.App
+			spec   *specContainer
+		)
+
+		createUser := func(email string) string {
+			uid := pkgTools.NewUUID().String()
+
+			_, err := db.Collection("users").InsertOne(ctx, user.User{
+				UID:      uid,
+				Name:     "Foo",
+				Email:    email,
+				EmailKey: email,
+				Status:   user.StatusConfirmed,
+			})
+			Expect(err).To(Succeed())
+
+			return uid
+		}
+
+		tokenFor := func(uid string) string {
+			token, err := spec.AuthSvc.Sign(auth.TokenPayload{UserID: uid})
+			Expect(err).To(Succeed())
+
+			return token
+		}
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+
+			for _, collection := range []string{"users", "organizations", "memberships", "invitations", verification.CollectionName} {
+				_, err := db.Collection(collection).DeleteMany(ctx, bson.M{})
+				Expect(err).To(Succeed())
+			}
+
+			app = fx.New(
+				fx.Supply(logger),
+				fx.Supply(db),
+				constModule,
+				fx.Invoke(func(s specContainer) {
+					spec = &s
+				}),
+			)
+
+			appStartCtx, appStartCancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer appStartCancel()
+
+			err := app.Start(appStartCtx)
+			Expect(err).To(Succeed())
+		})
+
+		AfterEach(func() {
+			appStopCtx, appStopCancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer appStopCancel()
+
+			err := app.Stop(appStopCtx)
+			Expect(err).To(Succeed())
+
+			cancel()
+		})
+
+		It("Token is missing", func() {
+			body := bytes.NewBuffer([]byte(`{"name":"Acme"}`))
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/organizations", body)
+			req.Header.Add("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(401))
+			Expect(rec.Body.String()).To(ContainSubstring("no_token"))
+		})
+
+		It("Creates organization with the caller as owner", func() {
+			ownerUID := createUser("owner@bar.baz")
+
+			body := bytes.NewBuffer([]byte(`{"name":"Acme"}`))
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/organizations", body)
+			req.Header.Add("Content-Type", "application/json")
+			req.Header.Add("Authorization", "Bearer "+tokenFor(ownerUID))
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(201))
+			Expect(rec.Body.String()).To(MatchRegexp(`"role":"owner"`))
+
+			count, err := db.Collection("memberships").CountDocuments(ctx, bson.M{
+				"userUid": ownerUID,
+				"role":    organization.RoleOwner,
+			})
+			Expect(err).To(Succeed())
+			Expect(count).To(Equal(int64(1)))
+		})
+
+		It("Inviting needs a recent authentication", func() {
+			ownerUID := createUser("owner@bar.baz")
+			orgUID := pkgTools.NewUUID().String()
+
+			_, err := db.Collection("memberships").InsertOne(ctx, organization.Membership{
+				UID:             pkgTools.NewUUID().String(),
+				OrganizationUID: orgUID,
+				UserUID:         ownerUID,
+				Role:            organization.RoleOwner,
+			})
+			Expect(err).To(Succeed())
+
+			token, err := spec.AuthSvc.Sign(auth.TokenPayload{
+				UserID:   ownerUID,
+				AuthTime: time.Now().Add(-time.Minute * 10),
+			})
+			Expect(err).To(Succeed())
+
+			body := bytes.NewBuffer([]byte(`{"email":"new@bar.baz","role":"admin"}`))
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/organizations/%s/invitations", orgUID), body)
+			req.Header.Add("Content-Type", "application/json")
+			req.Header.Add("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(401))
+			Expect(rec.Body.String()).To(ContainSubstring(`"reason":"step_up_required"`))
+
+			count, err := db.Collection("invitations").CountDocuments(ctx, bson.M{"organizationUid": orgUID})
+			Expect(err).To(Succeed())
+			Expect(count).To(BeZero())
+		})
+
+		It("Member can not invite", func() {
+			memberUID := createUser("member@bar.baz")
+			orgUID := pkgTools.NewUUID().String()
+
+			_, err := db.Collection("memberships").InsertOne(ctx, organization.Membership{
+				UID:             pkgTools.NewUUID().String(),
+				OrganizationUID: orgUID,
+				UserUID:         memberUID,
+				Role:            organization.RoleMember,
+			})
+			Expect(err).To(Succeed())
+
+			_, err = db.Collection("organizations").InsertOne(ctx, organization.Organization{
+				UID:  orgUID,
+				Name: "Acme",
+			})
+			Expect(err).To(Succeed())
+
+			body := bytes.NewBuffer([]byte(`{"email":"new@bar.baz","role":"member"}`))
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/organizations/%s/invitations", orgUID), body)
+			req.Header.Add("Content-Type", "application/json")
+			req.Header.Add("Authorization", "Bearer "+tokenFor(memberUID))
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(401))
+			Expect(rec.Body.String()).To(ContainSubstring("insufficient_role"))
+		})
+
+		It("Existing user accepts invitation and selects organization", func() {
+			userUID := createUser("invitee@bar.baz")
+			orgUID := pkgTools.NewUUID().String()
+
+			_, err := db.Collection("organizations").InsertOne(ctx, organization.Organization{
+				UID:  orgUID,
+				Name: "Acme",
+			})
+			Expect(err).To(Succeed())
+
+			_, err = db.Collection("invitations").InsertOne(ctx, organization.Invitation{
+				UID:             pkgTools.NewUUID().String(),
+				OrganizationUID: orgUID,
+				Email:           "invitee@bar.baz",
+				Role:            organization.RoleAdmin,
+				Token:           security.HashToken("qwe"),
+				Status:          organization.InvitationStatusPending,
+				ExpiresAt:       time.Now().Add(time.Hour),
+			})
+			Expect(err).To(Succeed())
+
+			body := bytes.NewBuffer([]byte(`{"token":"qwe"}`))
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/organizations/invitations/accept", body)
+			req.Header.Add("Content-Type", "application/json")
+			req.Header.Add("Authorization", "Bearer "+tokenFor(userUID))
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(200))
+			Expect(rec.Body.String()).To(ContainSubstring(`"role":"admin"`))
+
+			req = httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/organizations/%s/token", orgUID), nil)
+			req.Header.Add("Authorization", "Bearer "+tokenFor(userUID))
+			rec = httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(200))
+
+			var signedIn struct {
+				Token string `json:"token"`
+			}
+			Expect(json.Unmarshal(rec.Body.Bytes(), &signedIn)).To(Succeed())
+
+			payload, err := spec.AuthSvc.Verify(signedIn.Token)
+			Expect(err).To(Succeed())
+			Expect(payload.OrganizationID).To(Equal(orgUID))
+			Expect(payload.Role).To(Equal(string(organization.RoleAdmin)))
+		})
+
+		It("Invitation tokens are stored hashed and mailed once", func() {
+			ownerUID := createUser("owner@bar.baz")
+			inviteeUID := createUser("invitee@bar.baz")
+			orgUID := pkgTools.NewUUID().String()
+
+			_, err := db.Collection("organizations").InsertOne(ctx, organization.Organization{
+				UID:  orgUID,
+				Name: "Acme",
+			})
+			Expect(err).To(Succeed())
+
+			_, err = db.Collection("memberships").InsertOne(ctx, organization.Membership{
+				UID:             pkgTools.NewUUID().String(),
+				OrganizationUID: orgUID,
+				UserUID:         ownerUID,
+				Role:            organization.RoleOwner,
+			})
+			Expect(err).To(Succeed())
+
+			body := bytes.NewBuffer([]byte(`{"email":"invitee@bar.baz","role":"member"}`))
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/organizations/%s/invitations", orgUID), body)
+			req.Header.Add("Content-Type", "application/json")
+			req.Header.Add("Authorization", "Bearer "+tokenFor(ownerUID))
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(201))
+
+			var stored organization.Invitation
+			Expect(db.Collection("invitations").FindOne(ctx, bson.M{"organizationUid": orgUID}).Decode(&stored)).To(Succeed())
+			Expect(stored.MailToken).NotTo(BeEmpty())
+			Expect(stored.Token).To(Equal(security.HashToken(stored.MailToken)))
+
+			invitationRepo := organization.NewInvitationRepository(db)
+			Expect(invitationRepo.SaveNotifiedTime(ctx, stored.UID, time.Now())).To(Succeed())
+
+			notified, err := invitationRepo.FindByUID(ctx, stored.UID)
+			Expect(err).To(Succeed())
+			Expect(notified.MailToken).To(BeEmpty())
+
+			body = bytes.NewBuffer([]byte(fmt.Sprintf(`{"token":"%s"}`, stored.MailToken)))
+			req = httptest.NewRequest(http.MethodPost, "/api/v1/organizations/invitations/accept", body)
+			req.Header.Add("Content-Type", "application/json")
+			req.Header.Add("Authorization", "Bearer "+tokenFor(inviteeUID))
+			rec = httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(200))
+		})
+
+		It("Invitations created before tokens were hashed are accepted", func() {
+			userUID := createUser("invitee@bar.baz")
+
+			_, err := db.Collection("invitations").InsertOne(ctx, organization.Invitation{
+				UID:             pkgTools.NewUUID().String(),
+				OrganizationUID: pkgTools.NewUUID().String(),
+				Email:           "invitee@bar.baz",
+				Role:            organization.RoleMember,
+				Token:           "qwe",
+				Status:          organization.InvitationStatusPending,
+				ExpiresAt:       time.Now().Add(time.Hour),
+			})
+			Expect(err).To(Succeed())
+
+			body := bytes.NewBuffer([]byte(`{"token":"qwe"}`))
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/organizations/invitations/accept", body)
+			req.Header.Add("Content-Type", "application/json")
+			req.Header.Add("Authorization", "Bearer "+tokenFor(userUID))
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(200))
+		})
+
+		It("Invitation whose membership already exists is accepted again", func() {
+			userUID := createUser("invitee@bar.baz")
+			orgUID := pkgTools.NewUUID().String()
+			invitationUID := pkgTools.NewUUID().String()
+
+			// memberships are unique with the declared indexes
+			var declared []schema.CollectionIndexes
+			for _, c := range schema.Indexes() {
+				if c.Collection == "memberships" {
+					declared = append(declared, c)
+				}
+			}
+
+			reconciler := schema.NewIndexReconciler(db, declared, schema.IndexReconcilerSettings{})
+			changes, err := reconciler.Plan(ctx)
+			Expect(err).To(Succeed())
+			Expect(reconciler.Apply(ctx, changes)).To(Succeed())
+
+			// the membership of an accept which failed before marking the invitation
+			_, err = db.Collection("memberships").InsertOne(ctx, organization.Membership{
+				UID:             pkgTools.NewUUID().String(),
+				OrganizationUID: orgUID,
+				UserUID:         userUID,
+				Role:            organization.RoleMember,
+				InvitationUID:   invitationUID,
+			})
+			Expect(err).To(Succeed())
+
+			_, err = db.Collection("invitations").InsertOne(ctx, organization.Invitation{
+				UID:             invitationUID,
+				OrganizationUID: orgUID,
+				Email:           "invitee@bar.baz",
+				Role:            organization.RoleMember,
+				Token:           security.HashToken("qwe"),
+				Status:          organization.InvitationStatusPending,
+				ExpiresAt:       time.Now().Add(time.Hour),
+			})
+			Expect(err).To(Succeed())
+
+			body := bytes.NewBuffer([]byte(`{"token":"qwe"}`))
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/organizations/invitations/accept", body)
+			req.Header.Add("Content-Type", "application/json")
+			req.Header.Add("Authorization", "Bearer "+tokenFor(userUID))
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(200))
+
+			count, err := db.Collection("invitations").CountDocuments(ctx, bson.M{
+				"_id":    invitationUID,
+				"status": organization.InvitationStatusAccepted,
+			})
+			Expect(err).To(Succeed())
+			Expect(count).To(Equal(int64(1)))
+
+			// accepted already
+			body = bytes.NewBuffer([]byte(`{"token":"qwe"}`))
+			req = httptest.NewRequest(http.MethodPost, "/api/v1/organizations/invitations/accept", body)
+			req.Header.Add("Content-Type", "application/json")
+			req.Header.Add("Authorization", "Bearer "+tokenFor(userUID))
+			rec = httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(404))
+		})
+
+		It("Members can't accept another invitation to their organization", func() {
+			userUID := createUser("invitee@bar.baz")
+			orgUID := pkgTools.NewUUID().String()
+			invitationUID := pkgTools.NewUUID().String()
+
+			var declared []schema.CollectionIndexes
+			for _, c := range schema.Indexes() {
+				if c.Collection == "memberships" {
+					declared = append(declared, c)
+				}
+			}
+
+			reconciler := schema.NewIndexReconciler(db, declared, schema.IndexReconcilerSettings{})
+			changes, err := reconciler.Plan(ctx)
+			Expect(err).To(Succeed())
+			Expect(reconciler.Apply(ctx, changes)).To(Succeed())
+
+			_, err = db.Collection("memberships").InsertOne(ctx, organization.Membership{
+				UID:             pkgTools.NewUUID().String(),
+				OrganizationUID: orgUID,
+				UserUID:         userUID,
+				Role:            organization.RoleMember,
+			})
+			Expect(err).To(Succeed())
+
+			_, err = db.Collection("invitations").InsertOne(ctx, organization.Invitation{
+				UID:             invitationUID,
+				OrganizationUID: orgUID,
+				Email:           "invitee@bar.baz",
+				Role:            organization.RoleAdmin,
+				Token:           security.HashToken("qwe"),
+				Status:          organization.InvitationStatusPending,
+				ExpiresAt:       time.Now().Add(time.Hour),
+			})
+			Expect(err).To(Succeed())
+
+			body := bytes.NewBuffer([]byte(`{"token":"qwe"}`))
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/organizations/invitations/accept", body)
+			req.Header.Add("Content-Type", "application/json")
+			req.Header.Add("Authorization", "Bearer "+tokenFor(userUID))
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(409))
+
+			membership, err := spec.MembershipRepo.FindByOrganizationAndUser(ctx, orgUID, userUID)
+			Expect(err).To(Succeed())
+			Expect(membership.Role).To(Equal(organization.RoleMember))
+
+			count, err := db.Collection("invitations").CountDocuments(ctx, bson.M{
+				"_id":    invitationUID,
+				"status": organization.InvitationStatusPending,
+			})
+			Expect(err).To(Succeed())
+			Expect(count).To(Equal(int64(1)))
+		})
+	})
+}
@@ -0,0 +1,73 @@
+package passwordhash
+
+import (
+	"bytes"
+	"strings"
+
+	"apart-deal-api/pkg/security"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	testTools "apart-deal-api/tests/tools"
+)
+
+// RegisterSuite describes the verification of password hashes, it needs no database
+func RegisterSuite() {
+	Describe("Password hashes", func() {
+		var hasher *security.PasswordHasher
+
+		salt := bytes.Repeat([]byte{1}, 16)
+		key := bytes.Repeat([]byte{2}, 32)
+
+		BeforeEach(func() {
+			hasher = testTools.NewFastPasswordHasher()
+		})
+
+		It("Hashes are verified", func() {
+			encoded, err := hasher.Hash("correct-horse")
+			Expect(err).To(Succeed())
+
+			ok, needsRehash, err := hasher.Verify("correct-horse", encoded)
+			Expect(err).To(Succeed())
+			Expect(ok).To(BeTrue())
+			Expect(needsRehash).To(BeFalse())
+
+			ok, _, err = hasher.Verify("wrong-horse", encoded)
+			Expect(err).To(Succeed())
+			Expect(ok).To(BeFalse())
+		})
+
+		DescribeTable("Parameters out of range are rejected before hashing",
+			func(encoded string) {
+				ok, _, err := hasher.Verify("correct-horse", encoded)
+				Expect(err).To(MatchError(ContainSubstring("out of range")))
+				Expect(ok).To(BeFalse())
+			},
+			Entry("pbkdf2 iterations", security.EncodePbkdf2Sha256(security.MaxPbkdf2Iterations+1, salt, key)),
+			Entry("pbkdf2 empty key", security.EncodePbkdf2Sha256(1000, salt, nil)),
+			Entry("scrypt memory", security.EncodeScrypt(1<<20, 8, 1, salt, key)),
+			Entry("scrypt parallelism", security.EncodeScrypt(1024, 8, security.MaxScryptParallelism+1, salt, key)),
+			Entry("scrypt long key", security.EncodeScrypt(1024, 8, 1, salt, bytes.Repeat([]byte{2}, security.MaxHashKeyLength+1))),
+			Entry("argon2id memory", "$argon2id$v=19$m=4194304,t=1,p=1$AQEBAQEBAQEBAQEBAQEBAQ$AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI"),
+			Entry("argon2id iterations", "$argon2id$v=19$m=1024,t=1000,p=1$AQEBAQEBAQEBAQEBAQEBAQ$AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI"),
+			Entry("argon2id parallelism", "$argon2id$v=19$m=1024,t=1,p=0$AQEBAQEBAQEBAQEBAQEBAQ$AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI"),
+		)
+
+		It("bcrypt doesn't hash passwords it would truncate", func() {
+			bcrypt := security.NewBcryptAlgorithm(security.BcryptParams{Cost: 4})
+
+			longest := strings.Repeat("a", security.BcryptMaxPasswordBytes)
+
+			encoded, err := bcrypt.Hash(longest)
+			Expect(err).To(Succeed())
+
+			ok, err := bcrypt.Verify(longest, encoded)
+			Expect(err).To(Succeed())
+			Expect(ok).To(BeTrue())
+
+			_, err = bcrypt.Hash(longest + "b")
+			Expect(err).To(BeAssignableToTypeOf(&security.PasswordTooLongError{}))
+		})
+	})
+}
@@ -0,0 +1,134 @@
+package passwordpolicy
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+
+	"apart-deal-api/pkg/security"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// RegisterSuite describes the password policy and the breached-password corpora, they need
+// no database
+func RegisterSuite() {
+	Describe("Password policy", func() {
+		codes := func(violations []security.PasswordViolation) []string {
+			result := make([]string, 0, len(violations))
+			for _, v := range violations {
+				result = append(result, v.Code)
+			}
+
+			return result
+		}
+
+		DescribeTable("Rules",
+			func(cfg security.PasswordPolicyConfig, password string, expected []string) {
+				policy := security.NewPasswordPolicy(cfg, nil)
+
+				Expect(codes(policy.Check(password))).To(ConsistOf(expected))
+			},
+			Entry("Long enough", security.PasswordPolicyConfig{MinLength: 8}, "abcdefgh", []string{}),
+			Entry("Too short", security.PasswordPolicyConfig{MinLength: 8}, "abcdefg", []string{"too_short"}),
+			Entry("Length counts characters, not bytes", security.PasswordPolicyConfig{MinLength: 4}, "пароль", []string{}),
+			Entry("Too long stops the other checks",
+				security.PasswordPolicyConfig{MaxLength: 4, RequireDigit: true, MinEntropyBits: 100}, "abcde", []string{"too_long"}),
+			Entry("Max bytes counts bytes", security.PasswordPolicyConfig{MaxLength: 128, MaxBytes: 72},
+				strings.Repeat("é", 37), []string{"too_long"}),
+			Entry("Max length is capped", security.PasswordPolicyConfig{MaxLength: 1000},
+				strings.Repeat("a", security.MaxAcceptedPasswordLength+1), []string{"too_long"}),
+			Entry("Missing classes",
+				security.PasswordPolicyConfig{RequireLower: true, RequireUpper: true, RequireDigit: true, RequireSymbol: true},
+				"abc", []string{"missing_uppercase", "missing_digit", "missing_symbol"}),
+			Entry("Every class", security.PasswordPolicyConfig{RequireLower: true, RequireUpper: true, RequireDigit: true, RequireSymbol: true},
+				"aB1!", []string{}),
+			Entry("Not enough classes", security.PasswordPolicyConfig{MinCharClasses: 3}, "abcD", []string{"not_enough_char_classes"}),
+			Entry("Non-ASCII letters count as symbols", security.PasswordPolicyConfig{MinCharClasses: 2}, "abcé", []string{}),
+			Entry("Repeated characters are weak", security.PasswordPolicyConfig{MinEntropyBits: 28}, "aaaaaaaaaaaaaaaa", []string{"too_weak"}),
+			Entry("Varied characters are strong", security.PasswordPolicyConfig{MinEntropyBits: 28}, "correct-horse", []string{}),
+		)
+
+		It("Breached passwords are reported", func() {
+			corpus, err := security.ReadSha1Corpus(strings.NewReader(digestOf("hunter22") + ":42\n"))
+			Expect(err).To(Succeed())
+
+			policy := security.NewPasswordPolicy(security.DefaultPasswordPolicyConfig, corpus)
+
+			Expect(codes(policy.Check("hunter22"))).To(ContainElement("breached"))
+			Expect(codes(policy.Check("correct-horse-battery"))).To(BeEmpty())
+		})
+	})
+
+	Describe("Breached passwords", func() {
+		It("SHA-1 corpus finds listed passwords only", func() {
+			corpus, err := security.ReadSha1Corpus(strings.NewReader(strings.Join([]string{
+				"# comment",
+				strings.ToUpper(digestOf("first")) + ":3",
+				"",
+				digestOf("second"),
+			}, "\n")))
+			Expect(err).To(Succeed())
+
+			Expect(corpus.IsBreached("first")).To(BeTrue())
+			Expect(corpus.IsBreached("second")).To(BeTrue())
+			Expect(corpus.IsBreached("third")).To(BeFalse())
+		})
+
+		It("SHA-1 corpus rejects malformed digests", func() {
+			_, err := security.ReadSha1Corpus(strings.NewReader("not-a-digest\n"))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Bloom filter has no false negatives and about the chosen false positive rate", func() {
+			const (
+				n      = 2000
+				fpRate = 0.01
+			)
+
+			// sized the same way as apart-deal-breached-bloom
+			m := uint64(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+			k := uint32(math.Max(1, math.Round(float64(m)/float64(n)*math.Ln2)))
+
+			filter := security.NewBloomFilter(m, k)
+			for i := 0; i < n; i++ {
+				filter.Add(fmt.Sprintf("breached-%d", i))
+			}
+
+			var buf bytes.Buffer
+			_, err := filter.WriteTo(&buf)
+			Expect(err).To(Succeed())
+
+			read, err := security.ReadBloomFilter(&buf)
+			Expect(err).To(Succeed())
+
+			for i := 0; i < n; i++ {
+				Expect(read.IsBreached(fmt.Sprintf("breached-%d", i))).To(BeTrue())
+			}
+
+			falsePositives := 0
+			for i := 0; i < n*10; i++ {
+				if read.IsBreached(fmt.Sprintf("safe-%d", i)) {
+					falsePositives++
+				}
+			}
+
+			Expect(float64(falsePositives) / float64(n*10)).To(BeNumerically("<", fpRate*3))
+		})
+
+		It("Bloom filter rejects other files", func() {
+			_, err := security.ReadBloomFilter(strings.NewReader(digestOf("first")))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+}
+
+func digestOf(password string) string {
+	digest := sha1.Sum([]byte(password))
+
+	return hex.EncodeToString(digest[:])
+}
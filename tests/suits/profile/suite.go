@@ -0,0 +1,337 @@
+package profile
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"apart-deal-api/dependencies"
+	"apart-deal-api/pkg/api/auth"
+	"apart-deal-api/pkg/config"
+	"apart-deal-api/pkg/security"
+	"apart-deal-api/pkg/store/audit"
+	"apart-deal-api/pkg/store/device"
+	"apart-deal-api/pkg/store/notification"
+	"apart-deal-api/pkg/store/session"
+	"apart-deal-api/pkg/store/user"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	authHandlers "apart-deal-api/pkg/api/handlers/auth"
+	challengeHandlers "apart-deal-api/pkg/api/handlers/challenge"
+	userHandlers "apart-deal-api/pkg/api/handlers/user"
+	apiServer "apart-deal-api/pkg/api/server"
+	auditDomain "apart-deal-api/pkg/domain/audit"
+	deviceDomain "apart-deal-api/pkg/domain/device"
+	identityDomain "apart-deal-api/pkg/domain/identity"
+	profileDomain "apart-deal-api/pkg/domain/profile"
+	pkgTools "apart-deal-api/pkg/tools"
+	testTools "apart-deal-api/tests/tools"
+	oas "gitlab.com/apart-deals/openapi/go/api"
+)
+
+type specContainer struct {
+	fx.In
+
+	Echo     *echo.Echo
+	Hasher   *security.PasswordHasher
+	AuthSvc  *auth.AuthenticationService
+	UserRepo user.UserRepository
+}
+
+var constModule = fx.Options(
+	fx.NopLogger,
+	fx.Supply(&config.Config{
+		IsDebug: true,
+	}),
+	fx.Supply(&dependencies.ApiConfig{
+		Port:        37900 + GinkgoParallelProcess(),
+		TokenSecret: "foobar",
+	}),
+	fx.Supply(testTools.NewFastPasswordHasher()),
+	fx.Supply(auditDomain.DefaultSettings),
+	fx.Provide(apiServer.NewServer),
+	fx.Supply(challengeHandlers.NewGuard(nil, nil)),
+	fx.Provide(apiServer.NewAuthRouteGroup),
+	fx.Provide(apiServer.NewUserRouteGroup),
+	fx.Provide(user.NewUserRepository),
+	fx.Provide(audit.NewEventRepository),
+	fx.Provide(device.NewKnownDeviceRepository),
+	fx.Provide(notification.NewNotificationRepository),
+	fx.Provide(security.NewSecretGenerator),
+	fx.Provide(auditDomain.NewAuditService),
+	fx.Provide(deviceDomain.NewDeviceService),
+	fx.Provide(profileDomain.NewProfileService),
+	fx.Supply(identityDomain.NewEmailNormalizer(identityDomain.DefaultEmailSettings)),
+	fx.Provide(dependencies.NewAuthenticationService),
+	fx.Supply(auth.DefaultSessionSettings),
+	fx.Provide(session.NewSessionRepository),
+	fx.Provide(auth.NewSessionService),
+	fx.Provide(authHandlers.NewSignInHandler),
+	fx.Provide(userHandlers.NewGetProfileHandler),
+	fx.Provide(userHandlers.NewUpdateProfileHandler),
+	fx.Provide(userHandlers.NewUserInfoHandler),
+	fx.Invoke(authHandlers.RegisterSignInRoute),
+	fx.Invoke(userHandlers.RegisterGetProfileRoute),
+	fx.Invoke(userHandlers.RegisterUpdateProfileRoute),
+	fx.Invoke(userHandlers.RegisterUserInfoRoute),
+)
+
+func RegisterSuite(db *mongo.Database) {
+	Describe("Profile", func() {
+		loggerLvl := zap.NewAtomicLevelAt(zap.ErrorLevel)
+		logger := dependencies.NewLogger(&loggerLvl)
+
+		var (
+			ctx     context.Context
+			cancel  context.CancelFunc
+			app     *fx.App
+			spec    *specContainer
+			userUID string
+			token   string
+		)
+
+		requestWithHeaders := func(method string, path string, body string, headers map[string]string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, bytes.NewBuffer([]byte(body)))
+			req.Header.Add("Content-Type", "application/json")
+			req.Header.Add("Authorization", "Bearer "+token)
+			for name, value := range headers {
+				req.Header.Add(name, value)
+			}
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			return rec
+		}
+
+		request := func(method string, path string, body string) *httptest.ResponseRecorder {
+			return requestWithHeaders(method, path, body, nil)
+		}
+
+		signIn := func() string {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/sign-in", bytes.NewBuffer([]byte(`{"email":"foo@bar.baz","password":"my_secret"}`)))
+			req.Header.Add("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+			Expect(rec.Code).To(Equal(200))
+
+			var signedIn oas.SignedIn
+			Expect(json.Unmarshal(rec.Body.Bytes(), &signedIn)).To(Succeed())
+
+			return signedIn.Token
+		}
+
+		getProfile := func() oas.Profile {
+			rec := request(http.MethodGet, "/api/v1/users/me/profile", "")
+			Expect(rec.Code).To(Equal(200))
+
+			var profile oas.Profile
+			Expect(json.Unmarshal(rec.Body.Bytes(), &profile)).To(Succeed())
+
+			return profile
+		}
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+
+			for _, collection := range []string{"users", "known_devices", "notifications", "audit_events", "sessions"} {
+				_, err := db.Collection(collection).DeleteMany(ctx, bson.M{})
+				Expect(err).To(Succeed())
+			}
+
+			app = fx.New(
+				fx.Supply(logger),
+				fx.Supply(db),
+				constModule,
+				fx.Invoke(func(s specContainer) {
+					spec = &s
+				}),
+			)
+
+			appStartCtx, appStartCancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer appStartCancel()
+
+			err := app.Start(appStartCtx)
+			Expect(err).To(Succeed())
+
+			passHash, err := spec.Hasher.Hash("my_secret")
+			Expect(err).To(Succeed())
+
+			userUID = pkgTools.NewUUID().String()
+
+			_, err = db.Collection("users").InsertOne(ctx, bson.M{
+				"_id":          userUID,
+				"name":         "Foo",
+				"email":        "foo@bar.baz",
+				"emailKey":     "foo@bar.baz",
+				"passwordHash": passHash,
+				"status":       user.StatusConfirmed,
+				"createdAt":    time.Now(),
+			})
+			Expect(err).To(Succeed())
+
+			token = signIn()
+		})
+
+		AfterEach(func() {
+			appStopCtx, appStopCancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer appStopCancel()
+
+			err := app.Stop(appStopCtx)
+			Expect(err).To(Succeed())
+
+			cancel()
+		})
+
+		It("Profile of a user created before profiles is returned", func() {
+			profile := getProfile()
+
+			Expect(profile.Name).To(Equal("Foo"))
+			Expect(profile.Email).To(Equal("foo@bar.baz"))
+			Expect(profile.Locale).To(BeEmpty())
+			Expect(profile.Version).To(Equal(int32(0)))
+		})
+
+		It("Only the given fields are updated", func() {
+			rec := request(http.MethodPatch, "/api/v1/users/me/profile", `{"version":0,"locale":"de-CH","timezone":"Europe/Zurich"}`)
+			Expect(rec.Code).To(Equal(200))
+
+			rec = request(http.MethodPatch, "/api/v1/users/me/profile", `{"version":1,"avatarUrl":"https://cdn.example.com/foo.png"}`)
+			Expect(rec.Code).To(Equal(200))
+
+			profile := getProfile()
+			Expect(profile.Name).To(Equal("Foo"))
+			Expect(profile.Locale).To(Equal("de-CH"))
+			Expect(profile.Timezone).To(Equal("Europe/Zurich"))
+			Expect(profile.AvatarUrl).To(Equal("https://cdn.example.com/foo.png"))
+			Expect(profile.Version).To(Equal(int32(2)))
+			Expect(profile.UpdatedAt).NotTo(BeNil())
+		})
+
+		It("An empty string clears a field", func() {
+			Expect(request(http.MethodPatch, "/api/v1/users/me/profile", `{"version":0,"locale":"fr"}`).Code).To(Equal(200))
+			Expect(request(http.MethodPatch, "/api/v1/users/me/profile", `{"version":1,"locale":""}`).Code).To(Equal(200))
+
+			Expect(getProfile().Locale).To(BeEmpty())
+		})
+
+		It("Update based on a stale version is rejected", func() {
+			Expect(request(http.MethodPatch, "/api/v1/users/me/profile", `{"version":0,"name":"Phone"}`).Code).To(Equal(200))
+
+			rec := request(http.MethodPatch, "/api/v1/users/me/profile", `{"version":0,"name":"Laptop"}`)
+			Expect(rec.Code).To(Equal(409))
+
+			Expect(getProfile().Name).To(Equal("Phone"))
+		})
+
+		It("Profile carries its version as ETag", func() {
+			rec := request(http.MethodGet, "/api/v1/users/me/profile", "")
+			Expect(rec.Code).To(Equal(200))
+			Expect(rec.Header().Get("ETag")).To(Equal(`"0"`))
+
+			rec = requestWithHeaders(http.MethodGet, "/api/v1/users/me/profile", "", map[string]string{"If-None-Match": `"0"`})
+			Expect(rec.Code).To(Equal(304))
+
+			rec = request(http.MethodPatch, "/api/v1/users/me/profile", `{"version":0,"name":"Phone"}`)
+			Expect(rec.Code).To(Equal(200))
+			Expect(rec.Header().Get("ETag")).To(Equal(`"1"`))
+
+			rec = requestWithHeaders(http.MethodGet, "/api/v1/users/me/profile", "", map[string]string{"If-None-Match": `"0"`})
+			Expect(rec.Code).To(Equal(200))
+		})
+
+		It("If-Match takes precedence over the version of the body", func() {
+			rec := requestWithHeaders(http.MethodPatch, "/api/v1/users/me/profile", `{"version":5,"name":"Phone"}`, map[string]string{"If-Match": `"0"`})
+			Expect(rec.Code).To(Equal(200))
+
+			rec = requestWithHeaders(http.MethodPatch, "/api/v1/users/me/profile", `{"version":1,"name":"Laptop"}`, map[string]string{"If-Match": `"0"`})
+			Expect(rec.Code).To(Equal(412))
+
+			rec = requestWithHeaders(http.MethodPatch, "/api/v1/users/me/profile", `{"version":1,"name":"Laptop"}`, map[string]string{"If-Match": `W/"1"`})
+			Expect(rec.Code).To(Equal(400))
+
+			Expect(getProfile().Name).To(Equal("Phone"))
+		})
+
+		It("Any update of the user makes the version read with the profile stale", func() {
+			Expect(spec.UserRepo.RequirePasswordReset(ctx, userUID, 0, false, time.Now())).To(Succeed())
+
+			rec := request(http.MethodPatch, "/api/v1/users/me/profile", `{"version":0,"name":"Phone"}`)
+			Expect(rec.Code).To(Equal(409))
+
+			Expect(spec.UserRepo.RequirePasswordReset(ctx, userUID, 0, false, time.Now())).
+				To(BeAssignableToTypeOf(&user.ConcurrentModificationError{}))
+			Expect(spec.UserRepo.RequirePasswordReset(ctx, pkgTools.NewUUID().String(), 0, false, time.Now())).
+				To(Equal(mongo.ErrNoDocuments))
+
+			Expect(getProfile().Version).To(Equal(int32(1)))
+		})
+
+		It("Retries apply an update to the latest version", func() {
+			attempts := 0
+
+			err := user.RetryOnConflict(ctx, spec.UserRepo, userUID, user.DefaultRetryAttempts, func(u *user.User) error {
+				attempts++
+
+				// another update lands between the read and the first attempt
+				if attempts == 1 {
+					Expect(spec.UserRepo.UpdatePasswordHash(ctx, u.UID, u.Version, u.PasswordHash)).To(Succeed())
+				}
+
+				return spec.UserRepo.RequirePasswordReset(ctx, u.UID, u.Version, false, time.Now())
+			})
+			Expect(err).To(Succeed())
+			Expect(attempts).To(Equal(2))
+
+			userModel, err := spec.UserRepo.FindByUID(ctx, userUID)
+			Expect(err).To(Succeed())
+			Expect(userModel.PasswordResetRequired).To(BeTrue())
+			Expect(userModel.Version).To(Equal(2))
+		})
+
+		DescribeTable("Invalid fields are rejected",
+			func(body string) {
+				rec := request(http.MethodPatch, "/api/v1/users/me/profile", body)
+				Expect(rec.Code).To(Equal(400))
+
+				Expect(getProfile().Version).To(Equal(int32(0)))
+			},
+			Entry("blank name", `{"version":0,"name":""}`),
+			Entry("locale", `{"version":0,"locale":"not a locale"}`),
+			Entry("timezone", `{"version":0,"timezone":"Mars/Olympus"}`),
+			Entry("local timezone", `{"version":0,"timezone":"Local"}`),
+			Entry("avatar url", `{"version":0,"avatarUrl":"not a url"}`),
+			Entry("plain http avatar url", `{"version":0,"avatarUrl":"http://cdn.example.com/foo.png"}`),
+		)
+
+		It("Tokens and userinfo carry the profile claims", func() {
+			Expect(request(http.MethodPatch, "/api/v1/users/me/profile", `{"version":0,"locale":"en-GB","timezone":"Europe/London","avatarUrl":"https://cdn.example.com/foo.png"}`).Code).To(Equal(200))
+
+			payload, err := spec.AuthSvc.Verify(signIn())
+			Expect(err).To(Succeed())
+			Expect(payload.Name).To(Equal("Foo"))
+			Expect(payload.Locale).To(Equal("en-GB"))
+			Expect(payload.Zoneinfo).To(Equal("Europe/London"))
+
+			rec := request(http.MethodGet, "/api/v1/users/me/userinfo", "")
+			Expect(rec.Code).To(Equal(200))
+
+			var userInfo oas.UserInfo
+			Expect(json.Unmarshal(rec.Body.Bytes(), &userInfo)).To(Succeed())
+			Expect(userInfo.Sub).To(Equal(userUID))
+			Expect(userInfo.EmailVerified).To(BeTrue())
+			Expect(userInfo.Zoneinfo).To(Equal("Europe/London"))
+			Expect(userInfo.Picture).To(Equal("https://cdn.example.com/foo.png"))
+		})
+	})
+}
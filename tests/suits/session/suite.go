@@ -0,0 +1,312 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"apart-deal-api/dependencies"
+	"apart-deal-api/pkg/api/auth"
+	"apart-deal-api/pkg/config"
+	"apart-deal-api/pkg/security"
+	"apart-deal-api/pkg/store/audit"
+	"apart-deal-api/pkg/store/device"
+	"apart-deal-api/pkg/store/notification"
+	"apart-deal-api/pkg/store/session"
+	"apart-deal-api/pkg/store/user"
+	"apart-deal-api/pkg/store/verification"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	authHandlers "apart-deal-api/pkg/api/handlers/auth"
+	challengeHandlers "apart-deal-api/pkg/api/handlers/challenge"
+	apiServer "apart-deal-api/pkg/api/server"
+	auditDomain "apart-deal-api/pkg/domain/audit"
+	authDomain "apart-deal-api/pkg/domain/auth"
+	deviceDomain "apart-deal-api/pkg/domain/device"
+	identityDomain "apart-deal-api/pkg/domain/identity"
+	pkgTools "apart-deal-api/pkg/tools"
+	testTools "apart-deal-api/tests/tools"
+	oas "gitlab.com/apart-deals/openapi/go/api"
+)
+
+type specContainer struct {
+	fx.In
+
+	Echo   *echo.Echo
+	Hasher *security.PasswordHasher
+}
+
+var constModule = fx.Options(
+	fx.NopLogger,
+	fx.Supply(&config.Config{
+		IsDebug: true,
+	}),
+	fx.Supply(&dependencies.ApiConfig{
+		Port:        37800 + GinkgoParallelProcess(),
+		TokenSecret: "foobar",
+	}),
+	fx.Supply(testTools.NewFastPasswordHasher()),
+	fx.Supply(auditDomain.DefaultSettings),
+	fx.Provide(apiServer.NewServer),
+	fx.Supply(challengeHandlers.NewGuard(nil, nil)),
+	fx.Provide(apiServer.NewAuthRouteGroup),
+	fx.Provide(user.NewUserRepository),
+	fx.Provide(verification.NewRequestRepository),
+	fx.Provide(audit.NewEventRepository),
+	fx.Provide(device.NewKnownDeviceRepository),
+	fx.Provide(notification.NewNotificationRepository),
+	fx.Provide(security.NewSecretGenerator),
+	fx.Provide(auditDomain.NewAuditService),
+	fx.Provide(authDomain.NewPasswordResetService),
+	fx.Provide(deviceDomain.NewDeviceService),
+	fx.Supply(identityDomain.NewEmailNormalizer(identityDomain.DefaultEmailSettings)),
+	fx.Provide(dependencies.NewAuthenticationService),
+	fx.Supply(auth.DefaultSessionSettings),
+	fx.Provide(session.NewSessionRepository),
+	fx.Provide(auth.NewSessionService),
+	fx.Provide(authHandlers.NewSignInHandler),
+	fx.Provide(authHandlers.NewSignOutHandler),
+	fx.Invoke(authHandlers.RegisterSignInRoute),
+	fx.Invoke(authHandlers.RegisterSignOutRoute),
+	fx.Invoke(func(e *echo.Echo, authSvc *auth.AuthenticationService, sessionSvc *auth.SessionService) {
+		ok := func(c echo.Context) error {
+			return c.NoContent(http.StatusNoContent)
+		}
+
+		e.GET("/protected", ok, auth.NewAuthMiddleware(authSvc, sessionSvc))
+		e.POST("/protected", ok, auth.NewAuthMiddleware(authSvc, sessionSvc))
+		e.GET("/profile", func(c echo.Context) error {
+			payload := auth.PayloadFromContext(c)
+
+			return c.String(http.StatusOK, payload.Name+" <"+payload.Email+">")
+		}, auth.NewAuthMiddleware(authSvc, sessionSvc))
+	}),
+)
+
+func RegisterSuite(db *mongo.Database) {
+	Describe("Cookie sessions", func() {
+		loggerLvl := zap.NewAtomicLevelAt(zap.ErrorLevel)
+		logger := dependencies.NewLogger(&loggerLvl)
+
+		var (
+			ctx    context.Context
+			cancel context.CancelFunc
+			app    *fx.App
+			spec   *specContainer
+		)
+
+		request := func(method string, path string, body string, modify func(req *http.Request)) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, bytes.NewBuffer([]byte(body)))
+			req.Header.Add("Content-Type", "application/json")
+			if modify != nil {
+				modify(req)
+			}
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			return rec
+		}
+
+		findCookie := func(rec *httptest.ResponseRecorder, name string) *http.Cookie {
+			for _, cookie := range rec.Result().Cookies() {
+				if cookie.Name == name {
+					return cookie
+				}
+			}
+
+			return nil
+		}
+
+		withCookies := func(cookies ...*http.Cookie) func(req *http.Request) {
+			return func(req *http.Request) {
+				for _, cookie := range cookies {
+					req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+				}
+			}
+		}
+
+		signIn := func() (*http.Cookie, *http.Cookie) {
+			rec := request(http.MethodPost, "/api/v1/auth/sign-in", `{"email":"foo@bar.baz","password":"my_secret","useCookie":true}`, nil)
+			Expect(rec.Code).To(Equal(200))
+
+			sessionCookie := findCookie(rec, auth.DefaultSessionSettings.CookieName)
+			csrfCookie := findCookie(rec, auth.DefaultSessionSettings.CSRFCookieName)
+			Expect(sessionCookie).NotTo(BeNil())
+			Expect(csrfCookie).NotTo(BeNil())
+
+			return sessionCookie, csrfCookie
+		}
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+
+			for _, collection := range []string{"users", "known_devices", "notifications", "audit_events", "sessions", verification.CollectionName} {
+				_, err := db.Collection(collection).DeleteMany(ctx, bson.M{})
+				Expect(err).To(Succeed())
+			}
+
+			app = fx.New(
+				fx.Supply(logger),
+				fx.Supply(db),
+				constModule,
+				fx.Invoke(func(s specContainer) {
+					spec = &s
+				}),
+			)
+
+			appStartCtx, appStartCancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer appStartCancel()
+
+			err := app.Start(appStartCtx)
+			Expect(err).To(Succeed())
+
+			passHash, err := spec.Hasher.Hash("my_secret")
+			Expect(err).To(Succeed())
+
+			_, err = db.Collection("users").InsertOne(ctx, user.User{
+				UID:          pkgTools.NewUUID().String(),
+				Name:         "Foo",
+				Email:        "foo@bar.baz",
+				EmailKey:     "foo@bar.baz",
+				PasswordHash: passHash,
+				Status:       user.StatusConfirmed,
+			})
+			Expect(err).To(Succeed())
+		})
+
+		AfterEach(func() {
+			appStopCtx, appStopCancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer appStopCancel()
+
+			err := app.Stop(appStopCtx)
+			Expect(err).To(Succeed())
+
+			cancel()
+		})
+
+		It("Cookie sign-in sets the session and CSRF cookies", func() {
+			rec := request(http.MethodPost, "/api/v1/auth/sign-in", `{"email":"foo@bar.baz","password":"my_secret","useCookie":true}`, nil)
+			Expect(rec.Code).To(Equal(200))
+			Expect(rec.Body.String()).NotTo(ContainSubstring(`"token"`))
+
+			var started oas.SessionStarted
+			Expect(json.Unmarshal(rec.Body.Bytes(), &started)).To(Succeed())
+
+			sessionCookie := findCookie(rec, "session")
+			Expect(sessionCookie.HttpOnly).To(BeTrue())
+			Expect(sessionCookie.Secure).To(BeTrue())
+			Expect(sessionCookie.SameSite).To(Equal(http.SameSiteLaxMode))
+
+			csrfCookie := findCookie(rec, "csrf_token")
+			Expect(csrfCookie.HttpOnly).To(BeFalse())
+			Expect(csrfCookie.Value).To(Equal(started.CsrfToken))
+
+			var stored session.Session
+			err := db.Collection("sessions").FindOne(ctx, bson.M{}).Decode(&stored)
+			Expect(err).To(Succeed())
+			Expect(stored.UID).To(Equal(security.HashToken(sessionCookie.Value)))
+			Expect(stored.CSRFToken).To(Equal(security.HashToken(csrfCookie.Value)))
+		})
+
+		It("Safe requests only need the session cookie", func() {
+			sessionCookie, _ := signIn()
+
+			rec := request(http.MethodGet, "/protected", "", withCookies(sessionCookie))
+			Expect(rec.Code).To(Equal(204))
+		})
+
+		It("State-changing requests need the CSRF token", func() {
+			sessionCookie, csrfCookie := signIn()
+
+			rec := request(http.MethodPost, "/protected", "", withCookies(sessionCookie, csrfCookie))
+			Expect(rec.Code).To(Equal(401))
+			Expect(rec.Body.String()).To(ContainSubstring(`"reason":"invalid_csrf_token"`))
+
+			rec = request(http.MethodPost, "/protected", "", func(req *http.Request) {
+				withCookies(sessionCookie, csrfCookie)(req)
+				req.Header.Add(auth.CSRFHeader, "forged")
+			})
+			Expect(rec.Code).To(Equal(401))
+
+			rec = request(http.MethodPost, "/protected", "", func(req *http.Request) {
+				withCookies(sessionCookie, csrfCookie)(req)
+				req.Header.Add(auth.CSRFHeader, csrfCookie.Value)
+			})
+			Expect(rec.Code).To(Equal(204))
+		})
+
+		It("Bearer tokens don't need the CSRF token", func() {
+			rec := request(http.MethodPost, "/api/v1/auth/sign-in", `{"email":"foo@bar.baz","password":"my_secret"}`, nil)
+			Expect(rec.Code).To(Equal(200))
+			Expect(findCookie(rec, "session")).To(BeNil())
+
+			var signedIn oas.SignedIn
+			Expect(json.Unmarshal(rec.Body.Bytes(), &signedIn)).To(Succeed())
+
+			rec = request(http.MethodPost, "/protected", "", func(req *http.Request) {
+				req.Header.Add("Authorization", "Bearer "+signedIn.Token)
+			})
+			Expect(rec.Code).To(Equal(204))
+		})
+
+		It("Sign-out ends the session", func() {
+			sessionCookie, csrfCookie := signIn()
+
+			rec := request(http.MethodPost, "/api/v1/auth/sign-out", "", func(req *http.Request) {
+				withCookies(sessionCookie, csrfCookie)(req)
+				req.Header.Add(auth.CSRFHeader, csrfCookie.Value)
+			})
+			Expect(rec.Code).To(Equal(204))
+			Expect(findCookie(rec, "session").MaxAge).To(BeNumerically("<", 0))
+
+			rec = request(http.MethodGet, "/protected", "", withCookies(sessionCookie))
+			Expect(rec.Code).To(Equal(401))
+			Expect(rec.Body.String()).To(ContainSubstring(`"reason":"invalid_session"`))
+		})
+
+		It("Sessions read the profile from the user", func() {
+			sessionCookie, _ := signIn()
+
+			var stored bson.M
+			Expect(db.Collection("sessions").FindOne(ctx, bson.M{}).Decode(&stored)).To(Succeed())
+			Expect(stored).NotTo(HaveKey("email"))
+			Expect(stored).NotTo(HaveKey("name"))
+
+			rec := request(http.MethodGet, "/profile", "", withCookies(sessionCookie))
+			Expect(rec.Code).To(Equal(200))
+			Expect(rec.Body.String()).To(Equal("Foo <foo@bar.baz>"))
+
+			_, err := db.Collection("users").UpdateOne(ctx, bson.M{"email": "foo@bar.baz"}, bson.M{
+				"$set": bson.M{"name": "Bar"},
+			})
+			Expect(err).To(Succeed())
+
+			rec = request(http.MethodGet, "/profile", "", withCookies(sessionCookie))
+			Expect(rec.Body.String()).To(Equal("Bar <foo@bar.baz>"))
+		})
+
+		It("Revoked sessions are rejected", func() {
+			sessionCookie, _ := signIn()
+
+			_, err := db.Collection("users").UpdateOne(ctx, bson.M{"email": "foo@bar.baz"}, bson.M{
+				"$set": bson.M{"sessionsRevokedAt": time.Now().Add(time.Second)},
+			})
+			Expect(err).To(Succeed())
+
+			rec := request(http.MethodGet, "/protected", "", withCookies(sessionCookie))
+			Expect(rec.Code).To(Equal(401))
+			Expect(rec.Body.String()).To(ContainSubstring(`"reason":"session_revoked"`))
+		})
+	})
+}
@@ -9,9 +9,15 @@ import (
 	"time"
 
 	"apart-deal-api/dependencies"
+	"apart-deal-api/pkg/api/auth"
 	"apart-deal-api/pkg/config"
 	"apart-deal-api/pkg/security"
+	"apart-deal-api/pkg/store/audit"
+	"apart-deal-api/pkg/store/device"
+	"apart-deal-api/pkg/store/notification"
+	"apart-deal-api/pkg/store/session"
 	"apart-deal-api/pkg/store/user"
+	"apart-deal-api/pkg/store/verification"
 
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson"
@@ -23,14 +29,21 @@ import (
 	. "github.com/onsi/gomega"
 
 	authHandlers "apart-deal-api/pkg/api/handlers/auth"
+	challengeHandlers "apart-deal-api/pkg/api/handlers/challenge"
 	apiServer "apart-deal-api/pkg/api/server"
+	auditDomain "apart-deal-api/pkg/domain/audit"
+	authDomain "apart-deal-api/pkg/domain/auth"
+	deviceDomain "apart-deal-api/pkg/domain/device"
+	identityDomain "apart-deal-api/pkg/domain/identity"
 	pkgTools "apart-deal-api/pkg/tools"
+	testTools "apart-deal-api/tests/tools"
 )
 
 type specContainer struct {
 	fx.In
 
-	Echo *echo.Echo
+	Echo   *echo.Echo
+	Hasher *security.PasswordHasher
 }
 
 var constModule = fx.Options(
@@ -42,10 +55,25 @@ var constModule = fx.Options(
 		Port:        37800 + GinkgoParallelProcess(),
 		TokenSecret: "foobar",
 	}),
+	fx.Supply(testTools.NewFastPasswordHasher()),
 	fx.Provide(apiServer.NewServer),
+	fx.Supply(challengeHandlers.NewGuard(nil, nil)),
 	fx.Provide(apiServer.NewAuthRouteGroup),
 	fx.Provide(user.NewUserRepository),
+	fx.Provide(verification.NewRequestRepository),
+	fx.Supply(auditDomain.DefaultSettings),
+	fx.Provide(audit.NewEventRepository),
+	fx.Provide(auditDomain.NewAuditService),
+	fx.Provide(notification.NewNotificationRepository),
+	fx.Provide(security.NewSecretGenerator),
+	fx.Provide(device.NewKnownDeviceRepository),
+	fx.Provide(authDomain.NewPasswordResetService),
+	fx.Provide(deviceDomain.NewDeviceService),
+	fx.Supply(identityDomain.NewEmailNormalizer(identityDomain.DefaultEmailSettings)),
 	fx.Provide(dependencies.NewAuthenticationService),
+	fx.Supply(auth.DefaultSessionSettings),
+	fx.Provide(session.NewSessionRepository),
+	fx.Provide(auth.NewSessionService),
 	fx.Provide(authHandlers.NewSignInHandler),
 	fx.Invoke(authHandlers.RegisterSignInRoute),
 )
@@ -69,6 +97,9 @@ func RegisterSuite(t *testing.T, db *mongo.Database) {
 			_, err := db.Collection("users").DeleteMany(ctx, bson.M{})
 			Expect(err).To(Succeed())
 
+			_, err = db.Collection(verification.CollectionName).DeleteMany(ctx, bson.M{})
+			Expect(err).To(Succeed())
+
 			app = fx.New(
 				fx.Supply(logger),
 				fx.Supply(db),
@@ -129,13 +160,14 @@ func RegisterSuite(t *testing.T, db *mongo.Database) {
 
 		It("Password is wrong", func() {
 			rawPass := "my_secret"
-			passHash, err := security.HashPassword(rawPass)
+			passHash, err := spec.Hasher.Hash(rawPass)
 			Expect(err).To(Succeed())
 
 			_, err = db.Collection("users").InsertOne(ctx, user.User{
 				UID:          pkgTools.NewUUID().String(),
 				Name:         "Foo",
 				Email:        "foo@bar.baz",
+				EmailKey:     "foo@bar.baz",
 				PasswordHash: passHash,
 				Status:       user.StatusConfirmed,
 			})
@@ -153,13 +185,14 @@ func RegisterSuite(t *testing.T, db *mongo.Database) {
 
 		It("Credentials are right", func() {
 			rawPass := "my_secret"
-			passHash, err := security.HashPassword(rawPass)
+			passHash, err := spec.Hasher.Hash(rawPass)
 			Expect(err).To(Succeed())
 
 			_, err = db.Collection("users").InsertOne(ctx, user.User{
 				UID:          pkgTools.NewUUID().String(),
 				Name:         "Foo",
 				Email:        "foo@bar.baz",
+				EmailKey:     "foo@bar.baz",
 				PasswordHash: passHash,
 				Status:       user.StatusConfirmed,
 			})
@@ -174,6 +207,59 @@ func RegisterSuite(t *testing.T, db *mongo.Database) {
 			Expect(rec.Code).To(Equal(200))
 			Expect(rec.Body.String()).To(MatchRegexp(`{"token":".*"}`))
 		})
+
+		It("Email is case-insensitive", func() {
+			passHash, err := spec.Hasher.Hash("my_secret")
+			Expect(err).To(Succeed())
+
+			_, err = db.Collection("users").InsertOne(ctx, user.User{
+				UID:          pkgTools.NewUUID().String(),
+				Name:         "Foo",
+				Email:        "Foo@bar.baz",
+				EmailKey:     "foo@bar.baz",
+				PasswordHash: passHash,
+				Status:       user.StatusConfirmed,
+			})
+			Expect(err).To(Succeed())
+
+			body := bytes.NewBuffer([]byte(`{"email":"FOO@Bar.Baz","password":"my_secret"}`))
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/sign-in", body)
+			req.Header.Add("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(200))
+		})
+
+		It("Outdated hash is upgraded on sign in", func() {
+			rawPass := "my_secret"
+			passHash, err := security.NewBcryptAlgorithm(security.BcryptParams{Cost: 5}).Hash(rawPass)
+			Expect(err).To(Succeed())
+
+			userUID := pkgTools.NewUUID().String()
+			_, err = db.Collection("users").InsertOne(ctx, user.User{
+				UID:          userUID,
+				Name:         "Foo",
+				Email:        "foo@bar.baz",
+				EmailKey:     "foo@bar.baz",
+				PasswordHash: passHash,
+				Status:       user.StatusConfirmed,
+			})
+			Expect(err).To(Succeed())
+
+			body := bytes.NewBuffer([]byte(`{"email":"foo@bar.baz","password":"my_secret"}`))
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/sign-in", body)
+			req.Header.Add("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(200))
+
+			var found user.User
+			err = db.Collection("users").FindOne(ctx, bson.M{"_id": userUID}).Decode(&found)
+			Expect(err).To(Succeed())
+			Expect(found.PasswordHash).To(HavePrefix("$argon2id$"))
+		})
 	})
 
 }
@@ -6,11 +6,17 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"time"
 
 	"apart-deal-api/dependencies"
 	"apart-deal-api/pkg/api/handlers/auth"
 	"apart-deal-api/pkg/config"
+	"apart-deal-api/pkg/security"
+	"apart-deal-api/pkg/store/audit"
+	"apart-deal-api/pkg/store/notification"
+	"apart-deal-api/pkg/store/organization"
 	"apart-deal-api/pkg/store/user"
+	"apart-deal-api/pkg/store/verification"
 
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson"
@@ -21,9 +27,14 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	challengeHandlers "apart-deal-api/pkg/api/handlers/challenge"
 	apiServer "apart-deal-api/pkg/api/server"
+	auditDomain "apart-deal-api/pkg/domain/audit"
 	authDomain "apart-deal-api/pkg/domain/auth"
+	identityDomain "apart-deal-api/pkg/domain/identity"
+	orgDomain "apart-deal-api/pkg/domain/organization"
 	pkgTools "apart-deal-api/pkg/tools"
+	testTools "apart-deal-api/tests/tools"
 )
 
 type specContainer struct {
@@ -40,9 +51,31 @@ var signUpConstModule = fx.Options(
 	fx.Supply(&dependencies.ApiConfig{
 		Port: 37800 + GinkgoParallelProcess(),
 	}),
+	fx.Supply(security.NewPasswordPolicy(security.DefaultPasswordPolicyConfig, nil)),
+	fx.Supply(testTools.NewFastPasswordHasher()),
+	fx.Provide(func() security.SecretGenerator {
+		return testTools.NewStaticSecretGenerator("12345")
+	}),
+	fx.Provide(func() (*security.EmailDomainPolicy, error) {
+		return security.NewEmailDomainPolicy(security.EmailDomainPolicyConfig{
+			Deny:            []string{"denied.com"},
+			BlockDisposable: true,
+		})
+	}),
 	fx.Provide(apiServer.NewServer),
+	fx.Supply(challengeHandlers.NewGuard(nil, nil)),
 	fx.Provide(apiServer.NewAuthRouteGroup),
 	fx.Provide(user.NewUserRepository),
+	fx.Provide(verification.NewRequestRepository),
+	fx.Supply(auditDomain.DefaultSettings),
+	fx.Provide(audit.NewEventRepository),
+	fx.Provide(auditDomain.NewAuditService),
+	fx.Provide(notification.NewNotificationRepository),
+	fx.Provide(organization.NewOrganizationRepository),
+	fx.Provide(organization.NewMembershipRepository),
+	fx.Provide(organization.NewInvitationRepository),
+	fx.Supply(identityDomain.NewEmailNormalizer(identityDomain.DefaultEmailSettings)),
+	fx.Provide(orgDomain.NewInvitationService),
 	fx.Provide(auth.NewSignUpHandler),
 	fx.Provide(authDomain.NewSignUpService),
 	fx.Invoke(auth.RegisterSignUpRoute),
@@ -67,6 +100,9 @@ func RegisterSuite(db *mongo.Database) {
 			_, err := db.Collection("users").DeleteMany(ctx, bson.M{})
 			Expect(err).To(Succeed())
 
+			_, err = db.Collection(verification.CollectionName).DeleteMany(ctx, bson.M{})
+			Expect(err).To(Succeed())
+
 			app = fx.New(
 				fx.Supply(logger),
 				fx.Supply(db),
@@ -109,6 +145,43 @@ func RegisterSuite(db *mongo.Database) {
 			Expect(rec.Body.String()).To(ContainSubstring(`[{"path":"email","message":"must be a valid email address"}]`))
 		})
 
+		It("Password violates the policy", func() {
+			body := bytes.NewBuffer([]byte(`{"name":"foo", "email": "foo@gmail.com", "password": "1234"}`))
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/sign-up", body)
+			req.Header.Add("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(400))
+			Expect(rec.Body.String()).To(ContainSubstring(`"path":"password.too_short"`))
+			Expect(rec.Body.String()).To(ContainSubstring(`"path":"password.too_weak"`))
+		})
+
+		It("Email is normalized", func() {
+			body := bytes.NewBuffer([]byte(`{"name":"foo", "email": "Foo.Bar@GMail.com", "password": "barbaris"}`))
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/sign-up", body)
+			req.Header.Add("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(200))
+
+			var found user.User
+			err := db.Collection("users").FindOne(ctx, bson.M{"emailKey": "foo.bar@gmail.com"}).Decode(&found)
+			Expect(err).To(Succeed())
+			Expect(found.Email).To(Equal("Foo.Bar@gmail.com"))
+		})
+
+		It("Long passphrase is accepted", func() {
+			body := bytes.NewBuffer([]byte(`{"name":"foo", "email": "foo@gmail.com", "password": "correct horse battery staple"}`))
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/sign-up", body)
+			req.Header.Add("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(200))
+		})
+
 		It("Successful signup", func() {
 			body := bytes.NewBuffer([]byte(`{"name":"foo", "email": "foo@gmail.com", "password": "barbaris"}`))
 			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/sign-up", body)
@@ -117,15 +190,54 @@ func RegisterSuite(db *mongo.Database) {
 			spec.Echo.ServeHTTP(rec, req)
 
 			Expect(rec.Code).To(Equal(200))
-			Expect(rec.Body.String()).To(MatchRegexp(`{"token":".+"}`))
+			Expect(rec.Body.String()).To(ContainSubstring(`{"token":"token-1"}`))
+
+			var found user.User
+			err := db.Collection("users").FindOne(ctx, bson.M{"email": "foo@gmail.com"}).Decode(&found)
+			Expect(err).To(Succeed())
+
+			var foundReq verification.Request
+			err = db.Collection(verification.CollectionName).FindOne(ctx, bson.M{"userUid": found.UID}).Decode(&foundReq)
+			Expect(err).To(Succeed())
+			Expect(foundReq.Type).To(Equal(verification.TypeSignUp))
+			Expect(foundReq.Token).To(Equal(security.HashToken("token-1")))
+			Expect(foundReq.Code).To(Equal("12345"))
+			Expect(foundReq.ExpiresAt).To(BeTemporally("~", found.CreatedAt.Add(authDomain.SignUpExpiration), time.Second))
+		})
+
+		It("Disposable email is rejected", func() {
+			body := bytes.NewBuffer([]byte(`{"name":"foo", "email": "foo@Mailinator.com", "password": "barbaris"}`))
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/sign-up", body)
+			req.Header.Add("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(400))
+			Expect(rec.Body.String()).To(ContainSubstring(`"tag":"email_domain_disposable"`))
+
+			count, err := db.Collection("users").CountDocuments(ctx, bson.M{})
+			Expect(err).To(Succeed())
+			Expect(count).To(BeZero())
+		})
+
+		It("Subdomain of a denied domain is rejected", func() {
+			body := bytes.NewBuffer([]byte(`{"name":"foo", "email": "foo@mail.denied.com", "password": "barbaris"}`))
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/sign-up", body)
+			req.Header.Add("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(400))
+			Expect(rec.Body.String()).To(ContainSubstring(`"tag":"email_domain_denied"`))
 		})
 
 		It("Email is occupied by confirmed user", func() {
 			_, err := db.Collection("users").InsertOne(ctx, user.User{
-				UID:    pkgTools.NewUUID().String(),
-				Name:   "Foo",
-				Email:  "foo@gmail.com",
-				Status: user.StatusConfirmed,
+				UID:      pkgTools.NewUUID().String(),
+				Name:     "Foo",
+				Email:    "foo@gmail.com",
+				EmailKey: "foo@gmail.com",
+				Status:   user.StatusConfirmed,
 			})
 			Expect(err).To(Succeed())
 
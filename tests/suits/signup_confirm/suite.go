@@ -5,11 +5,17 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"sync"
+	"time"
 
 	"apart-deal-api/dependencies"
 	"apart-deal-api/pkg/api/handlers/auth"
 	"apart-deal-api/pkg/config"
+	"apart-deal-api/pkg/security"
+	"apart-deal-api/pkg/store/audit"
+	"apart-deal-api/pkg/store/organization"
 	"apart-deal-api/pkg/store/user"
+	"apart-deal-api/pkg/store/verification"
 
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson"
@@ -17,9 +23,14 @@ import (
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 
+	challengeHandlers "apart-deal-api/pkg/api/handlers/challenge"
 	apiServer "apart-deal-api/pkg/api/server"
+	auditDomain "apart-deal-api/pkg/domain/audit"
 	authDomain "apart-deal-api/pkg/domain/auth"
+	identityDomain "apart-deal-api/pkg/domain/identity"
+	orgDomain "apart-deal-api/pkg/domain/organization"
 	pkgTools "apart-deal-api/pkg/tools"
+	signupWorker "apart-deal-api/pkg/worker/signup"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -40,11 +51,26 @@ var constModule = fx.Options(
 		Port: 37800 + GinkgoParallelProcess(),
 	}),
 	fx.Provide(apiServer.NewServer),
+	fx.Supply(challengeHandlers.NewGuard(nil, nil)),
 	fx.Provide(apiServer.NewAuthRouteGroup),
 	fx.Provide(user.NewUserRepository),
+	fx.Provide(verification.NewRequestRepository),
+	fx.Supply(auditDomain.DefaultSettings),
+	fx.Provide(audit.NewEventRepository),
+	fx.Provide(auditDomain.NewAuditService),
+	fx.Provide(organization.NewOrganizationRepository),
+	fx.Provide(organization.NewMembershipRepository),
+	fx.Provide(organization.NewInvitationRepository),
+	fx.Provide(security.NewSecretGenerator),
+	fx.Supply(identityDomain.NewEmailNormalizer(identityDomain.DefaultEmailSettings)),
+	fx.Provide(orgDomain.NewInvitationService),
+	fx.Supply(authDomain.DefaultSignUpLimits),
 	fx.Provide(auth.NewSignUpConfirmHandler),
+	fx.Provide(auth.NewSignUpResendHandler),
 	fx.Provide(authDomain.NewConfirmSignUpService),
+	fx.Provide(authDomain.NewResendSignUpCodeService),
 	fx.Invoke(auth.RegisterSignUpConfirmRoute),
+	fx.Invoke(auth.RegisterSignUpResendRoute),
 )
 
 func RegisterSuite(db *mongo.Database) {
@@ -59,12 +85,30 @@ func RegisterSuite(db *mongo.Database) {
 			spec   *specContainer
 		)
 
+		createSignUpRequest := func(userUID string, req verification.Request) {
+			req.UID = pkgTools.NewUUID().String()
+			req.Type = verification.TypeSignUp
+			req.UserUID = userUID
+			if req.CreatedAt.IsZero() {
+				req.CreatedAt = time.Now()
+			}
+			if req.ExpiresAt.IsZero() {
+				req.ExpiresAt = req.CreatedAt.Add(authDomain.SignUpExpiration)
+			}
+
+			_, err := db.Collection(verification.CollectionName).InsertOne(ctx, req)
+			Expect(err).To(Succeed())
+		}
+
 		BeforeEach(func() {
 			ctx, cancel = context.WithCancel(context.Background())
 
 			_, err := db.Collection("users").DeleteMany(ctx, bson.M{})
 			Expect(err).To(Succeed())
 
+			_, err = db.Collection(verification.CollectionName).DeleteMany(ctx, bson.M{})
+			Expect(err).To(Succeed())
+
 			app = fx.New(
 				fx.Supply(logger),
 				fx.Supply(db),
@@ -106,19 +150,21 @@ func RegisterSuite(db *mongo.Database) {
 		})
 
 		It("User's code is wrong", func() {
+			userUID := pkgTools.NewUUID().String()
 			_, err := db.Collection("users").InsertOne(ctx, user.User{
-				UID:    pkgTools.NewUUID().String(),
-				Name:   "Foo",
-				Email:  "foo@gmail.com",
-				Status: user.StatusConfirmed,
-				SignUpReq: &user.SignUpRequest{
-					Code:       "228",
-					Token:      "qwe",
-					NotifiedAt: nil,
-				},
+				UID:      userUID,
+				Name:     "Foo",
+				Email:    "foo@gmail.com",
+				EmailKey: "foo@gmail.com",
+				Status:   user.StatusConfirmed,
 			})
 			Expect(err).To(Succeed())
 
+			createSignUpRequest(userUID, verification.Request{
+				Code:  "228",
+				Token: security.HashToken("qwe"),
+			})
+
 			body := bytes.NewBuffer([]byte(`{"code":"123","token":"qwe"}`))
 			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/sign-up-confirm", body)
 			req.Header.Add("Content-Type", "application/json")
@@ -132,18 +178,19 @@ func RegisterSuite(db *mongo.Database) {
 		It("User's code is correct", func() {
 			userUID := pkgTools.NewUUID().String()
 			_, err := db.Collection("users").InsertOne(ctx, user.User{
-				UID:    userUID,
-				Name:   "Foo",
-				Email:  "foo@gmail.com",
-				Status: user.StatusPending,
-				SignUpReq: &user.SignUpRequest{
-					Code:       "123",
-					Token:      "qwe",
-					NotifiedAt: nil,
-				},
+				UID:      userUID,
+				Name:     "Foo",
+				Email:    "foo@gmail.com",
+				EmailKey: "foo@gmail.com",
+				Status:   user.StatusPending,
 			})
 			Expect(err).To(Succeed())
 
+			createSignUpRequest(userUID, verification.Request{
+				Code:  "123",
+				Token: security.HashToken("qwe"),
+			})
+
 			body := bytes.NewBuffer([]byte(`{"code":"123","token":"qwe"}`))
 			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/sign-up-confirm", body)
 			req.Header.Add("Content-Type", "application/json")
@@ -161,23 +208,80 @@ func RegisterSuite(db *mongo.Database) {
 			Expect(err).To(Succeed())
 
 			Expect(found.Status).To(Equal(user.StatusConfirmed))
-			Expect(found.SignUpReq).To(BeNil())
+
+			count, err := db.Collection(verification.CollectionName).CountDocuments(ctx, bson.M{"userUid": userUID})
+			Expect(err).To(Succeed())
+			Expect(count).To(BeZero())
+		})
+
+		It("Requests created before tokens were hashed are confirmed", func() {
+			userUID := pkgTools.NewUUID().String()
+			_, err := db.Collection("users").InsertOne(ctx, user.User{
+				UID:      userUID,
+				Name:     "Foo",
+				Email:    "foo@gmail.com",
+				EmailKey: "foo@gmail.com",
+				Status:   user.StatusPending,
+			})
+			Expect(err).To(Succeed())
+
+			createSignUpRequest(userUID, verification.Request{
+				Code:  "123",
+				Token: "qwe",
+			})
+
+			body := bytes.NewBuffer([]byte(`{"code":"123","token":"qwe"}`))
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/sign-up-confirm", body)
+			req.Header.Add("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(204))
+		})
+
+		It("Expired request is not found", func() {
+			userUID := pkgTools.NewUUID().String()
+			_, err := db.Collection("users").InsertOne(ctx, user.User{
+				UID:      userUID,
+				Name:     "Foo",
+				Email:    "foo@gmail.com",
+				EmailKey: "foo@gmail.com",
+				Status:   user.StatusPending,
+			})
+			Expect(err).To(Succeed())
+
+			// the TTL monitor may not have removed it yet
+			createSignUpRequest(userUID, verification.Request{
+				Code:      "123",
+				Token:     security.HashToken("qwe"),
+				ExpiresAt: time.Now().Add(-time.Second),
+			})
+
+			body := bytes.NewBuffer([]byte(`{"code":"123","token":"qwe"}`))
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/sign-up-confirm", body)
+			req.Header.Add("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(404))
 		})
 
 		It("User is already confirmed", func() {
+			userUID := pkgTools.NewUUID().String()
 			_, err := db.Collection("users").InsertOne(ctx, user.User{
-				UID:    pkgTools.NewUUID().String(),
-				Name:   "Foo",
-				Email:  "foo@gmail.com",
-				Status: user.StatusConfirmed,
-				SignUpReq: &user.SignUpRequest{
-					Code:       "123",
-					Token:      "qwe",
-					NotifiedAt: nil,
-				},
+				UID:      userUID,
+				Name:     "Foo",
+				Email:    "foo@gmail.com",
+				EmailKey: "foo@gmail.com",
+				Status:   user.StatusConfirmed,
 			})
 			Expect(err).To(Succeed())
 
+			createSignUpRequest(userUID, verification.Request{
+				Code:  "123",
+				Token: security.HashToken("qwe"),
+			})
+
 			body := bytes.NewBuffer([]byte(`{"code":"123","token":"qwe"}`))
 			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/sign-up-confirm", body)
 			req.Header.Add("Content-Type", "application/json")
@@ -188,6 +292,177 @@ func RegisterSuite(db *mongo.Database) {
 			Expect(rec.Body.String()).To(ContainSubstring("unconfirmable"))
 		})
 
+		It("Request is invalidated after too many wrong codes", func() {
+			userUID := pkgTools.NewUUID().String()
+			_, err := db.Collection("users").InsertOne(ctx, user.User{
+				UID:      userUID,
+				Name:     "Foo",
+				Email:    "foo@gmail.com",
+				EmailKey: "foo@gmail.com",
+				Status:   user.StatusPending,
+			})
+			Expect(err).To(Succeed())
+
+			createSignUpRequest(userUID, verification.Request{
+				Code:  "12345",
+				Token: security.HashToken("qwe"),
+			})
+
+			var rec *httptest.ResponseRecorder
+
+			for i := 0; i < authDomain.DefaultSignUpLimits.MaxCodeAttempts; i++ {
+				body := bytes.NewBuffer([]byte(`{"code":"00000","token":"qwe"}`))
+				req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/sign-up-confirm", body)
+				req.Header.Add("Content-Type", "application/json")
+				rec = httptest.NewRecorder()
+				spec.Echo.ServeHTTP(rec, req)
+			}
+
+			Expect(rec.Code).To(Equal(400))
+			Expect(rec.Body.String()).To(ContainSubstring("attempts_exceeded"))
+
+			body := bytes.NewBuffer([]byte(`{"code":"12345","token":"qwe"}`))
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/sign-up-confirm", body)
+			req.Header.Add("Content-Type", "application/json")
+			rec = httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(400))
+			Expect(rec.Body.String()).To(ContainSubstring("attempts_exceeded"))
+		})
+
+		It("Concurrent wrong codes don't exceed the attempts limit", func() {
+			userUID := pkgTools.NewUUID().String()
+			_, err := db.Collection("users").InsertOne(ctx, user.User{
+				UID:      userUID,
+				Name:     "Foo",
+				Email:    "foo@gmail.com",
+				EmailKey: "foo@gmail.com",
+				Status:   user.StatusPending,
+			})
+			Expect(err).To(Succeed())
+
+			createSignUpRequest(userUID, verification.Request{
+				Code:  "12345",
+				Token: security.HashToken("qwe"),
+			})
+
+			var wg sync.WaitGroup
+
+			for i := 0; i < authDomain.DefaultSignUpLimits.MaxCodeAttempts*4; i++ {
+				wg.Add(1)
+
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+
+					body := bytes.NewBuffer([]byte(`{"code":"00000","token":"qwe"}`))
+					req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/sign-up-confirm", body)
+					req.Header.Add("Content-Type", "application/json")
+					spec.Echo.ServeHTTP(httptest.NewRecorder(), req)
+				}()
+			}
+
+			wg.Wait()
+
+			var found verification.Request
+			err = db.Collection(verification.CollectionName).FindOne(ctx, bson.M{"userUid": userUID}).Decode(&found)
+			Expect(err).To(Succeed())
+			Expect(found.Attempts).To(Equal(authDomain.DefaultSignUpLimits.MaxCodeAttempts))
+		})
+
+		It("Resends keep a sign-up alive up to its max lifetime", func() {
+			userUID := pkgTools.NewUUID().String()
+			createdAt := time.Now().Add(-authDomain.SignUpMaxLifetime + time.Minute)
+
+			_, err := db.Collection("users").InsertOne(ctx, user.User{
+				UID:       userUID,
+				Name:      "Foo",
+				Email:     "foo@gmail.com",
+				EmailKey:  "foo@gmail.com",
+				Status:    user.StatusPending,
+				CreatedAt: createdAt,
+			})
+			Expect(err).To(Succeed())
+
+			createSignUpRequest(userUID, verification.Request{
+				Code:      "12345",
+				Token:     security.HashToken("qwe"),
+				CreatedAt: createdAt,
+				ExpiresAt: time.Now().Add(time.Minute),
+			})
+
+			body := bytes.NewBuffer([]byte(`{"token":"qwe"}`))
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/sign-up-resend", body)
+			req.Header.Add("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(204))
+
+			var found verification.Request
+			err = db.Collection(verification.CollectionName).FindOne(ctx, bson.M{"userUid": userUID}).Decode(&found)
+			Expect(err).To(Succeed())
+			Expect(found.ExpiresAt).To(BeTemporally("~", createdAt.Add(authDomain.SignUpMaxLifetime), time.Second))
+
+			// the pending user outlives SignUpExpiration as long as its request does
+			worker := signupWorker.NewObsoleteReqWorker(user.NewUserRepository(db), verification.NewRequestRepository(db), zap.NewNop())
+			Expect(worker.Process(ctx)).To(Succeed())
+
+			count, err := db.Collection("users").CountDocuments(ctx, bson.M{"_id": userUID, "deletedAt": nil})
+			Expect(err).To(Succeed())
+			Expect(count).To(Equal(int64(1)))
+		})
+
+		It("Resend issues a new code for the worker", func() {
+			userUID := pkgTools.NewUUID().String()
+			notifiedAt := time.Now().Add(-time.Minute * 5)
+
+			_, err := db.Collection("users").InsertOne(ctx, user.User{
+				UID:       userUID,
+				Name:      "Foo",
+				Email:     "foo@gmail.com",
+				EmailKey:  "foo@gmail.com",
+				Status:    user.StatusPending,
+				CreatedAt: time.Now().Add(-time.Minute * 5),
+			})
+			Expect(err).To(Succeed())
+
+			createSignUpRequest(userUID, verification.Request{
+				Code:       "12345",
+				Token:      security.HashToken("qwe"),
+				NotifiedAt: &notifiedAt,
+				Attempts:   3,
+				CreatedAt:  time.Now().Add(-time.Minute * 5),
+			})
+
+			body := bytes.NewBuffer([]byte(`{"token":"qwe"}`))
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/sign-up-resend", body)
+			req.Header.Add("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(204))
+
+			var found verification.Request
+			err = db.Collection(verification.CollectionName).FindOne(ctx, bson.M{"userUid": userUID}).Decode(&found)
+			Expect(err).To(Succeed())
+			Expect(found.NotifiedAt).To(BeNil())
+			Expect(found.Attempts).To(Equal(0))
+			Expect(found.ResendCount).To(Equal(1))
+			Expect(found.ExpiresAt).To(BeTemporally("~", time.Now().Add(authDomain.SignUpExpiration), time.Second*5))
+
+			body = bytes.NewBuffer([]byte(`{"token":"qwe"}`))
+			req = httptest.NewRequest(http.MethodPost, "/api/v1/auth/sign-up-resend", body)
+			req.Header.Add("Content-Type", "application/json")
+			rec = httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(429))
+			Expect(rec.Body.String()).To(ContainSubstring("resend_cooldown"))
+			Expect(rec.Header().Get("Retry-After")).NotTo(BeEmpty())
+		})
+
 	})
 
 }
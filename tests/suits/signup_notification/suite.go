@@ -0,0 +1,105 @@
+package signup_notification
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"apart-deal-api/pkg/store/verification"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	pkgTools "apart-deal-api/pkg/tools"
+)
+
+func RegisterSuite(db *mongo.Database) {
+	Describe("Pending sign-up notifications", func() {
+		var (
+			ctx         context.Context
+			cancel      context.CancelFunc
+			requestRepo verification.RequestRepository
+		)
+
+		createRequest := func(i int, t verification.RequestType, createdAt time.Time, notifiedAt *time.Time) {
+			_, err := db.Collection(verification.CollectionName).InsertOne(ctx, verification.Request{
+				UID:        pkgTools.NewUUID().String(),
+				Type:       t,
+				UserUID:    fmt.Sprintf("user-%d", i),
+				Token:      pkgTools.NewUUID().String(),
+				Code:       "12345",
+				NotifiedAt: notifiedAt,
+				CreatedAt:  createdAt,
+				ExpiresAt:  createdAt.Add(time.Hour),
+			})
+			Expect(err).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+
+			_, err := db.Collection(verification.CollectionName).DeleteMany(ctx, bson.M{})
+			Expect(err).To(Succeed())
+
+			requestRepo = verification.NewRequestRepository(db)
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		It("Pending requests are streamed oldest first by batches", func() {
+			now := time.Now().Truncate(time.Millisecond)
+			notifiedAt := now
+
+			// inserted newest first, so that the order can only come from the sort
+			for i := 6; i >= 0; i-- {
+				createRequest(i, verification.TypeSignUp, now.Add(time.Duration(i)*time.Second), nil)
+			}
+
+			createRequest(7, verification.TypeSignUp, now.Add(-time.Minute), &notifiedAt)
+			createRequest(8, verification.TypePasswordReset, now.Add(-time.Minute), nil)
+			createRequest(9, verification.TypeSignUp, now.Add(-time.Hour*2), nil)
+
+			var (
+				sizes    []int
+				userUIDs []string
+			)
+
+			Expect(requestRepo.ForEachNotNotifiedBatch(ctx, verification.TypeSignUp, 3, func(requests []verification.Request) error {
+				sizes = append(sizes, len(requests))
+				for _, req := range requests {
+					userUIDs = append(userUIDs, req.UserUID)
+				}
+
+				return nil
+			})).To(Succeed())
+
+			Expect(sizes).To(Equal([]int{3, 3, 1}))
+			Expect(userUIDs).To(Equal([]string{
+				"user-0", "user-1", "user-2", "user-3",
+				"user-4", "user-5", "user-6",
+			}))
+		})
+
+		It("Iteration stops at the first error", func() {
+			for i := 0; i < 5; i++ {
+				createRequest(i, verification.TypeSignUp, time.Now(), nil)
+			}
+
+			calls := 0
+
+			err := requestRepo.ForEachNotNotifiedBatch(ctx, verification.TypeSignUp, 2, func(requests []verification.Request) error {
+				calls++
+
+				return fmt.Errorf("smtp is down")
+			})
+
+			Expect(err).To(MatchError("smtp is down"))
+			Expect(calls).To(Equal(1))
+		})
+	})
+}
@@ -0,0 +1,244 @@
+package stepup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"apart-deal-api/dependencies"
+	"apart-deal-api/pkg/api/auth"
+	"apart-deal-api/pkg/config"
+	"apart-deal-api/pkg/security"
+	"apart-deal-api/pkg/store/audit"
+	"apart-deal-api/pkg/store/device"
+	"apart-deal-api/pkg/store/notification"
+	"apart-deal-api/pkg/store/session"
+	"apart-deal-api/pkg/store/user"
+	"apart-deal-api/pkg/store/verification"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	authHandlers "apart-deal-api/pkg/api/handlers/auth"
+	challengeHandlers "apart-deal-api/pkg/api/handlers/challenge"
+	apiServer "apart-deal-api/pkg/api/server"
+	auditDomain "apart-deal-api/pkg/domain/audit"
+	authDomain "apart-deal-api/pkg/domain/auth"
+	deviceDomain "apart-deal-api/pkg/domain/device"
+	identityDomain "apart-deal-api/pkg/domain/identity"
+	pkgTools "apart-deal-api/pkg/tools"
+	testTools "apart-deal-api/tests/tools"
+	oas "gitlab.com/apart-deals/openapi/go/api"
+)
+
+type specContainer struct {
+	fx.In
+
+	Echo    *echo.Echo
+	Hasher  *security.PasswordHasher
+	AuthSvc *auth.AuthenticationService
+}
+
+var constModule = fx.Options(
+	fx.NopLogger,
+	fx.Supply(&config.Config{
+		IsDebug: true,
+	}),
+	fx.Supply(&dependencies.ApiConfig{
+		Port:        37800 + GinkgoParallelProcess(),
+		TokenSecret: "foobar",
+	}),
+	fx.Supply(testTools.NewFastPasswordHasher()),
+	fx.Supply(auditDomain.DefaultSettings),
+	fx.Provide(apiServer.NewServer),
+	fx.Supply(challengeHandlers.NewGuard(nil, nil)),
+	fx.Provide(apiServer.NewAuthRouteGroup),
+	fx.Provide(user.NewUserRepository),
+	fx.Provide(verification.NewRequestRepository),
+	fx.Provide(audit.NewEventRepository),
+	fx.Provide(device.NewKnownDeviceRepository),
+	fx.Provide(notification.NewNotificationRepository),
+	fx.Provide(security.NewSecretGenerator),
+	fx.Provide(auditDomain.NewAuditService),
+	fx.Provide(authDomain.NewPasswordResetService),
+	fx.Provide(deviceDomain.NewDeviceService),
+	fx.Supply(identityDomain.NewEmailNormalizer(identityDomain.DefaultEmailSettings)),
+	fx.Provide(dependencies.NewAuthenticationService),
+	fx.Supply(auth.DefaultSessionSettings),
+	fx.Provide(session.NewSessionRepository),
+	fx.Provide(auth.NewSessionService),
+	fx.Provide(authHandlers.NewSignInHandler),
+	fx.Provide(authHandlers.NewReauthenticateHandler),
+	fx.Invoke(authHandlers.RegisterSignInRoute),
+	fx.Invoke(authHandlers.RegisterReauthenticateRoute),
+	fx.Invoke(func(e *echo.Echo, authSvc *auth.AuthenticationService, sessionSvc *auth.SessionService) {
+		ok := func(c echo.Context) error {
+			return c.NoContent(http.StatusNoContent)
+		}
+
+		e.POST("/recent", ok, auth.NewAuthMiddleware(authSvc, sessionSvc), auth.NewStepUpMiddleware(auth.StepUpRequirement{
+			MaxAge: time.Minute * 5,
+		}))
+		e.POST("/otp", ok, auth.NewAuthMiddleware(authSvc, sessionSvc), auth.NewStepUpMiddleware(auth.StepUpRequirement{
+			AMR: []string{"otp"},
+		}))
+	}),
+)
+
+func RegisterSuite(db *mongo.Database) {
+	Describe("Step-up authentication", func() {
+		loggerLvl := zap.NewAtomicLevelAt(zap.ErrorLevel)
+		logger := dependencies.NewLogger(&loggerLvl)
+
+		var (
+			ctx     context.Context
+			cancel  context.CancelFunc
+			app     *fx.App
+			spec    *specContainer
+			userUID string
+		)
+
+		post := func(path string, body string, token string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, path, bytes.NewBuffer([]byte(body)))
+			req.Header.Add("Content-Type", "application/json")
+			if token != "" {
+				req.Header.Add("Authorization", "Bearer "+token)
+			}
+			rec := httptest.NewRecorder()
+			spec.Echo.ServeHTTP(rec, req)
+
+			return rec
+		}
+
+		tokenFrom := func(rec *httptest.ResponseRecorder) string {
+			var signedIn oas.SignedIn
+			Expect(json.Unmarshal(rec.Body.Bytes(), &signedIn)).To(Succeed())
+
+			return signedIn.Token
+		}
+
+		staleToken := func() string {
+			token, err := spec.AuthSvc.Sign(auth.TokenPayload{
+				UserID:   userUID,
+				Email:    "foo@bar.baz",
+				AuthTime: time.Now().Add(-time.Minute * 10),
+				AMR:      []string{auth.AMRPassword},
+			})
+			Expect(err).To(Succeed())
+
+			return token
+		}
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+
+			for _, collection := range []string{"users", "known_devices", "notifications", "audit_events", verification.CollectionName} {
+				_, err := db.Collection(collection).DeleteMany(ctx, bson.M{})
+				Expect(err).To(Succeed())
+			}
+
+			app = fx.New(
+				fx.Supply(logger),
+				fx.Supply(db),
+				constModule,
+				fx.Invoke(func(s specContainer) {
+					spec = &s
+				}),
+			)
+
+			appStartCtx, appStartCancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer appStartCancel()
+
+			err := app.Start(appStartCtx)
+			Expect(err).To(Succeed())
+
+			passHash, err := spec.Hasher.Hash("my_secret")
+			Expect(err).To(Succeed())
+
+			userUID = pkgTools.NewUUID().String()
+			_, err = db.Collection("users").InsertOne(ctx, user.User{
+				UID:          userUID,
+				Name:         "Foo",
+				Email:        "foo@bar.baz",
+				EmailKey:     "foo@bar.baz",
+				PasswordHash: passHash,
+				Status:       user.StatusConfirmed,
+			})
+			Expect(err).To(Succeed())
+		})
+
+		AfterEach(func() {
+			appStopCtx, appStopCancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer appStopCancel()
+
+			err := app.Stop(appStopCtx)
+			Expect(err).To(Succeed())
+
+			cancel()
+		})
+
+		It("Sign-in token carries auth_time and amr", func() {
+			rec := post("/api/v1/auth/sign-in", `{"email":"foo@bar.baz","password":"my_secret"}`, "")
+			Expect(rec.Code).To(Equal(200))
+
+			payload, err := spec.AuthSvc.Verify(tokenFrom(rec))
+			Expect(err).To(Succeed())
+			Expect(payload.AuthTime).To(BeTemporally("~", time.Now(), time.Second*2))
+			Expect(payload.AMR).To(Equal([]string{auth.AMRPassword}))
+
+			Expect(post("/recent", "", tokenFrom(rec)).Code).To(Equal(204))
+		})
+
+		It("Stale authentication requires a step-up", func() {
+			rec := post("/recent", "", staleToken())
+
+			Expect(rec.Code).To(Equal(401))
+			Expect(rec.Body.String()).To(ContainSubstring(`"reason":"step_up_required"`))
+			Expect(rec.Body.String()).To(ContainSubstring(`"maxAge":300`))
+		})
+
+		It("Reauthentication refreshes auth_time", func() {
+			rec := post("/api/v1/auth/reauthenticate", `{"password":"my_secret"}`, staleToken())
+			Expect(rec.Code).To(Equal(200))
+
+			Expect(post("/recent", "", tokenFrom(rec)).Code).To(Equal(204))
+
+			count, err := db.Collection("audit_events").CountDocuments(ctx, bson.M{
+				"type":    "reauthenticate",
+				"outcome": "success",
+			})
+			Expect(err).To(Succeed())
+			Expect(count).To(Equal(int64(1)))
+		})
+
+		It("Reauthentication with a wrong password fails", func() {
+			rec := post("/api/v1/auth/reauthenticate", `{"password":"wrong"}`, staleToken())
+
+			Expect(rec.Code).To(Equal(401))
+			Expect(rec.Body.String()).To(ContainSubstring(`"reason":"invalid_password"`))
+		})
+
+		It("Reauthentication needs a token", func() {
+			rec := post("/api/v1/auth/reauthenticate", `{"password":"my_secret"}`, "")
+
+			Expect(rec.Code).To(Equal(401))
+			Expect(rec.Body.String()).To(ContainSubstring(`"reason":"no_token"`))
+		})
+
+		It("Missing factor requires a step-up", func() {
+			rec := post("/otp", "", staleToken())
+
+			Expect(rec.Code).To(Equal(401))
+			Expect(rec.Body.String()).To(ContainSubstring(`"amr":["otp"]`))
+		})
+	})
+}
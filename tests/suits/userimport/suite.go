@@ -0,0 +1,110 @@
+package userimport
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+
+	"apart-deal-api/pkg/domain/identity"
+	"apart-deal-api/pkg/domain/userimport"
+	"apart-deal-api/pkg/security"
+	"apart-deal-api/pkg/store/user"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	testTools "apart-deal-api/tests/tools"
+)
+
+func RegisterSuite(db *mongo.Database) {
+	Describe("Users import", func() {
+		var (
+			ctx       context.Context
+			cancel    context.CancelFunc
+			importSvc *userimport.ImportService
+			hasher    *security.PasswordHasher
+		)
+
+		salt := []byte("0123456789abcdef")
+		b64 := base64.StdEncoding.EncodeToString
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+
+			_, err := db.Collection("users").DeleteMany(ctx, bson.M{})
+			Expect(err).To(Succeed())
+
+			importSvc = userimport.NewImportService(user.NewUserRepository(db), identity.NewEmailNormalizer(identity.DefaultEmailSettings))
+			hasher = testTools.NewFastPasswordHasher()
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		It("Imports legacy hashes and reports bad rows", func() {
+			pbkdf2Key := pbkdf2.Key([]byte("legacy_pass"), salt, 1000, 32, sha256.New)
+			scryptKey, err := scrypt.Key([]byte("legacy_pass"), salt, 1024, 8, 1, 32)
+			Expect(err).To(Succeed())
+
+			input := bytes.NewBufferString(fmt.Sprintf(
+				"%s\n%s\n%s\n%s\n%s\n%s\n",
+				fmt.Sprintf(`{"email":"pbkdf2@bar.baz","name":"Foo","algorithm":"pbkdf2-sha256","salt":"%s","hash":"%s","iterations":1000}`, b64(salt), b64(pbkdf2Key)),
+				fmt.Sprintf(`{"email":"scrypt@bar.baz","algorithm":"scrypt","salt":"%s","hash":"%s","n":1024,"r":8,"p":1}`, b64(salt), b64(scryptKey)),
+				fmt.Sprintf(`{"email":"scrypt@bar.baz","algorithm":"scrypt","salt":"%s","hash":"%s","n":1024,"r":8,"p":1}`, b64(salt), b64(scryptKey)),
+				`{"email":"not-an-email","algorithm":"md5","salt":"x","hash":"y"}`,
+				`{"email":`,
+				// would need 1GiB of memory on every sign-in attempt
+				fmt.Sprintf(`{"email":"costly@bar.baz","algorithm":"scrypt","salt":"%s","hash":"%s","n":1048576,"r":8,"p":1}`, b64(salt), b64(scryptKey)),
+			))
+
+			reader, err := userimport.NewRowReader(input, userimport.FormatJSONL)
+			Expect(err).To(Succeed())
+
+			report, err := importSvc.Import(ctx, reader)
+			Expect(err).To(Succeed())
+			Expect(report.Imported).To(Equal(2))
+			Expect(report.Duplicates).To(HaveLen(1))
+			Expect(report.Duplicates[0].Line).To(Equal(3))
+			Expect(report.Invalid).To(HaveLen(3))
+			Expect(report.Invalid[2].Email).To(Equal("costly@bar.baz"))
+
+			for _, email := range []string{"pbkdf2@bar.baz", "scrypt@bar.baz"} {
+				var found user.User
+				err = db.Collection("users").FindOne(ctx, bson.M{"email": email}).Decode(&found)
+				Expect(err).To(Succeed())
+				Expect(found.Status).To(Equal(user.StatusConfirmed))
+
+				ok, needsRehash, err := hasher.Verify("legacy_pass", found.PasswordHash)
+				Expect(err).To(Succeed())
+				Expect(ok).To(BeTrue())
+				Expect(needsRehash).To(BeTrue())
+			}
+		})
+
+		It("Reads CSV by header names", func() {
+			pbkdf2Key := pbkdf2.Key([]byte("legacy_pass"), salt, 1000, 32, sha256.New)
+
+			input := bytes.NewBufferString(fmt.Sprintf(
+				"name,email,algorithm,iterations,salt,hash\nFoo,csv@bar.baz,pbkdf2-sha256,1000,%s,%s\nBar,bad@bar.baz,pbkdf2-sha256,many,%s,%s\n",
+				b64(salt), b64(pbkdf2Key), b64(salt), b64(pbkdf2Key),
+			))
+
+			reader, err := userimport.NewRowReader(input, userimport.FormatCSV)
+			Expect(err).To(Succeed())
+
+			report, err := importSvc.Import(ctx, reader)
+			Expect(err).To(Succeed())
+			Expect(report.Imported).To(Equal(1))
+			Expect(report.Invalid).To(HaveLen(1))
+			Expect(report.Invalid[0].Line).To(Equal(3))
+		})
+	})
+}
@@ -0,0 +1,151 @@
+package userrepository
+
+import (
+	"context"
+	"time"
+
+	"apart-deal-api/pkg/store/user"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	pkgTools "apart-deal-api/pkg/tools"
+)
+
+// RegisterCacheSuite describes the cache in front of the repository returned by newRepo,
+// which has to be empty
+func RegisterCacheSuite(name string, newRepo func(ctx context.Context) user.UserRepository) {
+	Describe(name, func() {
+		var (
+			ctx     context.Context
+			cancel  context.CancelFunc
+			backing user.UserRepository
+			cache   *user.CachedUserRepository
+		)
+
+		create := func(email string) *user.User {
+			u := &user.User{
+				UID:          pkgTools.NewUUID().String(),
+				Name:         "Foo",
+				Email:        email,
+				EmailKey:     email,
+				Status:       user.StatusConfirmed,
+				PasswordHash: "hash",
+				CreatedAt:    time.Now(),
+			}
+			Expect(cache.Create(ctx, u)).To(Succeed())
+
+			return u
+		}
+
+		find := func(uid string) *user.User {
+			u, err := cache.FindByUID(ctx, uid)
+			Expect(err).To(Succeed())
+
+			return u
+		}
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+
+			backing = newRepo(ctx)
+			cache = user.NewCachedUserRepository(backing, user.CacheSettings{
+				Size: 2,
+				TTL:  time.Millisecond * 200,
+			})
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		It("Users found once are served from the cache", func() {
+			created := create("foo@bar.baz")
+
+			find(created.UID)
+			find(created.UID)
+
+			byKey, err := cache.FindByEmailKey(ctx, "foo@bar.baz")
+			Expect(err).To(Succeed())
+			Expect(byKey.UID).To(Equal(created.UID))
+
+			stats := cache.Stats()
+			Expect(stats.Misses).To(Equal(uint64(1)))
+			Expect(stats.Hits).To(Equal(uint64(2)))
+		})
+
+		It("Writes through the cache invalidate the user", func() {
+			created := create("foo@bar.baz")
+			find(created.UID)
+
+			Expect(cache.UpdatePasswordHash(ctx, created.UID, 0, "new")).To(Succeed())
+
+			u := find(created.UID)
+			Expect(u.PasswordHash).To(Equal("new"))
+			Expect(u.Version).To(Equal(1))
+		})
+
+		It("Writes of other replicas are served once the TTL has passed", func() {
+			created := create("foo@bar.baz")
+			find(created.UID)
+
+			Expect(backing.UpdatePasswordHash(ctx, created.UID, 0, "new")).To(Succeed())
+
+			Expect(find(created.UID).PasswordHash).To(Equal("hash"))
+			Eventually(func() string {
+				return find(created.UID).PasswordHash
+			}).WithTimeout(time.Second).Should(Equal("new"))
+
+			// as done by the CacheInvalidator
+			Expect(backing.UpdatePasswordHash(ctx, created.UID, 1, "newer")).To(Succeed())
+			cache.Invalidate(created.UID)
+
+			Expect(find(created.UID).PasswordHash).To(Equal("newer"))
+		})
+
+		It("The least recently used user is evicted", func() {
+			first := create("first@bar.baz")
+			second := create("second@bar.baz")
+			third := create("third@bar.baz")
+
+			find(first.UID)
+			find(second.UID)
+			find(first.UID)
+			find(third.UID)
+
+			Expect(cache.Stats().Evictions).To(Equal(uint64(1)))
+			Expect(cache.Stats().Size).To(Equal(2))
+
+			misses := cache.Stats().Misses
+			find(second.UID)
+			Expect(cache.Stats().Misses).To(Equal(misses + 1))
+		})
+
+		It("Unknown users aren't cached", func() {
+			uid := pkgTools.NewUUID().String()
+
+			_, err := cache.FindByUID(ctx, uid)
+			Expect(err).To(Equal(mongo.ErrNoDocuments))
+
+			byKey, err := cache.FindByEmailKey(ctx, "foo@bar.baz")
+			Expect(err).To(Succeed())
+			Expect(byKey).To(BeNil())
+
+			created := create("foo@bar.baz")
+
+			byKey, err = cache.FindByEmailKey(ctx, "foo@bar.baz")
+			Expect(err).To(Succeed())
+			Expect(byKey.UID).To(Equal(created.UID))
+		})
+
+		It("Changing a cached user doesn't change the cache", func() {
+			created := create("foo@bar.baz")
+
+			find(created.UID).Name = "Bar"
+
+			Expect(find(created.UID).Name).To(Equal("Foo"))
+		})
+	})
+}
@@ -0,0 +1,269 @@
+package userrepository
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"apart-deal-api/pkg/security"
+	"apart-deal-api/pkg/store/datakey"
+	"apart-deal-api/pkg/store/user"
+
+	"go.uber.org/zap"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	pkgTools "apart-deal-api/pkg/tools"
+	accountWorker "apart-deal-api/pkg/worker/account"
+)
+
+// RegisterEncryptionSuite describes the encryption of the repository returned by newRepo
+// with data keys of the repository returned by newDataKeys, both have to be empty
+func RegisterEncryptionSuite(
+	name string,
+	newRepo func(ctx context.Context) user.UserRepository,
+	newDataKeys func(ctx context.Context) datakey.DataKeyRepository,
+) {
+	Describe(name, func() {
+		var (
+			ctx      context.Context
+			cancel   context.CancelFunc
+			stored   user.UserRepository
+			dataKeys datakey.DataKeyRepository
+			keyring  *user.Keyring
+			repo     user.UserRepository
+		)
+
+		newKey := func() []byte {
+			key, err := security.NewDataKey()
+			Expect(err).To(Succeed())
+
+			return key
+		}
+
+		indexKey := newKey()
+		firstMaster := security.MasterKey{ID: "first", Key: newKey()}
+		secondMaster := security.MasterKey{ID: "second", Key: newKey()}
+
+		newKeyring := func(rotation time.Duration, masterKeys ...security.MasterKey) *user.Keyring {
+			k := user.NewKeyring(dataKeys, user.KeyringSettings{
+				MasterKeys: masterKeys,
+				IndexKey:   indexKey,
+				Rotation:   rotation,
+			})
+			Expect(k.Load(ctx)).To(Succeed())
+
+			return k
+		}
+
+		newUser := func(email string) *user.User {
+			return &user.User{
+				UID:          pkgTools.NewUUID().String(),
+				Name:         "Foo",
+				Email:        email,
+				EmailKey:     email,
+				Status:       user.StatusConfirmed,
+				PasswordHash: "hash",
+				CreatedAt:    time.Now(),
+			}
+		}
+
+		create := func(email string) *user.User {
+			u := newUser(email)
+			Expect(repo.Create(ctx, u)).To(Succeed())
+
+			return u
+		}
+
+		storedUser := func(uid string) *user.User {
+			u, err := stored.FindByUID(ctx, uid)
+			Expect(err).To(Succeed())
+
+			return u
+		}
+
+		reEncrypt := func() {
+			worker := accountWorker.NewReEncryptWorker(repo, keyring, 2, 0, zap.NewNop())
+			Expect(worker.Process(ctx)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+
+			stored = newRepo(ctx)
+			dataKeys = newDataKeys(ctx)
+			keyring = newKeyring(0, firstMaster)
+			repo = user.NewEncryptedUserRepository(stored, keyring)
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		It("Names and emails are stored encrypted and found by email key", func() {
+			created := create("foo@bar.baz")
+
+			s := storedUser(created.UID)
+			Expect(s.Name).NotTo(ContainSubstring("Foo"))
+			Expect(s.Email).NotTo(ContainSubstring("foo@bar.baz"))
+			Expect(s.EmailKey).To(Equal(keyring.BlindIndex("foo@bar.baz")))
+			Expect(s.KeyGeneration).To(Equal(1))
+
+			byUID, err := repo.FindByUID(ctx, created.UID)
+			Expect(err).To(Succeed())
+			Expect(byUID.Name).To(Equal("Foo"))
+			Expect(byUID.Email).To(Equal("foo@bar.baz"))
+
+			byKey, err := repo.FindByEmailKey(ctx, "foo@bar.baz")
+			Expect(err).To(Succeed())
+			Expect(byKey.UID).To(Equal(created.UID))
+			Expect(byKey.EmailKey).To(Equal("foo@bar.baz"))
+
+			Expect(repo.Create(ctx, newUser("foo@bar.baz"))).To(BeAssignableToTypeOf(&user.UserDuplicateError{}))
+		})
+
+		It("Encrypted values can't be moved to another user", func() {
+			first := create("first@bar.baz")
+			second := create("second@bar.baz")
+
+			name := storedUser(first.UID).Name
+			Expect(stored.UpdateProfile(ctx, second.UID, 0, user.ProfileUpdate{Name: &name}, time.Now())).To(Succeed())
+
+			_, err := repo.FindByUID(ctx, second.UID)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Profile names are encrypted", func() {
+			created := create("foo@bar.baz")
+
+			name := "Bar"
+			Expect(repo.UpdateProfile(ctx, created.UID, 0, user.ProfileUpdate{Name: &name}, time.Now())).To(Succeed())
+
+			Expect(storedUser(created.UID).Name).NotTo(ContainSubstring("Bar"))
+
+			u, err := repo.FindByUID(ctx, created.UID)
+			Expect(err).To(Succeed())
+			Expect(u.Name).To(Equal("Bar"))
+		})
+
+		It("Users stored in plaintext are read until they're encrypted", func() {
+			plain := newUser("foo@bar.baz")
+			Expect(stored.Create(ctx, plain)).To(Succeed())
+
+			deleted := newUser("deleted@bar.baz")
+			Expect(stored.Create(ctx, deleted)).To(Succeed())
+			Expect(stored.Delete(ctx, deleted.UID, 0, "admin", time.Now())).To(Succeed())
+
+			byKey, err := repo.FindByEmailKey(ctx, "foo@bar.baz")
+			Expect(err).To(Succeed())
+			Expect(byKey.Name).To(Equal("Foo"))
+
+			Expect(repo.Create(ctx, newUser("foo@bar.baz"))).To(BeAssignableToTypeOf(&user.UserDuplicateError{}))
+
+			reEncrypt()
+
+			s := storedUser(plain.UID)
+			Expect(s.Email).NotTo(ContainSubstring("foo@bar.baz"))
+			Expect(s.EmailKey).To(Equal(keyring.BlindIndex("foo@bar.baz")))
+			Expect(s.KeyGeneration).To(Equal(1))
+			Expect(s.Version).To(Equal(plain.Version))
+
+			deletedStored, err := stored.FindDeletedByUID(ctx, deleted.UID)
+			Expect(err).To(Succeed())
+			Expect(deletedStored.KeyGeneration).To(Equal(1))
+
+			byKey, err = repo.FindByEmailKey(ctx, "foo@bar.baz")
+			Expect(err).To(Succeed())
+			Expect(byKey.UID).To(Equal(plain.UID))
+			Expect(byKey.Email).To(Equal("foo@bar.baz"))
+		})
+
+		It("Users in plaintext which can't be encrypted don't stop the others", func() {
+			// a batch of two users whose email was signed up again encrypted, ahead of another
+			for _, email := range []string{"first@bar.baz", "second@bar.baz"} {
+				plain := newUser(email)
+				plain.UID = "00000000-" + plain.UID[9:]
+				Expect(stored.Create(ctx, plain)).To(Succeed())
+
+				encrypted := newUser(email)
+				encryptedEmail, err := keyring.Encrypt(encrypted.UID, "email", email)
+				Expect(err).To(Succeed())
+				encrypted.Email = encryptedEmail
+				encrypted.EmailKey = keyring.BlindIndex(email)
+				encrypted.KeyGeneration = 1
+				Expect(stored.Create(ctx, encrypted)).To(Succeed())
+			}
+
+			last := newUser("third@bar.baz")
+			last.UID = "ffffffff-" + last.UID[9:]
+			Expect(stored.Create(ctx, last)).To(Succeed())
+
+			reEncrypt()
+
+			Expect(storedUser(last.UID).KeyGeneration).To(Equal(1))
+		})
+
+		It("Users are encrypted again with a rotated data key", func() {
+			uids := []string{create("first@bar.baz").UID, create("second@bar.baz").UID, create("third@bar.baz").UID}
+
+			keyring = newKeyring(time.Nanosecond, firstMaster)
+			repo = user.NewEncryptedUserRepository(stored, keyring)
+
+			reEncrypt()
+
+			generation, _ := keyring.Active()
+			Expect(generation).To(Equal(2))
+
+			for _, uid := range uids {
+				s := storedUser(uid)
+				Expect(s.KeyGeneration).To(Equal(2))
+				Expect(strings.HasPrefix(s.Name, "enc:v1:2:")).To(BeTrue())
+
+				u, err := repo.FindByUID(ctx, uid)
+				Expect(err).To(Succeed())
+				Expect(u.Name).To(Equal("Foo"))
+			}
+		})
+
+		It("Data keys are wrapped again with a new master key", func() {
+			created := create("foo@bar.baz")
+
+			newKeyring(0, secondMaster, firstMaster)
+
+			keys, err := dataKeys.FindAll(ctx)
+			Expect(err).To(Succeed())
+			Expect(keys).To(HaveLen(1))
+			Expect(keys[0].MasterKeyID).To(Equal("second"))
+
+			keyring = newKeyring(0, secondMaster)
+			repo = user.NewEncryptedUserRepository(stored, keyring)
+
+			u, err := repo.FindByUID(ctx, created.UID)
+			Expect(err).To(Succeed())
+			Expect(u.Email).To(Equal("foo@bar.baz"))
+
+			unknown := user.NewKeyring(dataKeys, user.KeyringSettings{
+				MasterKeys: []security.MasterKey{firstMaster},
+				IndexKey:   indexKey,
+			})
+			Expect(unknown.Load(ctx)).To(MatchError(ContainSubstring("unknown master key")))
+		})
+
+		It("Master keys are parsed from configuration", func() {
+			encoded := base64.StdEncoding.EncodeToString(newKey())
+
+			keys, err := security.ParseMasterKeys("new:" + encoded + ",\nold:" + encoded)
+			Expect(err).To(Succeed())
+			Expect(keys).To(HaveLen(2))
+			Expect(keys[0].ID).To(Equal("new"))
+
+			_, err = security.ParseMasterKeys("new:" + encoded + ",new:" + encoded)
+			Expect(err).To(HaveOccurred())
+
+			_, err = security.ParseMasterKeys("short:" + base64.StdEncoding.EncodeToString([]byte("key")))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+}
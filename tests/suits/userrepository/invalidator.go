@@ -0,0 +1,73 @@
+package userrepository
+
+import (
+	"context"
+	"time"
+
+	"apart-deal-api/pkg/store/user"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	pkgTools "apart-deal-api/pkg/tools"
+)
+
+func registerInvalidatorSuite(db *mongo.Database, newRepo func(ctx context.Context) user.UserRepository) {
+	Describe("User cache invalidator", func() {
+		var (
+			ctx    context.Context
+			cancel context.CancelFunc
+		)
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+
+			var hello bson.M
+			Expect(db.Client().Database("admin").RunCommand(ctx, bson.M{"hello": 1}).Decode(&hello)).To(Succeed())
+
+			if _, ok := hello["setName"]; !ok {
+				Skip("change streams need Mongo to run as a replica set")
+			}
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		It("Writes of other replicas invalidate the user right away", func() {
+			backing := newRepo(ctx)
+			cache := user.NewCachedUserRepository(backing, user.CacheSettings{Size: 10, TTL: time.Hour})
+
+			errs := make(chan error, 10)
+			go user.NewCacheInvalidator(db, cache, func(err error) { errs <- err }).Run(ctx)
+
+			created := &user.User{
+				UID:          pkgTools.NewUUID().String(),
+				Name:         "Foo",
+				Email:        "foo@bar.baz",
+				EmailKey:     "foo@bar.baz",
+				Status:       user.StatusConfirmed,
+				PasswordHash: "hash",
+				CreatedAt:    time.Now(),
+			}
+			Expect(backing.Create(ctx, created)).To(Succeed())
+
+			// the stream may open after the first update, which is then missed
+			Eventually(func() string {
+				u, err := cache.FindByUID(ctx, created.UID)
+				Expect(err).To(Succeed())
+
+				if u.PasswordHash == "hash" {
+					_ = backing.UpdatePasswordHash(ctx, u.UID, u.Version, "new")
+				}
+
+				return u.PasswordHash
+			}).WithTimeout(time.Second * 5).Should(Equal("new"))
+
+			Expect(errs).To(BeEmpty())
+		})
+	})
+}
@@ -0,0 +1,406 @@
+package userrepository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"apart-deal-api/pkg/store/datakey"
+	"apart-deal-api/pkg/store/user"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	pkgTools "apart-deal-api/pkg/tools"
+)
+
+// RegisterSuite runs the contract, the cache and the encryption suite against the Mongo
+// repository
+func RegisterSuite(db *mongo.Database) {
+	newRepo := func(ctx context.Context) user.UserRepository {
+		_, err := db.Collection(user.CollectionName).DeleteMany(ctx, bson.M{})
+		Expect(err).To(Succeed())
+
+		return user.NewUserRepository(db)
+	}
+
+	RegisterContract("Mongo user repository", newRepo)
+	RegisterContract("Cached Mongo user repository", func(ctx context.Context) user.UserRepository {
+		return user.NewCachedUserRepository(newRepo(ctx), user.DefaultCacheSettings)
+	})
+	RegisterCacheSuite("User cache in front of Mongo", newRepo)
+	RegisterEncryptionSuite("Encrypted Mongo user repository", newRepo, func(ctx context.Context) datakey.DataKeyRepository {
+		_, err := db.Collection(datakey.CollectionName).DeleteMany(ctx, bson.M{})
+		Expect(err).To(Succeed())
+
+		return datakey.NewDataKeyRepository(db)
+	})
+	registerInvalidatorSuite(db, newRepo)
+}
+
+// RegisterMemorySuite runs the contract, the cache and the encryption suite against the
+// in-memory repository, they need no database
+func RegisterMemorySuite() {
+	newRepo := func(_ context.Context) user.UserRepository {
+		return user.NewMemoryUserRepository()
+	}
+
+	RegisterContract("In-memory user repository", newRepo)
+	RegisterContract("Cached in-memory user repository", func(ctx context.Context) user.UserRepository {
+		return user.NewCachedUserRepository(newRepo(ctx), user.DefaultCacheSettings)
+	})
+	RegisterCacheSuite("User cache in front of memory", newRepo)
+	RegisterEncryptionSuite("Encrypted in-memory user repository", newRepo, func(_ context.Context) datakey.DataKeyRepository {
+		return datakey.NewMemoryDataKeyRepository()
+	})
+}
+
+// RegisterContract describes the behavior every UserRepository must have, newRepo returns
+// a repository without users
+func RegisterContract(name string, newRepo func(ctx context.Context) user.UserRepository) {
+	Describe(name, func() {
+		var (
+			ctx    context.Context
+			cancel context.CancelFunc
+			repo   user.UserRepository
+		)
+
+		newUser := func(email string, status user.UserStatus) *user.User {
+			return &user.User{
+				UID:          pkgTools.NewUUID().String(),
+				Name:         "Foo",
+				Email:        email,
+				EmailKey:     email,
+				Status:       status,
+				PasswordHash: "hash",
+				CreatedAt:    time.Now(),
+			}
+		}
+
+		create := func(email string, status user.UserStatus) *user.User {
+			u := newUser(email, status)
+			Expect(repo.Create(ctx, u)).To(Succeed())
+
+			return u
+		}
+
+		find := func(uid string) *user.User {
+			u, err := repo.FindByUID(ctx, uid)
+			Expect(err).To(Succeed())
+
+			return u
+		}
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+
+			repo = newRepo(ctx)
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		It("Created users are found by uid and email key", func() {
+			created := create("foo@bar.baz", user.StatusPending)
+
+			byUID := find(created.UID)
+			Expect(byUID.Email).To(Equal("foo@bar.baz"))
+			Expect(byUID.Status).To(Equal(user.StatusPending))
+			Expect(byUID.Version).To(BeZero())
+
+			byKey, err := repo.FindByEmailKey(ctx, "foo@bar.baz")
+			Expect(err).To(Succeed())
+			Expect(byKey.UID).To(Equal(created.UID))
+		})
+
+		It("Unknown users are reported the same way as by Mongo", func() {
+			_, err := repo.FindByUID(ctx, pkgTools.NewUUID().String())
+			Expect(err).To(Equal(mongo.ErrNoDocuments))
+
+			byKey, err := repo.FindByEmailKey(ctx, "nobody@bar.baz")
+			Expect(err).To(Succeed())
+			Expect(byKey).To(BeNil())
+		})
+
+		It("Users are unique by uid, email and email key", func() {
+			existing := create("foo@bar.baz", user.StatusPending)
+
+			sameUID := newUser("other@bar.baz", user.StatusPending)
+			sameUID.UID = existing.UID
+			Expect(repo.Create(ctx, sameUID)).To(BeAssignableToTypeOf(&user.UserDuplicateError{}))
+
+			sameEmail := newUser("foo@bar.baz", user.StatusPending)
+			sameEmail.EmailKey = "other@bar.baz"
+			Expect(repo.Create(ctx, sameEmail)).To(BeAssignableToTypeOf(&user.UserDuplicateError{}))
+
+			sameKey := newUser("Foo@Bar.baz", user.StatusPending)
+			sameKey.EmailKey = "foo@bar.baz"
+			Expect(repo.Create(ctx, sameKey)).To(BeAssignableToTypeOf(&user.UserDuplicateError{}))
+		})
+
+		It("Changing a found user doesn't change the stored one", func() {
+			created := create("foo@bar.baz", user.StatusPending)
+
+			found := find(created.UID)
+			found.Name = "Bar"
+
+			created.Name = "Baz"
+
+			Expect(find(created.UID).Name).To(Equal("Foo"))
+		})
+
+		It("Only pending users are confirmed", func() {
+			created := create("foo@bar.baz", user.StatusPending)
+
+			confirmed, err := repo.Confirm(ctx, created.UID, 0)
+			Expect(err).To(Succeed())
+			Expect(confirmed).To(BeTrue())
+
+			u := find(created.UID)
+			Expect(u.Status).To(Equal(user.StatusConfirmed))
+			Expect(u.ConfirmedAt).NotTo(BeNil())
+			Expect(u.Version).To(Equal(1))
+
+			confirmed, err = repo.Confirm(ctx, created.UID, 1)
+			Expect(err).To(Succeed())
+			Expect(confirmed).To(BeFalse())
+			Expect(find(created.UID).Version).To(Equal(1))
+		})
+
+		It("Updates based on a stale version are rejected", func() {
+			created := create("foo@bar.baz", user.StatusPending)
+
+			Expect(repo.UpdatePasswordHash(ctx, created.UID, 0, "new")).To(Succeed())
+
+			Expect(repo.UpdatePasswordHash(ctx, created.UID, 0, "stale")).
+				To(BeAssignableToTypeOf(&user.ConcurrentModificationError{}))
+
+			_, err := repo.Confirm(ctx, created.UID, 0)
+			Expect(err).To(BeAssignableToTypeOf(&user.ConcurrentModificationError{}))
+
+			Expect(repo.UpdatePasswordHash(ctx, pkgTools.NewUUID().String(), 0, "new")).To(Equal(mongo.ErrNoDocuments))
+
+			u := find(created.UID)
+			Expect(u.PasswordHash).To(Equal("new"))
+			Expect(u.Version).To(Equal(1))
+		})
+
+		It("Only one of concurrent updates of the same version is applied", func() {
+			created := create("foo@bar.baz", user.StatusConfirmed)
+
+			var (
+				wg        sync.WaitGroup
+				mu        sync.Mutex
+				applied   int
+				conflicts int
+			)
+
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+
+					err := repo.UpdatePasswordHash(ctx, created.UID, 0, "new")
+
+					mu.Lock()
+					defer mu.Unlock()
+
+					if err == nil {
+						applied++
+					} else {
+						Expect(err).To(BeAssignableToTypeOf(&user.ConcurrentModificationError{}))
+						conflicts++
+					}
+				}()
+			}
+
+			wg.Wait()
+
+			Expect(applied).To(Equal(1))
+			Expect(conflicts).To(Equal(7))
+			Expect(find(created.UID).Version).To(Equal(1))
+		})
+
+		It("Password resets block and then restore sign-in", func() {
+			created := create("foo@bar.baz", user.StatusConfirmed)
+			revokedAt := time.Now()
+
+			Expect(repo.RequirePasswordReset(ctx, created.UID, 0, true, revokedAt)).To(Succeed())
+
+			u := find(created.UID)
+			Expect(u.PasswordResetRequired).To(BeTrue())
+			Expect(u.SessionsRevokedAt).NotTo(BeNil())
+
+			Expect(repo.CompletePasswordReset(ctx, created.UID, 1, "new")).To(Succeed())
+
+			u = find(created.UID)
+			Expect(u.PasswordResetRequired).To(BeFalse())
+			Expect(u.PasswordHash).To(Equal("new"))
+			Expect(u.Version).To(Equal(2))
+		})
+
+		It("Profile updates change the given fields and clear empty ones", func() {
+			created := create("foo@bar.baz", user.StatusConfirmed)
+
+			name, locale, timezone := "Bar", "de-CH", "Europe/Zurich"
+
+			Expect(repo.UpdateProfile(ctx, created.UID, 0, user.ProfileUpdate{
+				Name:     &name,
+				Locale:   &locale,
+				Timezone: &timezone,
+			}, time.Now())).To(Succeed())
+
+			empty := ""
+
+			Expect(repo.UpdateProfile(ctx, created.UID, 1, user.ProfileUpdate{
+				Locale: &empty,
+			}, time.Now())).To(Succeed())
+
+			u := find(created.UID)
+			Expect(u.Name).To(Equal("Bar"))
+			Expect(u.Locale).To(BeEmpty())
+			Expect(u.Timezone).To(Equal("Europe/Zurich"))
+			Expect(u.ProfileUpdatedAt).NotTo(BeNil())
+			Expect(u.Version).To(Equal(2))
+		})
+
+		It("Only pending users older than the given time are deleted", func() {
+			old := newUser("old@bar.baz", user.StatusPending)
+			old.CreatedAt = time.Now().Add(-time.Hour)
+			Expect(repo.Create(ctx, old)).To(Succeed())
+
+			kept := newUser("kept@bar.baz", user.StatusPending)
+			kept.CreatedAt = time.Now().Add(-time.Hour)
+			Expect(repo.Create(ctx, kept)).To(Succeed())
+
+			oldConfirmed := newUser("confirmed@bar.baz", user.StatusConfirmed)
+			oldConfirmed.CreatedAt = time.Now().Add(-time.Hour)
+			Expect(repo.Create(ctx, oldConfirmed)).To(Succeed())
+
+			recent := create("recent@bar.baz", user.StatusPending)
+
+			deleted, err := repo.DeleteAllPendingOlderThan(ctx, time.Now().Add(-time.Minute), []string{kept.UID})
+			Expect(err).To(Succeed())
+			Expect(deleted).To(Equal(1))
+
+			_, err = repo.FindByUID(ctx, old.UID)
+			Expect(err).To(Equal(mongo.ErrNoDocuments))
+
+			deletedOld, err := repo.FindDeletedByUID(ctx, old.UID)
+			Expect(err).To(Succeed())
+			Expect(deletedOld.DeletedBy).To(Equal(user.DeletedBySystem))
+
+			find(oldConfirmed.UID)
+			find(recent.UID)
+			find(kept.UID)
+		})
+
+		It("Deleted users are hidden and their email is free", func() {
+			created := create("foo@bar.baz", user.StatusConfirmed)
+
+			Expect(repo.Delete(ctx, created.UID, 0, "admin", time.Now())).To(Succeed())
+
+			_, err := repo.FindByUID(ctx, created.UID)
+			Expect(err).To(Equal(mongo.ErrNoDocuments))
+
+			byKey, err := repo.FindByEmailKey(ctx, "foo@bar.baz")
+			Expect(err).To(Succeed())
+			Expect(byKey).To(BeNil())
+
+			deleted, err := repo.FindDeletedByUID(ctx, created.UID)
+			Expect(err).To(Succeed())
+			Expect(deleted.DeletedAt).NotTo(BeNil())
+			Expect(deleted.DeletedBy).To(Equal("admin"))
+			Expect(deleted.SessionsRevokedAt).NotTo(BeNil())
+			Expect(deleted.Version).To(Equal(1))
+
+			Expect(repo.UpdatePasswordHash(ctx, created.UID, 1, "new")).To(Equal(mongo.ErrNoDocuments))
+
+			create("foo@bar.baz", user.StatusPending)
+		})
+
+		It("Deletes based on a stale version are rejected", func() {
+			created := create("foo@bar.baz", user.StatusConfirmed)
+
+			Expect(repo.UpdatePasswordHash(ctx, created.UID, 0, "new")).To(Succeed())
+
+			Expect(repo.Delete(ctx, created.UID, 0, "admin", time.Now())).
+				To(BeAssignableToTypeOf(&user.ConcurrentModificationError{}))
+
+			find(created.UID)
+		})
+
+		It("Restored users are found again unless their email was taken", func() {
+			restored := create("foo@bar.baz", user.StatusConfirmed)
+			Expect(repo.Delete(ctx, restored.UID, 0, "admin", time.Now())).To(Succeed())
+
+			Expect(repo.Restore(ctx, restored.UID, time.Now().Add(-time.Hour))).To(Succeed())
+
+			u := find(restored.UID)
+			Expect(u.DeletedAt).To(BeNil())
+			Expect(u.DeletedBy).To(BeEmpty())
+			Expect(u.Version).To(Equal(2))
+
+			Expect(repo.Restore(ctx, restored.UID, time.Now().Add(-time.Hour))).To(Equal(mongo.ErrNoDocuments))
+
+			Expect(repo.Delete(ctx, restored.UID, 2, "admin", time.Now())).To(Succeed())
+			create("foo@bar.baz", user.StatusConfirmed)
+
+			Expect(repo.Restore(ctx, restored.UID, time.Now().Add(-time.Hour))).
+				To(BeAssignableToTypeOf(&user.UserDuplicateError{}))
+
+			_, err := repo.FindDeletedByUID(ctx, restored.UID)
+			Expect(err).To(Succeed())
+		})
+
+		It("Users deleted before the given time aren't restored", func() {
+			deleted := create("foo@bar.baz", user.StatusConfirmed)
+			Expect(repo.Delete(ctx, deleted.UID, 0, "admin", time.Now().Add(-time.Hour))).To(Succeed())
+
+			Expect(repo.Restore(ctx, deleted.UID, time.Now().Add(-time.Minute))).To(Equal(mongo.ErrNoDocuments))
+
+			_, err := repo.FindDeletedByUID(ctx, deleted.UID)
+			Expect(err).To(Succeed())
+		})
+
+		It("Only users deleted before the given time are purged", func() {
+			old := create("old@bar.baz", user.StatusConfirmed)
+			Expect(repo.Delete(ctx, old.UID, 0, "admin", time.Now().Add(-time.Hour))).To(Succeed())
+
+			recent := create("recent@bar.baz", user.StatusConfirmed)
+			Expect(repo.Delete(ctx, recent.UID, 0, "admin", time.Now())).To(Succeed())
+
+			live := create("live@bar.baz", user.StatusConfirmed)
+
+			before := time.Now().Add(-time.Minute)
+
+			uids, err := repo.FindUIDsDeletedBefore(ctx, before, 10)
+			Expect(err).To(Succeed())
+			Expect(uids).To(ConsistOf(old.UID))
+
+			for _, uid := range []string{recent.UID, live.UID} {
+				purged, err := repo.PurgeDeleted(ctx, uid, before)
+				Expect(err).To(Succeed())
+				Expect(purged).To(BeFalse())
+			}
+
+			purged, err := repo.PurgeDeleted(ctx, old.UID, before)
+			Expect(err).To(Succeed())
+			Expect(purged).To(BeTrue())
+
+			_, err = repo.FindDeletedByUID(ctx, old.UID)
+			Expect(err).To(Equal(mongo.ErrNoDocuments))
+
+			_, err = repo.FindDeletedByUID(ctx, recent.UID)
+			Expect(err).To(Succeed())
+
+			find(live.UID)
+		})
+	})
+}
@@ -0,0 +1,207 @@
+package validators
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"apart-deal-api/pkg/mongo/schema"
+	"apart-deal-api/pkg/store/user"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	pkgTools "apart-deal-api/pkg/tools"
+)
+
+const (
+	collectionName = "validation_specs"
+)
+
+func RegisterSuite(db *mongo.Database) {
+	Describe("Collection validators", func() {
+		var (
+			ctx    context.Context
+			cancel context.CancelFunc
+		)
+
+		strict := schema.ValidationSettings{Level: "strict", Action: "error"}
+
+		// applyAs validates collectionName with the schema of v
+		applyAs := func(v schema.CollectionValidator) {
+			v.Collection = collectionName
+
+			Expect(schema.ApplyValidators(ctx, db, []schema.CollectionValidator{v}, strict)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+
+			Expect(db.Collection(collectionName).Drop(ctx)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		It("Every stored struct is accepted by the schema derived from it", func() {
+			for _, v := range schema.Validators() {
+				By(v.Collection)
+
+				_, err := v.JSONSchema()
+				Expect(err).To(Succeed())
+
+				Expect(db.Collection(collectionName).Drop(ctx)).To(Succeed())
+				applyAs(v)
+
+				for _, withOptionals := range []bool{true, false} {
+					model := reflect.New(reflect.TypeOf(v.Model)).Elem()
+					populate(model, v.Enums, "", withOptionals)
+
+					_, err := db.Collection(collectionName).InsertOne(ctx, model.Interface())
+					Expect(err).To(Succeed())
+				}
+			}
+		})
+
+		It("Enums of missing fields are reported", func() {
+			_, err := schema.CollectionValidator{
+				Collection: collectionName,
+				Model:      user.User{},
+				Enums:      map[string][]string{"state": {"pending"}},
+			}.JSONSchema()
+			Expect(err).To(MatchError(ContainSubstring("state")))
+		})
+
+		It("Users without email or with an unknown status are rejected", func() {
+			for _, v := range schema.Validators() {
+				if v.Collection == user.CollectionName {
+					applyAs(v)
+				}
+			}
+
+			valid := func() user.User {
+				return user.User{
+					UID:       pkgTools.NewUUID().String(),
+					Name:      "Foo",
+					Email:     "foo@bar.baz",
+					EmailKey:  "foo@bar.baz",
+					Status:    user.StatusPending,
+					CreatedAt: time.Now(),
+				}
+			}
+
+			_, err := db.Collection(collectionName).InsertOne(ctx, valid())
+			Expect(err).To(Succeed())
+
+			unknownStatus := valid()
+			unknownStatus.Status = "banned"
+
+			_, err = db.Collection(collectionName).InsertOne(ctx, unknownStatus)
+			Expect(err).To(HaveOccurred())
+
+			withoutEmail, err := bson.Marshal(valid())
+			Expect(err).To(Succeed())
+
+			var doc bson.M
+			Expect(bson.Unmarshal(withoutEmail, &doc)).To(Succeed())
+			delete(doc, "email")
+
+			_, err = db.Collection(collectionName).InsertOne(ctx, doc)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Validators can be removed", func() {
+			v := schema.Validators()[0]
+			v.Collection = collectionName
+
+			applyAs(v)
+			Expect(schema.RemoveValidators(ctx, db, []schema.CollectionValidator{v})).To(Succeed())
+
+			_, err := db.Collection(collectionName).InsertOne(ctx, bson.M{"status": "banned"})
+			Expect(err).To(Succeed())
+		})
+	})
+}
+
+// populate fills every field of v, enums take their first value and optional fields are
+// left empty unless withOptionals
+func populate(v reflect.Value, enums map[string][]string, path string, withOptionals bool) {
+	if v.Type() == reflect.TypeOf(time.Time{}) {
+		v.Set(reflect.ValueOf(time.Now()))
+
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		if values, ok := enums[path]; ok {
+			v.SetString(values[0])
+		} else {
+			v.SetString("value")
+		}
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(1)
+	case reflect.Ptr:
+		if withOptionals {
+			v.Set(reflect.New(v.Type().Elem()))
+			populate(v.Elem(), enums, path, withOptionals)
+		}
+	case reflect.Slice:
+		if withOptionals {
+			v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+			populate(v.Index(0), enums, path+".$", withOptionals)
+		}
+	case reflect.Map:
+		if withOptionals {
+			v.Set(reflect.MakeMap(v.Type()))
+
+			value := reflect.New(v.Type().Elem()).Elem()
+			populate(value, enums, path+".$", withOptionals)
+			v.SetMapIndex(reflect.ValueOf("key"), value)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			name := field.Tag.Get("bson")
+			for j, c := range name {
+				if c == ',' {
+					name = name[:j]
+
+					break
+				}
+			}
+
+			if name == "_id" {
+				if v.Field(i).Kind() == reflect.String {
+					v.Field(i).SetString(pkgTools.NewUUID().String())
+				} else {
+					v.Field(i).SetInt(time.Now().UnixNano())
+				}
+
+				continue
+			}
+
+			populate(v.Field(i), enums, joinPath(path, name), withOptionals)
+		}
+	}
+}
+
+func joinPath(prefix string, name string) string {
+	if prefix == "" {
+		return name
+	}
+
+	return prefix + "." + name
+}
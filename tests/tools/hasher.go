@@ -0,0 +1,33 @@
+package tools
+
+import (
+	"apart-deal-api/pkg/security"
+)
+
+// NewFastPasswordHasher keeps specs fast, production parameters take most of a second per hash
+func NewFastPasswordHasher() *security.PasswordHasher {
+	return security.NewPasswordHasher(
+		security.NewArgon2idAlgorithm(security.Argon2idParams{
+			Memory:      1024,
+			Iterations:  1,
+			Parallelism: 1,
+			SaltLength:  16,
+			KeyLength:   32,
+		}),
+		security.NewBcryptAlgorithm(security.BcryptParams{
+			Cost: 4,
+		}),
+		security.NewPbkdf2Sha256Algorithm(security.Pbkdf2Params{
+			Iterations: 1000,
+			SaltLength: 16,
+			KeyLength:  32,
+		}),
+		security.NewScryptAlgorithm(security.ScryptParams{
+			N:          1024,
+			R:          8,
+			P:          1,
+			SaltLength: 16,
+			KeyLength:  32,
+		}),
+	)
+}
@@ -0,0 +1,39 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// StaticSecretGenerator hands out predictable values so that specs can use the token and
+// code an endpoint generated: tokens are "token-1", "token-2", ... and codes repeat Code
+type StaticSecretGenerator struct {
+	Code string
+
+	mu      sync.Mutex
+	counter int
+}
+
+func NewStaticSecretGenerator(code string) *StaticSecretGenerator {
+	return &StaticSecretGenerator{
+		Code: code,
+	}
+}
+
+func (g *StaticSecretGenerator) Token(_ int) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.counter++
+
+	return fmt.Sprintf("token-%d", g.counter), nil
+}
+
+func (g *StaticSecretGenerator) NumericCode(digits int) (string, error) {
+	if len(g.Code) >= digits {
+		return g.Code[:digits], nil
+	}
+
+	return strings.Repeat("0", digits-len(g.Code)) + g.Code, nil
+}